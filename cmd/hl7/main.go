@@ -0,0 +1,124 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/joho/godotenv"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/hl7"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+const usage = `usage: go run ./cmd/hl7 <command>
+
+commands:
+  send <addr> <file>...  send each file as one HL7 message to the MLLP
+                         listener at addr (e.g. localhost:2575) and print
+                         the ACKs; segments may end in line breaks
+  dead-letters           list messages that could not be applied
+  reprocess [id...]      apply dead letters again, the given ones or all;
+                         those that go through are removed`
+
+func main() {
+    if len(os.Args) < 2 {
+        log.Fatal(usage)
+    }
+
+    switch os.Args[1] {
+    case "send":
+        if len(os.Args) < 4 {
+            log.Fatal(usage)
+        }
+        client, err := hl7.Dial(os.Args[2], 30*time.Second)
+        if err != nil {
+            log.Fatalf("Failed to connect to %s: %v", os.Args[2], err)
+        }
+        defer client.Close()
+
+        failed := false
+        for _, path := range os.Args[3:] {
+            message, err := os.ReadFile(path)
+            if err != nil {
+                log.Fatalf("Failed to read %s: %v", path, err)
+            }
+            ack, err := client.Send(message)
+            if err != nil {
+                log.Fatalf("Failed to send %s: %v", path, err)
+            }
+            fmt.Printf("%s:\n%s\n", path, strings.ReplaceAll(string(ack), "\r", "\n"))
+            if parsed, err := hl7.Parse(ack); err != nil || parsed.Value("MSA", 1, 1) != hl7.AckAccept {
+                failed = true
+            }
+        }
+        if failed {
+            os.Exit(1)
+        }
+    case "dead-letters", "reprocess":
+        var ids []uint
+        for _, arg := range os.Args[2:] {
+            id, err := strconv.ParseUint(arg, 10, 64)
+            if err != nil || os.Args[1] != "reprocess" {
+                log.Fatal(usage)
+            }
+            ids = append(ids, uint(id))
+        }
+
+        if err := godotenv.Load(); err != nil {
+            log.Fatal("Error loading .env file")
+        }
+        keys, err := config.LoadEncryptionKeys()
+        if err != nil {
+            log.Fatalf("Failed to load encryption keys: %v", err)
+        }
+        fieldcrypt.Use(keys)
+        db, err := config.OpenDB()
+        if err != nil {
+            log.Fatalf("Failed to connect to database: %v", err)
+        }
+        deadLetters := service.NewDeadLetterService(repository.NewDeadLetterRepository(db))
+
+        if os.Args[1] == "dead-letters" {
+            var afterID uint
+            for {
+                letters, err := deadLetters.List(afterID, 100)
+                if err != nil {
+                    log.Fatalf("Failed to list dead letters: %v", err)
+                }
+                for _, letter := range letters {
+                    fmt.Printf("%d\t%s\t%s\t%d attempts\t%s\n", letter.ID, letter.CreatedAt, letter.Source, letter.Attempts, letter.Reason)
+                }
+                if len(letters) < 100 {
+                    return
+                }
+                afterID = letters[len(letters)-1].ID
+            }
+        }
+
+        ingester := hl7.NewIngester(service.NewPatientService(repository.NewTransactor(db)), deadLetters)
+        results, err := ingester.Reprocess(ids...)
+        applied := 0
+        for _, result := range results {
+            if result.Err != nil {
+                fmt.Printf("%d\tfailed\t%v\n", result.ID, result.Err)
+            } else {
+                fmt.Printf("%d\tapplied\n", result.ID)
+                applied++
+            }
+        }
+        fmt.Printf("Applied %d of %d dead letters\n", applied, len(results))
+        if err != nil {
+            log.Fatalf("Failed to reprocess dead letters: %v", err)
+        }
+        if applied < len(results) {
+            os.Exit(1)
+        }
+    default:
+        log.Fatal(usage)
+    }
+}
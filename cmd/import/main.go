@@ -0,0 +1,97 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "github.com/joho/godotenv"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+const usage = `usage: go run ./cmd/import [flags] <file>
+
+Imports patients from a CSV file with a header row (first_name, last_name,
+date_of_birth, gender, contact, address) or from NDJSON. The format is taken
+from the file extension unless -format is given.
+
+flags:`
+
+func main() {
+    flag.Usage = func() {
+        fmt.Fprintln(flag.CommandLine.Output(), usage)
+        flag.PrintDefaults()
+    }
+    format := flag.String("format", "", "input format: csv or ndjson")
+    dryRun := flag.Bool("dry-run", false, "validate without importing")
+    batchSize := flag.Int("batch-size", service.DefaultImportBatchSize, "rows per transaction")
+    force := flag.Bool("force", false, "import rows that look like existing patients")
+    flag.Parse()
+    if flag.NArg() != 1 {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    path := flag.Arg(0)
+    if *format == "" {
+        switch strings.ToLower(filepath.Ext(path)) {
+        case ".csv":
+            *format = service.ImportCSV
+        case ".ndjson", ".jsonl":
+            *format = service.ImportNDJSON
+        default:
+            log.Fatalf("Cannot tell the format of %s; pass -format", path)
+        }
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        log.Fatalf("Failed to open %s: %v", path, err)
+    }
+    defer file.Close()
+
+    if err := godotenv.Load(); err != nil {
+        log.Fatal("Error loading .env file")
+    }
+    keys, err := config.LoadEncryptionKeys()
+    if err != nil {
+        log.Fatalf("Failed to load encryption keys: %v", err)
+    }
+    fieldcrypt.Use(keys)
+    db, err := config.OpenDB()
+    if err != nil {
+        log.Fatalf("Failed to connect to database: %v", err)
+    }
+
+    patients := service.NewPatientService(repository.NewTransactor(db))
+
+    // Imports from the command line are audited as user 0, like the
+    // retention job.
+    report, err := patients.Import(0, file, service.ImportOptions{Format: *format, DryRun: *dryRun, BatchSize: *batchSize, Force: *force})
+    if err != nil {
+        log.Fatalf("Failed to import patients: %v", err)
+    }
+
+    for _, row := range report.Errors {
+        for _, field := range row.Errors {
+            if field.Field != "" {
+                fmt.Printf("line %d: %s %s\n", row.Line, field.Field, field.Message)
+            } else {
+                fmt.Printf("line %d: %s\n", row.Line, field.Message)
+            }
+        }
+    }
+    if report.DryRun {
+        fmt.Printf("%d of %d rows are valid; nothing was imported (dry run)\n", report.Valid, report.Total)
+    } else {
+        fmt.Printf("Imported %d of %d rows\n", report.Imported, report.Total)
+    }
+    if len(report.Errors) > 0 {
+        os.Exit(1)
+    }
+}
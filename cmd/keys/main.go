@@ -0,0 +1,67 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "github.com/joho/godotenv"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/repository"
+)
+
+const usage = `usage: go run ./cmd/keys <command>
+
+commands:
+  generate <id>       print a new field encryption key as id=base64key;
+                      use the id "index" for the search index key
+  rotate [batch size] re-encrypt stored values with the current key and
+                      rebuild the patient search index (default batch 500)`
+
+func main() {
+    if len(os.Args) < 2 {
+        log.Fatal(usage)
+    }
+
+    switch os.Args[1] {
+    case "generate":
+        if len(os.Args) < 3 {
+            log.Fatal(usage)
+        }
+        key, err := fieldcrypt.GenerateKey(os.Args[2])
+        if err != nil {
+            log.Fatalf("Failed to generate key: %v", err)
+        }
+        fmt.Println(key)
+    case "rotate":
+        batchSize := 500
+        if len(os.Args) > 2 {
+            n, err := strconv.Atoi(os.Args[2])
+            if err != nil || n < 1 {
+                log.Fatalf("Invalid batch size %q", os.Args[2])
+            }
+            batchSize = n
+        }
+
+        if err := godotenv.Load(); err != nil {
+            log.Fatal("Error loading .env file")
+        }
+        ring, err := config.LoadEncryptionKeys()
+        if err != nil {
+            log.Fatalf("Failed to load encryption keys: %v", err)
+        }
+        db, err := config.OpenDB()
+        if err != nil {
+            log.Fatalf("Failed to connect to database: %v", err)
+        }
+
+        result, err := repository.RotateEncryption(db, ring, batchSize)
+        fmt.Printf("Re-encrypted %d patients, %d medical history entries and %d audit keys with key %s\n", result.Patients, result.MedicalHistory, result.AuditKeys, ring.CurrentKeyID())
+        if err != nil {
+            log.Fatalf("Failed to rotate keys: %v", err)
+        }
+    default:
+        log.Fatal(usage)
+    }
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+    "context"
+    "errors"
     "log"
     "os"
-    "github.com/gin-gonic/gin"
+    _ "time/tzdata"
     "github.com/joho/godotenv"
     swaggerFiles "github.com/swaggo/files"
     ginSwagger "github.com/swaggo/gin-swagger"
     "makerble-assessment/internal/config"
-    "makerble-assessment/internal/handler"
-    "makerble-assessment/internal/middleware"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/hl7"
+    "makerble-assessment/internal/migration"
     "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/router"
     "makerble-assessment/internal/service"
     _ "makerble-assessment/docs"
 )
@@ -29,37 +33,52 @@ func main() {
     }
 
     db, err := config.InitDB()
+    if errors.Is(err, migration.ErrPendingMigrations) {
+        log.Fatalf("%v; run `go run ./migrations up` first", err)
+    }
     if err != nil {
         log.Fatal("Failed to connect to database:", err)
     }
 
-    r := gin.Default()
+    keys, err := config.LoadJWTKeys()
+    if err != nil {
+        log.Fatal("Failed to load JWT keys:", err)
+    }
 
-    userRepo := repository.NewUserRepository(db)
-    patientRepo := repository.NewPatientRepository(db)
-    authService := service.NewAuthService(userRepo)
-    patientService := service.NewPatientService(patientRepo)
-    authHandler := handler.NewAuthHandler(authService)
-    patientHandler := handler.NewPatientHandler(patientService)
+    encryptionKeys, err := config.LoadEncryptionKeys()
+    if err != nil {
+        log.Fatal("Failed to load encryption keys:", err)
+    }
+    fieldcrypt.Use(encryptionKeys)
 
-    r.POST("/login", authHandler.Login)
+    // Purge patients that have been in the trash longer than PATIENT_RETENTION.
+    patients := service.NewPatientService(repository.NewTransactor(db))
+    go service.NewRetentionJob(patients, config.LoadRetentionConfig()).Run(context.Background())
 
-    receptionist := r.Group("/api/receptionist").Use(middleware.AuthMiddleware(authService, "receptionist"))
-    {
-        receptionist.POST("/patients", patientHandler.Create)
-        receptionist.GET("/patients", patientHandler.List)
-        receptionist.GET("/patients/:id", patientHandler.Get)
-        receptionist.PUT("/patients/:id", patientHandler.Update)
-        receptionist.DELETE("/patients/:id", patientHandler.Delete)
+    // Receive HL7 v2 ADT messages over MLLP when HL7_MLLP_ADDR is set.
+    if hl7Config := config.LoadHL7Config(); hl7Config.Addr != "" {
+        deadLetters := service.NewDeadLetterService(repository.NewDeadLetterRepository(db))
+        server := &hl7.Server{
+            Handler:        hl7.NewIngester(patients, deadLetters),
+            IdleTimeout:    hl7Config.IdleTimeout,
+            MaxMessageSize: hl7Config.MaxMessageSize,
+        }
+        go func() {
+            log.Fatal("HL7 listener failed: ", server.ListenAndServe(hl7Config.Addr))
+        }()
+        log.Printf("Receiving HL7 messages on %s", hl7Config.Addr)
     }
 
-    doctor := r.Group("/api/doctor").Use(middleware.AuthMiddleware(authService, "doctor"))
-    {
-        doctor.GET("/patients", patientHandler.List)
-        doctor.GET("/patients/:id", patientHandler.Get)
-        doctor.PUT("/patients/:id", patientHandler.UpdateMedicalHistory)
+    r := router.New(db, router.Config{
+        Keys:       keys,
+        Auth:       config.LoadAuthConfig(),
+        LoginLimit: config.LoadLoginLimitConfig(),
+    })
+    if proxies := config.LoadTrustedProxies(); len(proxies) > 0 {
+        if err := r.SetTrustedProxies(proxies); err != nil {
+            log.Fatal("Invalid TRUSTED_PROXIES:", err)
+        }
     }
-
     r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
     port := os.Getenv("PORT")
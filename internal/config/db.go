@@ -1,27 +1,199 @@
 package config
 
 import (
-    "os"
     "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    mysqldriver "github.com/go-sql-driver/mysql"
     "gorm.io/driver/mysql"
+    "gorm.io/driver/postgres"
+    "gorm.io/driver/sqlite"
     "gorm.io/gorm"
-    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/migration"
+)
+
+const (
+    DriverMySQL    = "mysql"
+    DriverPostgres = "postgres"
+    DriverSQLite   = "sqlite"
 )
 
+// DBConfig holds the connection settings read from the DB_* environment variables.
+type DBConfig struct {
+    Driver          string
+    Host            string
+    Port            string
+    User            string
+    Password        string
+    Name            string
+    SSLMode         string
+    MaxOpenConns    int
+    MaxIdleConns    int
+    ConnMaxLifetime time.Duration
+}
+
+// LoadDBConfig reads the database settings from the environment. DB_DRIVER
+// defaults to mysql so existing .env files keep working.
+func LoadDBConfig() DBConfig {
+    driver := strings.ToLower(os.Getenv("DB_DRIVER"))
+    if driver == "" {
+        driver = DriverMySQL
+    }
+
+    return DBConfig{
+        Driver:          driver,
+        Host:            os.Getenv("DB_HOST"),
+        Port:            os.Getenv("DB_PORT"),
+        User:            os.Getenv("DB_USER"),
+        Password:        os.Getenv("DB_PASSWORD"),
+        Name:            os.Getenv("DB_NAME"),
+        SSLMode:         os.Getenv("DB_SSLMODE"),
+        MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 0),
+        MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 0),
+        ConnMaxLifetime: envDuration("DB_CONN_MAX_LIFETIME", 0),
+    }
+}
+
+// DSN builds the driver-specific connection string.
+func (c DBConfig) DSN() (string, error) {
+    switch c.Driver {
+    case DriverMySQL:
+        // The driver formats the DSN so that @, / and : in the password
+        // survive parsing.
+        cfg := mysqldriver.NewConfig()
+        cfg.User = c.User
+        cfg.Passwd = c.Password
+        cfg.Net = "tcp"
+        cfg.Addr = net.JoinHostPort(c.Host, c.Port)
+        cfg.DBName = c.Name
+        cfg.ParseTime = true
+        cfg.Loc = time.Local
+        cfg.Params = map[string]string{"charset": "utf8mb4"}
+        return cfg.FormatDSN(), nil
+    case DriverPostgres:
+        sslMode := c.SSLMode
+        if sslMode == "" {
+            sslMode = "disable"
+        }
+        port := c.Port
+        if port == "" {
+            port = "5432"
+        }
+        return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=UTC",
+            pgValue(c.Host), pgValue(port), pgValue(c.User), pgValue(c.Password), pgValue(c.Name), pgValue(sslMode)), nil
+    case DriverSQLite:
+        // DB_NAME is a file path; empty or ":memory:" gives a private in-memory database.
+        if c.IsInMemory() {
+            return "file::memory:?_foreign_keys=on", nil
+        }
+        return "file:" + c.Name + "?_foreign_keys=on", nil
+    default:
+        return "", fmt.Errorf("unsupported DB_DRIVER %q", c.Driver)
+    }
+}
+
+// pgValue quotes a value for a libpq key=value connection string, so spaces,
+// quotes and backslashes in a password or name cannot break the string or
+// inject extra parameters.
+func pgValue(value string) string {
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// IsInMemory reports whether the config points at an in-memory SQLite database.
+func (c DBConfig) IsInMemory() bool {
+    return c.Driver == DriverSQLite && (c.Name == "" || c.Name == ":memory:")
+}
+
+// Open connects to the database described by the config and applies the pool settings.
+func (c DBConfig) Open() (*gorm.DB, error) {
+    dsn, err := c.DSN()
+    if err != nil {
+        return nil, err
+    }
+
+    var dialector gorm.Dialector
+    switch c.Driver {
+    case DriverMySQL:
+        dialector = mysql.Open(dsn)
+    case DriverPostgres:
+        dialector = postgres.Open(dsn)
+    case DriverSQLite:
+        dialector = sqlite.Open(dsn)
+    }
+
+    db, err := gorm.Open(dialector, &gorm.Config{})
+    if err != nil {
+        return nil, err
+    }
+
+    sqlDB, err := db.DB()
+    if err != nil {
+        return nil, err
+    }
+
+    maxOpen := c.MaxOpenConns
+    if c.Driver == DriverSQLite {
+        // SQLite serialises writers; a single connection also keeps an
+        // in-memory database alive for the lifetime of the pool.
+        maxOpen = 1
+    }
+    if maxOpen > 0 {
+        sqlDB.SetMaxOpenConns(maxOpen)
+    }
+    if c.MaxIdleConns > 0 {
+        sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+    }
+    if c.ConnMaxLifetime > 0 && !c.IsInMemory() {
+        sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+    }
+
+    return db, nil
+}
+
+// OpenDB connects using the environment configuration without touching the schema.
+func OpenDB() (*gorm.DB, error) {
+    return LoadDBConfig().Open()
+}
+
+// InitDB connects and verifies the schema is current. An in-memory SQLite
+// database, or DB_AUTO_MIGRATE=true, applies pending migrations instead of
+// refusing to start.
 func InitDB() (*gorm.DB, error) {
-    host := os.Getenv("DB_HOST")
-    port := os.Getenv("DB_PORT")
-    user := os.Getenv("DB_USER")
-    password := os.Getenv("DB_PASSWORD")
-    dbname := os.Getenv("DB_NAME")
-
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-        user, password, host, port, dbname)
-    db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+    cfg := LoadDBConfig()
+    db, err := cfg.Open()
     if err != nil {
         return nil, err
     }
 
-    db.AutoMigrate(&model.User{}, &model.Patient{})
+    migrator := migration.NewMigrator(db)
+    if cfg.IsInMemory() || os.Getenv("DB_AUTO_MIGRATE") == "true" {
+        if _, err := migrator.Up(); err != nil {
+            return nil, err
+        }
+        return db, nil
+    }
+
+    if err := migrator.CheckCurrent(); err != nil {
+        return nil, err
+    }
     return db, nil
-}
\ No newline at end of file
+}
+
+func envInt(key string, fallback int) int {
+    value, err := strconv.Atoi(os.Getenv(key))
+    if err != nil {
+        return fallback
+    }
+    return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+    value, err := time.ParseDuration(os.Getenv(key))
+    if err != nil {
+        return fallback
+    }
+    return value
+}
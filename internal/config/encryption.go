@@ -0,0 +1,88 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "makerble-assessment/internal/fieldcrypt"
+)
+
+// LoadEncryptionKeys builds the field encryption key ring from
+// ENCRYPTION_KEY_FILE, a file with one id=base64key entry per line, or
+// failing that ENCRYPTION_KEYS, the same entries separated by commas. The
+// first key encrypts; the rest are retired keys kept to decrypt older
+// values. An entry with the ID "index" is not an encryption key but keys
+// the patient search index, which then survives rotation; without one the
+// index is keyed from the current key. Generate keys with
+// `go run ./cmd/keys generate <id>`.
+func LoadEncryptionKeys() (*fieldcrypt.KeyRing, error) {
+    var entries []string
+    if path := os.Getenv("ENCRYPTION_KEY_FILE"); path != "" {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        for _, line := range strings.Split(string(data), "\n") {
+            if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+                entries = append(entries, line)
+            }
+        }
+        if len(entries) == 0 {
+            return nil, fmt.Errorf("%s: no keys found", path)
+        }
+    } else if entries = splitList(os.Getenv("ENCRYPTION_KEYS")); len(entries) == 0 {
+        return nil, errors.New("ENCRYPTION_KEY_FILE or ENCRYPTION_KEYS must be set")
+    }
+
+    var (
+        keys     []*fieldcrypt.Key
+        indexKey *fieldcrypt.Key
+    )
+    for _, entry := range entries {
+        key, err := fieldcrypt.ParseKey(entry)
+        if err != nil {
+            return nil, err
+        }
+        if compromised(entry) && (key.ID == fieldcrypt.IndexKeyID || len(keys) == 0) {
+            return nil, fmt.Errorf("key %q was published in the repository history; generate a new one and keep %q only as a retired key until rotated away", key.ID, key.ID)
+        }
+        if key.ID != fieldcrypt.IndexKeyID {
+            keys = append(keys, key)
+            continue
+        }
+        if indexKey != nil {
+            return nil, errors.New("more than one search index key")
+        }
+        indexKey = key
+    }
+    if len(keys) == 0 {
+        return nil, errors.New("no encryption key besides the search index key")
+    }
+
+    ring, err := fieldcrypt.NewKeyRing(keys[0], keys[1:]...)
+    if err != nil {
+        return nil, err
+    }
+    if indexKey != nil {
+        ring.SetIndexKey(indexKey)
+    }
+    return ring, nil
+}
+
+// compromisedKeys are secrets that were once committed to this repository.
+// They may still be listed as retired keys, so values sealed with them can
+// be rotated away, but they never encrypt or index anything new.
+var compromisedKeys = []string{
+    "gpA/GMesXVS2AkK7CAIl5xx5qZNlQanZwfR1dbuOtNU=",
+}
+
+func compromised(entry string) bool {
+    _, encoded, _ := strings.Cut(entry, "=")
+    for _, secret := range compromisedKeys {
+        if strings.TrimSpace(encoded) == secret {
+            return true
+        }
+    }
+    return false
+}
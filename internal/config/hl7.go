@@ -0,0 +1,18 @@
+package config
+
+import (
+    "os"
+    "makerble-assessment/internal/hl7"
+)
+
+// LoadHL7Config reads HL7_MLLP_ADDR, the TCP address to receive HL7 v2 ADT
+// messages on (unset disables the listener), HL7_MLLP_IDLE_TIMEOUT, after
+// which silent connections are closed (default 5m), and
+// HL7_MLLP_MAX_MESSAGE_SIZE in bytes (default 1 MB).
+func LoadHL7Config() hl7.Config {
+    cfg := hl7.DefaultConfig()
+    cfg.Addr = os.Getenv("HL7_MLLP_ADDR")
+    cfg.IdleTimeout = envDuration("HL7_MLLP_IDLE_TIMEOUT", cfg.IdleTimeout)
+    cfg.MaxMessageSize = envInt("HL7_MLLP_MAX_MESSAGE_SIZE", cfg.MaxMessageSize)
+    return cfg
+}
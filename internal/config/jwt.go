@@ -0,0 +1,99 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "makerble-assessment/internal/service"
+    "makerble-assessment/internal/token"
+)
+
+// compromisedJWTSecret was once committed to this repository; anyone can
+// sign tokens with it.
+const compromisedJWTSecret = "mysecret123456"
+
+// LoadJWTKeys builds the token key set from the environment:
+//
+//  - JWT_SIGNING_KEY_FILE: PEM RSA or Ed25519 private key; selects RS256 or
+//    EdDSA. Without it tokens are signed HS256 with JWT_SECRET.
+//  - JWT_KEY_ID: kid of the signing key (defaults to a key thumbprint).
+//  - JWT_VERIFY_KEY_FILES: comma-separated PEM keys, optionally as kid=path,
+//    that are still accepted for verification after a rotation.
+//  - JWT_PREVIOUS_SECRETS: comma-separated retired HS256 secrets, likewise.
+func LoadJWTKeys() (*token.KeySet, error) {
+    var signing *token.Key
+    keyID := os.Getenv("JWT_KEY_ID")
+
+    if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+        key, err := readPEMKey(keyID, path)
+        if err != nil {
+            return nil, err
+        }
+        signing = key
+    } else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+        if secret == compromisedJWTSecret {
+            return nil, errors.New("JWT_SECRET was published in the repository history; generate a new one")
+        }
+        signing = token.NewHMACKey(keyID, []byte(secret))
+    } else {
+        return nil, errors.New("JWT_SIGNING_KEY_FILE or JWT_SECRET must be set")
+    }
+
+    var previous []*token.Key
+    for _, entry := range splitList(os.Getenv("JWT_VERIFY_KEY_FILES")) {
+        id, path := "", entry
+        if before, after, found := strings.Cut(entry, "="); found {
+            id, path = before, after
+        }
+        key, err := readPEMKey(id, path)
+        if err != nil {
+            return nil, err
+        }
+        previous = append(previous, key)
+    }
+    for _, secret := range splitList(os.Getenv("JWT_PREVIOUS_SECRETS")) {
+        if secret == compromisedJWTSecret {
+            return nil, errors.New("JWT_PREVIOUS_SECRETS lists a secret published in the repository history")
+        }
+        previous = append(previous, token.NewHMACKey("", []byte(secret)))
+    }
+
+    return token.NewKeySet(signing, previous...)
+}
+
+func readPEMKey(id, path string) (*token.Key, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    key, err := token.ParsePEMKey(id, data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return key, nil
+}
+
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+// LoadAuthConfig reads token lifetimes from JWT_ACCESS_TTL,
+// JWT_REFRESH_TTL and TWO_FACTOR_CHALLENGE_TTL (Go durations such as 15m or
+// 720h), and the name authenticator apps show from TOTP_ISSUER.
+func LoadAuthConfig() service.AuthConfig {
+    cfg := service.DefaultAuthConfig()
+    cfg.AccessTokenTTL = envDuration("JWT_ACCESS_TTL", cfg.AccessTokenTTL)
+    cfg.RefreshTokenTTL = envDuration("JWT_REFRESH_TTL", cfg.RefreshTokenTTL)
+    cfg.ChallengeTTL = envDuration("TWO_FACTOR_CHALLENGE_TTL", cfg.ChallengeTTL)
+    if issuer := strings.TrimSpace(os.Getenv("TOTP_ISSUER")); issuer != "" {
+        cfg.TOTPIssuer = issuer
+    }
+    return cfg
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+    "os"
+    "makerble-assessment/internal/service"
+)
+
+// LoadLoginLimitConfig reads the /login limits: LOGIN_IP_RATE attempts per
+// IP per LOGIN_IP_RATE_WINDOW (default 30 per 1m), and LOGIN_MAX_FAILURES
+// failures per account (default 5) or LOGIN_MAX_IP_FAILURES per IP (default
+// 50) within LOGIN_FAILURE_WINDOW (default 15m) before a lockout of
+// LOGIN_LOCKOUT (default 1m), doubling up to LOGIN_MAX_LOCKOUT (default 1h).
+// 0 turns a limit off.
+func LoadLoginLimitConfig() service.LoginLimitConfig {
+    cfg := service.DefaultLoginLimitConfig()
+    cfg.IPRequests = envInt("LOGIN_IP_RATE", cfg.IPRequests)
+    cfg.RequestWindow = envDuration("LOGIN_IP_RATE_WINDOW", cfg.RequestWindow)
+    cfg.AccountFailures = envInt("LOGIN_MAX_FAILURES", cfg.AccountFailures)
+    cfg.IPFailures = envInt("LOGIN_MAX_IP_FAILURES", cfg.IPFailures)
+    cfg.FailureWindow = envDuration("LOGIN_FAILURE_WINDOW", cfg.FailureWindow)
+    cfg.Lockout = envDuration("LOGIN_LOCKOUT", cfg.Lockout)
+    cfg.MaxLockout = envDuration("LOGIN_MAX_LOCKOUT", cfg.MaxLockout)
+    return cfg
+}
+
+// LoadTrustedProxies reads TRUSTED_PROXIES, the comma-separated IPs or CIDR
+// ranges of reverse proxies whose X-Forwarded-For header gives the client's
+// IP. Unset, the connection's address is used.
+func LoadTrustedProxies() []string {
+    return splitList(os.Getenv("TRUSTED_PROXIES"))
+}
@@ -0,0 +1,15 @@
+package config
+
+import "makerble-assessment/internal/service"
+
+// LoadRetentionConfig reads PATIENT_RETENTION, how long deleted patients are
+// kept before being purged (unset or 0 keeps them), PATIENT_PURGE_INTERVAL,
+// how often to check (default 1h), and PATIENT_PURGE_BATCH, how many
+// patients to purge per transaction (default 100).
+func LoadRetentionConfig() service.RetentionConfig {
+    cfg := service.DefaultRetentionConfig()
+    cfg.Retention = envDuration("PATIENT_RETENTION", cfg.Retention)
+    cfg.Interval = envDuration("PATIENT_PURGE_INTERVAL", cfg.Interval)
+    cfg.BatchSize = envInt("PATIENT_PURGE_BATCH", cfg.BatchSize)
+    return cfg
+}
@@ -0,0 +1,40 @@
+package fhir
+
+// Bundle is an R4 searchset Bundle: one page of search results.
+type Bundle struct {
+    ResourceType string        `json:"resourceType"`
+    Type         string        `json:"type"`
+    Total        int64         `json:"total"`
+    Link         []BundleLink  `json:"link,omitempty"`
+    Entry        []BundleEntry `json:"entry"`
+}
+
+// BundleLink is a paging link: self, next or previous.
+type BundleLink struct {
+    Relation string `json:"relation"`
+    URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+    FullURL  string       `json:"fullUrl"`
+    Resource Patient      `json:"resource"`
+    Search   *EntrySearch `json:"search,omitempty"`
+}
+
+type EntrySearch struct {
+    Mode string `json:"mode"`
+}
+
+// NewSearchset starts a searchset Bundle with total matches overall.
+func NewSearchset(total int64) Bundle {
+    return Bundle{ResourceType: "Bundle", Type: "searchset", Total: total, Entry: []BundleEntry{}}
+}
+
+// Add appends a matching patient; base is the server's FHIR base URL.
+func (b *Bundle) Add(base string, patient Patient) {
+    b.Entry = append(b.Entry, BundleEntry{
+        FullURL:  base + "/Patient/" + patient.ID,
+        Resource: patient,
+        Search:   &EntrySearch{Mode: "match"},
+    })
+}
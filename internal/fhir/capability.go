@@ -0,0 +1,89 @@
+package fhir
+
+// CapabilityStatement is the R4 resource served at /metadata, describing
+// what this server supports.
+type CapabilityStatement struct {
+    ResourceType   string         `json:"resourceType"`
+    Status         string         `json:"status"`
+    Date           string         `json:"date"`
+    Kind           string         `json:"kind"`
+    Software       Software       `json:"software"`
+    Implementation Implementation `json:"implementation"`
+    FHIRVersion    string         `json:"fhirVersion"`
+    Format         []string       `json:"format"`
+    Rest           []Rest         `json:"rest"`
+}
+
+type Software struct {
+    Name string `json:"name"`
+}
+
+type Implementation struct {
+    Description string `json:"description"`
+    URL         string `json:"url"`
+}
+
+type Rest struct {
+    Mode     string     `json:"mode"`
+    Security Security   `json:"security"`
+    Resource []Resource `json:"resource"`
+}
+
+type Security struct {
+    Description string `json:"description"`
+}
+
+type Resource struct {
+    Type         string        `json:"type"`
+    Interaction  []Interaction `json:"interaction"`
+    Versioning   string        `json:"versioning"`
+    ReadHistory  bool          `json:"readHistory"`
+    UpdateCreate bool          `json:"updateCreate"`
+    SearchParam  []SearchParam `json:"searchParam"`
+}
+
+type Interaction struct {
+    Code string `json:"code"`
+}
+
+type SearchParam struct {
+    Name          string `json:"name"`
+    Type          string `json:"type"`
+    Documentation string `json:"documentation"`
+}
+
+// capabilityDate is when the capabilities below last changed.
+const capabilityDate = "2026-10-18"
+
+// NewCapabilityStatement describes the Patient API served at base.
+func NewCapabilityStatement(base string) CapabilityStatement {
+    return CapabilityStatement{
+        ResourceType:   "CapabilityStatement",
+        Status:         "active",
+        Date:           capabilityDate,
+        Kind:           "instance",
+        Software:       Software{Name: "makerble-assessment"},
+        Implementation: Implementation{Description: "Patient records API", URL: base},
+        FHIRVersion:    Version,
+        Format:         []string{"json"},
+        Rest: []Rest{{
+            Mode:     "server",
+            Security: Security{Description: "Send the access token from POST /login as a Bearer Authorization header. Reads need patient:read and writes patient:write."},
+            Resource: []Resource{{
+                Type:        "Patient",
+                Interaction: []Interaction{{Code: "read"}, {Code: "search-type"}, {Code: "create"}, {Code: "update"}},
+                // Updates must send the version being replaced as If-Match.
+                Versioning: "versioned-update",
+                SearchParam: []SearchParam{
+                    {Name: "name", Type: "string", Documentation: "Prefix of the given or family name"},
+                    {Name: "family", Type: "string", Documentation: "Same as name: prefix of the given or family name"},
+                    {Name: "given", Type: "string", Documentation: "Same as name: prefix of the given or family name"},
+                    {Name: "birthdate", Type: "date", Documentation: "Full date, optionally prefixed with eq, ge or le"},
+                    {Name: "gender", Type: "token", Documentation: "male, female or other"},
+                    {Name: "_count", Type: "number", Documentation: "Page size, 1 to 100 (default 20)"},
+                    {Name: "page", Type: "number", Documentation: "Page number, from 1"},
+                },
+            }},
+        }},
+    }
+}
@@ -0,0 +1,56 @@
+package fhir
+
+import (
+    "makerble-assessment/internal/service"
+)
+
+// OperationOutcome is the R4 resource every FHIR error is reported as.
+type OperationOutcome struct {
+    ResourceType string  `json:"resourceType"`
+    Issue        []Issue `json:"issue"`
+}
+
+// Issue is one problem. Expression points at the offending element, e.g.
+// "Patient.birthDate", when there is one.
+type Issue struct {
+    Severity    string   `json:"severity"`
+    Code        string   `json:"code"`
+    Diagnostics string   `json:"diagnostics,omitempty"`
+    Expression  []string `json:"expression,omitempty"`
+}
+
+// issueTypes maps service error kinds to FHIR IssueType codes.
+var issueTypes = map[service.ErrorKind]string{
+    service.KindValidation:           "invalid",
+    service.KindUnauthorized:         "login",
+    service.KindForbidden:            "forbidden",
+    service.KindNotFound:             "not-found",
+    service.KindConflict:             "conflict",
+    service.KindPreconditionFailed:   "conflict",
+    service.KindPreconditionRequired: "required",
+    service.KindUnprocessable:        "processing",
+    service.KindTooManyRequests:      "throttled",
+    service.KindInternal:             "exception",
+}
+
+// NewOperationOutcome reports err with message as its diagnostics: one
+// issue per invalid field, or a single issue without any.
+func NewOperationOutcome(err *service.Error, message string) OperationOutcome {
+    code, ok := issueTypes[err.Kind]
+    if !ok {
+        code = "exception"
+    }
+
+    outcome := OperationOutcome{ResourceType: "OperationOutcome"}
+    for _, field := range err.Fields {
+        issue := Issue{Severity: "error", Code: code, Diagnostics: field.Field + " " + field.Message}
+        if field.Field != "" {
+            issue.Expression = []string{field.Field}
+        }
+        outcome.Issue = append(outcome.Issue, issue)
+    }
+    if len(outcome.Issue) == 0 {
+        outcome.Issue = []Issue{{Severity: "error", Code: code, Diagnostics: message}}
+    }
+    return outcome
+}
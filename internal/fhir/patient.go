@@ -0,0 +1,175 @@
+// Package fhir maps patients to and from HL7 FHIR R4 resources. Only the
+// parts of each resource this API stores or serves are modelled; other
+// elements of incoming resources are ignored.
+package fhir
+
+import (
+    "strconv"
+    "strings"
+    "time"
+    "makerble-assessment/internal/service"
+)
+
+// Version is the FHIR release the resources follow.
+const Version = "4.0.1"
+
+// ContentType is the media type of FHIR JSON.
+const ContentType = "application/fhir+json"
+
+// dateLayout is the FHIR date format; partial dates such as "1990" are not
+// accepted since a patient's full date of birth is required.
+const dateLayout = "2006-01-02"
+
+// Patient is an R4 Patient resource.
+type Patient struct {
+    ResourceType string         `json:"resourceType"`
+    ID           string         `json:"id,omitempty"`
+    Meta         *Meta          `json:"meta,omitempty"`
+    Name         []HumanName    `json:"name,omitempty"`
+    Telecom      []ContactPoint `json:"telecom,omitempty"`
+    Gender       string         `json:"gender,omitempty"`
+    BirthDate    string         `json:"birthDate,omitempty"`
+    Address      []Address      `json:"address,omitempty"`
+}
+
+// Meta carries the resource version, which is also its ETag.
+type Meta struct {
+    VersionID string `json:"versionId,omitempty"`
+}
+
+type HumanName struct {
+    Use    string   `json:"use,omitempty"`
+    Text   string   `json:"text,omitempty"`
+    Family string   `json:"family,omitempty"`
+    Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+    System string `json:"system,omitempty"`
+    Value  string `json:"value,omitempty"`
+    Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+    Use        string   `json:"use,omitempty"`
+    Text       string   `json:"text,omitempty"`
+    Line       []string `json:"line,omitempty"`
+    City       string   `json:"city,omitempty"`
+    District   string   `json:"district,omitempty"`
+    State      string   `json:"state,omitempty"`
+    PostalCode string   `json:"postalCode,omitempty"`
+    Country    string   `json:"country,omitempty"`
+}
+
+// genders maps FHIR administrative genders to the stored ones. "unknown"
+// has no stored equivalent.
+var genders = map[string]string{"male": "Male", "female": "Female", "other": "Other"}
+
+// Gender returns the stored gender for a FHIR administrative gender.
+func Gender(fhirGender string) (string, bool) {
+    gender, ok := genders[fhirGender]
+    return gender, ok
+}
+
+// NewPatient maps a patient to its FHIR resource. The name is official, the
+// contact a phone number and the address free text, since that is how they
+// are stored.
+func NewPatient(patient service.PatientResponse) Patient {
+    resource := Patient{
+        ResourceType: "Patient",
+        ID:           strconv.FormatUint(uint64(patient.ID), 10),
+        Meta:         &Meta{VersionID: strconv.FormatUint(uint64(patient.Version), 10)},
+        Name:         []HumanName{{Use: "official", Family: patient.LastName, Given: []string{patient.FirstName}}},
+        Gender:       strings.ToLower(patient.Gender),
+    }
+    if dob, err := time.Parse(time.RFC3339, patient.DateOfBirth); err == nil {
+        resource.BirthDate = dob.Format(dateLayout)
+    }
+    if patient.Contact != "" {
+        resource.Telecom = []ContactPoint{{System: "phone", Value: patient.Contact}}
+    }
+    if patient.Address != "" {
+        resource.Address = []Address{{Use: "home", Text: patient.Address}}
+    }
+    return resource
+}
+
+// PatientInput maps a FHIR Patient to the fields a patient is stored with.
+// It takes the official name, or the first one that is not old; the first
+// current phone number; and the first current address, as its text or its
+// parts joined with commas. Other elements are ignored.
+func (p Patient) PatientInput() (service.CreatePatientInput, error) {
+    invalid := &service.Error{Kind: service.KindValidation, Code: "invalid_resource", Message: "Invalid Patient resource"}
+    if p.ResourceType != "Patient" {
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: "Patient.resourceType", Message: "must be Patient"})
+    }
+
+    var input service.CreatePatientInput
+    if name, ok := p.name(); ok {
+        input.FirstName = strings.Join(name.Given, " ")
+        input.LastName = name.Family
+    }
+    if input.FirstName == "" {
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: "Patient.name.given", Message: "is required"})
+    }
+    if input.LastName == "" {
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: "Patient.name.family", Message: "is required"})
+    }
+
+    if dob, err := time.Parse(dateLayout, p.BirthDate); err != nil {
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: "Patient.birthDate", Message: "must be a full date (YYYY-MM-DD)"})
+    } else {
+        input.DateOfBirth = dob.Format(time.RFC3339)
+    }
+
+    if gender, ok := Gender(p.Gender); ok {
+        input.Gender = gender
+    } else {
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: "Patient.gender", Message: "must be one of: male, female, other"})
+    }
+
+    for _, telecom := range p.Telecom {
+        if (telecom.System == "phone" || telecom.System == "") && telecom.Use != "old" && telecom.Value != "" {
+            input.Contact = telecom.Value
+            break
+        }
+    }
+    for _, address := range p.Address {
+        if address.Use != "old" {
+            input.Address = address.text()
+            break
+        }
+    }
+
+    if len(invalid.Fields) > 0 {
+        return service.CreatePatientInput{}, invalid
+    }
+    return input, nil
+}
+
+func (p Patient) name() (HumanName, bool) {
+    for _, name := range p.Name {
+        if name.Use == "official" {
+            return name, true
+        }
+    }
+    for _, name := range p.Name {
+        if name.Use != "old" && name.Use != "maiden" {
+            return name, true
+        }
+    }
+    return HumanName{}, false
+}
+
+func (a Address) text() string {
+    if a.Text != "" {
+        return a.Text
+    }
+    var parts []string
+    for _, part := range append(append([]string(nil), a.Line...), a.City, a.District, a.State, a.PostalCode, a.Country) {
+        if part = strings.TrimSpace(part); part != "" {
+            parts = append(parts, part)
+        }
+    }
+    return strings.Join(parts, ", ")
+}
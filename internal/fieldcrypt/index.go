@@ -0,0 +1,70 @@
+package fieldcrypt
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// MinIndexedPrefix and maxIndexedPrefix bound the prefixes indexed per
+// word. Words shorter than MinIndexedPrefix are indexed whole, so a shorter
+// term only matches a word it equals. Longer search terms are cut to
+// maxIndexedPrefix, so they can match a little more than they should.
+const (
+    MinIndexedPrefix = 3
+    maxIndexedPrefix = 24
+)
+
+// SearchToken is the blind index token of one lower-case search term: a
+// truncated keyed hash, so the index reveals nothing without the key.
+func (r *KeyRing) SearchToken(term string) string {
+    runes := []rune(term)
+    if len(runes) > maxIndexedPrefix {
+        runes = runes[:maxIndexedPrefix]
+    }
+    mac := hmac.New(sha256.New, r.indexKey)
+    mac.Write([]byte(string(runes)))
+    return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// SearchIndex returns the tokens of the prefixes of every word in text, at
+// least MinIndexedPrefix long, space-separated with a space at either end,
+// so a term matches with LIKE '% token %' as well as through a full-text
+// index. Empty text gives an empty index.
+//
+// Tokens are deduplicated and sorted, so the index does not show which
+// tokens belong to one word or in what order words appear, and no token
+// stands for a value's first one or two characters. It still leaks, to
+// anyone who can read it: how many distinct prefixes the value has, which
+// roughly tracks its length; and which rows share a word or prefix, since
+// equal prefixes give equal tokens under one index key.
+func (r *KeyRing) SearchIndex(text string) string {
+    words := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+        return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+    })
+
+    seen := make(map[string]bool)
+    var tokens []string
+    for _, word := range words {
+        runes := []rune(word)
+        shortest := MinIndexedPrefix
+        if len(runes) < shortest {
+            shortest = len(runes)
+        }
+        for n := shortest; n <= len(runes) && n <= maxIndexedPrefix; n++ {
+            token := r.SearchToken(string(runes[:n]))
+            if !seen[token] {
+                seen[token] = true
+                tokens = append(tokens, token)
+            }
+        }
+    }
+    if len(tokens) == 0 {
+        return ""
+    }
+    sort.Strings(tokens)
+    return " " + strings.Join(tokens, " ") + " "
+}
@@ -0,0 +1,193 @@
+// Package fieldcrypt encrypts individual database columns with AES-256-GCM.
+// Each value records the ID of the key that sealed it, so keys can be
+// rotated while older rows stay readable.
+package fieldcrypt
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// KeySize is the length of an AES-256 key in bytes.
+const KeySize = 32
+
+// IndexKeyID is the ID reserved for the search index key in key lists.
+const IndexKeyID = "index"
+
+// prefix marks an encrypted value; a whole value reads
+// "enc:v1:<key id>:<base64 of nonce and ciphertext>". Values without it are
+// legacy plaintext and are returned as they are.
+const prefix = "enc:v1:"
+
+var (
+    ErrNoKeys     = errors.New("field encryption keys are not configured")
+    ErrUnknownKey = errors.New("value was encrypted with an unknown key")
+    ErrMalformed  = errors.New("malformed encrypted value")
+    ErrTampered   = errors.New("encrypted value failed authentication")
+)
+
+// Key is one AES-256-GCM key identified by its ID.
+type Key struct {
+    ID     string
+    secret []byte
+    aead   cipher.AEAD
+}
+
+// NewKey wraps a 32-byte secret. The ID is stored with every value the key
+// encrypts, so it must be unique and must not contain a colon.
+func NewKey(id string, secret []byte) (*Key, error) {
+    if id == "" || strings.ContainsAny(id, ": \t\n") {
+        return nil, fmt.Errorf("invalid key id %q", id)
+    }
+    if len(secret) != KeySize {
+        return nil, fmt.Errorf("key %q must be %d bytes, got %d", id, KeySize, len(secret))
+    }
+    block, err := aes.NewCipher(secret)
+    if err != nil {
+        return nil, err
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, err
+    }
+    return &Key{ID: id, secret: secret, aead: aead}, nil
+}
+
+// ParseKey reads a key written as "id=base64secret", the format of the key
+// file and ENCRYPTION_KEYS.
+func ParseKey(entry string) (*Key, error) {
+    id, encoded, found := strings.Cut(strings.TrimSpace(entry), "=")
+    if !found {
+        return nil, fmt.Errorf("key entry must be id=base64 key")
+    }
+    secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+    if err != nil {
+        return nil, fmt.Errorf("key %q: %w", id, err)
+    }
+    return NewKey(strings.TrimSpace(id), secret)
+}
+
+// GenerateKey returns a new random key as "id=base64secret".
+func GenerateKey(id string) (string, error) {
+    secret := make([]byte, KeySize)
+    if _, err := rand.Read(secret); err != nil {
+        return "", err
+    }
+    if _, err := NewKey(id, secret); err != nil {
+        return "", err
+    }
+    return id + "=" + base64.StdEncoding.EncodeToString(secret), nil
+}
+
+// KeyRing encrypts with its current key and decrypts with any key it holds.
+type KeyRing struct {
+    current  *Key
+    keys     map[string]*Key
+    indexKey []byte
+}
+
+// NewKeyRing builds a ring that encrypts with current and can still decrypt
+// values sealed with the retired keys in previous.
+func NewKeyRing(current *Key, previous ...*Key) (*KeyRing, error) {
+    if current == nil {
+        return nil, ErrNoKeys
+    }
+
+    ring := &KeyRing{current: current, keys: make(map[string]*Key)}
+    for _, key := range append([]*Key{current}, previous...) {
+        if _, exists := ring.keys[key.ID]; exists {
+            return nil, fmt.Errorf("duplicate key id %q", key.ID)
+        }
+        ring.keys[key.ID] = key
+    }
+
+    // Until SetIndexKey is called the search index key is derived from the
+    // current key, so rotating keys also means rebuilding the index.
+    ring.indexKey = deriveIndexKey(current)
+    return ring, nil
+}
+
+// SetIndexKey keys the search index from key rather than the current
+// encryption key, so the index stays valid when encryption keys rotate.
+// Setting the current key here gives the index it already has.
+func (r *KeyRing) SetIndexKey(key *Key) {
+    r.indexKey = deriveIndexKey(key)
+}
+
+func deriveIndexKey(key *Key) []byte {
+    mac := hmac.New(sha256.New, key.secret)
+    mac.Write([]byte("fieldcrypt search index"))
+    return mac.Sum(nil)
+}
+
+// CurrentKeyID is the ID of the key new values are encrypted with.
+func (r *KeyRing) CurrentKeyID() string {
+    return r.current.ID
+}
+
+// Encrypt seals plaintext with the current key. column is bound to the
+// ciphertext as additional data, so a value copied into another column
+// fails to decrypt. Empty strings are stored as they are.
+func (r *KeyRing) Encrypt(column, plaintext string) (string, error) {
+    if plaintext == "" {
+        return "", nil
+    }
+
+    nonce := make([]byte, r.current.aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+    sealed := r.current.aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+    return prefix + r.current.ID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt for the same column. Plaintext
+// written before encryption was enabled is returned unchanged.
+func (r *KeyRing) Decrypt(column, value string) (string, error) {
+    if !strings.HasPrefix(value, prefix) {
+        return value, nil
+    }
+
+    id, encoded, found := strings.Cut(value[len(prefix):], ":")
+    if !found {
+        return "", ErrMalformed
+    }
+    key, ok := r.keys[id]
+    if !ok {
+        return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+    }
+    sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+    if err != nil || len(sealed) < key.aead.NonceSize() {
+        return "", ErrMalformed
+    }
+    nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+    // Open fails when the value was altered or belongs to another column.
+    plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(column))
+    if err != nil {
+        return "", fmt.Errorf("%w (key %q)", ErrTampered, id)
+    }
+    return string(plaintext), nil
+}
+
+// KeyID returns the ID of the key that encrypted value, or "" for
+// plaintext.
+func KeyID(value string) string {
+    if !strings.HasPrefix(value, prefix) {
+        return ""
+    }
+    id, _, _ := strings.Cut(value[len(prefix):], ":")
+    return id
+}
+
+// NeedsRotation reports whether value is non-empty and not encrypted with
+// the current key.
+func (r *KeyRing) NeedsRotation(value string) bool {
+    return value != "" && KeyID(value) != r.current.ID
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/service"
+)
+
+type AppointmentHandler struct {
+    service *service.AppointmentService
+}
+
+func NewAppointmentHandler(service *service.AppointmentService) *AppointmentHandler {
+    return &AppointmentHandler{service: service}
+}
+
+// Book godoc
+// @Security BearerAuth
+// @Summary Book an appointment
+// @Description Book a patient in with a doctor (requires appointment:write). Times are RFC 3339; a doctor cannot have overlapping appointments.
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param appointment body service.BookAppointmentInput true "Appointment data"
+// @Success 201 {object} service.AppointmentResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/appointments [post]
+func (h *AppointmentHandler) Book(c *gin.Context) {
+    var input service.BookAppointmentInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    appointment, err := h.service.Book(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, appointment)
+}
+
+// List godoc
+// @Security BearerAuth
+// @Summary List appointments
+// @Description Get a page of appointments ordered by start time (requires appointment:read)
+// @Tags appointments
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param page query int false "Page number" minimum(1) default(1)
+// @Param limit query int false "Page size" minimum(1) maximum(100) default(20)
+// @Param doctor_id query int false "Only appointments with this doctor"
+// @Param patient_id query int false "Only appointments of this patient"
+// @Param status query string false "Appointment status" Enums(scheduled, cancelled)
+// @Param from query string false "Only appointments ending after this time, RFC 3339"
+// @Param to query string false "Only appointments starting before this time, RFC 3339"
+// @Success 200 {object} service.AppointmentListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/appointments [get]
+func (h *AppointmentHandler) List(c *gin.Context) {
+    var input service.ListAppointmentsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    appointments, err := h.service.List(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, appointments)
+}
+
+// Mine godoc
+// @Security BearerAuth
+// @Summary List my upcoming appointments
+// @Description Get the signed-in doctor's scheduled appointments that have not ended, soonest first (requires appointment:attend)
+// @Tags appointments
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param page query int false "Page number" minimum(1) default(1)
+// @Param limit query int false "Page size" minimum(1) maximum(100) default(20)
+// @Success 200 {object} service.AppointmentListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/appointments/mine [get]
+func (h *AppointmentHandler) Mine(c *gin.Context) {
+    var input service.ListUpcomingInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    appointments, err := h.service.Upcoming(currentUserID(c), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, appointments)
+}
+
+// Get godoc
+// @Security BearerAuth
+// @Summary Get an appointment
+// @Description Get an appointment by ID (requires appointment:read)
+// @Tags appointments
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Appointment ID"
+// @Success 200 {object} service.AppointmentResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/appointments/{id} [get]
+func (h *AppointmentHandler) Get(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    appointment, err := h.service.Get(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, appointment)
+}
+
+// Reschedule godoc
+// @Security BearerAuth
+// @Summary Reschedule an appointment
+// @Description Move a scheduled appointment to new times and optionally another doctor (requires appointment:write)
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Appointment ID"
+// @Param appointment body service.RescheduleAppointmentInput true "New times"
+// @Success 200 {object} service.AppointmentResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/appointments/{id} [put]
+func (h *AppointmentHandler) Reschedule(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    var input service.RescheduleAppointmentInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    appointment, err := h.service.Reschedule(id, input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, appointment)
+}
+
+// Cancel godoc
+// @Security BearerAuth
+// @Summary Cancel an appointment
+// @Description Cancel a scheduled appointment, with an optional reason (requires appointment:write)
+// @Tags appointments
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Appointment ID"
+// @Param cancellation body service.CancelAppointmentInput false "Cancellation reason"
+// @Success 200 {object} service.AppointmentResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/appointments/{id}/cancel [post]
+func (h *AppointmentHandler) Cancel(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    // The body is optional.
+    var input service.CancelAppointmentInput
+    if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    appointment, err := h.service.Cancel(id, input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, appointment)
+}
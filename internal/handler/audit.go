@@ -0,0 +1,50 @@
+package handler
+
+import (
+    "net/http"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/service"
+)
+
+type AuditHandler struct {
+    service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+    return &AuditHandler{service: service}
+}
+
+// List godoc
+// @Security BearerAuth
+// @Summary Query the audit log
+// @Description Get a page of patient record accesses and changes, newest first (requires audit:read)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param user_id query int false "Only actions by this user"
+// @Param patient_id query int false "Only actions on this patient"
+// @Param from query string false "Earliest time, RFC 3339"
+// @Param to query string false "Latest time, RFC 3339"
+// @Success 200 {object} service.AuditLogListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/admin/audit-logs [get]
+func (h *AuditHandler) List(c *gin.Context) {
+    var input service.ListAuditLogsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    logs, err := h.service.List(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, logs)
+}
@@ -1,45 +1,367 @@
 package handler
 
 import (
+    "errors"
     "net/http"
+    "strconv"
     "github.com/gin-gonic/gin"
     "makerble-assessment/internal/service"
 )
 
 type AuthHandler struct {
     service *service.AuthService
+    limiter *service.LoginLimiter
 }
 
-func NewAuthHandler(service *service.AuthService) *AuthHandler {
-    return &AuthHandler{service: service}
+func NewAuthHandler(service *service.AuthService, limiter *service.LoginLimiter) *AuthHandler {
+    return &AuthHandler{service: service, limiter: limiter}
 }
 
 // Login godoc
 // @Summary Login a user
-// @Description Authenticate a user and return a JWT token
+// @Description Authenticate a user and return a short-lived access token and a refresh token. Users with two-factor authentication, or holding a role that requires it, get only a two_factor challenge instead; complete it at /auth/2fa/verify, or enroll first when enrollment_required is set. Attempts are rate limited per client IP, and repeated failures lock the account or IP out for a growing time; refused attempts get 429 with Retry-After.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body service.LoginInput true "User credentials"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Success 200 {object} service.TokenResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 429 {object} handler.ErrorResponse
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
 // @Router /login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
     var input service.LoginInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        RespondError(c, invalidInput(err))
         return
     }
 
-    token, user, err := h.service.Login(input)
+    var tokens service.TokenResponse
+    err := h.limited(c, input.Email, func() (bool, error) {
+        var err error
+        tokens, err = h.service.Login(input)
+        // A right password with a code still to come does not end the run
+        // of failures, or alternating would allow endless code guesses.
+        return tokens.TwoFactor == nil, err
+    })
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        RespondError(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
-        "token": token,
-        "user":  user,
+    c.JSON(http.StatusOK, tokens)
+}
+
+// limited makes a sign-in attempt for account under the login limits. It
+// is refused while the account or IP is locked out, a wrong password or
+// code counts as a failure, and an attempt reporting that it signed in
+// starts the run of failures over.
+func (h *AuthHandler) limited(c *gin.Context, account string, attempt func() (bool, error)) error {
+    ip := c.ClientIP()
+    if err := h.limiter.Allow(ip, account); err != nil {
+        return err
+    }
+
+    signedIn, err := attempt()
+    if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrInvalidTwoFactorCode) {
+        // The attempt is refused either way; a limiter failure only goes to
+        // the log.
+        if err := h.limiter.Fail(ip, account); err != nil {
+            c.Error(err)
+        }
+    }
+    if err != nil {
+        return err
+    }
+    if signedIn {
+        if err := h.limiter.Succeed(account); err != nil {
+            c.Error(err)
+        }
+    }
+    return nil
+}
+
+// currentAccount names the signed-in caller for the login limits.
+func currentAccount(c *gin.Context) string {
+    return "user:" + strconv.FormatUint(uint64(currentUserID(c)), 10)
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token from login and a TOTP code, or one of the user's unused recovery codes, for an access token and a refresh token. Each TOTP code and each challenge works once. Wrong codes count against the login limits.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param challenge body service.ChallengeCodeInput true "Challenge token and code"
+// @Success 200 {object} service.TokenResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Failure 429 {object} handler.ErrorResponse
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
+// @Router /auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+    var input service.ChallengeCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    account, err := h.service.ChallengeAccount(input.ChallengeToken)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    var tokens service.TokenResponse
+    err = h.limited(c, account, func() (bool, error) {
+        var err error
+        tokens, err = h.service.VerifyTwoFactor(input)
+        return true, err
     })
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, tokens)
+}
+
+// StartChallengeEnrollment godoc
+// @Summary Start two-factor enrollment during login
+// @Description For a login whose challenge has enrollment_required, create an authenticator secret. Show provisioning_uri as a QR code, then confirm with a code from the app. Starting again replaces the secret.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param challenge body service.ChallengeInput true "Challenge token"
+// @Success 200 {object} service.TwoFactorSetup
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /auth/2fa/enroll [post]
+func (h *AuthHandler) StartChallengeEnrollment(c *gin.Context) {
+    var input service.ChallengeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    setup, err := h.service.StartChallengeEnrollment(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmChallengeEnrollment godoc
+// @Summary Confirm two-factor enrollment during login
+// @Description Enable two-factor authentication with a first code from the authenticator app and complete the login. The response includes recovery codes, which are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param challenge body service.ChallengeCodeInput true "Challenge token and code"
+// @Success 200 {object} service.TokenResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /auth/2fa/enroll/confirm [post]
+func (h *AuthHandler) ConfirmChallengeEnrollment(c *gin.Context) {
+    var input service.ChallengeCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    tokens, err := h.service.ConfirmChallengeEnrollment(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTwoFactor godoc
+// @Security BearerAuth
+// @Summary Start two-factor enrollment
+// @Description Create an authenticator secret for the signed-in user. Show provisioning_uri as a QR code, then confirm with a code from the app. Starting again replaces the secret.
+// @Tags auth
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} service.TwoFactorSetup
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/account/2fa [post]
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+    setup, err := h.service.EnrollTwoFactor(currentUserID(c))
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTwoFactor godoc
+// @Security BearerAuth
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication for the signed-in user with a first code from the authenticator app. Returns recovery codes, which are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param code body service.TwoFactorCodeInput true "TOTP code"
+// @Success 200 {object} service.RecoveryCodesResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/account/2fa/confirm [post]
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+    var input service.TwoFactorCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    codes, err := h.service.ConfirmTwoFactor(currentUserID(c), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, codes)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Security BearerAuth
+// @Summary Replace recovery codes
+// @Description Replace all of the signed-in user's recovery codes, used or not, given a current TOTP or recovery code. Wrong codes count against the login limits.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param code body service.TwoFactorCodeInput true "TOTP or recovery code"
+// @Success 200 {object} service.RecoveryCodesResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Failure 429 {object} handler.ErrorResponse
+// @Router /api/account/2fa/recovery-codes [post]
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+    var input service.TwoFactorCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    var codes service.RecoveryCodesResponse
+    err := h.limited(c, currentAccount(c), func() (bool, error) {
+        var err error
+        codes, err = h.service.RegenerateRecoveryCodes(currentUserID(c), input)
+        return true, err
+    })
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, codes)
+}
+
+// DisableTwoFactor godoc
+// @Security BearerAuth
+// @Summary Turn off two-factor authentication
+// @Description Turn off two-factor authentication for the signed-in user given a current TOTP or recovery code. Refused with 403 while one of their roles requires it. Wrong codes count against the login limits.
+// @Tags auth
+// @Accept json
+// @Param Authorization header string true "Bearer token"
+// @Param code body service.TwoFactorCodeInput true "TOTP or recovery code"
+// @Success 204
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Failure 429 {object} handler.ErrorResponse
+// @Router /api/account/2fa/disable [post]
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+    var input service.TwoFactorCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    err := h.limited(c, currentAccount(c), func() (bool, error) {
+        return true, h.service.DisableTwoFactor(currentUserID(c), input)
+    })
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// Refresh godoc
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token can be used once; reusing one revokes the whole session. Sessions of users who must now enroll in two-factor authentication are refused and revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh_token body service.RefreshInput true "Refresh token"
+// @Success 200 {object} service.TokenResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+    var input service.RefreshInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    tokens, err := h.service.Refresh(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the session of a refresh token, including access tokens issued from it
+// @Tags auth
+// @Accept json
+// @Param refresh_token body service.RefreshInput true "Refresh token"
+// @Success 204
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+    var input service.RefreshInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    if err := h.service.Logout(input); err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying tokens issued by this API. HMAC keys are never listed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} token.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+    c.JSON(http.StatusOK, h.service.JWKS())
 }
\ No newline at end of file
@@ -0,0 +1,134 @@
+package handler
+
+import (
+    "net/http"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/service"
+)
+
+type AvailabilityHandler struct {
+    service *service.AvailabilityService
+}
+
+func NewAvailabilityHandler(service *service.AvailabilityService) *AvailabilityHandler {
+    return &AvailabilityHandler{service: service}
+}
+
+// GetMine godoc
+// @Security BearerAuth
+// @Summary Get my availability
+// @Description Get the signed-in doctor's published schedule (requires appointment:attend)
+// @Tags doctors
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} service.AvailabilityResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/doctors/me/availability [get]
+func (h *AvailabilityHandler) GetMine(c *gin.Context) {
+    availability, err := h.service.Get(currentUserID(c))
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, availability)
+}
+
+// SetMine godoc
+// @Security BearerAuth
+// @Summary Publish my availability
+// @Description Replace the signed-in doctor's weekly working hours, breaks, leave days, timezone and slot length (requires appointment:attend). Weekday 0 is Sunday; times are HH:MM in the given IANA timezone.
+// @Tags doctors
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param availability body service.AvailabilityInput true "Schedule"
+// @Success 200 {object} service.AvailabilityResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/doctors/me/availability [put]
+func (h *AvailabilityHandler) SetMine(c *gin.Context) {
+    var input service.AvailabilityInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    availability, err := h.service.Set(currentUserID(c), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, availability)
+}
+
+// Get godoc
+// @Security BearerAuth
+// @Summary Get a doctor's availability
+// @Description Get a doctor's published schedule (requires appointment:read)
+// @Tags doctors
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Doctor's user ID"
+// @Success 200 {object} service.AvailabilityResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/doctors/{id}/availability [get]
+func (h *AvailabilityHandler) Get(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    availability, err := h.service.Get(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, availability)
+}
+
+// Slots godoc
+// @Security BearerAuth
+// @Summary List a doctor's free slots
+// @Description Get the bookable slots of a doctor between two dates, inclusive, in the doctor's timezone (requires appointment:read). Leave days, breaks, past slots and booked times are left out.
+// @Tags doctors
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Doctor's user ID"
+// @Param from query string true "First date, YYYY-MM-DD"
+// @Param to query string true "Last date, YYYY-MM-DD (at most 31 days after from)"
+// @Param timezone query string false "IANA timezone to write slot times in (default: the doctor's)"
+// @Success 200 {object} service.SlotListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/doctors/{id}/slots [get]
+func (h *AvailabilityHandler) Slots(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    var input service.ListSlotsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    slots, err := h.service.Slots(id, input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, slots)
+}
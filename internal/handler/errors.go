@@ -0,0 +1,138 @@
+package handler
+
+import (
+    "errors"
+    "net/http"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
+    "github.com/go-playground/validator/v10"
+    "makerble-assessment/internal/fhir"
+    "makerble-assessment/internal/service"
+)
+
+// ErrorResponse is the body of every error response. Details lists the
+// offending input fields of validation errors, and Duplicates the existing
+// patients a new one may duplicate.
+type ErrorResponse struct {
+    Code       string                       `json:"code"`
+    Message    string                       `json:"message"`
+    Details    []service.FieldError         `json:"details,omitempty"`
+    Duplicates []service.DuplicateCandidate `json:"duplicates,omitempty"`
+}
+
+var statusByKind = map[service.ErrorKind]int{
+    service.KindValidation:           http.StatusBadRequest,
+    service.KindUnauthorized:         http.StatusUnauthorized,
+    service.KindForbidden:            http.StatusForbidden,
+    service.KindNotFound:             http.StatusNotFound,
+    service.KindConflict:             http.StatusConflict,
+    service.KindPreconditionFailed:   http.StatusPreconditionFailed,
+    service.KindPreconditionRequired: http.StatusPreconditionRequired,
+    service.KindUnprocessable:        http.StatusUnprocessableEntity,
+    service.KindTooManyRequests:      http.StatusTooManyRequests,
+    service.KindInternal:             http.StatusInternalServerError,
+}
+
+func init() {
+    // Report binding errors under the names clients send, not Go's.
+    if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+        v.RegisterTagNameFunc(func(field reflect.StructField) string {
+            for _, tag := range []string{"json", "form"} {
+                if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+                    return name
+                }
+            }
+            return field.Name
+        })
+    }
+}
+
+// RespondError translates err into its status and an ErrorResponse, or an
+// OperationOutcome under FHIRErrors, and aborts the request. Internal errors
+// are attached to the context for the logger and never shown to the caller;
+// other errors show only their service message, never the text of errors
+// they wrap. Rate limit refusals carry a Retry-After header in whole seconds.
+func RespondError(c *gin.Context, err error) {
+    serviceErr := service.AsError(err)
+    status, ok := statusByKind[serviceErr.Kind]
+    if !ok {
+        status = http.StatusInternalServerError
+    }
+
+    response := ErrorResponse{Code: serviceErr.Code, Message: serviceErr.Message, Details: serviceErr.Fields}
+    if status == http.StatusInternalServerError {
+        c.Error(err)
+    }
+    var duplicates *service.DuplicatesError
+    if errors.As(err, &duplicates) {
+        response.Duplicates = duplicates.Candidates
+    }
+    var rateLimit *service.RateLimitError
+    if errors.As(err, &rateLimit) {
+        c.Header("Retry-After", strconv.FormatInt(int64((rateLimit.RetryAfter+time.Second-1)/time.Second), 10))
+    }
+    if c.GetBool(fhirErrorsKey) {
+        c.Header("Content-Type", fhir.ContentType+"; charset=utf-8")
+        c.AbortWithStatusJSON(status, fhir.NewOperationOutcome(serviceErr, response.Message))
+        return
+    }
+    c.AbortWithStatusJSON(status, response)
+}
+
+// invalidInput describes a request body or query string that failed to bind.
+func invalidInput(err error) error {
+    var fieldErrors validator.ValidationErrors
+    if !errors.As(err, &fieldErrors) {
+        return &service.Error{Kind: service.KindValidation, Code: "invalid_input", Message: err.Error(), Err: err}
+    }
+
+    invalid := &service.Error{Kind: service.KindValidation, Code: "invalid_input", Message: "Invalid input", Err: err}
+    for _, fieldErr := range fieldErrors {
+        // Drop the struct name from e.g. "AvailabilityInput.breaks[0].start".
+        field := fieldErr.Namespace()
+        if i := strings.Index(field, "."); i >= 0 {
+            field = field[i+1:]
+        }
+        invalid.Fields = append(invalid.Fields, service.FieldError{Field: field, Message: describeRule(fieldErr)})
+    }
+    return invalid
+}
+
+func describeRule(fieldErr validator.FieldError) string {
+    switch fieldErr.Tag() {
+    case "required":
+        return "is required"
+    case "email":
+        return "must be a valid email address"
+    case "oneof":
+        return "must be one of: " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+    case "min":
+        return "must be at least " + fieldErr.Param()
+    case "max":
+        return "must be at most " + fieldErr.Param()
+    case "datetime":
+        return "must have the format " + fieldErr.Param()
+    default:
+        return "failed the " + fieldErr.Tag() + " rule"
+    }
+}
+
+// pathID reads the :id route parameter, answering 400 when it is not a
+// positive integer.
+func pathID(c *gin.Context) (uint, bool) {
+    id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+    if err != nil || id == 0 {
+        RespondError(c, &service.Error{
+            Kind:    service.KindValidation,
+            Code:    "invalid_id",
+            Message: "Invalid ID",
+            Fields:  []service.FieldError{{Field: "id", Message: "must be a positive integer"}},
+        })
+        return 0, false
+    }
+    return uint(id), true
+}
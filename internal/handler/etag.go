@@ -0,0 +1,38 @@
+package handler
+
+import (
+    "strconv"
+    "strings"
+    "makerble-assessment/internal/service"
+)
+
+// errIfMatchRequired rejects an update sent without an If-Match header,
+// which would silently overwrite changes made since the client's read.
+var errIfMatchRequired = &service.Error{Kind: service.KindPreconditionRequired, Code: "if_match_required",
+    Message: "send the ETag of the version being updated as If-Match, or * to update any version"}
+
+// etag is the strong entity tag for a record version.
+func etag(version uint) string {
+    return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// ifMatchVersion reads an If-Match header holding a single tag. "*" accepts
+// any version and yields 0. A missing header is errIfMatchRequired, and a
+// tag that can never match, such as a weak, malformed or listed one, is
+// service.ErrVersionConflict.
+func ifMatchVersion(header string) (uint, error) {
+    header = strings.TrimSpace(header)
+    switch {
+    case header == "":
+        return 0, errIfMatchRequired
+    case header == "*":
+        return 0, nil
+    case len(header) < 3 || header[0] != '"' || header[len(header)-1] != '"':
+        return 0, service.ErrVersionConflict
+    }
+    n, err := strconv.ParseUint(header[1:len(header)-1], 10, 32)
+    if err != nil || n == 0 {
+        return 0, service.ErrVersionConflict
+    }
+    return uint(n), nil
+}
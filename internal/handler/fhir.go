@@ -0,0 +1,327 @@
+package handler
+
+import (
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/fhir"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/service"
+)
+
+// fhirErrorsKey marks a request whose errors RespondError reports as FHIR
+// OperationOutcome resources.
+const fhirErrorsKey = "fhir_errors"
+
+// FHIRHandler serves patients as HL7 FHIR R4 Patient resources. Reads are
+// audited like those of PatientHandler; writes are audited by the service.
+type FHIRHandler struct {
+    service *service.PatientService
+    audit   *service.AuditService
+}
+
+func NewFHIRHandler(service *service.PatientService, audit *service.AuditService) *FHIRHandler {
+    return &FHIRHandler{service: service, audit: audit}
+}
+
+// FHIRErrors makes RespondError answer with an OperationOutcome, for the
+// routes under /fhir and the middleware in front of them.
+func FHIRErrors() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Set(fhirErrorsKey, true)
+        c.Next()
+    }
+}
+
+// Metadata godoc
+// @Summary FHIR capability statement
+// @Description Describe the FHIR R4 interactions and search parameters this server supports
+// @Tags fhir
+// @Produce json
+// @Success 200 {object} fhir.CapabilityStatement
+// @Router /fhir/metadata [get]
+func (h *FHIRHandler) Metadata(c *gin.Context) {
+    respondFHIR(c, http.StatusOK, fhir.NewCapabilityStatement(fhirBase(c)))
+}
+
+// Read godoc
+// @Security BearerAuth
+// @Summary Read a FHIR Patient
+// @Description Get a patient as a FHIR R4 Patient resource (requires patient:read). The ETag is the weak form of the resource version.
+// @Tags fhir
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Success 200 {object} fhir.Patient
+// @Failure 400 {object} fhir.OperationOutcome
+// @Failure 401 {object} fhir.OperationOutcome
+// @Failure 403 {object} fhir.OperationOutcome
+// @Failure 404 {object} fhir.OperationOutcome
+// @Router /fhir/Patient/{id} [get]
+func (h *FHIRHandler) Read(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    patient, err := h.service.Get(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    if err := h.audit.Record(currentUserID(c), model.AuditPatientRead, patient.ID, nil, nil); err != nil {
+        RespondError(c, errAuditFailed(err))
+        return
+    }
+
+    c.Header("ETag", weakETag(patient.Version))
+    respondFHIR(c, http.StatusOK, fhir.NewPatient(patient))
+}
+
+// Search godoc
+// @Security BearerAuth
+// @Summary Search FHIR Patients
+// @Description Get a page of patients as a FHIR searchset Bundle (requires patient:read). Unsupported search parameters are rejected.
+// @Tags fhir
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param name query string false "Prefix of the given or family name"
+// @Param family query string false "Same as name"
+// @Param given query string false "Same as name"
+// @Param birthdate query string false "Date of birth (YYYY-MM-DD), optionally prefixed with eq, ge or le"
+// @Param gender query string false "Gender" Enums(male, female, other)
+// @Param _count query int false "Page size (default 20, max 100)"
+// @Param page query int false "Page number (default 1)"
+// @Success 200 {object} fhir.Bundle
+// @Failure 400 {object} fhir.OperationOutcome
+// @Failure 401 {object} fhir.OperationOutcome
+// @Failure 403 {object} fhir.OperationOutcome
+// @Router /fhir/Patient [get]
+func (h *FHIRHandler) Search(c *gin.Context) {
+    query := c.Request.URL.Query()
+    input, err := fhirSearchInput(query)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    patients, err := h.service.List(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    ids := make([]uint, 0, len(patients.Data))
+    for _, patient := range patients.Data {
+        ids = append(ids, patient.ID)
+    }
+    if err := h.audit.RecordViews(currentUserID(c), model.AuditPatientList, ids); err != nil {
+        RespondError(c, errAuditFailed(err))
+        return
+    }
+
+    base := fhirBase(c)
+    bundle := fhir.NewSearchset(patients.Meta.Total)
+    page := func(relation string, n int) {
+        query.Set("page", strconv.Itoa(n))
+        bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: relation, URL: base + "/Patient?" + query.Encode()})
+    }
+    page("self", patients.Meta.Page)
+    if patients.Meta.Page < patients.Meta.TotalPages {
+        page("next", patients.Meta.Page+1)
+    }
+    if patients.Meta.Page > 1 {
+        page("previous", patients.Meta.Page-1)
+    }
+    for _, patient := range patients.Data {
+        bundle.Add(base, fhir.NewPatient(patient))
+    }
+    respondFHIR(c, http.StatusOK, bundle)
+}
+
+// Create godoc
+// @Security BearerAuth
+// @Summary Create a FHIR Patient
+// @Description Create a patient from a FHIR R4 Patient resource (requires patient:write). The official name, first phone number and first address are stored; other elements are ignored.
+// @Tags fhir
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param patient body fhir.Patient true "Patient resource"
+// @Success 201 {object} fhir.Patient
+// @Failure 400 {object} fhir.OperationOutcome
+// @Failure 401 {object} fhir.OperationOutcome
+// @Failure 403 {object} fhir.OperationOutcome
+// @Router /fhir/Patient [post]
+func (h *FHIRHandler) Create(c *gin.Context) {
+    var resource fhir.Patient
+    if err := c.ShouldBindJSON(&resource); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    input, err := resource.PatientInput()
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    // FHIR has no way to show possible duplicates to the sender, so they are
+    // left for staff to merge.
+    input.Force = true
+
+    patient, err := h.service.Create(currentUserID(c), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    created := fhir.NewPatient(patient)
+    c.Header("Location", fhirBase(c)+"/Patient/"+created.ID+"/_history/"+created.Meta.VersionID)
+    c.Header("ETag", weakETag(patient.Version))
+    respondFHIR(c, http.StatusCreated, created)
+}
+
+// Update godoc
+// @Security BearerAuth
+// @Summary Update a FHIR Patient
+// @Description Replace a patient with a FHIR R4 Patient resource (requires patient:write). The resource id must match the URL. If-Match is required: send the ETag of the version being replaced, or * to replace any version. Elements left out are cleared.
+// @Tags fhir
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param If-Match header string true "ETag of the version being replaced, e.g. W/\"3\", or *"
+// @Param id path int true "Patient ID"
+// @Param patient body fhir.Patient true "Patient resource"
+// @Success 200 {object} fhir.Patient
+// @Failure 400 {object} fhir.OperationOutcome
+// @Failure 401 {object} fhir.OperationOutcome
+// @Failure 403 {object} fhir.OperationOutcome
+// @Failure 404 {object} fhir.OperationOutcome
+// @Failure 412 {object} fhir.OperationOutcome
+// @Failure 428 {object} fhir.OperationOutcome
+// @Router /fhir/Patient/{id} [put]
+func (h *FHIRHandler) Update(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+    var resource fhir.Patient
+    if err := c.ShouldBindJSON(&resource); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    if resource.ID != c.Param("id") {
+        RespondError(c, &service.Error{Kind: service.KindValidation, Code: "invalid_resource", Message: "Invalid Patient resource",
+            Fields: []service.FieldError{{Field: "Patient.id", Message: "must match the id in the URL"}}})
+        return
+    }
+    input, err := resource.PatientInput()
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    // FHIR servers send weak ETags, which name the same versions here.
+    expectedVersion, err := ifMatchVersion(strings.TrimPrefix(strings.TrimSpace(c.GetHeader("If-Match")), "W/"))
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    patient, err := h.service.Replace(currentUserID(c), id, expectedVersion, input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Header("ETag", weakETag(patient.Version))
+    respondFHIR(c, http.StatusOK, fhir.NewPatient(patient))
+}
+
+// fhirSearchInput turns FHIR Patient search parameters into a list query.
+func fhirSearchInput(query url.Values) (service.ListPatientsInput, error) {
+    invalid := &service.Error{Kind: service.KindValidation, Code: "invalid_search", Message: "Invalid search"}
+    fail := func(name, message string) (service.ListPatientsInput, error) {
+        invalid.Fields = []service.FieldError{{Field: name, Message: message}}
+        return service.ListPatientsInput{}, invalid
+    }
+
+    var input service.ListPatientsInput
+    for name, values := range query {
+        for _, value := range values {
+            switch name {
+            case "name", "family", "given":
+                if input.Name != "" && input.Name != value {
+                    return fail(name, "only one name prefix is supported")
+                }
+                input.Name = value
+            case "birthdate":
+                prefix, date := "eq", value
+                if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+                    prefix, date = value[:2], value[2:]
+                }
+                dob, err := time.Parse("2006-01-02", date)
+                if err != nil {
+                    return fail(name, "must be a full date (YYYY-MM-DD)")
+                }
+                switch prefix {
+                case "eq":
+                    input.DOBFrom, input.DOBTo = dob, dob
+                case "ge":
+                    input.DOBFrom = dob
+                case "le":
+                    input.DOBTo = dob
+                default:
+                    return fail(name, "supports the prefixes eq, ge and le")
+                }
+            case "gender":
+                gender, ok := fhir.Gender(value)
+                if !ok {
+                    return fail(name, "must be one of: male, female, other")
+                }
+                input.Gender = gender
+            case "_count":
+                n, err := strconv.Atoi(value)
+                if err != nil || n < 1 || n > service.MaxPageSize {
+                    return fail(name, "must be between 1 and 100")
+                }
+                input.Limit = n
+            case "page":
+                n, err := strconv.Atoi(value)
+                if err != nil || n < 1 {
+                    return fail(name, "must be a positive integer")
+                }
+                input.Page = n
+            case "_format":
+                if value != "json" && value != fhir.ContentType && value != "application/json" {
+                    return fail(name, "only json is supported")
+                }
+            default:
+                return fail(name, "is not a supported search parameter")
+            }
+        }
+    }
+    return input, nil
+}
+
+// fhirBase is the absolute URL of the FHIR API as the client reached it.
+func fhirBase(c *gin.Context) string {
+    scheme := "http"
+    if c.Request.TLS != nil {
+        scheme = "https"
+    }
+    if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+        scheme = proto
+    }
+    return scheme + "://" + c.Request.Host + "/fhir"
+}
+
+// weakETag is the ETag FHIR uses for a resource version.
+func weakETag(version uint) string {
+    return "W/" + etag(version)
+}
+
+func respondFHIR(c *gin.Context, status int, resource interface{}) {
+    c.Header("Content-Type", fhir.ContentType+"; charset=utf-8")
+    c.JSON(status, resource)
+}
@@ -1,201 +1,625 @@
 package handler
 
 import (
+    "errors"
+    "fmt"
     "net/http"
-    "strconv"
+    "time"
     "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/model"
     "makerble-assessment/internal/service"
 )
 
+// PatientHandler serves the patient routes. Every successful call is
+// written to the audit log before the response is sent.
 type PatientHandler struct {
     service *service.PatientService
+    audit   *service.AuditService
 }
 
-func NewPatientHandler(service *service.PatientService) *PatientHandler {
-    return &PatientHandler{service: service}
+func NewPatientHandler(service *service.PatientService, audit *service.AuditService) *PatientHandler {
+    return &PatientHandler{service: service, audit: audit}
 }
 
 // Create godoc
 // @Security BearerAuth
 // @Summary Create a patient
-// @Description Create a new patient (receptionist only)
-// @Tags receptionist
+// @Description Create a new patient (requires patient:write). A patient that looks like existing ones is refused with 409 possible_duplicate, listing them under duplicates with a score and what matched; send force to create it anyway.
+// @Tags patients
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param patient body service.CreatePatientInput true "Patient details"
 // @Success 201 {object} service.PatientResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 403 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/receptionist/patients [post]
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients [post]
 func (h *PatientHandler) Create(c *gin.Context) {
     var input service.CreatePatientInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        RespondError(c, invalidInput(err))
         return
     }
 
-    patient, err := h.service.Create(input)
+    patient, err := h.service.Create(currentUserID(c), input)
+    var duplicates *service.DuplicatesError
+    if errors.As(err, &duplicates) {
+        ids := make([]uint, 0, len(duplicates.Candidates))
+        for _, candidate := range duplicates.Candidates {
+            ids = append(ids, candidate.PatientID)
+        }
+        if !h.recordViews(c, model.AuditPatientMatch, ids) {
+            return
+        }
+    }
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        RespondError(c, err)
         return
     }
 
+    c.Header("ETag", etag(patient.Version))
     c.JSON(http.StatusCreated, patient)
 }
 
+// maxImportSize caps the body of an import request.
+const maxImportSize = 32 << 20
+
+// Import godoc
+// @Security BearerAuth
+// @Summary Import patients
+// @Description Create patients in bulk from CSV with a header row or from NDJSON (requires patient:write). Rows are validated like a single create; invalid rows are skipped and reported. With dry_run nothing is written.
+// @Tags patients
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param patients body string true "CSV or NDJSON patients"
+// @Param format query string false "Input format (default from Content-Type)" Enums(csv, ndjson)
+// @Param dry_run query bool false "Only validate"
+// @Param batch_size query int false "Rows per transaction (default 500, max 1000)"
+// @Param force query bool false "Import rows that look like existing patients"
+// @Success 200 {object} service.ImportReport
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients/import [post]
+func (h *PatientHandler) Import(c *gin.Context) {
+    var options service.ImportOptions
+    if err := c.ShouldBindQuery(&options); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    if options.Format == "" {
+        switch c.ContentType() {
+        case "text/csv":
+            options.Format = service.ImportCSV
+        case "application/x-ndjson", "application/jsonl":
+            options.Format = service.ImportNDJSON
+        }
+    }
+
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+    report, err := h.service.Import(currentUserID(c), c.Request.Body, options)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, report)
+}
+
 // List godoc
 // @Security BearerAuth
 // @Summary List patients
-// @Description Get a list of patients
-// @Tags receptionist,doctor
+// @Description Get a page of patients, optionally sorted and filtered
+// @Tags patients
 // @Produce json
 // @Param Authorization header string true "Bearer token"
-// @Success 200 {array} service.PatientResponse
-// @Failure 401 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/receptionist/patients [get]
-// @Router /api/doctor/patients [get]
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param sort query string false "Sort field" Enums(name, date_of_birth, created_at)
+// @Param order query string false "Sort direction" Enums(asc, desc)
+// @Param gender query string false "Gender" Enums(Male, Female, Other)
+// @Param dob_from query string false "Earliest date of birth (YYYY-MM-DD)"
+// @Param dob_to query string false "Latest date of birth (YYYY-MM-DD)"
+// @Param name query string false "First or last name prefix"
+// @Success 200 {object} service.PatientListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients [get]
 func (h *PatientHandler) List(c *gin.Context) {
-    patients, err := h.service.List()
+    var input service.ListPatientsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    patients, err := h.service.List(input)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        RespondError(c, err)
+        return
+    }
+    ids := make([]uint, 0, len(patients.Data))
+    for _, patient := range patients.Data {
+        ids = append(ids, patient.ID)
+    }
+    if !h.recordViews(c, model.AuditPatientList, ids) {
         return
     }
 
     c.JSON(http.StatusOK, patients)
 }
 
+// Search godoc
+// @Security BearerAuth
+// @Summary Search patients
+// @Description Find patients by partial name, phone number or address, best matches first
+// @Tags patients
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param q query string true "Search text"
+// @Param limit query int false "Maximum results (default 20, max 100)"
+// @Success 200 {object} service.PatientSearchResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients/search [get]
+func (h *PatientHandler) Search(c *gin.Context) {
+    var input service.SearchPatientsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    results, err := h.service.Search(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    ids := make([]uint, 0, len(results.Data))
+    for _, result := range results.Data {
+        ids = append(ids, result.ID)
+    }
+    if !h.recordViews(c, model.AuditPatientSearch, ids) {
+        return
+    }
+
+    c.JSON(http.StatusOK, results)
+}
+
 // Get godoc
 // @Security BearerAuth
 // @Summary Get a patient
 // @Description Get a patient by ID
-// @Tags receptionist,doctor
+// @Tags patients
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param id path int true "Patient ID"
 // @Success 200 {object} service.PatientResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/receptionist/patients/{id} [get]
-// @Router /api/doctor/patients/{id} [get]
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/patients/{id} [get]
 func (h *PatientHandler) Get(c *gin.Context) {
-    id, err := strconv.Atoi(c.Param("id"))
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+    id, ok := pathID(c)
+    if !ok {
         return
     }
 
-    patient, err := h.service.Get(uint(id))
+    patient, err := h.service.Get(id)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+        RespondError(c, err)
+        return
+    }
+    if !h.record(c, model.AuditPatientRead, patient.ID) {
         return
     }
 
+    c.Header("ETag", etag(patient.Version))
     c.JSON(http.StatusOK, patient)
 }
 
 // Update godoc
 // @Security BearerAuth
 // @Summary Update a patient
-// @Description Update a patient's details (receptionist only)
-// @Tags receptionist
+// @Description Update the given fields of a patient (requires patient:write). If-Match is required: send the ETag from a previous GET to reject the update if someone else changed the patient since, or * to update whatever version is current.
+// @Tags patients
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
+// @Param If-Match header string true "ETag of the version being updated, or *"
 // @Param id path int true "Patient ID"
 // @Param patient body service.UpdatePatientInput true "Patient details"
 // @Success 200 {object} service.PatientResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/receptionist/patients/{id} [put]
+// @Header 200 {string} ETag "Version of the updated patient"
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 412 {object} handler.ErrorResponse
+// @Failure 428 {object} handler.ErrorResponse
+// @Router /api/patients/{id} [put]
 func (h *PatientHandler) Update(c *gin.Context) {
-    id, err := strconv.Atoi(c.Param("id"))
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+    id, ok := pathID(c)
+    if !ok {
         return
     }
 
     var input service.UpdatePatientInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        RespondError(c, invalidInput(err))
+        return
+    }
+    expectedVersion, err := ifMatchVersion(c.GetHeader("If-Match"))
+    if err != nil {
+        RespondError(c, err)
         return
     }
 
-    patient, err := h.service.Update(uint(id), input)
+    patient, err := h.service.Update(currentUserID(c), id, expectedVersion, input)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        RespondError(c, err)
         return
     }
 
+    c.Header("ETag", etag(patient.Version))
     c.JSON(http.StatusOK, patient)
 }
 
 // Delete godoc
 // @Security BearerAuth
 // @Summary Delete a patient
-// @Description Delete a patient by ID (receptionist only)
-// @Tags receptionist
+// @Description Delete a patient by ID (requires patient:write)
+// @Tags patients
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param id path int true "Patient ID"
 // @Success 204
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/receptionist/patients/{id} [delete]
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/patients/{id} [delete]
 func (h *PatientHandler) Delete(c *gin.Context) {
-    id, err := strconv.Atoi(c.Param("id"))
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+    id, ok := pathID(c)
+    if !ok {
         return
     }
 
-    if err := h.service.Delete(uint(id)); err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+    if err := h.service.Delete(currentUserID(c), id); err != nil {
+        RespondError(c, err)
         return
     }
 
     c.Status(http.StatusNoContent)
 }
 
-// UpdateMedicalHistory godoc
+// Merge godoc
 // @Security BearerAuth
-// @Summary Update a patient's medical history
-// @Description Update a patient's medical history (doctor only)
-// @Tags doctor
+// @Summary Merge a duplicate patient
+// @Description Fold a duplicate into this patient (requires patient:write). The duplicate's medical history, appointments and identifiers in other systems move here, its contact and address fill in any this patient lacks, and it goes to the trash for good. Both patients' audit trails record the merge. If-Match is required and applies to this patient: send its ETag from a previous GET to reject the merge if someone else changed it since, or * to merge into whatever version is current.
+// @Tags patients
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
-// @Param id path int true "Patient ID"
-// @Param medical_history body service.MedicalHistoryInput true "Medical history"
+// @Param If-Match header string true "ETag of the version being merged into, or *"
+// @Param id path int true "ID of the patient kept"
+// @Param merge body service.MergePatientsInput true "Duplicate to merge"
 // @Success 200 {object} service.PatientResponse
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/doctor/patients/{id} [put]
-func (h *PatientHandler) UpdateMedicalHistory(c *gin.Context) {
-    id, err := strconv.Atoi(c.Param("id"))
+// @Header 200 {string} ETag "Version of the merged patient"
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 412 {object} handler.ErrorResponse
+// @Failure 428 {object} handler.ErrorResponse
+// @Router /api/patients/{id}/merge [post]
+func (h *PatientHandler) Merge(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    var input service.MergePatientsInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    expectedVersion, err := ifMatchVersion(c.GetHeader("If-Match"))
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+        RespondError(c, err)
+        return
+    }
+
+    patient, err := h.service.Merge(currentUserID(c), id, input.DuplicateID, expectedVersion)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Header("ETag", etag(patient.Version))
+    c.JSON(http.StatusOK, patient)
+}
+
+// AddMedicalHistoryEntry godoc
+// @Security BearerAuth
+// @Summary Add a medical history entry
+// @Description Append a diagnosis, allergy, medication, procedure or note to a patient's history, attributed to the caller (requires medical_history:write)
+// @Tags patients
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Param entry body service.MedicalHistoryInput true "History entry"
+// @Success 201 {object} service.MedicalHistoryEntryResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/patients/{id}/medical-history [post]
+func (h *PatientHandler) AddMedicalHistoryEntry(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
         return
     }
 
     var input service.MedicalHistoryInput
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    entry, err := h.service.AddMedicalHistoryEntry(id, currentUserID(c), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, entry)
+}
+
+// ListMedicalHistory godoc
+// @Security BearerAuth
+// @Summary List a patient's medical history
+// @Description Get every medical history entry of a patient, oldest first
+// @Tags patients
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Success 200 {object} service.MedicalHistoryListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/patients/{id}/medical-history [get]
+func (h *PatientHandler) ListMedicalHistory(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
         return
     }
 
-    patient, err := h.service.UpdateMedicalHistory(uint(id), input.MedicalHistory)
+    history, err := h.service.ListMedicalHistory(id)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        RespondError(c, err)
+        return
+    }
+    if !h.record(c, model.AuditMedicalHistoryRead, id) {
         return
     }
 
+    c.JSON(http.StatusOK, history)
+}
+
+// ListDeleted godoc
+// @Security BearerAuth
+// @Summary List deleted patients
+// @Description Get a page of soft-deleted patients, most recently deleted first (requires patient:trash)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Success 200 {object} service.DeletedPatientListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/admin/patients/trash [get]
+func (h *PatientHandler) ListDeleted(c *gin.Context) {
+    var input service.ListDeletedPatientsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    patients, err := h.service.ListDeleted(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    ids := make([]uint, 0, len(patients.Data))
+    for _, patient := range patients.Data {
+        ids = append(ids, patient.ID)
+    }
+    if !h.recordViews(c, model.AuditPatientTrashList, ids) {
+        return
+    }
+
+    c.JSON(http.StatusOK, patients)
+}
+
+// Restore godoc
+// @Security BearerAuth
+// @Summary Restore a deleted patient
+// @Description Take a patient out of the trash (requires patient:trash). A duplicate that was merged into another patient cannot be restored.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Success 200 {object} service.PatientResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/admin/patients/trash/{id}/restore [post]
+func (h *PatientHandler) Restore(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    patient, err := h.service.Restore(currentUserID(c), id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Header("ETag", etag(patient.Version))
     c.JSON(http.StatusOK, patient)
-}
\ No newline at end of file
+}
+
+// Purge godoc
+// @Security BearerAuth
+// @Summary Permanently delete a patient
+// @Description Erase a patient in the trash with its medical history and appointments; this cannot be undone (requires patient:trash)
+// @Tags admin
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Success 204
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/patients/trash/{id} [delete]
+func (h *PatientHandler) Purge(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    if err := h.service.Purge(currentUserID(c), id); err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+func errAuditFailed(err error) error {
+    return &service.Error{Kind: service.KindInternal, Code: "audit_failed", Message: "Failed to record audit log", Err: err}
+}
+
+// exportContentTypes maps export formats to their media types.
+var exportContentTypes = map[string]string{
+    service.ExportCSV:    "text/csv; charset=utf-8",
+    service.ExportNDJSON: "application/x-ndjson",
+}
+
+// Export godoc
+// @Security BearerAuth
+// @Summary Export patients
+// @Description Stream every patient matching the filters as CSV or NDJSON, in ID order (requires patient:export). Each exported patient is audited.
+// @Tags patients
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param Authorization header string true "Bearer token"
+// @Param format query string false "Output format (default csv)" Enums(csv, ndjson)
+// @Param gender query string false "Gender" Enums(Male, Female, Other)
+// @Param dob_from query string false "Earliest date of birth (YYYY-MM-DD)"
+// @Param dob_to query string false "Latest date of birth (YYYY-MM-DD)"
+// @Param name query string false "First or last name prefix"
+// @Success 200 {file} file
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients/export [get]
+func (h *PatientHandler) Export(c *gin.Context) {
+    var input service.ExportPatientsInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+    if input.Format == "" {
+        input.Format = service.ExportCSV
+    }
+
+    c.Header("Content-Type", exportContentTypes[input.Format])
+    c.Header("Content-Disposition", `attachment; filename="patients.`+input.Format+`"`)
+    userID := currentUserID(c)
+    err := h.service.Export(c.Writer, input, func(patientIDs []uint) error {
+        if err := h.audit.RecordViews(userID, model.AuditPatientExport, patientIDs); err != nil {
+            return errAuditFailed(err)
+        }
+        return nil
+    })
+    if err == nil {
+        return
+    }
+    if !c.Writer.Written() {
+        c.Writer.Header().Del("Content-Type")
+        c.Writer.Header().Del("Content-Disposition")
+        RespondError(c, err)
+        return
+    }
+    // The status is already sent; the download simply ends early.
+    c.Error(err)
+    c.Abort()
+}
+
+// Summary godoc
+// @Security BearerAuth
+// @Summary Patient summary PDF
+// @Description Download a PDF of a patient's demographics and medical history, e.g. to give patients a copy of their record
+// @Tags patients
+// @Produce application/pdf
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "Patient ID"
+// @Success 200 {file} file
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 422 {object} handler.ErrorResponse
+// @Failure 500 {object} handler.ErrorResponse
+// @Router /api/patients/{id}/summary.pdf [get]
+func (h *PatientHandler) Summary(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    document, err := h.service.SummaryPDF(id, time.Now())
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+    if !h.record(c, model.AuditPatientSummary, id) {
+        return
+    }
+
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="patient-%d-summary.pdf"`, id))
+    c.Data(http.StatusOK, "application/pdf", document)
+}
+
+// record writes an audit entry for a read by the caller and reports whether
+// the request may proceed. Data is only returned once its access is on
+// record. Writes are audited by PatientService, in their own transaction.
+func (h *PatientHandler) record(c *gin.Context, action string, patientID uint) bool {
+    if err := h.audit.Record(currentUserID(c), action, patientID, nil, nil); err != nil {
+        RespondError(c, errAuditFailed(err))
+        return false
+    }
+    return true
+}
+
+func (h *PatientHandler) recordViews(c *gin.Context, action string, patientIDs []uint) bool {
+    if err := h.audit.RecordViews(currentUserID(c), action, patientIDs); err != nil {
+        RespondError(c, errAuditFailed(err))
+        return false
+    }
+    return true
+}
@@ -0,0 +1,332 @@
+package handler
+
+import (
+    "net/http"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/service"
+)
+
+type UserHandler struct {
+    service *service.UserService
+}
+
+func NewUserHandler(service *service.UserService) *UserHandler {
+    return &UserHandler{service: service}
+}
+
+// Create godoc
+// @Security BearerAuth
+// @Summary Create a user
+// @Description Create a user with one or more roles (requires user:manage). Passwords need 12 to 72 characters with upper and lower case letters and a digit.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param user body service.CreateUserInput true "User data"
+// @Success 201 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/admin/users [post]
+func (h *UserHandler) Create(c *gin.Context) {
+    var input service.CreateUserInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    user, err := h.service.Create(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusCreated, user)
+}
+
+// List godoc
+// @Security BearerAuth
+// @Summary List users
+// @Description Get a page of users ordered by ID (requires user:manage)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param page query int false "Page number" minimum(1) default(1)
+// @Param limit query int false "Page size" minimum(1) maximum(100) default(20)
+// @Param role query string false "Only users with this role"
+// @Param status query string false "Account status" Enums(active, inactive)
+// @Success 200 {object} service.UserListResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/admin/users [get]
+func (h *UserHandler) List(c *gin.Context) {
+    var input service.ListUsersInput
+    if err := c.ShouldBindQuery(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    users, err := h.service.List(input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, users)
+}
+
+// Get godoc
+// @Security BearerAuth
+// @Summary Get a user
+// @Description Get a user by ID (requires user:manage)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Success 200 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id} [get]
+func (h *UserHandler) Get(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    user, err := h.service.Get(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// Update godoc
+// @Security BearerAuth
+// @Summary Update a user
+// @Description Change a user's email and roles; given roles replace the current ones and end the user's sessions. Admins cannot remove the admin role from themselves or from the last active admin (requires user:manage)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Param user body service.UpdateUserInput true "User data"
+// @Success 200 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Failure 409 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id} [put]
+func (h *UserHandler) Update(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    var input service.UpdateUserInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    user, err := h.service.Update(currentUserID(c), id, input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// Deactivate godoc
+// @Security BearerAuth
+// @Summary Deactivate a user
+// @Description Disable a user's account and revoke all of their sessions (requires user:manage)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Success 200 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id}/deactivate [post]
+func (h *UserHandler) Deactivate(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    user, err := h.service.Deactivate(currentUserID(c), id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// Activate godoc
+// @Security BearerAuth
+// @Summary Reactivate a user
+// @Description Re-enable a deactivated account (requires user:manage)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Success 200 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id}/activate [post]
+func (h *UserHandler) Activate(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    user, err := h.service.Activate(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// ResetPassword godoc
+// @Security BearerAuth
+// @Summary Reset a user's password
+// @Description Set a new password and revoke all of the user's sessions (requires user:manage)
+// @Tags admin
+// @Accept json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Param password body service.ResetPasswordInput true "New password"
+// @Success 204
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id}/password [put]
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    var input service.ResetPasswordInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    if err := h.service.ResetPassword(id, input); err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.Status(http.StatusNoContent)
+}
+
+// ResetTwoFactor godoc
+// @Security BearerAuth
+// @Summary Reset a user's two-factor authentication
+// @Description Turn off a user's two-factor authentication, discarding their authenticator secret and recovery codes, and revoke all of their sessions (requires user:manage). If a role of theirs requires it, they enroll again on their next login.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path int true "User ID"
+// @Success 200 {object} service.UserResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/users/{id}/2fa [delete]
+func (h *UserHandler) ResetTwoFactor(c *gin.Context) {
+    id, ok := pathID(c)
+    if !ok {
+        return
+    }
+
+    user, err := h.service.ResetTwoFactor(id)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, user)
+}
+
+// ListRoles godoc
+// @Security BearerAuth
+// @Summary List roles
+// @Description Get every role with its permissions and two-factor policy (requires user:manage)
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} service.RoleResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Router /api/admin/roles [get]
+func (h *UserHandler) ListRoles(c *gin.Context) {
+    roles, err := h.service.ListRoles()
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, roles)
+}
+
+// UpdateRole godoc
+// @Security BearerAuth
+// @Summary Update a role's two-factor policy
+// @Description Require or stop requiring two-factor authentication for every holder of a role (requires user:manage). Turning it on signs out every holder who has not enrolled, so they enroll on their next login.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param name path string true "Role name"
+// @Param role body service.UpdateRoleInput true "Role policy"
+// @Success 200 {object} service.RoleResponse
+// @Failure 400 {object} handler.ErrorResponse
+// @Failure 401 {object} handler.ErrorResponse
+// @Failure 403 {object} handler.ErrorResponse
+// @Failure 404 {object} handler.ErrorResponse
+// @Router /api/admin/roles/{name} [put]
+func (h *UserHandler) UpdateRole(c *gin.Context) {
+    var input service.UpdateRoleInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        RespondError(c, invalidInput(err))
+        return
+    }
+
+    role, err := h.service.UpdateRole(c.Param("name"), input)
+    if err != nil {
+        RespondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, role)
+}
+
+// currentUserID is the ID of the authenticated caller, as stored by
+// middleware.Authenticate.
+func currentUserID(c *gin.Context) uint {
+    // JSON numbers in the token claims decode as float64.
+    id, _ := c.Get("user_id")
+    if value, ok := id.(float64); ok {
+        return uint(value)
+    }
+    return 0
+}
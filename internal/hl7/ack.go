@@ -0,0 +1,117 @@
+package hl7
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Acknowledgement codes (MSA-1), in original acknowledgement mode.
+const (
+    // AckAccept: the message was applied.
+    AckAccept = "AA"
+    // AckError: the message could not be applied, e.g. a required field is
+    // missing. Sending it again unchanged will not help.
+    AckError = "AE"
+    // AckReject: the message was not even considered, e.g. its type is not
+    // supported or it cannot be parsed.
+    AckReject = "AR"
+)
+
+// Error codes from HL7 table 0357, sent in ERR-3.
+const (
+    ErrRequiredFieldMissing   = 101
+    ErrDataTypeError          = 102
+    ErrTableValueNotFound     = 103
+    ErrUnsupportedMessageType = 200
+    ErrUnsupportedEventCode   = 201
+    ErrUnknownKeyIdentifier   = 204
+    ErrApplicationInternal    = 207
+)
+
+var errorCodeText = map[int]string{
+    ErrRequiredFieldMissing:   "Required field missing",
+    ErrDataTypeError:          "Data type error",
+    ErrTableValueNotFound:     "Table value not found",
+    ErrUnsupportedMessageType: "Unsupported message type",
+    ErrUnsupportedEventCode:   "Unsupported event code",
+    ErrUnknownKeyIdentifier:   "Unknown key identifier",
+    ErrApplicationInternal:    "Application internal error",
+}
+
+// Issue is one problem reported in an ERR segment. Location is a segment
+// and field such as "PID-7", or "" for the message as a whole.
+type Issue struct {
+    Location string
+    Code     int
+    Text     string
+}
+
+func (i Issue) String() string {
+    if i.Location == "" {
+        return i.Text
+    }
+    return i.Location + ": " + i.Text
+}
+
+// ACK builds the acknowledgement of message with code and one ERR segment
+// per issue. It is addressed back to the sender, with the version and
+// processing ID the message used. message may be nil when it could not be
+// parsed, and the ACK then has no control ID to refer to.
+func ACK(message *Message, code string, issues ...Issue) []byte {
+    if message == nil {
+        message = &Message{Delimiters: DefaultDelimiters}
+    }
+    d := message.Delimiters
+    msh := message.Segment("MSH")
+    version := msh.Field(12)
+    if version == "" {
+        version = "2.5.1"
+    }
+    processingID := msh.Field(11)
+    if processingID == "" {
+        processingID = "P"
+    }
+    component := string(d.Component)
+
+    header := []string{
+        "MSH",
+        string([]byte{d.Component, d.Repetition, d.Escape, d.Subcomponent}),
+        msh.Field(5),
+        msh.Field(6),
+        msh.Field(3),
+        msh.Field(4),
+        time.Now().UTC().Format("20060102150405") + "+0000",
+        "",
+        "ACK" + component + message.Value("MSH", 9, 2) + component + "ACK",
+        controlID(),
+        processingID,
+        version,
+    }
+    text := ""
+    if len(issues) > 0 {
+        text = issues[0].Text
+    }
+    segments := []string{
+        strings.Join(header, string(d.Field)),
+        strings.Join([]string{"MSA", code, msh.Field(10), d.Escaped(text)}, string(d.Field)),
+    }
+    for _, issue := range issues {
+        location := ""
+        if name, field, ok := strings.Cut(issue.Location, "-"); ok {
+            location = name + component + "1" + component + field
+        }
+        errorCode := strconv.Itoa(issue.Code) + component + errorCodeText[issue.Code] + component + "HL70357"
+        segments = append(segments, strings.Join([]string{"ERR", "", location, errorCode, "E", "", "", "", d.Escaped(issue.Text)}, string(d.Field)))
+    }
+    return []byte(strings.Join(segments, "\r"))
+}
+
+// controlID is a fresh message control ID for an ACK (MSH-10).
+func controlID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
@@ -0,0 +1,263 @@
+package hl7
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+    "makerble-assessment/internal/service"
+)
+
+// Events are the ADT trigger events applied to patients: admit (A01),
+// register (A04) and update patient information (A08). Each creates the
+// patient if the identifier is new and updates it otherwise, so a message
+// sent twice does no harm.
+var Events = map[string]bool{"A01": true, "A04": true, "A08": true}
+
+// hl7Null is how HL7 says "delete the value"; an empty field means
+// "unchanged".
+const hl7Null = `""`
+
+// sexes maps administrative sex (HL7 table 0001) to stored genders. U
+// (unknown) and N (not applicable) have no stored equivalent.
+var sexes = map[string]string{"M": "Male", "F": "Female", "O": "Other", "A": "Other"}
+
+// Ingester applies ADT messages to patients through the patient service.
+// Messages that parse but cannot be applied, and data that does not parse
+// at all, are kept as dead letters so they can be reprocessed. Writes are
+// audited as user 0, like other system changes.
+type Ingester struct {
+    patients    *service.PatientService
+    deadLetters *service.DeadLetterService
+}
+
+func NewIngester(patients *service.PatientService, deadLetters *service.DeadLetterService) *Ingester {
+    return &Ingester{patients: patients, deadLetters: deadLetters}
+}
+
+// rejection is why a message was not applied, as reported in its ACK.
+type rejection struct {
+    code   string
+    issues []Issue
+    // keep marks messages worth reprocessing; unsupported message types are
+    // refused for good.
+    keep bool
+}
+
+func (r *rejection) Error() string {
+    texts := make([]string, 0, len(r.issues))
+    for _, issue := range r.issues {
+        texts = append(texts, issue.String())
+    }
+    return strings.Join(texts, "; ")
+}
+
+// HandleMessage applies one message and returns its ACK: AA when applied,
+// AE when it could not be, AR when it was refused.
+func (i *Ingester) HandleMessage(source string, data []byte) []byte {
+    message, err := i.apply(data)
+    var rejected *rejection
+    if !errors.As(err, &rejected) {
+        return ACK(message, AckAccept)
+    }
+
+    if rejected.keep {
+        if err := i.deadLetters.Record(source, data, rejected.Error()); err != nil {
+            log.Printf("Failed to keep HL7 message from %s as a dead letter: %v", source, err)
+        }
+    }
+    log.Printf("HL7 message from %s not applied: %v", source, rejected)
+    return ACK(message, rejected.code, rejected.issues...)
+}
+
+// Reprocess applies the dead letters with the given IDs again, or all of
+// them when there are none. Those that go through are removed.
+func (i *Ingester) Reprocess(ids ...uint) ([]service.RetryResult, error) {
+    return i.deadLetters.Retry(func(data []byte) error {
+        _, err := i.apply(data)
+        return err
+    }, ids...)
+}
+
+// apply parses data and saves the patient in its PID segment. It returns
+// the parsed message, if any, for the ACK, and a *rejection unless the
+// patient was saved.
+func (i *Ingester) apply(data []byte) (*Message, error) {
+    message, err := Parse(data)
+    if err != nil {
+        return nil, &rejection{code: AckReject, keep: true, issues: []Issue{{Location: "MSH-1", Code: ErrDataTypeError, Text: err.Error()}}}
+    }
+
+    messageType, event := message.Value("MSH", 9, 1), message.Value("MSH", 9, 2)
+    if messageType != "ADT" {
+        return message, &rejection{code: AckReject, issues: []Issue{{Location: "MSH-9", Code: ErrUnsupportedMessageType, Text: fmt.Sprintf("message type %s is not supported", messageType)}}}
+    }
+    if !Events[event] {
+        return message, &rejection{code: AckReject, issues: []Issue{{Location: "MSH-9", Code: ErrUnsupportedEventCode, Text: fmt.Sprintf("event %s is not supported; only A01, A04 and A08 are", event)}}}
+    }
+
+    identifier, input, clear, issues := PatientFromPID(message)
+    if len(issues) > 0 {
+        return message, &rejection{code: AckError, keep: true, issues: issues}
+    }
+    if _, _, err := i.patients.SaveByIdentifier(0, identifier, input, clear...); err != nil {
+        serviceErr := service.AsError(err)
+        issue := Issue{Code: ErrApplicationInternal, Text: serviceErr.Message}
+        switch serviceErr.Kind {
+        case service.KindNotFound:
+            // The patient linked to the identifier is in the trash.
+            issue = Issue{Location: "PID-3", Code: ErrUnknownKeyIdentifier, Text: "the patient with this identifier has been deleted"}
+        case service.KindValidation:
+            issue.Code = ErrDataTypeError
+        case service.KindInternal:
+            log.Printf("Failed to save patient from HL7 message: %v", err)
+        }
+        return message, &rejection{code: AckError, keep: true, issues: []Issue{issue}}
+    }
+    return message, nil
+}
+
+// PatientFromPID reads the patient from the PID segment of an ADT message:
+//
+//   - PID-3, the identifier: the first repetition with identifier type MR
+//     (medical record number), or else the first. It is issued by its
+//     assigning authority, or by the sending facility (MSH-4) when that is
+//     empty.
+//   - PID-5, the name: the legal name (type L), or else the first; middle
+//     names are kept with the given name.
+//   - PID-7, the date of birth, of which only the date is kept.
+//   - PID-8, administrative sex: M, F, O or A (ambiguous, stored as Other).
+//   - PID-13 (or PID-14 when empty), the first phone number that is not an
+//     email address.
+//   - PID-11, the first address, its parts joined with commas.
+//
+// Empty phone and address fields leave the stored values alone on update;
+// "" (the HL7 null) clears them, and they are returned in clear.
+func PatientFromPID(message *Message) (service.PatientIdentifier, service.CreatePatientInput, []string, []Issue) {
+    var issues []Issue
+    pid := message.Segment("PID")
+    if pid == nil {
+        return service.PatientIdentifier{}, service.CreatePatientInput{}, nil, []Issue{{Location: "PID", Code: ErrRequiredFieldMissing, Text: "PID segment is missing"}}
+    }
+
+    identifier := service.PatientIdentifier{}
+    for n, repetition := range message.Repetitions(pid.Field(3)) {
+        if n == 0 || message.Component(repetition, 5) == "MR" {
+            identifier.Value = message.Component(repetition, 1)
+            identifier.System = message.Component(repetition, 4)
+        }
+        if message.Component(repetition, 5) == "MR" {
+            break
+        }
+    }
+    if identifier.System == "" {
+        identifier.System = message.Value("MSH", 4, 1)
+    }
+    switch {
+    case identifier.Value == "":
+        issues = append(issues, Issue{Location: "PID-3", Code: ErrRequiredFieldMissing, Text: "patient identifier is required"})
+    case identifier.System == "":
+        issues = append(issues, Issue{Location: "PID-3", Code: ErrRequiredFieldMissing, Text: "assigning authority or sending facility (MSH-4) is required"})
+    case len(identifier.Value) > 64 || len(identifier.System) > 64:
+        issues = append(issues, Issue{Location: "PID-3", Code: ErrDataTypeError, Text: "identifier and assigning authority must be at most 64 characters"})
+    }
+
+    var input service.CreatePatientInput
+    names := message.Repetitions(pid.Field(5))
+    for n, repetition := range names {
+        if n == 0 || message.Component(repetition, 7) == "L" {
+            input.LastName = message.Component(repetition, 1)
+            input.FirstName = strings.TrimSpace(message.Component(repetition, 2) + " " + message.Component(repetition, 3))
+        }
+        if message.Component(repetition, 7) == "L" {
+            break
+        }
+    }
+    if input.LastName == "" || input.FirstName == "" {
+        issues = append(issues, Issue{Location: "PID-5", Code: ErrRequiredFieldMissing, Text: "family and given name are required"})
+    }
+
+    if dob, err := parseDate(message.Value("PID", 7, 1)); err != nil {
+        issues = append(issues, Issue{Location: "PID-7", Code: ErrDataTypeError, Text: "date of birth must start with YYYYMMDD"})
+    } else {
+        input.DateOfBirth = dob.Format(time.RFC3339)
+    }
+
+    sex := message.Value("PID", 8, 1)
+    if gender, ok := sexes[sex]; ok {
+        input.Gender = gender
+    } else {
+        issues = append(issues, Issue{Location: "PID-8", Code: ErrTableValueNotFound, Text: "administrative sex must be M, F, O or A"})
+    }
+
+    var clear []string
+    phones := pid.Field(13)
+    if phones == "" {
+        phones = pid.Field(14)
+    }
+    if phones == hl7Null {
+        clear = append(clear, "contact")
+    }
+    for _, repetition := range message.Repetitions(phones) {
+        if equipment := message.Component(repetition, 3); equipment == "Internet" || equipment == "X.400" {
+            continue
+        }
+        if input.Contact = phoneNumber(message, repetition); input.Contact != "" {
+            break
+        }
+    }
+
+    address := pid.Field(11)
+    if address == hl7Null {
+        clear = append(clear, "address")
+    }
+    if repetitions := message.Repetitions(address); len(repetitions) > 0 && address != hl7Null {
+        var parts []string
+        for n := 1; n <= 6; n++ {
+            if part := strings.TrimSpace(message.Component(repetitions[0], n)); part != "" {
+                parts = append(parts, part)
+            }
+        }
+        input.Address = strings.Join(parts, ", ")
+    }
+
+    if len(issues) > 0 {
+        return service.PatientIdentifier{}, service.CreatePatientInput{}, nil, issues
+    }
+    return identifier, input, clear, nil
+}
+
+// parseDate reads the date part of an HL7 DT or DTM value
+// (YYYYMMDD[HHMM[SS[.S]]][+/-ZZZZ]).
+func parseDate(value string) (time.Time, error) {
+    if len(value) < 8 {
+        return time.Time{}, fmt.Errorf("date %q is too short", value)
+    }
+    return time.Parse("20060102", value[:8])
+}
+
+// phoneNumber reads an XTN repetition: the number as sent (XTN-1), or else
+// the unformatted number (XTN-12), or else one built from its parts.
+func phoneNumber(message *Message, repetition string) string {
+    if number := strings.TrimSpace(message.Component(repetition, 1)); number != "" && number != hl7Null {
+        return number
+    }
+    if number := message.Component(repetition, 12); number != "" {
+        return number
+    }
+    var parts []string
+    for _, n := range []int{5, 6, 7} {
+        if part := message.Component(repetition, n); part != "" {
+            parts = append(parts, part)
+        }
+    }
+    if country := message.Component(repetition, 5); country != "" && !strings.HasPrefix(country, "+") {
+        parts[0] = "+" + country
+    }
+    number := strings.Join(parts, " ")
+    if extension := message.Component(repetition, 8); extension != "" && number != "" {
+        number += " x" + extension
+    }
+    return number
+}
@@ -0,0 +1,189 @@
+// Package hl7 receives HL7 v2 messages over MLLP and applies ADT patient
+// registrations and updates through the patient service. Only what that
+// needs is implemented: parsing segments, fields, repetitions and
+// components with the delimiters a message declares, and building ACKs.
+package hl7
+
+import (
+    "errors"
+    "strings"
+)
+
+// ErrNoHeader is returned by Parse for data that does not start with a
+// usable MSH segment.
+var ErrNoHeader = errors.New("message does not start with an MSH segment")
+
+// Delimiters are the separators a message declares in MSH-1 and MSH-2.
+type Delimiters struct {
+    Field        byte
+    Component    byte
+    Repetition   byte
+    Escape       byte
+    Subcomponent byte
+}
+
+// DefaultDelimiters are the ones nearly every sender uses: |^~\&.
+var DefaultDelimiters = Delimiters{Field: '|', Component: '^', Repetition: '~', Escape: '\\', Subcomponent: '&'}
+
+// Segment is one line of a message. Fields are indexed by their HL7
+// sequence number, so Fields[3] is e.g. PID-3; Fields[0] is the segment
+// name. For MSH, Fields[1] is the field separator itself, as in the
+// standard.
+type Segment struct {
+    Name   string
+    Fields []string
+}
+
+// Message is a parsed HL7 v2 message.
+type Message struct {
+    Delimiters Delimiters
+    Segments   []Segment
+}
+
+// Parse splits a message into segments and fields. Segments end with a
+// carriage return; line feeds are accepted too, as messages saved to files
+// often have them. Field values are kept escaped until read.
+func Parse(data []byte) (*Message, error) {
+    text := strings.TrimSpace(strings.NewReplacer("\r\n", "\r", "\n", "\r").Replace(string(data)))
+    if len(text) < 8 || !strings.HasPrefix(text, "MSH") {
+        return nil, ErrNoHeader
+    }
+
+    d := Delimiters{Field: text[3], Component: text[4], Repetition: text[5], Escape: text[6], Subcomponent: text[7]}
+    seen := map[byte]bool{}
+    for _, c := range []byte{d.Field, d.Component, d.Repetition, d.Escape, d.Subcomponent} {
+        if seen[c] || c == '\r' || c == ' ' || isAlphanumeric(c) {
+            return nil, ErrNoHeader
+        }
+        seen[c] = true
+    }
+
+    message := &Message{Delimiters: d}
+    for _, line := range strings.Split(text, "\r") {
+        if line = strings.TrimSpace(line); line == "" {
+            continue
+        }
+        fields := strings.Split(line, string(d.Field))
+        if len(message.Segments) == 0 {
+            // MSH-1 is the separator between "MSH" and MSH-2.
+            fields = append([]string{"MSH", string(d.Field)}, fields[1:]...)
+        }
+        message.Segments = append(message.Segments, Segment{Name: fields[0], Fields: fields})
+    }
+    return message, nil
+}
+
+func isAlphanumeric(c byte) bool {
+    return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Segment returns the first segment called name, or nil.
+func (m *Message) Segment(name string) *Segment {
+    for i := range m.Segments {
+        if m.Segments[i].Name == name {
+            return &m.Segments[i]
+        }
+    }
+    return nil
+}
+
+// Field returns field n of s as sent, still escaped, or "" when the segment
+// is shorter.
+func (s *Segment) Field(n int) string {
+    if s == nil || n < 0 || n >= len(s.Fields) {
+        return ""
+    }
+    return s.Fields[n]
+}
+
+// Repetitions splits a field into its repetitions.
+func (m *Message) Repetitions(field string) []string {
+    if field == "" {
+        return nil
+    }
+    return strings.Split(field, string(m.Delimiters.Repetition))
+}
+
+// Component returns component n (from 1) of one repetition, unescaped. Of a
+// component with subcomponents only the first is returned.
+func (m *Message) Component(repetition string, n int) string {
+    components := strings.Split(repetition, string(m.Delimiters.Component))
+    if n < 1 || n > len(components) {
+        return ""
+    }
+    subcomponent, _, _ := strings.Cut(components[n-1], string(m.Delimiters.Subcomponent))
+    return m.Unescape(subcomponent)
+}
+
+// Value returns component n of the first repetition of field in the first
+// segment called segment, e.g. Value("MSH", 9, 2) for the trigger event.
+func (m *Message) Value(segment string, field, component int) string {
+    repetitions := m.Repetitions(m.Segment(segment).Field(field))
+    if len(repetitions) == 0 {
+        return ""
+    }
+    return m.Component(repetitions[0], component)
+}
+
+// Unescape replaces the escape sequences for delimiters (\F\, \S\, \T\, \R\
+// and \E\) with the characters they stand for. Formatting and other escape
+// sequences are dropped.
+func (m *Message) Unescape(value string) string {
+    e := string(m.Delimiters.Escape)
+    if !strings.Contains(value, e) {
+        return value
+    }
+
+    var b strings.Builder
+    for {
+        start := strings.Index(value, e)
+        if start < 0 {
+            break
+        }
+        end := strings.Index(value[start+1:], e)
+        if end < 0 {
+            break
+        }
+        b.WriteString(value[:start])
+        switch value[start+1 : start+1+end] {
+        case "F":
+            b.WriteByte(m.Delimiters.Field)
+        case "S":
+            b.WriteByte(m.Delimiters.Component)
+        case "T":
+            b.WriteByte(m.Delimiters.Subcomponent)
+        case "R":
+            b.WriteByte(m.Delimiters.Repetition)
+        case "E":
+            b.WriteByte(m.Delimiters.Escape)
+        }
+        value = value[start+end+2:]
+    }
+    b.WriteString(value)
+    return b.String()
+}
+
+// Escaped is the inverse of Unescape, for values written into a message.
+// Line breaks become spaces, since they would end the segment.
+func (d Delimiters) Escaped(value string) string {
+    var b strings.Builder
+    for i := 0; i < len(value); i++ {
+        switch c := value[i]; c {
+        case d.Escape:
+            b.WriteString(string(d.Escape) + "E" + string(d.Escape))
+        case d.Field:
+            b.WriteString(string(d.Escape) + "F" + string(d.Escape))
+        case d.Component:
+            b.WriteString(string(d.Escape) + "S" + string(d.Escape))
+        case d.Subcomponent:
+            b.WriteString(string(d.Escape) + "T" + string(d.Escape))
+        case d.Repetition:
+            b.WriteString(string(d.Escape) + "R" + string(d.Escape))
+        case '\r', '\n':
+            b.WriteByte(' ')
+        default:
+            b.WriteByte(c)
+        }
+    }
+    return b.String()
+}
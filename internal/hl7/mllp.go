@@ -0,0 +1,107 @@
+package hl7
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "time"
+)
+
+// MLLP frames each message as <VT> message <FS><CR>.
+const (
+    startBlock = 0x0b
+    endBlock   = 0x1c
+    trailer    = 0x0d
+)
+
+// DefaultMaxMessageSize caps the size of one framed message.
+const DefaultMaxMessageSize = 1 << 20
+
+// ErrMessageTooLarge is returned by ReadMessage for a frame over the limit.
+var ErrMessageTooLarge = errors.New("mllp message too large")
+
+// ReadMessage reads the next framed message from r and returns it without
+// its framing. Bytes before the start block, such as keep-alive line breaks,
+// are skipped. It returns io.EOF when r ends between messages.
+func ReadMessage(r *bufio.Reader, maxSize int) ([]byte, error) {
+    for {
+        b, err := r.ReadByte()
+        if err != nil {
+            return nil, err
+        }
+        if b == startBlock {
+            break
+        }
+    }
+
+    var message []byte
+    for {
+        chunk, err := r.ReadSlice(endBlock)
+        if len(message)+len(chunk) > maxSize+1 {
+            return nil, ErrMessageTooLarge
+        }
+        message = append(message, chunk...)
+        if err == nil {
+            break
+        }
+        if errors.Is(err, bufio.ErrBufferFull) {
+            continue
+        }
+        if errors.Is(err, io.EOF) {
+            return nil, io.ErrUnexpectedEOF
+        }
+        return nil, err
+    }
+    if b, err := r.ReadByte(); err != nil || b != trailer {
+        return nil, fmt.Errorf("mllp frame not terminated by a carriage return")
+    }
+    return message[:len(message)-1], nil
+}
+
+// WriteMessage writes message to w in an MLLP frame.
+func WriteMessage(w io.Writer, message []byte) error {
+    frame := make([]byte, 0, len(message)+3)
+    frame = append(frame, startBlock)
+    frame = append(frame, message...)
+    frame = append(frame, endBlock, trailer)
+    _, err := w.Write(frame)
+    return err
+}
+
+// Client sends messages to an MLLP listener and waits for their
+// acknowledgements, one at a time.
+type Client struct {
+    conn    net.Conn
+    reader  *bufio.Reader
+    timeout time.Duration
+}
+
+// Dial connects to the MLLP listener at addr. timeout bounds the connection
+// and each exchange; 0 means none.
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+    conn, err := net.DialTimeout("tcp", addr, timeout)
+    if err != nil {
+        return nil, err
+    }
+    return &Client{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Send sends message, with its segments separated by carriage returns or
+// line breaks, and returns the reply.
+func (c *Client) Send(message []byte) ([]byte, error) {
+    if c.timeout > 0 {
+        c.conn.SetDeadline(time.Now().Add(c.timeout))
+    }
+    message = bytes.TrimSpace(bytes.ReplaceAll(bytes.ReplaceAll(message, []byte("\r\n"), []byte("\r")), []byte("\n"), []byte("\r")))
+    if err := WriteMessage(c.conn, message); err != nil {
+        return nil, err
+    }
+    return ReadMessage(c.reader, DefaultMaxMessageSize)
+}
+
+func (c *Client) Close() error {
+    return c.conn.Close()
+}
@@ -0,0 +1,156 @@
+package hl7
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "log"
+    "net"
+    "sync"
+    "time"
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("hl7: server closed")
+
+// Config sets where and how the MLLP listener runs. An empty Addr disables
+// it.
+type Config struct {
+    Addr           string
+    IdleTimeout    time.Duration
+    MaxMessageSize int
+}
+
+func DefaultConfig() Config {
+    return Config{IdleTimeout: 5 * time.Minute, MaxMessageSize: DefaultMaxMessageSize}
+}
+
+// Handler turns a received message into the reply to send back; source is
+// the sender's address.
+type Handler interface {
+    HandleMessage(source string, message []byte) []byte
+}
+
+// Server accepts MLLP connections and answers each message on a connection
+// in turn, as MLLP senders expect. MLLP has no authentication, so listen
+// only where the sending systems, and nothing else, can connect.
+type Server struct {
+    Handler Handler
+    // IdleTimeout closes connections that send nothing for that long; 0
+    // keeps them open.
+    IdleTimeout time.Duration
+    // MaxMessageSize defaults to DefaultMaxMessageSize. A connection that
+    // sends a larger message is closed.
+    MaxMessageSize int
+
+    mu       sync.Mutex
+    listener net.Listener
+    conns    map[net.Conn]struct{}
+    closed   bool
+}
+
+// ListenAndServe listens on the TCP address addr and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    return s.Serve(listener)
+}
+
+// Serve accepts connections on listener until Close is called.
+func (s *Server) Serve(listener net.Listener) error {
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        listener.Close()
+        return ErrServerClosed
+    }
+    s.listener = listener
+    s.mu.Unlock()
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            s.mu.Lock()
+            closed := s.closed
+            s.mu.Unlock()
+            if closed {
+                return ErrServerClosed
+            }
+            var netErr net.Error
+            if errors.As(err, &netErr) && netErr.Timeout() {
+                time.Sleep(10 * time.Millisecond)
+                continue
+            }
+            return err
+        }
+        if !s.track(conn) {
+            conn.Close()
+            return ErrServerClosed
+        }
+        go s.serveConn(conn)
+    }
+}
+
+// Close stops accepting connections and closes the open ones.
+func (s *Server) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.closed = true
+    var err error
+    if s.listener != nil {
+        err = s.listener.Close()
+    }
+    for conn := range s.conns {
+        conn.Close()
+    }
+    return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.closed {
+        return false
+    }
+    if s.conns == nil {
+        s.conns = make(map[net.Conn]struct{})
+    }
+    s.conns[conn] = struct{}{}
+    return true
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+    defer func() {
+        conn.Close()
+        s.mu.Lock()
+        delete(s.conns, conn)
+        s.mu.Unlock()
+    }()
+
+    maxSize := s.MaxMessageSize
+    if maxSize <= 0 {
+        maxSize = DefaultMaxMessageSize
+    }
+    source := conn.RemoteAddr().String()
+    reader := bufio.NewReader(conn)
+    for {
+        if s.IdleTimeout > 0 {
+            conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+        }
+        message, err := ReadMessage(reader, maxSize)
+        if err != nil {
+            if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+                log.Printf("HL7 connection from %s closed: %v", source, err)
+            }
+            return
+        }
+        if err := WriteMessage(conn, s.Handler.HandleMessage(source, message)); err != nil {
+            log.Printf("HL7 connection from %s closed: %v", source, err)
+            return
+        }
+    }
+}
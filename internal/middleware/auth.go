@@ -1,18 +1,26 @@
 package middleware
 
 import (
-    "net/http"
     "strings"
     "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/handler"
     "makerble-assessment/internal/service"
 )
 
-func AuthMiddleware(authService *service.AuthService, requiredRole string) gin.HandlerFunc {
+var errForbidden = &service.Error{Kind: service.KindForbidden, Code: "forbidden", Message: "Insufficient permissions"}
+
+func unauthorized(message string) error {
+    return &service.Error{Kind: service.KindUnauthorized, Code: "unauthorized", Message: message}
+}
+
+// Authenticate validates the bearer token and stores the caller's user_id,
+// roles and permissions in the context for the handlers and
+// RequirePermission.
+func Authenticate(authService *service.AuthService) gin.HandlerFunc {
     return func(c *gin.Context) {
         authHeader := c.GetHeader("Authorization")
         if authHeader == "" {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-            c.Abort()
+            handler.RespondError(c, unauthorized("Authorization header required"))
             return
         }
 
@@ -21,26 +29,51 @@ func AuthMiddleware(authService *service.AuthService, requiredRole string) gin.H
         if len(parts) == 2 && parts[0] == "Bearer" {
             token = parts[1]
         } else if len(parts) != 1 {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header"})
-            c.Abort()
+            handler.RespondError(c, unauthorized("Invalid authorization header"))
             return
         }
 
         claims, err := authService.ValidateToken(token)
         if err != nil {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-            c.Abort()
+            handler.RespondError(c, err)
             return
         }
 
-        role, ok := claims["role"].(string)
-        if !ok || role != requiredRole {
-            c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-            c.Abort()
-            return
+        c.Set("user_id", claims["user_id"])
+        c.Set("roles", claimStrings(claims["roles"]))
+        c.Set("permissions", claimStrings(claims["permissions"]))
+        c.Next()
+    }
+}
+
+// RequirePermission lets the request through only if the authenticated
+// caller holds every listed permission. It must run after Authenticate.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        granted := make(map[string]bool)
+        for _, permission := range c.GetStringSlice("permissions") {
+            granted[permission] = true
         }
 
-        c.Set("user_id", claims["user_id"])
+        for _, permission := range permissions {
+            if !granted[permission] {
+                handler.RespondError(c, errForbidden)
+                return
+            }
+        }
         c.Next()
     }
-}
\ No newline at end of file
+}
+
+// claimStrings converts a JSON array claim to a string slice, dropping any
+// non-string entries.
+func claimStrings(claim interface{}) []string {
+    values, _ := claim.([]interface{})
+    result := make([]string, 0, len(values))
+    for _, value := range values {
+        if s, ok := value.(string); ok {
+            result = append(result, s)
+        }
+    }
+    return result
+}
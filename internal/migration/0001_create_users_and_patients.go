@@ -0,0 +1,51 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type user0001 struct {
+    gorm.Model
+    Email    string `gorm:"unique;not null"`
+    Password string `gorm:"not null"`
+    Role     string `gorm:"not null"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type patient0001 struct {
+    gorm.Model
+    FirstName      string    `gorm:"not null"`
+    LastName       string    `gorm:"not null"`
+    DateOfBirth    time.Time `gorm:"not null"`
+    Gender         string    `gorm:"not null"`
+    Contact        string
+    Address        string
+    MedicalHistory string
+}
+
+func (patient0001) TableName() string { return "patients" }
+
+func init() {
+    register(Migration{
+        Version: 1,
+        Name:    "create_users_and_patients",
+        Up: func(tx *gorm.DB) error {
+            // Databases created by the old AutoMigrate call already have
+            // these tables, so only create what is missing.
+            for _, table := range []interface{}{&user0001{}, &patient0001{}} {
+                if tx.Migrator().HasTable(table) {
+                    continue
+                }
+                if err := tx.Migrator().CreateTable(table); err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&patient0001{}, &user0001{})
+        },
+    })
+}
@@ -0,0 +1,39 @@
+package migration
+
+import (
+    "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+)
+
+var defaultUsers0002 = []user0001{
+    {Email: "recep@example.com", Role: "receptionist"},
+    {Email: "doc@example.com", Role: "doctor"},
+}
+
+func init() {
+    register(Migration{
+        Version: 2,
+        Name:    "seed_default_users",
+        Up: func(tx *gorm.DB) error {
+            password, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+            if err != nil {
+                return err
+            }
+
+            for _, user := range defaultUsers0002 {
+                user.Password = string(password)
+                if err := tx.Where(user0001{Email: user.Email}).FirstOrCreate(&user).Error; err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            emails := make([]string, 0, len(defaultUsers0002))
+            for _, user := range defaultUsers0002 {
+                emails = append(emails, user.Email)
+            }
+            return tx.Unscoped().Where("email IN ?", emails).Delete(&user0001{}).Error
+        },
+    })
+}
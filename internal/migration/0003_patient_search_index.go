@@ -0,0 +1,72 @@
+package migration
+
+import (
+    "gorm.io/gorm"
+)
+
+// SQLite keeps its own copy of the searchable columns in an FTS5 table, kept
+// in sync with patients by triggers. go-sqlite3 only ships FTS5 when built
+// with the sqlite_fts5 tag; without it the table is skipped and searches
+// fall back to LIKE matching.
+var sqliteSearchIndex0003 = []string{
+    `CREATE VIRTUAL TABLE patients_fts USING fts5(first_name, last_name, contact, address)`,
+    `INSERT INTO patients_fts(rowid, first_name, last_name, contact, address)
+        SELECT id, first_name, last_name, contact, address FROM patients`,
+    `CREATE TRIGGER patients_fts_insert AFTER INSERT ON patients BEGIN
+        INSERT INTO patients_fts(rowid, first_name, last_name, contact, address)
+        VALUES (new.id, new.first_name, new.last_name, new.contact, new.address);
+    END`,
+    `CREATE TRIGGER patients_fts_update AFTER UPDATE ON patients BEGIN
+        DELETE FROM patients_fts WHERE rowid = old.id;
+        INSERT INTO patients_fts(rowid, first_name, last_name, contact, address)
+        VALUES (new.id, new.first_name, new.last_name, new.contact, new.address);
+    END`,
+    `CREATE TRIGGER patients_fts_delete AFTER DELETE ON patients BEGIN
+        DELETE FROM patients_fts WHERE rowid = old.id;
+    END`,
+}
+
+func init() {
+    register(Migration{
+        Version: 3,
+        Name:    "patient_search_index",
+        Up: func(tx *gorm.DB) error {
+            switch tx.Dialector.Name() {
+            case "mysql":
+                return tx.Exec("ALTER TABLE patients ADD FULLTEXT INDEX idx_patients_search (first_name, last_name, contact, address)").Error
+            case "sqlite":
+                var fts5 int
+                if err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+                    return err
+                }
+                if fts5 == 0 {
+                    return nil
+                }
+                for _, statement := range sqliteSearchIndex0003 {
+                    if err := tx.Exec(statement).Error; err != nil {
+                        return err
+                    }
+                }
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            switch tx.Dialector.Name() {
+            case "mysql":
+                return tx.Exec("ALTER TABLE patients DROP INDEX idx_patients_search").Error
+            case "sqlite":
+                for _, statement := range []string{
+                    "DROP TRIGGER IF EXISTS patients_fts_insert",
+                    "DROP TRIGGER IF EXISTS patients_fts_update",
+                    "DROP TRIGGER IF EXISTS patients_fts_delete",
+                    "DROP TABLE IF EXISTS patients_fts",
+                } {
+                    if err := tx.Exec(statement).Error; err != nil {
+                        return err
+                    }
+                }
+            }
+            return nil
+        },
+    })
+}
@@ -0,0 +1,32 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type refreshToken0004 struct {
+    ID        uint      `gorm:"primarykey"`
+    UserID    uint      `gorm:"not null;index"`
+    FamilyID  string    `gorm:"size:64;not null;index"`
+    TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+    ExpiresAt time.Time `gorm:"not null"`
+    UsedAt    *time.Time
+    RevokedAt *time.Time
+    CreatedAt time.Time
+}
+
+func (refreshToken0004) TableName() string { return "refresh_tokens" }
+
+func init() {
+    register(Migration{
+        Version: 4,
+        Name:    "create_refresh_tokens",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&refreshToken0004{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&refreshToken0004{})
+        },
+    })
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+    "gorm.io/gorm"
+)
+
+type permission0005 struct {
+    gorm.Model
+    Name string `gorm:"size:64;uniqueIndex;not null"`
+}
+
+func (permission0005) TableName() string { return "permissions" }
+
+type role0005 struct {
+    gorm.Model
+    Name string `gorm:"size:64;uniqueIndex;not null"`
+}
+
+func (role0005) TableName() string { return "roles" }
+
+type rolePermission0005 struct {
+    RoleID       uint `gorm:"primaryKey"`
+    PermissionID uint `gorm:"primaryKey"`
+}
+
+func (rolePermission0005) TableName() string { return "role_permissions" }
+
+type userRole0005 struct {
+    UserID uint `gorm:"primaryKey"`
+    RoleID uint `gorm:"primaryKey"`
+}
+
+func (userRole0005) TableName() string { return "user_roles" }
+
+// userRoleColumn0005 is the single-role column that user_roles replaces.
+type userRoleColumn0005 struct {
+    Role string `gorm:"not null;default:''"`
+}
+
+func (userRoleColumn0005) TableName() string { return "users" }
+
+var rolePermissions0005 = map[string][]string{
+    "receptionist": {"patient:read", "patient:write"},
+    "doctor":       {"patient:read", "medical_history:write"},
+}
+
+// seedRoles creates any missing permissions and roles and grants each role
+// its listed permissions. Later migrations reuse it for new roles.
+func seedRoles(tx *gorm.DB, grants map[string][]string) error {
+    for roleName, permissionNames := range grants {
+        role := role0005{Name: roleName}
+        if err := tx.Where(role0005{Name: roleName}).FirstOrCreate(&role).Error; err != nil {
+            return err
+        }
+        for _, permissionName := range permissionNames {
+            permission := permission0005{Name: permissionName}
+            if err := tx.Where(permission0005{Name: permissionName}).FirstOrCreate(&permission).Error; err != nil {
+                return err
+            }
+            grant := rolePermission0005{RoleID: role.ID, PermissionID: permission.ID}
+            if err := tx.Where(grant).FirstOrCreate(&grant).Error; err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func init() {
+    register(Migration{
+        Version: 5,
+        Name:    "roles_and_permissions",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&permission0005{}, &role0005{}, &rolePermission0005{}, &userRole0005{}); err != nil {
+                return err
+            }
+            if err := seedRoles(tx, rolePermissions0005); err != nil {
+                return err
+            }
+
+            // Carry every user's single role over, creating roles without
+            // permissions for any value not seeded above.
+            var existing []string
+            if err := tx.Table("users").Distinct("role").Where("role <> ''").Pluck("role", &existing).Error; err != nil {
+                return err
+            }
+            for _, name := range existing {
+                if err := tx.Where(role0005{Name: name}).FirstOrCreate(&role0005{Name: name}).Error; err != nil {
+                    return err
+                }
+            }
+            if err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+                SELECT users.id, roles.id FROM users JOIN roles ON roles.name = users.role`).Error; err != nil {
+                return err
+            }
+
+            return tx.Migrator().DropColumn(&userRoleColumn0005{}, "Role")
+        },
+        Down: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&userRoleColumn0005{}, "Role"); err != nil {
+                return err
+            }
+            if err := tx.Exec(`UPDATE users SET role = COALESCE((SELECT MIN(roles.name) FROM user_roles
+                JOIN roles ON roles.id = user_roles.role_id WHERE user_roles.user_id = users.id), '')`).Error; err != nil {
+                return err
+            }
+            return tx.Migrator().DropTable(&userRole0005{}, &rolePermission0005{}, &role0005{}, &permission0005{})
+        },
+    })
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+    "time"
+    "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+)
+
+type user0006 struct {
+    gorm.Model
+    Email         string `gorm:"unique;not null"`
+    Password      string `gorm:"not null"`
+    DeactivatedAt *time.Time
+}
+
+func (user0006) TableName() string { return "users" }
+
+const defaultAdminEmail0006 = "admin@example.com"
+
+func init() {
+    register(Migration{
+        Version: 6,
+        Name:    "admin_users",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&user0006{}, "DeactivatedAt"); err != nil {
+                return err
+            }
+            if err := seedRoles(tx, map[string][]string{"admin": {"user:manage"}}); err != nil {
+                return err
+            }
+
+            // The first administrator; change its password through the API.
+            password, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+            if err != nil {
+                return err
+            }
+            admin := user0006{Email: defaultAdminEmail0006, Password: string(password)}
+            if err := tx.Where(user0006{Email: admin.Email}).FirstOrCreate(&admin).Error; err != nil {
+                return err
+            }
+            var role role0005
+            if err := tx.Where(role0005{Name: "admin"}).First(&role).Error; err != nil {
+                return err
+            }
+            grant := userRole0005{UserID: admin.ID, RoleID: role.ID}
+            return tx.Where(grant).FirstOrCreate(&grant).Error
+        },
+        Down: func(tx *gorm.DB) error {
+            var role role0005
+            if err := tx.Where(role0005{Name: "admin"}).First(&role).Error; err != nil {
+                return err
+            }
+            var permission permission0005
+            if err := tx.Where(permission0005{Name: "user:manage"}).First(&permission).Error; err != nil {
+                return err
+            }
+
+            admins := tx.Unscoped().Model(&user0006{}).Select("id").Where("email = ?", defaultAdminEmail0006)
+            if err := tx.Where("role_id = ? OR user_id IN (?)", role.ID, admins).Delete(&userRole0005{}).Error; err != nil {
+                return err
+            }
+            if err := tx.Where("role_id = ? OR permission_id = ?", role.ID, permission.ID).Delete(&rolePermission0005{}).Error; err != nil {
+                return err
+            }
+            if err := tx.Unscoped().Delete(&role).Error; err != nil {
+                return err
+            }
+            if err := tx.Unscoped().Delete(&permission).Error; err != nil {
+                return err
+            }
+            if err := tx.Unscoped().Where("email = ?", defaultAdminEmail0006).Delete(&user0006{}).Error; err != nil {
+                return err
+            }
+            return tx.Migrator().DropColumn(&user0006{}, "DeactivatedAt")
+        },
+    })
+}
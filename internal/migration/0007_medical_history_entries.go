@@ -0,0 +1,70 @@
+package migration
+
+import (
+    "strings"
+    "time"
+    "gorm.io/gorm"
+)
+
+type medicalHistoryEntry0007 struct {
+    ID          uint   `gorm:"primarykey"`
+    PatientID   uint   `gorm:"not null;index"`
+    AuthorID    *uint  `gorm:"index"`
+    Kind        string `gorm:"size:32;not null"`
+    Description string `gorm:"type:text;not null"`
+    CreatedAt   time.Time
+}
+
+func (medicalHistoryEntry0007) TableName() string { return "medical_history_entries" }
+
+// patientHistory0007 is the free-text column the entries replace.
+type patientHistory0007 struct {
+    MedicalHistory string
+}
+
+func (patientHistory0007) TableName() string { return "patients" }
+
+func init() {
+    register(Migration{
+        Version: 7,
+        Name:    "medical_history_entries",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&medicalHistoryEntry0007{}); err != nil {
+                return err
+            }
+
+            // Existing free text becomes one unattributed note per patient.
+            if err := tx.Exec(`INSERT INTO medical_history_entries (patient_id, kind, description, created_at)
+                SELECT id, 'note', medical_history, updated_at FROM patients
+                WHERE medical_history IS NOT NULL AND medical_history <> ''`).Error; err != nil {
+                return err
+            }
+
+            // A plain DROP COLUMN: GORM's SQLite migrator would rebuild the
+            // table and lose the search index triggers.
+            return tx.Exec("ALTER TABLE patients DROP COLUMN medical_history").Error
+        },
+        Down: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&patientHistory0007{}, "MedicalHistory"); err != nil {
+                return err
+            }
+
+            var entries []medicalHistoryEntry0007
+            if err := tx.Order("patient_id, created_at, id").Find(&entries).Error; err != nil {
+                return err
+            }
+            history := make(map[uint][]string)
+            for _, entry := range entries {
+                history[entry.PatientID] = append(history[entry.PatientID], entry.Kind+": "+entry.Description)
+            }
+            for patientID, lines := range history {
+                if err := tx.Table("patients").Where("id = ?", patientID).
+                    UpdateColumn("medical_history", strings.Join(lines, "\n")).Error; err != nil {
+                    return err
+                }
+            }
+
+            return tx.Migrator().DropTable(&medicalHistoryEntry0007{})
+        },
+    })
+}
@@ -0,0 +1,82 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type auditLog0008 struct {
+    ID        uint      `gorm:"primarykey"`
+    UserID    uint      `gorm:"not null;index"`
+    Action    string    `gorm:"size:32;not null"`
+    PatientID uint      `gorm:"not null;index"`
+    Changes   string    `gorm:"type:text"`
+    CreatedAt time.Time `gorm:"index"`
+}
+
+func (auditLog0008) TableName() string { return "audit_logs" }
+
+// appendOnly0008 makes the database itself refuse to change or remove audit
+// rows, whatever the application does.
+var appendOnly0008 = map[string][]string{
+    "mysql": {
+        `CREATE TRIGGER audit_logs_no_update BEFORE UPDATE ON audit_logs FOR EACH ROW
+            SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit log is append-only'`,
+        `CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs FOR EACH ROW
+            SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit log is append-only'`,
+    },
+    "postgres": {
+        `CREATE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+            BEGIN RAISE EXCEPTION 'audit log is append-only'; END
+        $$ LANGUAGE plpgsql`,
+        `CREATE TRIGGER audit_logs_no_change BEFORE UPDATE OR DELETE ON audit_logs
+            FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+    },
+    "sqlite": {
+        `CREATE TRIGGER audit_logs_no_update BEFORE UPDATE ON audit_logs BEGIN
+            SELECT RAISE(ABORT, 'audit log is append-only');
+        END`,
+        `CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs BEGIN
+            SELECT RAISE(ABORT, 'audit log is append-only');
+        END`,
+    },
+}
+
+func init() {
+    register(Migration{
+        Version: 8,
+        Name:    "create_audit_logs",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&auditLog0008{}); err != nil {
+                return err
+            }
+            for _, statement := range appendOnly0008[tx.Dialector.Name()] {
+                if err := tx.Exec(statement).Error; err != nil {
+                    return err
+                }
+            }
+            return seedRoles(tx, map[string][]string{"admin": {"audit:read"}})
+        },
+        Down: func(tx *gorm.DB) error {
+            var permission permission0005
+            if err := tx.Where(permission0005{Name: "audit:read"}).First(&permission).Error; err != nil {
+                return err
+            }
+            if err := tx.Where("permission_id = ?", permission.ID).Delete(&rolePermission0005{}).Error; err != nil {
+                return err
+            }
+            if err := tx.Unscoped().Delete(&permission).Error; err != nil {
+                return err
+            }
+
+            // Dropping the table drops its triggers too.
+            if err := tx.Migrator().DropTable(&auditLog0008{}); err != nil {
+                return err
+            }
+            if tx.Dialector.Name() == "postgres" {
+                return tx.Exec("DROP FUNCTION IF EXISTS audit_logs_append_only()").Error
+            }
+            return nil
+        },
+    })
+}
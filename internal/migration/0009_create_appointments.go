@@ -0,0 +1,48 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type appointment0009 struct {
+    gorm.Model
+    PatientID          uint      `gorm:"not null;index"`
+    DoctorID           uint      `gorm:"not null;index:idx_appointments_doctor_start"`
+    StartsAt           time.Time `gorm:"not null;index:idx_appointments_doctor_start"`
+    EndsAt             time.Time `gorm:"not null"`
+    Status             string    `gorm:"size:16;not null"`
+    Reason             string
+    CancellationReason string
+}
+
+func (appointment0009) TableName() string { return "appointments" }
+
+var appointmentPermissions0009 = map[string][]string{
+    "receptionist": {"appointment:read", "appointment:write"},
+    "doctor":       {"appointment:attend"},
+}
+
+func init() {
+    register(Migration{
+        Version: 9,
+        Name:    "create_appointments",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&appointment0009{}); err != nil {
+                return err
+            }
+            return seedRoles(tx, appointmentPermissions0009)
+        },
+        Down: func(tx *gorm.DB) error {
+            names := []string{"appointment:read", "appointment:write", "appointment:attend"}
+            permissions := tx.Model(&permission0005{}).Select("id").Where("name IN ?", names)
+            if err := tx.Where("permission_id IN (?)", permissions).Delete(&rolePermission0005{}).Error; err != nil {
+                return err
+            }
+            if err := tx.Unscoped().Where("name IN ?", names).Delete(&permission0005{}).Error; err != nil {
+                return err
+            }
+            return tx.Migrator().DropTable(&appointment0009{})
+        },
+    })
+}
@@ -0,0 +1,56 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type doctorSchedule0010 struct {
+    DoctorID    uint   `gorm:"primaryKey;autoIncrement:false"`
+    Timezone    string `gorm:"size:64;not null"`
+    SlotMinutes int    `gorm:"not null"`
+    UpdatedAt   time.Time
+}
+
+func (doctorSchedule0010) TableName() string { return "doctor_schedules" }
+
+type workingHours0010 struct {
+    ID        uint   `gorm:"primarykey"`
+    DoctorID  uint   `gorm:"not null;index"`
+    Weekday   int    `gorm:"not null"`
+    StartTime string `gorm:"size:5;not null"`
+    EndTime   string `gorm:"size:5;not null"`
+}
+
+func (workingHours0010) TableName() string { return "working_hours" }
+
+type scheduleBreak0010 struct {
+    ID        uint   `gorm:"primarykey"`
+    DoctorID  uint   `gorm:"not null;index"`
+    Weekday   int    `gorm:"not null"`
+    StartTime string `gorm:"size:5;not null"`
+    EndTime   string `gorm:"size:5;not null"`
+}
+
+func (scheduleBreak0010) TableName() string { return "schedule_breaks" }
+
+type leaveDay0010 struct {
+    ID       uint   `gorm:"primarykey"`
+    DoctorID uint   `gorm:"not null;uniqueIndex:idx_leave_days_doctor_date"`
+    Date     string `gorm:"size:10;not null;uniqueIndex:idx_leave_days_doctor_date"`
+}
+
+func (leaveDay0010) TableName() string { return "leave_days" }
+
+func init() {
+    register(Migration{
+        Version: 10,
+        Name:    "doctor_availability",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&doctorSchedule0010{}, &workingHours0010{}, &scheduleBreak0010{}, &leaveDay0010{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&leaveDay0010{}, &scheduleBreak0010{}, &workingHours0010{}, &doctorSchedule0010{})
+        },
+    })
+}
@@ -0,0 +1,25 @@
+package migration
+
+import "gorm.io/gorm"
+
+// patientVersion0011 is the optimistic locking counter on patients.
+type patientVersion0011 struct {
+    Version uint `gorm:"not null;default:1"`
+}
+
+func (patientVersion0011) TableName() string { return "patients" }
+
+func init() {
+    register(Migration{
+        Version: 11,
+        Name:    "patient_version",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().AddColumn(&patientVersion0011{}, "Version")
+        },
+        Down: func(tx *gorm.DB) error {
+            // A plain DROP COLUMN, as in 0007, keeps the SQLite search
+            // index triggers.
+            return tx.Exec("ALTER TABLE patients DROP COLUMN version").Error
+        },
+    })
+}
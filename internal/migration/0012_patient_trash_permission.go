@@ -0,0 +1,20 @@
+package migration
+
+import "gorm.io/gorm"
+
+func init() {
+    register(Migration{
+        Version: 12,
+        Name:    "patient_trash_permission",
+        Up: func(tx *gorm.DB) error {
+            return seedRoles(tx, map[string][]string{"admin": {"patient:trash"}})
+        },
+        Down: func(tx *gorm.DB) error {
+            permissions := tx.Model(&permission0005{}).Select("id").Where("name = ?", "patient:trash")
+            if err := tx.Where("permission_id IN (?)", permissions).Delete(&rolePermission0005{}).Error; err != nil {
+                return err
+            }
+            return tx.Unscoped().Where("name = ?", "patient:trash").Delete(&permission0005{}).Error
+        },
+    })
+}
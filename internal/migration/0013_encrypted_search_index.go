@@ -0,0 +1,114 @@
+package migration
+
+import "gorm.io/gorm"
+
+// patientSearchIndex0013 holds the blind search tokens that replace
+// full-text matching on contact and address once those are encrypted.
+type patientSearchIndex0013 struct {
+    ContactIndex string `gorm:"type:text"`
+    AddressIndex string `gorm:"type:text"`
+}
+
+func (patientSearchIndex0013) TableName() string { return "patients" }
+
+// The SQLite FTS5 table indexes the token columns in place of contact and
+// address; ciphertext is not worth indexing.
+var sqliteSearchIndex0013 = []string{
+    `CREATE VIRTUAL TABLE patients_fts USING fts5(first_name, last_name, contact_index, address_index)`,
+    `INSERT INTO patients_fts(rowid, first_name, last_name, contact_index, address_index)
+        SELECT id, first_name, last_name, contact_index, address_index FROM patients`,
+    `CREATE TRIGGER patients_fts_insert AFTER INSERT ON patients BEGIN
+        INSERT INTO patients_fts(rowid, first_name, last_name, contact_index, address_index)
+        VALUES (new.id, new.first_name, new.last_name, new.contact_index, new.address_index);
+    END`,
+    `CREATE TRIGGER patients_fts_update AFTER UPDATE ON patients BEGIN
+        DELETE FROM patients_fts WHERE rowid = old.id;
+        INSERT INTO patients_fts(rowid, first_name, last_name, contact_index, address_index)
+        VALUES (new.id, new.first_name, new.last_name, new.contact_index, new.address_index);
+    END`,
+    `CREATE TRIGGER patients_fts_delete AFTER DELETE ON patients BEGIN
+        DELETE FROM patients_fts WHERE rowid = old.id;
+    END`,
+}
+
+var dropSQLiteSearchIndex0013 = []string{
+    "DROP TRIGGER IF EXISTS patients_fts_insert",
+    "DROP TRIGGER IF EXISTS patients_fts_update",
+    "DROP TRIGGER IF EXISTS patients_fts_delete",
+    "DROP TABLE IF EXISTS patients_fts",
+}
+
+func hasSQLiteSearchIndex(tx *gorm.DB) (bool, error) {
+    var count int64
+    err := tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'patients_fts'").Scan(&count).Error
+    return count > 0, err
+}
+
+func execAll(tx *gorm.DB, statements ...[]string) error {
+    for _, group := range statements {
+        for _, statement := range group {
+            if err := tx.Exec(statement).Error; err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func init() {
+    register(Migration{
+        Version: 13,
+        Name:    "encrypted_search_index",
+        // Existing rows are indexed, and encrypted, by `go run ./cmd/keys
+        // rotate`; until then their contact and address are not searchable.
+        Up: func(tx *gorm.DB) error {
+            for _, column := range []string{"ContactIndex", "AddressIndex"} {
+                if err := tx.Migrator().AddColumn(&patientSearchIndex0013{}, column); err != nil {
+                    return err
+                }
+            }
+
+            switch tx.Dialector.Name() {
+            case "mysql":
+                return execAll(tx, []string{
+                    "ALTER TABLE patients DROP INDEX idx_patients_search",
+                    "ALTER TABLE patients ADD FULLTEXT INDEX idx_patients_search (first_name, last_name, contact_index, address_index)",
+                })
+            case "sqlite":
+                if ok, err := hasSQLiteSearchIndex(tx); err != nil || !ok {
+                    return err
+                }
+                return execAll(tx, dropSQLiteSearchIndex0013, sqliteSearchIndex0013)
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            switch tx.Dialector.Name() {
+            case "mysql":
+                if err := execAll(tx, []string{
+                    "ALTER TABLE patients DROP INDEX idx_patients_search",
+                    "ALTER TABLE patients ADD FULLTEXT INDEX idx_patients_search (first_name, last_name, contact, address)",
+                }); err != nil {
+                    return err
+                }
+            case "sqlite":
+                ok, err := hasSQLiteSearchIndex(tx)
+                if err != nil {
+                    return err
+                }
+                if ok {
+                    if err := execAll(tx, dropSQLiteSearchIndex0013, sqliteSearchIndex0003); err != nil {
+                        return err
+                    }
+                }
+            }
+
+            // A plain DROP COLUMN, as in 0007, keeps the SQLite search
+            // index triggers.
+            return execAll(tx, []string{
+                "ALTER TABLE patients DROP COLUMN contact_index",
+                "ALTER TABLE patients DROP COLUMN address_index",
+            })
+        },
+    })
+}
@@ -0,0 +1,20 @@
+package migration
+
+import "gorm.io/gorm"
+
+func init() {
+    register(Migration{
+        Version: 14,
+        Name:    "patient_export_permission",
+        Up: func(tx *gorm.DB) error {
+            return seedRoles(tx, map[string][]string{"admin": {"patient:export"}})
+        },
+        Down: func(tx *gorm.DB) error {
+            permissions := tx.Model(&permission0005{}).Select("id").Where("name = ?", "patient:export")
+            if err := tx.Where("permission_id IN (?)", permissions).Delete(&rolePermission0005{}).Error; err != nil {
+                return err
+            }
+            return tx.Unscoped().Where("name = ?", "patient:export").Delete(&permission0005{}).Error
+        },
+    })
+}
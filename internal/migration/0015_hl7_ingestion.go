@@ -0,0 +1,41 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type patientIdentifier0015 struct {
+    ID        uint   `gorm:"primarykey"`
+    PatientID uint   `gorm:"not null;index"`
+    System    string `gorm:"size:64;not null;uniqueIndex:idx_patient_identifiers_system_value"`
+    Value     string `gorm:"size:64;not null;uniqueIndex:idx_patient_identifiers_system_value"`
+    CreatedAt time.Time
+}
+
+func (patientIdentifier0015) TableName() string { return "patient_identifiers" }
+
+type deadLetter0015 struct {
+    ID        uint   `gorm:"primarykey"`
+    Source    string `gorm:"size:255;not null"`
+    Message   string `gorm:"type:text;not null"`
+    Reason    string `gorm:"type:text;not null"`
+    Attempts  int    `gorm:"not null"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+func (deadLetter0015) TableName() string { return "dead_letters" }
+
+func init() {
+    register(Migration{
+        Version: 15,
+        Name:    "hl7_ingestion",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&patientIdentifier0015{}, &deadLetter0015{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&deadLetter0015{}, &patientIdentifier0015{})
+        },
+    })
+}
@@ -0,0 +1,39 @@
+package migration
+
+import "gorm.io/gorm"
+
+// patientMerge0016 points a patient merged into another at the one kept.
+type patientMerge0016 struct {
+    MergedIntoID *uint
+}
+
+func (patientMerge0016) TableName() string { return "patients" }
+
+// auditRelatedPatient0016 names the other patient of a merge in its audit
+// entries.
+type auditRelatedPatient0016 struct {
+    RelatedPatientID *uint
+}
+
+func (auditRelatedPatient0016) TableName() string { return "audit_logs" }
+
+func init() {
+    register(Migration{
+        Version: 16,
+        Name:    "patient_merge",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&patientMerge0016{}, "MergedIntoID"); err != nil {
+                return err
+            }
+            return tx.Migrator().AddColumn(&auditRelatedPatient0016{}, "RelatedPatientID")
+        },
+        Down: func(tx *gorm.DB) error {
+            if err := tx.Exec("ALTER TABLE audit_logs DROP COLUMN related_patient_id").Error; err != nil {
+                return err
+            }
+            // A plain DROP COLUMN, as in 0011, keeps the SQLite search
+            // index triggers.
+            return tx.Exec("ALTER TABLE patients DROP COLUMN merged_into_id").Error
+        },
+    })
+}
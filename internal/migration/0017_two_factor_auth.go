@@ -0,0 +1,67 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+type userTOTP0017 struct {
+    TOTPSecret    string `gorm:"type:text"`
+    TOTPEnabledAt *time.Time
+    TOTPLastStep  int64 `gorm:"not null;default:0"`
+}
+
+func (userTOTP0017) TableName() string { return "users" }
+
+type roleTwoFactor0017 struct {
+    TwoFactorRequired bool `gorm:"not null;default:false"`
+}
+
+func (roleTwoFactor0017) TableName() string { return "roles" }
+
+type recoveryCode0017 struct {
+    ID        uint   `gorm:"primarykey"`
+    UserID    uint   `gorm:"not null;index"`
+    CodeHash  string `gorm:"size:64;not null"`
+    UsedAt    *time.Time
+    CreatedAt time.Time
+}
+
+func (recoveryCode0017) TableName() string { return "recovery_codes" }
+
+func init() {
+    register(Migration{
+        Version: 17,
+        Name:    "two_factor_auth",
+        Up: func(tx *gorm.DB) error {
+            for _, field := range []string{"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"} {
+                if err := tx.Migrator().AddColumn(&userTOTP0017{}, field); err != nil {
+                    return err
+                }
+            }
+            if err := tx.Migrator().AddColumn(&roleTwoFactor0017{}, "TwoFactorRequired"); err != nil {
+                return err
+            }
+            if err := tx.Migrator().CreateTable(&recoveryCode0017{}); err != nil {
+                return err
+            }
+            // Security policy: doctors see medical history, so they sign in
+            // with a second factor.
+            return tx.Model(&roleTwoFactor0017{}).Where("name = ?", "doctor").Update("two_factor_required", true).Error
+        },
+        Down: func(tx *gorm.DB) error {
+            if err := tx.Migrator().DropTable(&recoveryCode0017{}); err != nil {
+                return err
+            }
+            if err := tx.Exec("ALTER TABLE roles DROP COLUMN two_factor_required").Error; err != nil {
+                return err
+            }
+            for _, column := range []string{"totp_last_step", "totp_enabled_at", "totp_secret"} {
+                if err := tx.Exec("ALTER TABLE users DROP COLUMN " + column).Error; err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    })
+}
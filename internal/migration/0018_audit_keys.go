@@ -0,0 +1,29 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+// auditKey0018 seals the audit log diffs of one patient, so purging the
+// patient can erase them from the append-only log by deleting the key.
+type auditKey0018 struct {
+    PatientID uint   `gorm:"primarykey;autoIncrement:false"`
+    Secret    string `gorm:"type:text;not null"`
+    CreatedAt time.Time
+}
+
+func (auditKey0018) TableName() string { return "audit_keys" }
+
+func init() {
+    register(Migration{
+        Version: 18,
+        Name:    "audit_keys",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&auditKey0018{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&auditKey0018{})
+        },
+    })
+}
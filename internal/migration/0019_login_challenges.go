@@ -0,0 +1,31 @@
+package migration
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+// loginChallenge0019 replaces the signed two-factor challenge tokens, which
+// shared the access token keys, with opaque tokens stored by hash.
+type loginChallenge0019 struct {
+    ID        uint      `gorm:"primarykey"`
+    UserID    uint      `gorm:"not null;index"`
+    TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+    ExpiresAt time.Time `gorm:"not null;index"`
+    CreatedAt time.Time
+}
+
+func (loginChallenge0019) TableName() string { return "login_challenges" }
+
+func init() {
+    register(Migration{
+        Version: 19,
+        Name:    "login_challenges",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&loginChallenge0019{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&loginChallenge0019{})
+        },
+    })
+}
@@ -0,0 +1,57 @@
+package migration
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9]+`)
+
+const migrationTemplate = `package migration
+
+import (
+    "gorm.io/gorm"
+)
+
+func init() {
+    register(Migration{
+        Version: %d,
+        Name:    %q,
+        Up: func(tx *gorm.DB) error {
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            return nil
+        },
+    })
+}
+`
+
+// Create writes a new empty migration file into dir, numbered one past the
+// highest registered version, and returns its path.
+func Create(dir, name string) (string, error) {
+    slug := strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(name), "_"), "_")
+    if slug == "" {
+        return "", fmt.Errorf("invalid migration name %q", name)
+    }
+
+    version := 1
+    if migrations := All(); len(migrations) > 0 {
+        version = migrations[len(migrations)-1].Version + 1
+    }
+
+    path := filepath.Join(dir, fmt.Sprintf("%04d_%s.go", version, slug))
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    if _, err := fmt.Fprintf(file, migrationTemplate, version, slug); err != nil {
+        return "", err
+    }
+    return path, nil
+}
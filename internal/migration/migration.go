@@ -0,0 +1,199 @@
+package migration
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+    "gorm.io/gorm"
+)
+
+// Migration is a single numbered schema step. Up and Down run inside a
+// transaction together with the schema_migrations bookkeeping.
+type Migration struct {
+    Version int
+    Name    string
+    Up      func(tx *gorm.DB) error
+    Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration is a row in the schema_migrations history table.
+type SchemaMigration struct {
+    Version   int       `gorm:"primaryKey;autoIncrement:false"`
+    Name      string    `gorm:"size:255;not null"`
+    AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+    return "schema_migrations"
+}
+
+// Status describes whether a known migration has been applied.
+type Status struct {
+    Version   int
+    Name      string
+    Applied   bool
+    AppliedAt *time.Time
+}
+
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+var registry = map[int]Migration{}
+
+// register adds a migration to the global set. It is called from init
+// functions in the numbered migration files.
+func register(m Migration) {
+    if _, exists := registry[m.Version]; exists {
+        panic(fmt.Sprintf("migration: duplicate version %d", m.Version))
+    }
+    registry[m.Version] = m
+}
+
+// All returns every registered migration in version order.
+func All() []Migration {
+    migrations := make([]Migration, 0, len(registry))
+    for _, m := range registry {
+        migrations = append(migrations, m)
+    }
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+    return migrations
+}
+
+type Migrator struct {
+    db         *gorm.DB
+    migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+    return &Migrator{db: db, migrations: All()}
+}
+
+func (m *Migrator) ensureTable() error {
+    return m.db.AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+    if err := m.ensureTable(); err != nil {
+        return nil, err
+    }
+
+    var rows []SchemaMigration
+    if err := m.db.Order("version").Find(&rows).Error; err != nil {
+        return nil, err
+    }
+
+    applied := make(map[int]SchemaMigration, len(rows))
+    for _, row := range rows {
+        applied[row.Version] = row
+    }
+    return applied, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending() ([]Migration, error) {
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+
+    var pending []Migration
+    for _, migration := range m.migrations {
+        if _, ok := applied[migration.Version]; !ok {
+            pending = append(pending, migration)
+        }
+    }
+    return pending, nil
+}
+
+// Up applies every pending migration in order and returns the ones it ran.
+func (m *Migrator) Up() ([]Migration, error) {
+    pending, err := m.Pending()
+    if err != nil {
+        return nil, err
+    }
+
+    var ran []Migration
+    for _, migration := range pending {
+        err := m.db.Transaction(func(tx *gorm.DB) error {
+            if err := migration.Up(tx); err != nil {
+                return err
+            }
+            return tx.Create(&SchemaMigration{
+                Version:   migration.Version,
+                Name:      migration.Name,
+                AppliedAt: time.Now().UTC(),
+            }).Error
+        })
+        if err != nil {
+            return ran, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+        }
+        ran = append(ran, migration)
+    }
+    return ran, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+
+    var rolledBack []Migration
+    for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+        migration := m.migrations[i]
+        if _, ok := applied[migration.Version]; !ok {
+            continue
+        }
+
+        err := m.db.Transaction(func(tx *gorm.DB) error {
+            if migration.Down == nil {
+                return errors.New("migration has no down step")
+            }
+            if err := migration.Down(tx); err != nil {
+                return err
+            }
+            return tx.Delete(&SchemaMigration{}, migration.Version).Error
+        })
+        if err != nil {
+            return rolledBack, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+        }
+        rolledBack = append(rolledBack, migration)
+    }
+    return rolledBack, nil
+}
+
+// Status lists every known migration with its applied state.
+func (m *Migrator) Status() ([]Status, error) {
+    applied, err := m.applied()
+    if err != nil {
+        return nil, err
+    }
+
+    statuses := make([]Status, 0, len(m.migrations))
+    for _, migration := range m.migrations {
+        status := Status{Version: migration.Version, Name: migration.Name}
+        if row, ok := applied[migration.Version]; ok {
+            appliedAt := row.AppliedAt
+            status.Applied = true
+            status.AppliedAt = &appliedAt
+        }
+        statuses = append(statuses, status)
+    }
+    return statuses, nil
+}
+
+// CheckCurrent returns ErrPendingMigrations if any migration is unapplied.
+func (m *Migrator) CheckCurrent() error {
+    pending, err := m.Pending()
+    if err != nil {
+        return err
+    }
+    if len(pending) > 0 {
+        return fmt.Errorf("%w: %d not applied (next is %04d_%s)",
+            ErrPendingMigrations, len(pending), pending[0].Version, pending[0].Name)
+    }
+    return nil
+}
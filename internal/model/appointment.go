@@ -0,0 +1,25 @@
+package model
+
+import (
+    "time"
+    "gorm.io/gorm"
+)
+
+// Appointment statuses.
+const (
+    AppointmentScheduled = "scheduled"
+    AppointmentCancelled = "cancelled"
+)
+
+// Appointment books a doctor for a patient over [StartsAt, EndsAt). Times
+// are stored in UTC. Only scheduled appointments block the doctor's time.
+type Appointment struct {
+    gorm.Model
+    PatientID          uint      `gorm:"not null;index"`
+    DoctorID           uint      `gorm:"not null;index:idx_appointments_doctor_start"`
+    StartsAt           time.Time `gorm:"not null;index:idx_appointments_doctor_start"`
+    EndsAt             time.Time `gorm:"not null"`
+    Status             string    `gorm:"size:16;not null"`
+    Reason             string
+    CancellationReason string
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+    "time"
+)
+
+// Audited actions on patient records.
+const (
+    AuditPatientCreate      = "patient.create"
+    AuditPatientImport      = "patient.import"
+    AuditPatientRead        = "patient.read"
+    AuditPatientList        = "patient.list"
+    AuditPatientSearch      = "patient.search"
+    AuditPatientExport      = "patient.export"
+    AuditPatientSummary     = "patient.summary"
+    AuditPatientUpdate      = "patient.update"
+    AuditPatientDelete      = "patient.delete"
+    AuditPatientTrashList   = "patient.trash_list"
+    AuditPatientRestore     = "patient.restore"
+    AuditPatientPurge       = "patient.purge"
+    AuditPatientMatch       = "patient.match"
+    AuditPatientMerge       = "patient.merge"
+    AuditMedicalHistoryAdd  = "medical_history.add"
+    AuditMedicalHistoryRead = "medical_history.read"
+)
+
+// AuditLog records one access to or change of a patient record. Rows are
+// never updated or deleted; the database rejects attempts to. Changes holds
+// the JSON-encoded field diff of a write, sealed with the patient's
+// AuditKey. ChangesErased is set on entries read back after the patient was
+// purged and the key with them. RelatedPatientID is the other patient of a
+// merge.
+type AuditLog struct {
+    ID               uint      `gorm:"primarykey"`
+    UserID           uint      `gorm:"not null;index"`
+    Action           string    `gorm:"size:32;not null"`
+    PatientID        uint      `gorm:"not null;index"`
+    RelatedPatientID *uint
+    Changes          string    `gorm:"type:text"`
+    ChangesErased    bool      `gorm:"-"`
+    CreatedAt        time.Time `gorm:"index"`
+}
+
+// AuditKey seals the audit log diffs of one patient. Purging the patient
+// deletes it, which leaves their diffs unreadable without touching the
+// append-only log. Secret is itself encrypted with the field keys.
+type AuditKey struct {
+    PatientID uint   `gorm:"primarykey;autoIncrement:false"`
+    Secret    string `gorm:"type:text;not null;serializer:encrypted"`
+    CreatedAt time.Time
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// DoctorSchedule is a doctor's published availability: weekly working hours
+// and breaks in the doctor's timezone, days on leave, and the length of a
+// bookable slot.
+type DoctorSchedule struct {
+    DoctorID     uint            `gorm:"primaryKey;autoIncrement:false"`
+    Timezone     string          `gorm:"size:64;not null"`
+    SlotMinutes  int             `gorm:"not null"`
+    WorkingHours []WorkingHours  `gorm:"foreignKey:DoctorID;references:DoctorID"`
+    Breaks       []ScheduleBreak `gorm:"foreignKey:DoctorID;references:DoctorID"`
+    LeaveDays    []LeaveDay      `gorm:"foreignKey:DoctorID;references:DoctorID"`
+    UpdatedAt    time.Time
+}
+
+// WorkingHours is a weekly window in which the doctor sees patients.
+// Weekday follows time.Weekday (0 is Sunday); times are local "HH:MM".
+type WorkingHours struct {
+    ID        uint   `gorm:"primarykey"`
+    DoctorID  uint   `gorm:"not null;index"`
+    Weekday   int    `gorm:"not null"`
+    StartTime string `gorm:"size:5;not null"`
+    EndTime   string `gorm:"size:5;not null"`
+}
+
+// ScheduleBreak is a weekly window carved out of the working hours.
+type ScheduleBreak struct {
+    ID        uint   `gorm:"primarykey"`
+    DoctorID  uint   `gorm:"not null;index"`
+    Weekday   int    `gorm:"not null"`
+    StartTime string `gorm:"size:5;not null"`
+    EndTime   string `gorm:"size:5;not null"`
+}
+
+// LeaveDay is a whole day off. Date is the doctor's local calendar date as
+// YYYY-MM-DD, kept as text so no timezone conversion can shift it.
+type LeaveDay struct {
+    ID       uint   `gorm:"primarykey"`
+    DoctorID uint   `gorm:"not null;uniqueIndex:idx_leave_days_doctor_date"`
+    Date     string `gorm:"size:10;not null;uniqueIndex:idx_leave_days_doctor_date"`
+}
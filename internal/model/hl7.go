@@ -0,0 +1,29 @@
+package model
+
+import (
+    "time"
+)
+
+// PatientIdentifier links a patient to the ID another system knows them by,
+// e.g. the medical record number an admission system puts in its HL7
+// messages. System names the issuer; Value is unique within it.
+type PatientIdentifier struct {
+    ID        uint   `gorm:"primarykey"`
+    PatientID uint   `gorm:"not null;index"`
+    System    string `gorm:"size:64;not null;uniqueIndex:idx_patient_identifiers_system_value"`
+    Value     string `gorm:"size:64;not null;uniqueIndex:idx_patient_identifiers_system_value"`
+    CreatedAt time.Time
+}
+
+// DeadLetter is an inbound HL7 message that could not be applied, kept so it
+// can be reprocessed. Message holds the raw message and is encrypted at
+// rest; Reason says what went wrong on the latest attempt.
+type DeadLetter struct {
+    ID        uint   `gorm:"primarykey"`
+    Source    string `gorm:"size:255;not null"`
+    Message   string `gorm:"type:text;not null;serializer:encrypted"`
+    Reason    string `gorm:"type:text;not null"`
+    Attempts  int    `gorm:"not null"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+    "time"
+)
+
+// Kinds of medical history entry.
+const (
+    EntryDiagnosis  = "diagnosis"
+    EntryAllergy    = "allergy"
+    EntryMedication = "medication"
+    EntryProcedure  = "procedure"
+    EntryNote       = "note"
+)
+
+// MedicalHistoryEntry is one append-only record in a patient's history.
+// AuthorID is nil only for notes carried over from the old free-text field.
+// Description is encrypted at rest.
+type MedicalHistoryEntry struct {
+    ID          uint   `gorm:"primarykey"`
+    PatientID   uint   `gorm:"not null;index"`
+    AuthorID    *uint  `gorm:"index"`
+    Kind        string `gorm:"size:32;not null"`
+    Description string `gorm:"type:text;not null;serializer:encrypted"`
+    CreatedAt   time.Time
+}
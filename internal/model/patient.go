@@ -7,11 +7,19 @@ import (
 
 type Patient struct {
     gorm.Model
-    FirstName      string    `gorm:"not null"`
-    LastName       string    `gorm:"not null"`
-    DateOfBirth    time.Time `gorm:"not null"`
-    Gender         string    `gorm:"not null"`
-    Contact        string
-    Address        string
-    MedicalHistory string
-}
\ No newline at end of file
+    FirstName    string    `gorm:"not null"`
+    LastName     string    `gorm:"not null"`
+    DateOfBirth  time.Time `gorm:"not null"`
+    Gender       string    `gorm:"not null"`
+    // Contact and Address are encrypted at rest. ContactIndex and
+    // AddressIndex hold their blind search tokens (see fieldcrypt).
+    Contact      string    `gorm:"serializer:encrypted"`
+    Address      string    `gorm:"serializer:encrypted"`
+    ContactIndex string    `gorm:"type:text"`
+    AddressIndex string    `gorm:"type:text"`
+    // Version starts at 1 and goes up by one with every update.
+    Version      uint      `gorm:"not null;default:1"`
+    // MergedIntoID is set on a duplicate merged into another patient; the
+    // duplicate is then in the trash.
+    MergedIntoID *uint
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+    "time"
+)
+
+// RefreshToken is one issued refresh token, stored by hash. Tokens rotated
+// from the same login share a FamilyID; revoking the family ends the session.
+type RefreshToken struct {
+    ID        uint      `gorm:"primarykey"`
+    UserID    uint      `gorm:"not null;index"`
+    FamilyID  string    `gorm:"size:64;not null;index"`
+    TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+    ExpiresAt time.Time `gorm:"not null"`
+    UsedAt    *time.Time
+    RevokedAt *time.Time
+    CreatedAt time.Time
+}
+
+// LoginChallenge is a pending second login step, stored by the hash of the
+// opaque token the client holds. It is not a session: it only lets the user
+// finish logging in before ExpiresAt.
+type LoginChallenge struct {
+    ID        uint      `gorm:"primarykey"`
+    UserID    uint      `gorm:"not null;index"`
+    TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+    ExpiresAt time.Time `gorm:"not null;index"`
+    CreatedAt time.Time
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+    "gorm.io/gorm"
+)
+
+// Permission names checked by middleware.RequirePermission.
+const (
+    PermPatientRead         = "patient:read"
+    PermPatientWrite        = "patient:write"
+    PermMedicalHistoryWrite = "medical_history:write"
+    PermUserManage          = "user:manage"
+    PermAuditRead           = "audit:read"
+    PermAppointmentRead     = "appointment:read"
+    PermAppointmentWrite    = "appointment:write"
+    // PermAppointmentAttend marks users who can be booked as the doctor of
+    // an appointment.
+    PermAppointmentAttend   = "appointment:attend"
+    // PermPatientTrash covers listing, restoring and purging deleted
+    // patients.
+    PermPatientTrash        = "patient:trash"
+    // PermPatientExport covers bulk exports of the patient list.
+    PermPatientExport       = "patient:export"
+)
+
+// Built-in role names.
+const (
+    RoleReceptionist = "receptionist"
+    RoleDoctor       = "doctor"
+    RoleAdmin        = "admin"
+)
+
+type Role struct {
+    gorm.Model
+    Name        string       `gorm:"size:64;uniqueIndex;not null"`
+    Permissions []Permission `gorm:"many2many:role_permissions"`
+    // TwoFactorRequired makes every holder of the role sign in with a TOTP
+    // code, enrolling on their next login if they have not yet.
+    TwoFactorRequired bool `gorm:"not null;default:false"`
+}
+
+type Permission struct {
+    gorm.Model
+    Name string `gorm:"size:64;uniqueIndex;not null"`
+}
+
+
+// DefaultRoles returns the roles and permissions the migrations seed, for
+// stores that are not backed by a migrated database.
+func DefaultRoles() []Role {
+    grants := []struct {
+        role        string
+        permissions []string
+        twoFactor   bool
+    }{
+        {RoleReceptionist, []string{PermPatientRead, PermPatientWrite, PermAppointmentRead, PermAppointmentWrite}, false},
+        {RoleDoctor, []string{PermPatientRead, PermMedicalHistoryWrite, PermAppointmentAttend}, true},
+        {RoleAdmin, []string{PermUserManage, PermAuditRead, PermPatientTrash, PermPatientExport}, false},
+    }
+
+    roles := make([]Role, 0, len(grants))
+    for _, grant := range grants {
+        role := Role{Name: grant.role, TwoFactorRequired: grant.twoFactor}
+        for _, permission := range grant.permissions {
+            role.Permissions = append(role.Permissions, Permission{Name: permission})
+        }
+        roles = append(roles, role)
+    }
+    return roles
+}
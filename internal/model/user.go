@@ -1,6 +1,8 @@
 package model
 
 import (
+    "sort"
+    "time"
     "gorm.io/gorm"
 )
 
@@ -8,5 +10,70 @@ type User struct {
     gorm.Model
     Email    string `gorm:"unique;not null"`
     Password string `gorm:"not null"`
-    Role     string `gorm:"not null"`
-}
\ No newline at end of file
+    Roles    []Role `gorm:"many2many:user_roles"`
+    // DeactivatedAt is set while an administrator has disabled the account.
+    DeactivatedAt *time.Time
+    // TOTPSecret is the user's authenticator secret, encrypted at rest. It
+    // is set when enrollment starts and only checked once TOTPEnabledAt is
+    // set by a confirmed code. TOTPLastStep is the time step of the last
+    // code accepted, so a code cannot be used twice.
+    TOTPSecret    string `gorm:"serializer:encrypted"`
+    TOTPEnabledAt *time.Time
+    TOTPLastStep  int64 `gorm:"not null;default:0"`
+}
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+    ID        uint   `gorm:"primarykey"`
+    UserID    uint   `gorm:"not null;index"`
+    CodeHash  string `gorm:"size:64;not null"`
+    UsedAt    *time.Time
+    CreatedAt time.Time
+}
+
+func (u User) Active() bool {
+    return u.DeactivatedAt == nil
+}
+
+// TwoFactorEnabled reports whether signing in needs a TOTP code.
+func (u User) TwoFactorEnabled() bool {
+    return u.TOTPEnabledAt != nil
+}
+
+// TwoFactorRequired reports whether one of the user's roles requires
+// two-factor authentication.
+func (u User) TwoFactorRequired() bool {
+    for _, role := range u.Roles {
+        if role.TwoFactorRequired {
+            return true
+        }
+    }
+    return false
+}
+
+// RoleNames lists the names of the user's roles.
+func (u User) RoleNames() []string {
+    names := make([]string, 0, len(u.Roles))
+    for _, role := range u.Roles {
+        names = append(names, role.Name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Permissions is the sorted union of the permissions of all the user's roles.
+func (u User) Permissions() []string {
+    seen := make(map[string]bool)
+    permissions := []string{}
+    for _, role := range u.Roles {
+        for _, permission := range role.Permissions {
+            if !seen[permission.Name] {
+                seen[permission.Name] = true
+                permissions = append(permissions, permission.Name)
+            }
+        }
+    }
+    sort.Strings(permissions)
+    return permissions
+}
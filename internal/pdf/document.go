@@ -0,0 +1,209 @@
+// Package pdf writes simple text documents as PDF. It uses the standard
+// Helvetica fonts, which every reader has, so no font files are embedded and
+// nothing needs to be downloaded. They only cover WinAnsiEncoding; other
+// text makes WriteTo fail with ErrUnsupportedText.
+package pdf
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// A4 portrait, in points.
+const (
+    pageWidth  = 595.0
+    pageHeight = 842.0
+    margin     = 50.0
+)
+
+const (
+    fontRegular = "F1"
+    fontBold    = "F2"
+)
+
+// Document is a PDF being built top to bottom. Text that does not fit on
+// the current page continues on a new one. The first text that cannot be
+// encoded is kept as an error for WriteTo to return.
+type Document struct {
+    title  string
+    footer string
+    pages  []*bytes.Buffer
+    y      float64
+    err    error
+}
+
+// New starts a document. title is stored in the document properties.
+func New(title string) *Document {
+    d := &Document{title: title}
+    d.newPage()
+    return d
+}
+
+// SetFooter sets text printed at the bottom of every page, left of the
+// page number.
+func (d *Document) SetFooter(text string) {
+    d.footer = text
+}
+
+// Heading writes a large bold line.
+func (d *Document) Heading(text string) {
+    d.paragraph(fontBold, 18, text)
+    d.Space(6)
+}
+
+// Subheading writes a bold section title.
+func (d *Document) Subheading(text string) {
+    d.Space(8)
+    d.paragraph(fontBold, 13, text)
+    d.Space(2)
+}
+
+// Text writes a paragraph, wrapped to the page width.
+func (d *Document) Text(text string) {
+    d.paragraph(fontRegular, 10, text)
+}
+
+// BoldText writes a bold paragraph, wrapped to the page width.
+func (d *Document) BoldText(text string) {
+    d.paragraph(fontBold, 10, text)
+}
+
+// Field writes a label and its value on one line, wrapping long values.
+func (d *Document) Field(label, value string) {
+    const size, labelWidth = 10.0, 110.0
+    lines := wrap(value, fontRegular, size, pageWidth-2*margin-labelWidth)
+    for i, line := range lines {
+        d.ensureSpace(size * 1.4)
+        if i == 0 {
+            d.show(fontBold, size, margin, label)
+        }
+        d.show(fontRegular, size, margin+labelWidth, line)
+        d.y -= size * 1.4
+    }
+}
+
+// Space adds vertical space in points.
+func (d *Document) Space(points float64) {
+    d.y -= points
+}
+
+// WriteTo writes the finished PDF. If any text could not be encoded it
+// writes nothing and returns an error wrapping ErrUnsupportedText.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+    var out bytes.Buffer
+    var offsets []int
+    object := func(body string) {
+        offsets = append(offsets, out.Len())
+        fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+    }
+
+    out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+    // Objects 1 to 5 are fixed; each page then takes a page object
+    // followed by its content stream.
+    kids := make([]string, len(d.pages))
+    for i := range d.pages {
+        kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+    }
+    object("<< /Type /Catalog /Pages 2 0 R >>")
+    object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+    object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+    object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+    object(fmt.Sprintf("<< /Title %s /Producer (makerble-assessment) >>", d.literal(d.title)))
+
+    for i, page := range d.pages {
+        content := bytes.NewBuffer(append([]byte(nil), page.Bytes()...))
+        footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+        if d.footer != "" {
+            fmt.Fprintf(content, "BT /%s 8 Tf %.2f %.2f Td %s Tj ET\n", fontRegular, margin, margin/2, d.literal(d.footer))
+        }
+        fmt.Fprintf(content, "BT /%s 8 Tf %.2f %.2f Td %s Tj ET\n", fontRegular,
+            pageWidth-margin-textWidth(footer, fontRegular, 8), margin/2, d.literal(footer))
+
+        object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+            pageWidth, pageHeight, fontRegular, fontBold, len(offsets)+2))
+        object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()))
+    }
+
+    xref := out.Len()
+    fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+    for _, offset := range offsets {
+        fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+    }
+    fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+    if d.err != nil {
+        return 0, d.err
+    }
+    return out.WriteTo(w)
+}
+
+func (d *Document) newPage() {
+    d.pages = append(d.pages, new(bytes.Buffer))
+    d.y = pageHeight - margin
+}
+
+// ensureSpace starts a new page unless height points still fit above the
+// bottom margin.
+func (d *Document) ensureSpace(height float64) {
+    if d.y-height < margin {
+        d.newPage()
+    }
+}
+
+func (d *Document) paragraph(font string, size float64, text string) {
+    for _, line := range wrap(text, font, size, pageWidth-2*margin) {
+        d.ensureSpace(size * 1.4)
+        d.show(font, size, margin, line)
+        d.y -= size * 1.4
+    }
+}
+
+// show draws one line with its baseline size points below the cursor.
+func (d *Document) show(font string, size, x float64, text string) {
+    fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font, size, x, d.y-size, d.literal(text))
+}
+
+// literal encodes text, keeping the first encoding error for WriteTo.
+func (d *Document) literal(text string) string {
+    encoded, err := literal(text)
+    if err != nil && d.err == nil {
+        d.err = err
+    }
+    return encoded
+}
+
+// wrap splits text into lines no wider than width, breaking at spaces and
+// at newlines. Words longer than a line are split.
+func wrap(text, font string, size, width float64) []string {
+    var lines []string
+    for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+        line := ""
+        for _, word := range strings.Fields(paragraph) {
+            for textWidth(word, font, size) > width {
+                cut := 1
+                for cut < len([]rune(word)) && textWidth(string([]rune(word)[:cut+1]), font, size) <= width {
+                    cut++
+                }
+                if line != "" {
+                    lines = append(lines, line)
+                    line = ""
+                }
+                lines = append(lines, string([]rune(word)[:cut]))
+                word = string([]rune(word)[cut:])
+            }
+            switch {
+            case line == "":
+                line = word
+            case textWidth(line+" "+word, font, size) <= width:
+                line += " " + word
+            default:
+                lines = append(lines, line)
+                line = word
+            }
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
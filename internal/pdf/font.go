@@ -0,0 +1,76 @@
+package pdf
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrUnsupportedText is returned for text the standard fonts cannot show:
+// any character outside WinAnsiEncoding, such as Cyrillic, Greek or CJK.
+var ErrUnsupportedText = errors.New("text has characters the PDF fonts cannot show")
+
+// helveticaWidths are the Helvetica advance widths of the printable ASCII
+// characters from space to tilde, in thousandths of the font size.
+var helveticaWidths = [95]int{
+    278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+    556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+    1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+    667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+    333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+    556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsiExtras are the characters WinAnsiEncoding places in 0x80-0x9F,
+// where Latin-1 has control codes.
+var winAnsiExtras = map[rune]byte{
+    '€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+    '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+    '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+    'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// textWidth is the width of text in points. Bold text is measured a little
+// wide so wrapped lines never overflow; other characters count as a digit.
+func textWidth(text, font string, size float64) float64 {
+    total := 0
+    for _, r := range text {
+        if r >= ' ' && r <= '~' {
+            total += helveticaWidths[r-' ']
+        } else {
+            total += 556
+        }
+    }
+    width := float64(total) * size / 1000
+    if font == fontBold {
+        width *= 1.1
+    }
+    return width
+}
+
+// literal encodes text as a PDF string in WinAnsiEncoding. Text with a
+// character it cannot represent gives ErrUnsupportedText rather than a
+// string with that character dropped.
+func literal(text string) (string, error) {
+    var b strings.Builder
+    b.WriteByte('(')
+    for _, r := range text {
+        var c byte
+        switch extra, ok := winAnsiExtras[r]; {
+        case ok:
+            c = extra
+        case r == '\t':
+            c = ' '
+        case r >= ' ' && r <= '~', r >= 0xA0 && r <= 0xFF:
+            c = byte(r)
+        default:
+            return "", fmt.Errorf("%w: %q", ErrUnsupportedText, r)
+        }
+        if c == '(' || c == ')' || c == '\\' {
+            b.WriteByte('\\')
+        }
+        b.WriteByte(c)
+    }
+    b.WriteByte(')')
+    return b.String(), nil
+}
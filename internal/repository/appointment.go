@@ -0,0 +1,117 @@
+package repository
+
+import (
+    "errors"
+    "time"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "makerble-assessment/internal/model"
+)
+
+var ErrAppointmentOverlap = errors.New("the doctor already has an appointment at that time")
+
+// AppointmentQuery selects one page of appointments ordered by start time.
+// From and To keep appointments overlapping that window. Zero-valued filters
+// are ignored and a Limit of -1 returns every match.
+type AppointmentQuery struct {
+    Offset    int
+    Limit     int
+    DoctorID  uint
+    PatientID uint
+    Status    string
+    From      *time.Time
+    To        *time.Time
+}
+
+type AppointmentRepository struct {
+    db *gorm.DB
+}
+
+func NewAppointmentRepository(db *gorm.DB) *AppointmentRepository {
+    return &AppointmentRepository{db: db}
+}
+
+// Create inserts a scheduled appointment unless it overlaps another one of
+// the same doctor, in which case it returns ErrAppointmentOverlap.
+func (r *AppointmentRepository) Create(appointment *model.Appointment) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := checkOverlap(tx, appointment); err != nil {
+            return err
+        }
+        return tx.Create(appointment).Error
+    })
+}
+
+// Update saves an appointment with the same overlap check as Create.
+func (r *AppointmentRepository) Update(appointment *model.Appointment) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := checkOverlap(tx, appointment); err != nil {
+            return err
+        }
+        return tx.Save(appointment).Error
+    })
+}
+
+func (r *AppointmentRepository) FindByID(id uint) (model.Appointment, error) {
+    var appointment model.Appointment
+    err := r.db.First(&appointment, id).Error
+    return appointment, err
+}
+
+func (r *AppointmentRepository) FindPage(query AppointmentQuery) ([]model.Appointment, int64, error) {
+    tx := r.db.Model(&model.Appointment{})
+    if query.DoctorID != 0 {
+        tx = tx.Where("doctor_id = ?", query.DoctorID)
+    }
+    if query.PatientID != 0 {
+        tx = tx.Where("patient_id = ?", query.PatientID)
+    }
+    if query.Status != "" {
+        tx = tx.Where("status = ?", query.Status)
+    }
+    if query.From != nil {
+        tx = tx.Where("ends_at > ?", *query.From)
+    }
+    if query.To != nil {
+        tx = tx.Where("starts_at < ?", *query.To)
+    }
+    tx = tx.Session(&gorm.Session{})
+
+    var total int64
+    if err := tx.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+
+    var appointments []model.Appointment
+    err := tx.Order("starts_at").Order("id").Offset(query.Offset).Limit(query.Limit).Find(&appointments).Error
+    return appointments, total, err
+}
+
+// checkOverlap rejects a scheduled appointment that overlaps another
+// scheduled appointment of its doctor. Locking the doctor's user row first
+// serializes concurrent bookings for that doctor on MySQL and Postgres;
+// SQLite only ever has one writer.
+func checkOverlap(tx *gorm.DB, appointment *model.Appointment) error {
+    if appointment.Status != model.AppointmentScheduled {
+        return nil
+    }
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&model.User{}, appointment.DoctorID).Error; err != nil {
+        return err
+    }
+
+    overlapping := tx.Model(&model.Appointment{}).
+        Where("doctor_id = ? AND status = ?", appointment.DoctorID, model.AppointmentScheduled).
+        Where("starts_at < ? AND ends_at > ?", appointment.EndsAt, appointment.StartsAt)
+    if appointment.ID != 0 {
+        overlapping = overlapping.Where("id <> ?", appointment.ID)
+    }
+
+    var count int64
+    if err := overlapping.Count(&count).Error; err != nil {
+        return err
+    }
+    if count > 0 {
+        return ErrAppointmentOverlap
+    }
+    return nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+    "crypto/rand"
+    "encoding/base64"
+    "time"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/model"
+)
+
+// AuditQuery selects one page of audit logs, newest first. Zero-valued
+// filters are ignored.
+type AuditQuery struct {
+    Offset    int
+    Limit     int
+    UserID    uint
+    PatientID uint
+    From      *time.Time
+    To        *time.Time
+}
+
+type AuditLogRepository struct {
+    db *gorm.DB
+}
+
+func NewAuditLogRepository(db *gorm.DB) *AuditLogRepository {
+    return &AuditLogRepository{db: db}
+}
+
+// Create inserts the entries in a single statement. Changes are sealed with
+// their patient's audit key, created on first use.
+func (r *AuditLogRepository) Create(entries []model.AuditLog) error {
+    if len(entries) == 0 {
+        return nil
+    }
+
+    rows := make([]model.AuditLog, len(entries))
+    copy(rows, entries)
+    rings := make(map[uint]*fieldcrypt.KeyRing)
+    for i := range rows {
+        if rows[i].Changes == "" {
+            continue
+        }
+        ring, ok := rings[rows[i].PatientID]
+        if !ok {
+            var err error
+            if ring, err = r.createKey(rows[i].PatientID); err != nil {
+                return err
+            }
+            rings[rows[i].PatientID] = ring
+        }
+        sealed, err := ring.Encrypt(changesColumn, rows[i].Changes)
+        if err != nil {
+            return err
+        }
+        rows[i].Changes = sealed
+    }
+
+    if err := r.db.Create(&rows).Error; err != nil {
+        return err
+    }
+    for i := range rows {
+        entries[i].ID = rows[i].ID
+        entries[i].CreatedAt = rows[i].CreatedAt
+    }
+    return nil
+}
+
+// changesColumn binds sealed changes to the column they were written for.
+const changesColumn = "changes"
+
+// Erase deletes the audit keys of the patients, which leaves the changes of
+// their entries unreadable. The entries themselves stay.
+func (r *AuditLogRepository) Erase(patientIDs ...uint) error {
+    if len(patientIDs) == 0 {
+        return nil
+    }
+    return r.db.Where("patient_id IN ?", patientIDs).Delete(&model.AuditKey{}).Error
+}
+
+// createKey returns the patient's audit key, storing a new one if they have
+// none yet.
+func (r *AuditLogRepository) createKey(patientID uint) (*fieldcrypt.KeyRing, error) {
+    secret := make([]byte, fieldcrypt.KeySize)
+    if _, err := rand.Read(secret); err != nil {
+        return nil, err
+    }
+    // A concurrent write may have stored the key first; either way the
+    // stored one is read back.
+    key := model.AuditKey{PatientID: patientID, Secret: base64.StdEncoding.EncodeToString(secret)}
+    if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&key).Error; err != nil {
+        return nil, err
+    }
+    if err := r.db.Where("patient_id = ?", patientID).Take(&key).Error; err != nil {
+        return nil, err
+    }
+    return auditKeyRing(key)
+}
+
+func auditKeyRing(key model.AuditKey) (*fieldcrypt.KeyRing, error) {
+    secret, err := base64.StdEncoding.DecodeString(key.Secret)
+    if err != nil {
+        return nil, err
+    }
+    sealing, err := fieldcrypt.NewKey("patient", secret)
+    if err != nil {
+        return nil, err
+    }
+    return fieldcrypt.NewKeyRing(sealing)
+}
+
+func (r *AuditLogRepository) FindPage(query AuditQuery) ([]model.AuditLog, int64, error) {
+    tx := r.db.Model(&model.AuditLog{})
+    if query.UserID != 0 {
+        tx = tx.Where("user_id = ?", query.UserID)
+    }
+    if query.PatientID != 0 {
+        tx = tx.Where("patient_id = ?", query.PatientID)
+    }
+    if query.From != nil {
+        tx = tx.Where("created_at >= ?", *query.From)
+    }
+    if query.To != nil {
+        tx = tx.Where("created_at <= ?", *query.To)
+    }
+    tx = tx.Session(&gorm.Session{})
+
+    var total int64
+    if err := tx.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+
+    var entries []model.AuditLog
+    err := tx.Order("created_at DESC").Order("id DESC").Offset(query.Offset).Limit(query.Limit).Find(&entries).Error
+    if err != nil {
+        return nil, 0, err
+    }
+    return entries, total, r.open(entries)
+}
+
+// open decrypts the changes of entries in place. Entries of patients whose
+// key was erased lose their changes and are marked ChangesErased.
+func (r *AuditLogRepository) open(entries []model.AuditLog) error {
+    var patientIDs []uint
+    for _, entry := range entries {
+        if entry.Changes != "" {
+            patientIDs = append(patientIDs, entry.PatientID)
+        }
+    }
+    if len(patientIDs) == 0 {
+        return nil
+    }
+
+    var keys []model.AuditKey
+    if err := r.db.Where("patient_id IN ?", patientIDs).Find(&keys).Error; err != nil {
+        return err
+    }
+    rings := make(map[uint]*fieldcrypt.KeyRing, len(keys))
+    for _, key := range keys {
+        ring, err := auditKeyRing(key)
+        if err != nil {
+            return err
+        }
+        rings[key.PatientID] = ring
+    }
+
+    for i := range entries {
+        if entries[i].Changes == "" {
+            continue
+        }
+        ring, ok := rings[entries[i].PatientID]
+        if !ok {
+            entries[i].Changes = ""
+            entries[i].ChangesErased = true
+            continue
+        }
+        changes, err := ring.Decrypt(changesColumn, entries[i].Changes)
+        if err != nil {
+            return err
+        }
+        entries[i].Changes = changes
+    }
+    return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "makerble-assessment/internal/model"
+)
+
+type AvailabilityRepository struct {
+    db *gorm.DB
+}
+
+func NewAvailabilityRepository(db *gorm.DB) *AvailabilityRepository {
+    return &AvailabilityRepository{db: db}
+}
+
+// Find loads a doctor's schedule with its working hours, breaks and leave
+// days in the order they were saved.
+func (r *AvailabilityRepository) Find(doctorID uint) (model.DoctorSchedule, error) {
+    var schedule model.DoctorSchedule
+    byID := func(db *gorm.DB) *gorm.DB { return db.Order("id") }
+    err := r.db.Preload("WorkingHours", byID).Preload("Breaks", byID).Preload("LeaveDays", byID).
+        First(&schedule, "doctor_id = ?", doctorID).Error
+    return schedule, err
+}
+
+// Replace stores schedule as the doctor's complete availability, dropping
+// whatever was published before.
+func (r *AvailabilityRepository) Replace(schedule *model.DoctorSchedule) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Omit(clause.Associations).Save(schedule).Error; err != nil {
+            return err
+        }
+        for _, table := range []interface{}{&model.WorkingHours{}, &model.ScheduleBreak{}, &model.LeaveDay{}} {
+            if err := tx.Where("doctor_id = ?", schedule.DoctorID).Delete(table).Error; err != nil {
+                return err
+            }
+        }
+
+        for i := range schedule.WorkingHours {
+            schedule.WorkingHours[i].ID = 0
+            schedule.WorkingHours[i].DoctorID = schedule.DoctorID
+        }
+        for i := range schedule.Breaks {
+            schedule.Breaks[i].ID = 0
+            schedule.Breaks[i].DoctorID = schedule.DoctorID
+        }
+        for i := range schedule.LeaveDays {
+            schedule.LeaveDays[i].ID = 0
+            schedule.LeaveDays[i].DoctorID = schedule.DoctorID
+        }
+        if len(schedule.WorkingHours) > 0 {
+            if err := tx.Create(&schedule.WorkingHours).Error; err != nil {
+                return err
+            }
+        }
+        if len(schedule.Breaks) > 0 {
+            if err := tx.Create(&schedule.Breaks).Error; err != nil {
+                return err
+            }
+        }
+        if len(schedule.LeaveDays) > 0 {
+            if err := tx.Create(&schedule.LeaveDays).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
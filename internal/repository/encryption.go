@@ -0,0 +1,187 @@
+package repository
+
+import (
+    "gorm.io/gorm"
+    "makerble-assessment/internal/fieldcrypt"
+)
+
+// patientColumns and historyColumns read the stored, still encrypted values
+// without going through the encrypted serializer.
+type patientColumns struct {
+    ID           uint
+    Contact      string
+    Address      string
+    ContactIndex string
+    AddressIndex string
+}
+
+type historyColumns struct {
+    ID          uint
+    Description string
+}
+
+type auditKeyColumns struct {
+    PatientID uint
+    Secret    string
+}
+
+// RotationResult counts the rows RotateEncryption rewrote per table.
+type RotationResult struct {
+    Patients       int
+    MedicalHistory int
+    AuditKeys      int
+}
+
+// RotateEncryption re-encrypts every patient contact and address, medical
+// history description and patient audit key that is still plaintext or
+// sealed with a retired key, using ring's current key, and rebuilds the
+// patient search index. Rows go in batches of batchSize, one transaction
+// each, so it can run against a live database and be re-run after a
+// failure. Audit log diffs are sealed with the audit keys, not the ring, so
+// once this has run no row needs a retired key.
+func RotateEncryption(db *gorm.DB, ring *fieldcrypt.KeyRing, batchSize int) (RotationResult, error) {
+    var result RotationResult
+
+    var lastID uint
+    for {
+        var rows []patientColumns
+        err := db.Table("patients").
+            Select("id, COALESCE(contact, '') AS contact, COALESCE(address, '') AS address, COALESCE(contact_index, '') AS contact_index, COALESCE(address_index, '') AS address_index").
+            Where("id > ?", lastID).Order("id").Limit(batchSize).Scan(&rows).Error
+        if err != nil {
+            return result, err
+        }
+        if len(rows) == 0 {
+            break
+        }
+        lastID = rows[len(rows)-1].ID
+
+        err = db.Transaction(func(tx *gorm.DB) error {
+            for _, row := range rows {
+                changes, err := rotatePatient(ring, row)
+                if err != nil {
+                    return err
+                }
+                if len(changes) == 0 {
+                    continue
+                }
+                if err := tx.Table("patients").Where("id = ?", row.ID).UpdateColumns(changes).Error; err != nil {
+                    return err
+                }
+                result.Patients++
+            }
+            return nil
+        })
+        if err != nil {
+            return result, err
+        }
+        if len(rows) < batchSize {
+            break
+        }
+    }
+
+    lastID = 0
+    for {
+        var rows []historyColumns
+        err := db.Table("medical_history_entries").Select("id, description").
+            Where("id > ?", lastID).Order("id").Limit(batchSize).Scan(&rows).Error
+        if err != nil {
+            return result, err
+        }
+        if len(rows) == 0 {
+            break
+        }
+        lastID = rows[len(rows)-1].ID
+
+        err = db.Transaction(func(tx *gorm.DB) error {
+            for _, row := range rows {
+                if !ring.NeedsRotation(row.Description) {
+                    continue
+                }
+                sealed, err := reencrypt(ring, "description", row.Description)
+                if err != nil {
+                    return err
+                }
+                if err := tx.Table("medical_history_entries").Where("id = ?", row.ID).UpdateColumn("description", sealed).Error; err != nil {
+                    return err
+                }
+                result.MedicalHistory++
+            }
+            return nil
+        })
+        if err != nil {
+            return result, err
+        }
+        if len(rows) < batchSize {
+            break
+        }
+    }
+
+    var lastPatientID uint
+    for {
+        var rows []auditKeyColumns
+        err := db.Table("audit_keys").Select("patient_id, secret").
+            Where("patient_id > ?", lastPatientID).Order("patient_id").Limit(batchSize).Scan(&rows).Error
+        if err != nil || len(rows) == 0 {
+            return result, err
+        }
+        lastPatientID = rows[len(rows)-1].PatientID
+
+        err = db.Transaction(func(tx *gorm.DB) error {
+            for _, row := range rows {
+                if !ring.NeedsRotation(row.Secret) {
+                    continue
+                }
+                sealed, err := reencrypt(ring, "secret", row.Secret)
+                if err != nil {
+                    return err
+                }
+                if err := tx.Table("audit_keys").Where("patient_id = ?", row.PatientID).UpdateColumn("secret", sealed).Error; err != nil {
+                    return err
+                }
+                result.AuditKeys++
+            }
+            return nil
+        })
+        if err != nil {
+            return result, err
+        }
+        if len(rows) < batchSize {
+            return result, nil
+        }
+    }
+}
+
+// rotatePatient returns the columns of row that need rewriting.
+func rotatePatient(ring *fieldcrypt.KeyRing, row patientColumns) (map[string]interface{}, error) {
+    changes := make(map[string]interface{})
+    for _, field := range []struct {
+        column, indexColumn string
+        value, index        string
+    }{
+        {"contact", "contact_index", row.Contact, row.ContactIndex},
+        {"address", "address_index", row.Address, row.AddressIndex},
+    } {
+        plaintext, err := ring.Decrypt(field.column, field.value)
+        if err != nil {
+            return nil, err
+        }
+        if ring.NeedsRotation(field.value) {
+            if changes[field.column], err = ring.Encrypt(field.column, plaintext); err != nil {
+                return nil, err
+            }
+        }
+        if index := ring.SearchIndex(plaintext); index != field.index {
+            changes[field.indexColumn] = index
+        }
+    }
+    return changes, nil
+}
+
+func reencrypt(ring *fieldcrypt.KeyRing, column, value string) (string, error) {
+    plaintext, err := ring.Decrypt(column, value)
+    if err != nil {
+        return "", err
+    }
+    return ring.Encrypt(column, plaintext)
+}
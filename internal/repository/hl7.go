@@ -0,0 +1,62 @@
+package repository
+
+import (
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+)
+
+type PatientIdentifierRepository struct {
+    db *gorm.DB
+}
+
+func NewPatientIdentifierRepository(db *gorm.DB) *PatientIdentifierRepository {
+    return &PatientIdentifierRepository{db: db}
+}
+
+func (r *PatientIdentifierRepository) Create(identifier *model.PatientIdentifier) error {
+    return r.db.Create(identifier).Error
+}
+
+// Find returns the identifier value issued by system, or
+// gorm.ErrRecordNotFound. The condition is a struct so GORM quotes the
+// column names, since SYSTEM is a reserved word in MySQL.
+func (r *PatientIdentifierRepository) Find(system, value string) (model.PatientIdentifier, error) {
+    var identifier model.PatientIdentifier
+    err := r.db.Where(&model.PatientIdentifier{System: system, Value: value}).First(&identifier).Error
+    return identifier, err
+}
+
+type DeadLetterRepository struct {
+    db *gorm.DB
+}
+
+func NewDeadLetterRepository(db *gorm.DB) *DeadLetterRepository {
+    return &DeadLetterRepository{db: db}
+}
+
+func (r *DeadLetterRepository) Create(letter *model.DeadLetter) error {
+    return r.db.Create(letter).Error
+}
+
+func (r *DeadLetterRepository) FindByID(id uint) (model.DeadLetter, error) {
+    var letter model.DeadLetter
+    err := r.db.First(&letter, id).Error
+    return letter, err
+}
+
+// FindAfter returns up to limit dead letters with IDs above afterID, oldest
+// first, so callers can walk them in batches.
+func (r *DeadLetterRepository) FindAfter(afterID uint, limit int) ([]model.DeadLetter, error) {
+    letters := []model.DeadLetter{}
+    err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&letters).Error
+    return letters, err
+}
+
+// Update stores a failed retry: the new reason and attempt count.
+func (r *DeadLetterRepository) Update(letter *model.DeadLetter) error {
+    return r.db.Model(letter).Select("Reason", "Attempts").Updates(letter).Error
+}
+
+func (r *DeadLetterRepository) Delete(id uint) error {
+    return r.db.Delete(&model.DeadLetter{}, id).Error
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+    "sync"
+    "time"
+)
+
+// limiterSweepEvery is how many writes MemoryLimiterStore takes between
+// sweeps of its expired counters.
+const limiterSweepEvery = 1024
+
+// MemoryLimiterStore is a LimiterStore held in process memory. Limits kept
+// in it are per server and reset when it restarts.
+type MemoryLimiterStore struct {
+    mu       sync.Mutex
+    counters map[string]limiterCounter
+    writes   int
+}
+
+type limiterCounter struct {
+    value   int64
+    expires time.Time
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+    return &MemoryLimiterStore{counters: make(map[string]limiterCounter)}
+}
+
+// Incr adds one to the counter at key, starting it at 1 to expire after ttl
+// if there is none, and returns the count and the time it has left.
+func (s *MemoryLimiterStore) Incr(key string, ttl time.Duration) (int64, time.Duration, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    counter, ok := s.live(key, now)
+    if !ok {
+        counter = limiterCounter{expires: now.Add(ttl)}
+    }
+    counter.value++
+    s.write(key, counter, now)
+    return counter.value, counter.expires.Sub(now), nil
+}
+
+// Get returns the counter at key and the time it has left.
+func (s *MemoryLimiterStore) Get(key string) (int64, time.Duration, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    counter, ok := s.live(key, now)
+    if !ok {
+        return 0, 0, nil
+    }
+    return counter.value, counter.expires.Sub(now), nil
+}
+
+// Set replaces the counter at key with value, to expire after ttl.
+func (s *MemoryLimiterStore) Set(key string, value int64, ttl time.Duration) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    s.write(key, limiterCounter{value: value, expires: now.Add(ttl)}, now)
+    return nil
+}
+
+func (s *MemoryLimiterStore) Delete(keys ...string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, key := range keys {
+        delete(s.counters, key)
+    }
+    return nil
+}
+
+func (s *MemoryLimiterStore) live(key string, now time.Time) (limiterCounter, bool) {
+    counter, ok := s.counters[key]
+    if !ok || !counter.expires.After(now) {
+        return limiterCounter{}, false
+    }
+    return counter, true
+}
+
+// write stores counter, sweeping out expired ones now and then so keys that
+// are never seen again do not pile up.
+func (s *MemoryLimiterStore) write(key string, counter limiterCounter, now time.Time) {
+    s.counters[key] = counter
+    if s.writes++; s.writes < limiterSweepEvery {
+        return
+    }
+    s.writes = 0
+    for key, counter := range s.counters {
+        if !counter.expires.After(now) {
+            delete(s.counters, key)
+        }
+    }
+}
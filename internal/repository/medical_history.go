@@ -0,0 +1,28 @@
+package repository
+
+import (
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+)
+
+type MedicalHistoryRepository struct {
+    db *gorm.DB
+}
+
+func NewMedicalHistoryRepository(db *gorm.DB) *MedicalHistoryRepository {
+    return &MedicalHistoryRepository{db: db}
+}
+
+func (r *MedicalHistoryRepository) Create(entry *model.MedicalHistoryEntry) error {
+    return r.db.Create(entry).Error
+}
+
+// FindByPatients returns the entries of the given patients, oldest first.
+func (r *MedicalHistoryRepository) FindByPatients(patientIDs ...uint) ([]model.MedicalHistoryEntry, error) {
+    entries := []model.MedicalHistoryEntry{}
+    if len(patientIDs) == 0 {
+        return entries, nil
+    }
+    err := r.db.Where("patient_id IN ?", patientIDs).Order("created_at, id").Find(&entries).Error
+    return entries, err
+}
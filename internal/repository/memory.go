@@ -0,0 +1,1042 @@
+package repository
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+)
+
+// MemoryPatientRepository is an in-process PatientStore for tests and
+// storage-free development. Deletes are soft, as with the GORM repository.
+// Missing records are reported as gorm.ErrRecordNotFound so callers can
+// treat both implementations alike.
+type MemoryPatientRepository struct {
+    mu       sync.RWMutex
+    nextID   uint
+    patients map[uint]model.Patient
+}
+
+func NewMemoryPatientRepository() *MemoryPatientRepository {
+    return &MemoryPatientRepository{patients: make(map[uint]model.Patient)}
+}
+
+func (r *MemoryPatientRepository) Create(patient *model.Patient) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.nextID++
+    now := time.Now()
+    patient.ID = r.nextID
+    patient.CreatedAt = now
+    patient.UpdatedAt = now
+    if patient.Version == 0 {
+        patient.Version = 1
+    }
+    r.patients[patient.ID] = *patient
+    return nil
+}
+
+func (r *MemoryPatientRepository) CreateBatch(patients []model.Patient) error {
+    for i := range patients {
+        if err := r.Create(&patients[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r *MemoryPatientRepository) FindPage(query PatientQuery) ([]model.Patient, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var patients []model.Patient
+    for _, patient := range r.patients {
+        if matchesPatientQuery(patient, query) {
+            patients = append(patients, patient)
+        }
+    }
+
+    sort.Slice(patients, func(i, j int) bool {
+        a, b := patients[i], patients[j]
+        if query.Descending {
+            a, b = b, a
+        }
+        switch query.Sort {
+        case SortByName:
+            if a.LastName != b.LastName {
+                return a.LastName < b.LastName
+            }
+            if a.FirstName != b.FirstName {
+                return a.FirstName < b.FirstName
+            }
+        case SortByDateOfBirth:
+            if !a.DateOfBirth.Equal(b.DateOfBirth) {
+                return a.DateOfBirth.Before(b.DateOfBirth)
+            }
+        default:
+            if !a.CreatedAt.Equal(b.CreatedAt) {
+                return a.CreatedAt.Before(b.CreatedAt)
+            }
+        }
+        return a.ID < b.ID
+    })
+
+    total := int64(len(patients))
+    if query.Offset >= len(patients) {
+        return nil, total, nil
+    }
+    patients = patients[query.Offset:]
+    if query.Limit > 0 && query.Limit < len(patients) {
+        patients = patients[:query.Limit]
+    }
+    return patients, total, nil
+}
+
+func (r *MemoryPatientRepository) FindBatch(query PatientQuery, afterID uint, limit int) ([]model.Patient, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var patients []model.Patient
+    for _, patient := range r.patients {
+        if patient.ID > afterID && matchesPatientQuery(patient, query) {
+            patients = append(patients, patient)
+        }
+    }
+    sort.Slice(patients, func(i, j int) bool { return patients[i].ID < patients[j].ID })
+    if limit < len(patients) {
+        patients = patients[:limit]
+    }
+    return patients, nil
+}
+
+// matchesPatientQuery applies the filters of query to a live patient.
+func matchesPatientQuery(patient model.Patient, query PatientQuery) bool {
+    prefix := strings.ToLower(query.NamePrefix)
+    switch {
+    case patient.DeletedAt.Valid:
+    case query.Gender != "" && patient.Gender != query.Gender:
+    case query.DOBFrom != nil && patient.DateOfBirth.Before(*query.DOBFrom):
+    case query.DOBTo != nil && patient.DateOfBirth.After(*query.DOBTo):
+    case prefix != "" && !strings.HasPrefix(strings.ToLower(patient.FirstName), prefix) &&
+        !strings.HasPrefix(strings.ToLower(patient.LastName), prefix):
+    default:
+        return true
+    }
+    return false
+}
+
+func (r *MemoryPatientRepository) FindByID(id uint) (model.Patient, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    patient, ok := r.patients[id]
+    if !ok || patient.DeletedAt.Valid {
+        return model.Patient{}, gorm.ErrRecordNotFound
+    }
+    return patient, nil
+}
+
+func (r *MemoryPatientRepository) Search(text string, limit int) ([]PatientMatch, error) {
+    terms := searchTerms(text)
+    if len(terms) == 0 {
+        return nil, nil
+    }
+
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var matches []PatientMatch
+    for _, patient := range r.patients {
+        if patient.DeletedAt.Valid {
+            continue
+        }
+        if score, ok := likeScore(patient, terms); ok {
+            matches = append(matches, PatientMatch{Patient: patient, Score: score})
+        }
+    }
+
+    sort.Slice(matches, func(i, j int) bool {
+        if matches[i].Score != matches[j].Score {
+            return matches[i].Score > matches[j].Score
+        }
+        return matches[i].ID < matches[j].ID
+    })
+    if limit > 0 && limit < len(matches) {
+        matches = matches[:limit]
+    }
+    return matches, nil
+}
+
+func (r *MemoryPatientRepository) Update(id, expectedVersion uint, changes map[string]interface{}) (model.Patient, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    patient, ok := r.patients[id]
+    if !ok || patient.DeletedAt.Valid {
+        return model.Patient{}, gorm.ErrRecordNotFound
+    }
+    if expectedVersion != 0 && patient.Version != expectedVersion {
+        return patient, ErrVersionConflict
+    }
+
+    for column, value := range changes {
+        switch column {
+        case "first_name":
+            patient.FirstName = value.(string)
+        case "last_name":
+            patient.LastName = value.(string)
+        case "date_of_birth":
+            patient.DateOfBirth = value.(time.Time)
+        case "gender":
+            patient.Gender = value.(string)
+        case "contact":
+            patient.Contact = value.(string)
+        case "address":
+            patient.Address = value.(string)
+        default:
+            return model.Patient{}, errors.New("unknown patient column " + column)
+        }
+    }
+    patient.Version++
+    patient.UpdatedAt = time.Now()
+    r.patients[id] = patient
+    return patient, nil
+}
+
+func (r *MemoryPatientRepository) Delete(id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    patient, ok := r.patients[id]
+    if !ok || patient.DeletedAt.Valid {
+        return gorm.ErrRecordNotFound
+    }
+    patient.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+    r.patients[id] = patient
+    return nil
+}
+
+func (r *MemoryPatientRepository) FindDeletedPage(offset, limit int) ([]model.Patient, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var patients []model.Patient
+    for _, patient := range r.patients {
+        if patient.DeletedAt.Valid {
+            patients = append(patients, patient)
+        }
+    }
+    sort.Slice(patients, func(i, j int) bool {
+        a, b := patients[i], patients[j]
+        if !a.DeletedAt.Time.Equal(b.DeletedAt.Time) {
+            return a.DeletedAt.Time.After(b.DeletedAt.Time)
+        }
+        return a.ID > b.ID
+    })
+
+    total := int64(len(patients))
+    if offset >= len(patients) {
+        return nil, total, nil
+    }
+    patients = patients[offset:]
+    if limit > 0 && limit < len(patients) {
+        patients = patients[:limit]
+    }
+    return patients, total, nil
+}
+
+func (r *MemoryPatientRepository) Restore(id uint) (model.Patient, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    patient, ok := r.patients[id]
+    if !ok || !patient.DeletedAt.Valid {
+        return model.Patient{}, gorm.ErrRecordNotFound
+    }
+    if patient.MergedIntoID != nil {
+        return model.Patient{}, ErrPatientMerged
+    }
+    patient.DeletedAt = gorm.DeletedAt{}
+    r.patients[id] = patient
+    return patient, nil
+}
+
+// Merge only moves the duplicate to the trash, marked as merged; the memory
+// stores share no state, so there are no dependents to move.
+func (r *MemoryPatientRepository) Merge(duplicateID, survivorID uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    duplicate, ok := r.patients[duplicateID]
+    survivor, found := r.patients[survivorID]
+    if !ok || !found || duplicate.DeletedAt.Valid || survivor.DeletedAt.Valid {
+        return gorm.ErrRecordNotFound
+    }
+    duplicate.MergedIntoID = &survivorID
+    duplicate.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+    r.patients[duplicateID] = duplicate
+    return nil
+}
+
+// Purge only removes the patient; the memory stores share no state, so
+// there are no dependents to remove with it.
+func (r *MemoryPatientRepository) Purge(id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    patient, ok := r.patients[id]
+    if !ok || !patient.DeletedAt.Valid {
+        return gorm.ErrRecordNotFound
+    }
+    delete(r.patients, id)
+    return nil
+}
+
+func (r *MemoryPatientRepository) PurgeDeletedBefore(cutoff time.Time, limit int) ([]uint, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    var ids []uint
+    for id, patient := range r.patients {
+        if patient.DeletedAt.Valid && patient.DeletedAt.Time.Before(cutoff) {
+            ids = append(ids, id)
+        }
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    if limit > 0 && len(ids) > limit {
+        ids = ids[:limit]
+    }
+    for _, id := range ids {
+        delete(r.patients, id)
+    }
+    return ids, nil
+}
+
+// MemoryMedicalHistoryRepository is an in-process MedicalHistoryStore.
+type MemoryMedicalHistoryRepository struct {
+    mu      sync.RWMutex
+    entries []model.MedicalHistoryEntry
+}
+
+func NewMemoryMedicalHistoryRepository() *MemoryMedicalHistoryRepository {
+    return &MemoryMedicalHistoryRepository{}
+}
+
+func (r *MemoryMedicalHistoryRepository) Create(entry *model.MedicalHistoryEntry) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    entry.ID = uint(len(r.entries) + 1)
+    entry.CreatedAt = time.Now()
+    r.entries = append(r.entries, *entry)
+    return nil
+}
+
+// FindByPatients returns entries in insertion order, which is also creation
+// order.
+func (r *MemoryMedicalHistoryRepository) FindByPatients(patientIDs ...uint) ([]model.MedicalHistoryEntry, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    wanted := make(map[uint]bool, len(patientIDs))
+    for _, id := range patientIDs {
+        wanted[id] = true
+    }
+    entries := []model.MedicalHistoryEntry{}
+    for _, entry := range r.entries {
+        if wanted[entry.PatientID] {
+            entries = append(entries, entry)
+        }
+    }
+    return entries, nil
+}
+
+// MemoryAuditLogRepository is an in-process AuditStore.
+type MemoryAuditLogRepository struct {
+    mu      sync.RWMutex
+    entries []model.AuditLog
+}
+
+func NewMemoryAuditLogRepository() *MemoryAuditLogRepository {
+    return &MemoryAuditLogRepository{}
+}
+
+func (r *MemoryAuditLogRepository) Create(entries []model.AuditLog) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    now := time.Now()
+    for i := range entries {
+        entries[i].ID = uint(len(r.entries) + 1)
+        if entries[i].CreatedAt.IsZero() {
+            entries[i].CreatedAt = now
+        }
+        r.entries = append(r.entries, entries[i])
+    }
+    return nil
+}
+
+// Erase drops the changes of the patients' entries, as discarding their
+// audit keys does in the database.
+func (r *MemoryAuditLogRepository) Erase(patientIDs ...uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    erased := make(map[uint]bool, len(patientIDs))
+    for _, id := range patientIDs {
+        erased[id] = true
+    }
+    for i, entry := range r.entries {
+        if erased[entry.PatientID] && entry.Changes != "" {
+            r.entries[i].Changes = ""
+            r.entries[i].ChangesErased = true
+        }
+    }
+    return nil
+}
+
+func (r *MemoryAuditLogRepository) FindPage(query AuditQuery) ([]model.AuditLog, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var entries []model.AuditLog
+    for i := len(r.entries) - 1; i >= 0; i-- {
+        entry := r.entries[i]
+        switch {
+        case query.UserID != 0 && entry.UserID != query.UserID:
+        case query.PatientID != 0 && entry.PatientID != query.PatientID:
+        case query.From != nil && entry.CreatedAt.Before(*query.From):
+        case query.To != nil && entry.CreatedAt.After(*query.To):
+        default:
+            entries = append(entries, entry)
+        }
+    }
+
+    total := int64(len(entries))
+    if query.Offset >= len(entries) {
+        return nil, total, nil
+    }
+    entries = entries[query.Offset:]
+    if query.Limit > 0 && query.Limit < len(entries) {
+        entries = entries[:query.Limit]
+    }
+    return entries, total, nil
+}
+
+// MemoryAppointmentRepository is an in-process AppointmentStore.
+type MemoryAppointmentRepository struct {
+    mu           sync.RWMutex
+    nextID       uint
+    appointments map[uint]model.Appointment
+}
+
+func NewMemoryAppointmentRepository() *MemoryAppointmentRepository {
+    return &MemoryAppointmentRepository{appointments: make(map[uint]model.Appointment)}
+}
+
+func (r *MemoryAppointmentRepository) Create(appointment *model.Appointment) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if r.overlaps(*appointment) {
+        return ErrAppointmentOverlap
+    }
+    r.nextID++
+    now := time.Now()
+    appointment.ID = r.nextID
+    appointment.CreatedAt = now
+    appointment.UpdatedAt = now
+    r.appointments[appointment.ID] = *appointment
+    return nil
+}
+
+func (r *MemoryAppointmentRepository) Update(appointment *model.Appointment) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.appointments[appointment.ID]
+    if !ok || existing.DeletedAt.Valid {
+        return gorm.ErrRecordNotFound
+    }
+    if r.overlaps(*appointment) {
+        return ErrAppointmentOverlap
+    }
+    appointment.CreatedAt = existing.CreatedAt
+    appointment.UpdatedAt = time.Now()
+    r.appointments[appointment.ID] = *appointment
+    return nil
+}
+
+func (r *MemoryAppointmentRepository) overlaps(appointment model.Appointment) bool {
+    if appointment.Status != model.AppointmentScheduled {
+        return false
+    }
+    for _, other := range r.appointments {
+        if other.ID != appointment.ID && other.DoctorID == appointment.DoctorID && !other.DeletedAt.Valid &&
+            other.Status == model.AppointmentScheduled &&
+            other.StartsAt.Before(appointment.EndsAt) && other.EndsAt.After(appointment.StartsAt) {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *MemoryAppointmentRepository) FindByID(id uint) (model.Appointment, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    appointment, ok := r.appointments[id]
+    if !ok || appointment.DeletedAt.Valid {
+        return model.Appointment{}, gorm.ErrRecordNotFound
+    }
+    return appointment, nil
+}
+
+func (r *MemoryAppointmentRepository) FindPage(query AppointmentQuery) ([]model.Appointment, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var appointments []model.Appointment
+    for _, appointment := range r.appointments {
+        switch {
+        case appointment.DeletedAt.Valid:
+        case query.DoctorID != 0 && appointment.DoctorID != query.DoctorID:
+        case query.PatientID != 0 && appointment.PatientID != query.PatientID:
+        case query.Status != "" && appointment.Status != query.Status:
+        case query.From != nil && !appointment.EndsAt.After(*query.From):
+        case query.To != nil && !appointment.StartsAt.Before(*query.To):
+        default:
+            appointments = append(appointments, appointment)
+        }
+    }
+    sort.Slice(appointments, func(i, j int) bool {
+        if !appointments[i].StartsAt.Equal(appointments[j].StartsAt) {
+            return appointments[i].StartsAt.Before(appointments[j].StartsAt)
+        }
+        return appointments[i].ID < appointments[j].ID
+    })
+
+    total := int64(len(appointments))
+    if query.Offset >= len(appointments) {
+        return nil, total, nil
+    }
+    appointments = appointments[query.Offset:]
+    if query.Limit > 0 && query.Limit < len(appointments) {
+        appointments = appointments[:query.Limit]
+    }
+    return appointments, total, nil
+}
+
+// MemoryAvailabilityRepository is an in-process AvailabilityStore.
+type MemoryAvailabilityRepository struct {
+    mu        sync.RWMutex
+    schedules map[uint]model.DoctorSchedule
+}
+
+func NewMemoryAvailabilityRepository() *MemoryAvailabilityRepository {
+    return &MemoryAvailabilityRepository{schedules: make(map[uint]model.DoctorSchedule)}
+}
+
+func (r *MemoryAvailabilityRepository) Find(doctorID uint) (model.DoctorSchedule, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    schedule, ok := r.schedules[doctorID]
+    if !ok {
+        return model.DoctorSchedule{}, gorm.ErrRecordNotFound
+    }
+    return copySchedule(schedule), nil
+}
+
+func (r *MemoryAvailabilityRepository) Replace(schedule *model.DoctorSchedule) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    schedule.UpdatedAt = time.Now()
+    for i := range schedule.WorkingHours {
+        schedule.WorkingHours[i].ID = uint(i + 1)
+        schedule.WorkingHours[i].DoctorID = schedule.DoctorID
+    }
+    for i := range schedule.Breaks {
+        schedule.Breaks[i].ID = uint(i + 1)
+        schedule.Breaks[i].DoctorID = schedule.DoctorID
+    }
+    for i := range schedule.LeaveDays {
+        schedule.LeaveDays[i].ID = uint(i + 1)
+        schedule.LeaveDays[i].DoctorID = schedule.DoctorID
+    }
+    r.schedules[schedule.DoctorID] = copySchedule(*schedule)
+    return nil
+}
+
+// copySchedule keeps callers from mutating the stored slices.
+func copySchedule(schedule model.DoctorSchedule) model.DoctorSchedule {
+    schedule.WorkingHours = append([]model.WorkingHours(nil), schedule.WorkingHours...)
+    schedule.Breaks = append([]model.ScheduleBreak(nil), schedule.Breaks...)
+    schedule.LeaveDays = append([]model.LeaveDay(nil), schedule.LeaveDays...)
+    return schedule
+}
+
+// MemoryUserRepository is an in-process UserStore. It knows the roles
+// returned by model.DefaultRoles.
+type MemoryUserRepository struct {
+    mu            sync.RWMutex
+    nextID        uint
+    users         map[uint]model.User
+    roles         map[string]model.Role
+    recoveryCodes map[uint][]model.RecoveryCode
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+    roles := make(map[string]model.Role)
+    for i, role := range model.DefaultRoles() {
+        role.ID = uint(i + 1)
+        roles[role.Name] = role
+    }
+    return &MemoryUserRepository{users: make(map[uint]model.User), roles: roles, recoveryCodes: make(map[uint][]model.RecoveryCode)}
+}
+
+func (r *MemoryUserRepository) Create(user *model.User) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, existing := range r.users {
+        if existing.Email == user.Email && !existing.DeletedAt.Valid {
+            return errors.New("email already exists")
+        }
+    }
+
+    r.nextID++
+    now := time.Now()
+    user.ID = r.nextID
+    user.CreatedAt = now
+    user.UpdatedAt = now
+    r.users[user.ID] = *user
+    return nil
+}
+
+func (r *MemoryUserRepository) FindPage(query UserQuery) ([]model.User, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var users []model.User
+    for _, user := range r.users {
+        switch {
+        case user.DeletedAt.Valid:
+        case query.Role != "" && !hasRole(user, query.Role):
+        case query.Active != nil && user.Active() != *query.Active:
+        default:
+            users = append(users, user)
+        }
+    }
+    sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+    total := int64(len(users))
+    if query.Offset >= len(users) {
+        return nil, total, nil
+    }
+    users = users[query.Offset:]
+    if query.Limit > 0 && query.Limit < len(users) {
+        users = users[:query.Limit]
+    }
+    return users, total, nil
+}
+
+func hasRole(user model.User, name string) bool {
+    for _, role := range user.Roles {
+        if role.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *MemoryUserRepository) FindByID(id uint) (model.User, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    user, ok := r.users[id]
+    if !ok || user.DeletedAt.Valid {
+        return model.User{}, gorm.ErrRecordNotFound
+    }
+    return user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(email string) (model.User, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    for _, user := range r.users {
+        if user.Email == email && !user.DeletedAt.Valid {
+            return user, nil
+        }
+    }
+    return model.User{}, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryUserRepository) FindRoles(names []string) ([]model.Role, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var roles []model.Role
+    for _, name := range names {
+        if role, ok := r.roles[name]; ok {
+            roles = append(roles, role)
+        }
+    }
+    sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+    return roles, nil
+}
+
+func (r *MemoryUserRepository) Update(user *model.User) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.users[user.ID]
+    if !ok || existing.DeletedAt.Valid {
+        return gorm.ErrRecordNotFound
+    }
+    for _, other := range r.users {
+        if other.ID != user.ID && other.Email == user.Email && !other.DeletedAt.Valid {
+            return errors.New("email already exists")
+        }
+    }
+    user.CreatedAt = existing.CreatedAt
+    user.UpdatedAt = time.Now()
+    user.TOTPLastStep = existing.TOTPLastStep
+    r.users[user.ID] = *user
+    return nil
+}
+
+func (r *MemoryUserRepository) ListRoles() ([]model.Role, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    roles := make([]model.Role, 0, len(r.roles))
+    for _, role := range r.roles {
+        roles = append(roles, role)
+    }
+    sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+    return roles, nil
+}
+
+// UpdateRole saves role, keeping the stored permissions. Users hold copies
+// of their roles, so theirs are updated too.
+func (r *MemoryUserRepository) UpdateRole(role *model.Role) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.roles[role.Name]
+    if !ok || existing.ID != role.ID {
+        return gorm.ErrRecordNotFound
+    }
+    existing.TwoFactorRequired = role.TwoFactorRequired
+    existing.UpdatedAt = time.Now()
+    r.roles[role.Name] = existing
+    for id, user := range r.users {
+        roles := append([]model.Role(nil), user.Roles...)
+        for i := range roles {
+            if roles[i].Name == role.Name {
+                roles[i].TwoFactorRequired = role.TwoFactorRequired
+            }
+        }
+        user.Roles = roles
+        r.users[id] = user
+    }
+    return nil
+}
+
+func (r *MemoryUserRepository) AdvanceTOTPStep(userID uint, step int64) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    user, ok := r.users[userID]
+    if !ok || user.TOTPLastStep >= step {
+        return false, nil
+    }
+    user.TOTPLastStep = step
+    r.users[userID] = user
+    return true, nil
+}
+
+func (r *MemoryUserRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    now := time.Now()
+    codes := make([]model.RecoveryCode, 0, len(hashes))
+    for i, hash := range hashes {
+        codes = append(codes, model.RecoveryCode{ID: uint(i + 1), UserID: userID, CodeHash: hash, CreatedAt: now})
+    }
+    r.recoveryCodes[userID] = codes
+    return nil
+}
+
+func (r *MemoryUserRepository) UseRecoveryCode(userID uint, hash string, at time.Time) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for i, code := range r.recoveryCodes[userID] {
+        if code.CodeHash == hash && code.UsedAt == nil {
+            r.recoveryCodes[userID][i].UsedAt = &at
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// MemoryRefreshTokenRepository is an in-process RefreshTokenStore.
+type MemoryRefreshTokenRepository struct {
+    mu              sync.Mutex
+    nextID          uint
+    tokens          map[uint]model.RefreshToken
+    nextChallengeID uint
+    challenges      map[uint]model.LoginChallenge
+}
+
+func NewMemoryRefreshTokenRepository() *MemoryRefreshTokenRepository {
+    return &MemoryRefreshTokenRepository{tokens: make(map[uint]model.RefreshToken), challenges: make(map[uint]model.LoginChallenge)}
+}
+
+func (r *MemoryRefreshTokenRepository) Create(token *model.RefreshToken) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, existing := range r.tokens {
+        if existing.TokenHash == token.TokenHash {
+            return errors.New("token hash already exists")
+        }
+    }
+
+    r.nextID++
+    token.ID = r.nextID
+    token.CreatedAt = time.Now()
+    r.tokens[token.ID] = *token
+    return nil
+}
+
+func (r *MemoryRefreshTokenRepository) FindByHash(hash string) (model.RefreshToken, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, token := range r.tokens {
+        if token.TokenHash == hash {
+            return token, nil
+        }
+    }
+    return model.RefreshToken{}, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRefreshTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    token, ok := r.tokens[id]
+    if !ok || token.UsedAt != nil {
+        return false, nil
+    }
+    token.UsedAt = &at
+    r.tokens[id] = token
+    return true, nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for id, token := range r.tokens {
+        if token.FamilyID == familyID && token.RevokedAt == nil {
+            token.RevokedAt = &at
+            r.tokens[id] = token
+        }
+    }
+    return nil
+}
+
+func (r *MemoryRefreshTokenRepository) IsFamilyRevoked(familyID string) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, token := range r.tokens {
+        if token.FamilyID == familyID && token.RevokedAt != nil {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeUser(userID uint, at time.Time) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for id, challenge := range r.challenges {
+        if challenge.UserID == userID {
+            delete(r.challenges, id)
+        }
+    }
+    for id, token := range r.tokens {
+        if token.UserID == userID && token.RevokedAt == nil {
+            token.RevokedAt = &at
+            r.tokens[id] = token
+        }
+    }
+    return nil
+}
+
+func (r *MemoryRefreshTokenRepository) CreateChallenge(challenge *model.LoginChallenge) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    now := time.Now()
+    for id, existing := range r.challenges {
+        if existing.ExpiresAt.Before(now) {
+            delete(r.challenges, id)
+        } else if existing.TokenHash == challenge.TokenHash {
+            return errors.New("challenge hash already exists")
+        }
+    }
+
+    r.nextChallengeID++
+    challenge.ID = r.nextChallengeID
+    challenge.CreatedAt = now
+    r.challenges[challenge.ID] = *challenge
+    return nil
+}
+
+func (r *MemoryRefreshTokenRepository) FindChallenge(hash string) (model.LoginChallenge, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, challenge := range r.challenges {
+        if challenge.TokenHash == hash {
+            return challenge, nil
+        }
+    }
+    return model.LoginChallenge{}, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryRefreshTokenRepository) DeleteChallenge(id uint) (bool, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if _, ok := r.challenges[id]; !ok {
+        return false, nil
+    }
+    delete(r.challenges, id)
+    return true, nil
+}
+
+// MemoryPatientIdentifierRepository is an in-process PatientIdentifierStore.
+type MemoryPatientIdentifierRepository struct {
+    mu          sync.RWMutex
+    identifiers []model.PatientIdentifier
+}
+
+func NewMemoryPatientIdentifierRepository() *MemoryPatientIdentifierRepository {
+    return &MemoryPatientIdentifierRepository{}
+}
+
+func (r *MemoryPatientIdentifierRepository) Create(identifier *model.PatientIdentifier) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, existing := range r.identifiers {
+        if existing.System == identifier.System && existing.Value == identifier.Value {
+            return errors.New("identifier already exists")
+        }
+    }
+    identifier.ID = uint(len(r.identifiers) + 1)
+    identifier.CreatedAt = time.Now()
+    r.identifiers = append(r.identifiers, *identifier)
+    return nil
+}
+
+func (r *MemoryPatientIdentifierRepository) Find(system, value string) (model.PatientIdentifier, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    for _, identifier := range r.identifiers {
+        if identifier.System == system && identifier.Value == value {
+            return identifier, nil
+        }
+    }
+    return model.PatientIdentifier{}, gorm.ErrRecordNotFound
+}
+
+// MemoryDeadLetterRepository is an in-process DeadLetterStore.
+type MemoryDeadLetterRepository struct {
+    mu      sync.RWMutex
+    nextID  uint
+    letters map[uint]model.DeadLetter
+}
+
+func NewMemoryDeadLetterRepository() *MemoryDeadLetterRepository {
+    return &MemoryDeadLetterRepository{letters: make(map[uint]model.DeadLetter)}
+}
+
+func (r *MemoryDeadLetterRepository) Create(letter *model.DeadLetter) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    r.nextID++
+    letter.ID = r.nextID
+    letter.CreatedAt = time.Now()
+    letter.UpdatedAt = letter.CreatedAt
+    r.letters[letter.ID] = *letter
+    return nil
+}
+
+func (r *MemoryDeadLetterRepository) FindByID(id uint) (model.DeadLetter, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    letter, ok := r.letters[id]
+    if !ok {
+        return model.DeadLetter{}, gorm.ErrRecordNotFound
+    }
+    return letter, nil
+}
+
+func (r *MemoryDeadLetterRepository) FindAfter(afterID uint, limit int) ([]model.DeadLetter, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    letters := []model.DeadLetter{}
+    for _, letter := range r.letters {
+        if letter.ID > afterID {
+            letters = append(letters, letter)
+        }
+    }
+    sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+    if len(letters) > limit {
+        letters = letters[:limit]
+    }
+    return letters, nil
+}
+
+func (r *MemoryDeadLetterRepository) Update(letter *model.DeadLetter) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    stored, ok := r.letters[letter.ID]
+    if !ok {
+        return gorm.ErrRecordNotFound
+    }
+    stored.Reason = letter.Reason
+    stored.Attempts = letter.Attempts
+    stored.UpdatedAt = time.Now()
+    r.letters[letter.ID] = stored
+    return nil
+}
+
+func (r *MemoryDeadLetterRepository) Delete(id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    delete(r.letters, id)
+    return nil
+}
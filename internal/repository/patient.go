@@ -1,12 +1,44 @@
 package repository
 
 import (
+    "errors"
+    "strings"
+    "sync"
+    "time"
     "gorm.io/gorm"
+    "makerble-assessment/internal/fieldcrypt"
     "makerble-assessment/internal/model"
 )
 
+var ErrVersionConflict = errors.New("the record was changed by someone else; reload it and try again")
+
+// ErrPatientMerged is returned by Restore for a duplicate merged into another
+// patient.
+var ErrPatientMerged = errors.New("the patient was merged into another")
+
+// Sort keys accepted by PatientQuery.Sort.
+const (
+    SortByName        = "name"
+    SortByDateOfBirth = "date_of_birth"
+    SortByCreatedAt   = "created_at"
+)
+
+// PatientQuery selects one page of patients. Zero-valued filters are ignored.
+type PatientQuery struct {
+    Offset     int
+    Limit      int
+    Sort       string
+    Descending bool
+    Gender     string
+    DOBFrom    *time.Time
+    DOBTo      *time.Time
+    NamePrefix string
+}
+
 type PatientRepository struct {
-    db *gorm.DB
+    db      *gorm.DB
+    ftsOnce sync.Once
+    fts     bool
 }
 
 func NewPatientRepository(db *gorm.DB) *PatientRepository {
@@ -14,25 +46,281 @@ func NewPatientRepository(db *gorm.DB) *PatientRepository {
 }
 
 func (r *PatientRepository) Create(patient *model.Patient) error {
+    ring := fieldcrypt.Default()
+    if ring == nil {
+        return fieldcrypt.ErrNoKeys
+    }
+    indexPatient(ring, patient)
     return r.db.Create(patient).Error
 }
 
-func (r *PatientRepository) FindAll() ([]model.Patient, error) {
+// CreateBatch inserts patients in one transaction: either all of them are
+// stored, with their IDs set, or none are.
+func (r *PatientRepository) CreateBatch(patients []model.Patient) error {
+    ring := fieldcrypt.Default()
+    if ring == nil {
+        return fieldcrypt.ErrNoKeys
+    }
+    if len(patients) == 0 {
+        return nil
+    }
+    for i := range patients {
+        indexPatient(ring, &patients[i])
+    }
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        return tx.Create(&patients).Error
+    })
+}
+
+// indexPatient fills in the search index of the encrypted columns.
+func indexPatient(ring *fieldcrypt.KeyRing, patient *model.Patient) {
+    patient.ContactIndex = ring.SearchIndex(patient.Contact)
+    patient.AddressIndex = ring.SearchIndex(patient.Address)
+}
+
+// FindBatch returns up to limit patients matching query's filters with IDs
+// above afterID, in ID order, so callers can walk every match in batches
+// without offsets. Sorting and pagination fields of query are ignored.
+func (r *PatientRepository) FindBatch(query PatientQuery, afterID uint, limit int) ([]model.Patient, error) {
     var patients []model.Patient
-    err := r.db.Find(&patients).Error
+    err := filterPatients(r.db.Model(&model.Patient{}), query).
+        Where("id > ?", afterID).Order("id").Limit(limit).Find(&patients).Error
     return patients, err
 }
 
+func filterPatients(tx *gorm.DB, query PatientQuery) *gorm.DB {
+    if query.Gender != "" {
+        tx = tx.Where("gender = ?", query.Gender)
+    }
+    if query.DOBFrom != nil {
+        tx = tx.Where("date_of_birth >= ?", *query.DOBFrom)
+    }
+    if query.DOBTo != nil {
+        tx = tx.Where("date_of_birth <= ?", *query.DOBTo)
+    }
+    if query.NamePrefix != "" {
+        prefix := escapeLike(strings.ToLower(query.NamePrefix)) + "%"
+        tx = tx.Where("(LOWER(first_name) LIKE ? ESCAPE '!' OR LOWER(last_name) LIKE ? ESCAPE '!')", prefix, prefix)
+    }
+    return tx
+}
+
+// FindPage returns the patients matching query along with the total number
+// of matches before pagination.
+func (r *PatientRepository) FindPage(query PatientQuery) ([]model.Patient, int64, error) {
+    tx := filterPatients(r.db.Model(&model.Patient{}), query).Session(&gorm.Session{})
+
+    var total int64
+    if err := tx.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+
+    direction := " ASC"
+    if query.Descending {
+        direction = " DESC"
+    }
+    switch query.Sort {
+    case SortByName:
+        tx = tx.Order("last_name" + direction).Order("first_name" + direction)
+    case SortByDateOfBirth:
+        tx = tx.Order("date_of_birth" + direction)
+    default:
+        tx = tx.Order("created_at" + direction)
+    }
+
+    var patients []model.Patient
+    err := tx.Order("id" + direction).Offset(query.Offset).Limit(query.Limit).Find(&patients).Error
+    return patients, total, err
+}
+
 func (r *PatientRepository) FindByID(id uint) (model.Patient, error) {
     var patient model.Patient
     err := r.db.First(&patient, id).Error
     return patient, err
 }
 
-func (r *PatientRepository) Update(patient *model.Patient) error {
-    return r.db.Save(patient).Error
+// Update writes only the given columns and bumps the version, so writers
+// changing different fields never undo each other. A non-zero
+// expectedVersion must match the stored one or ErrVersionConflict is
+// returned. With no changes only the version is bumped. It returns the
+// updated patient.
+func (r *PatientRepository) Update(id, expectedVersion uint, changes map[string]interface{}) (model.Patient, error) {
+    values := map[string]interface{}{"version": gorm.Expr("version + 1")}
+    for column, value := range changes {
+        values[column] = value
+    }
+    if err := sealChanges(values); err != nil {
+        return model.Patient{}, err
+    }
+
+    var patient model.Patient
+    err := r.db.Transaction(func(tx *gorm.DB) error {
+        update := tx.Model(&model.Patient{}).Where("id = ?", id)
+        if expectedVersion != 0 {
+            update = update.Where("version = ?", expectedVersion)
+        }
+        result := update.Updates(values)
+        if result.Error != nil {
+            return result.Error
+        }
+        if err := tx.First(&patient, id).Error; err != nil {
+            return err
+        }
+        if result.RowsAffected == 0 {
+            return ErrVersionConflict
+        }
+        return nil
+    })
+    return patient, err
 }
 
+// Delete soft-deletes a patient, returning gorm.ErrRecordNotFound if there
+// was none to delete.
 func (r *PatientRepository) Delete(id uint) error {
-    return r.db.Delete(&model.Patient{}, id).Error
-}
\ No newline at end of file
+    result := r.db.Delete(&model.Patient{}, id)
+    if result.Error == nil && result.RowsAffected == 0 {
+        return gorm.ErrRecordNotFound
+    }
+    return result.Error
+}
+
+// FindDeletedPage returns soft-deleted patients, most recently deleted
+// first, along with their total number.
+func (r *PatientRepository) FindDeletedPage(offset, limit int) ([]model.Patient, int64, error) {
+    tx := r.db.Unscoped().Model(&model.Patient{}).Where("deleted_at IS NOT NULL").Session(&gorm.Session{})
+
+    var total int64
+    if err := tx.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+
+    var patients []model.Patient
+    err := tx.Order("deleted_at DESC").Order("id DESC").Offset(offset).Limit(limit).Find(&patients).Error
+    return patients, total, err
+}
+
+// Restore undoes a soft delete, returning gorm.ErrRecordNotFound if the
+// patient is not in the trash and ErrPatientMerged if it was merged away.
+func (r *PatientRepository) Restore(id uint) (model.Patient, error) {
+    var patient model.Patient
+    err := r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&patient, id).Error; err != nil {
+            return err
+        }
+        if patient.MergedIntoID != nil {
+            return ErrPatientMerged
+        }
+        if err := tx.Unscoped().Model(&model.Patient{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+            return err
+        }
+        return tx.First(&patient, id).Error
+    })
+    return patient, err
+}
+
+// Purge permanently removes a soft-deleted patient together with its
+// medical history, appointments and identifiers in other systems. Patients
+// that were not deleted first are reported as gorm.ErrRecordNotFound. Audit
+// log entries are kept.
+func (r *PatientRepository) Purge(id uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&model.Patient{}, id)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return gorm.ErrRecordNotFound
+        }
+        return purgeDependents(tx, []uint{id})
+    })
+}
+
+// PurgeDeletedBefore purges up to limit patients soft-deleted before cutoff,
+// lowest IDs first, as Purge does, and returns their IDs. A limit of 0 purges
+// them all.
+func (r *PatientRepository) PurgeDeletedBefore(cutoff time.Time, limit int) ([]uint, error) {
+    var ids []uint
+    err := r.db.Transaction(func(tx *gorm.DB) error {
+        query := tx.Unscoped().Model(&model.Patient{}).Where("deleted_at < ?", cutoff).Order("id")
+        if limit > 0 {
+            query = query.Limit(limit)
+        }
+        if err := query.Pluck("id", &ids).Error; err != nil {
+            return err
+        }
+        if len(ids) == 0 {
+            return nil
+        }
+        if err := tx.Unscoped().Where("id IN ?", ids).Delete(&model.Patient{}).Error; err != nil {
+            return err
+        }
+        return purgeDependents(tx, ids)
+    })
+    return ids, err
+}
+
+// Merge folds the patient duplicateID into survivorID: the duplicate's
+// medical history, appointments and identifiers in other systems move to the
+// survivor, and the duplicate goes to the trash marked as merged into it.
+// Unless both patients exist outside the trash it returns
+// gorm.ErrRecordNotFound.
+func (r *PatientRepository) Merge(duplicateID, survivorID uint) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        var count int64
+        if err := tx.Model(&model.Patient{}).Where("id IN ?", []uint{duplicateID, survivorID}).Count(&count).Error; err != nil {
+            return err
+        }
+        if count != 2 {
+            return gorm.ErrRecordNotFound
+        }
+        for _, dependent := range []interface{}{&model.MedicalHistoryEntry{}, &model.Appointment{}, &model.PatientIdentifier{}} {
+            if err := tx.Unscoped().Model(dependent).Where("patient_id = ?", duplicateID).Update("patient_id", survivorID).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Model(&model.Patient{}).Where("id = ?", duplicateID).
+            Updates(map[string]interface{}{"merged_into_id": survivorID, "deleted_at": time.Now()}).Error
+    })
+}
+
+func purgeDependents(tx *gorm.DB, patientIDs []uint) error {
+    if err := tx.Where("patient_id IN ?", patientIDs).Delete(&model.MedicalHistoryEntry{}).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("patient_id IN ?", patientIDs).Delete(&model.PatientIdentifier{}).Error; err != nil {
+        return err
+    }
+    return tx.Unscoped().Where("patient_id IN ?", patientIDs).Delete(&model.Appointment{}).Error
+}
+
+// sealChanges encrypts contact and address in a map update, which GORM
+// writes without running the encrypted serializer, and refreshes their
+// search index columns.
+func sealChanges(values map[string]interface{}) error {
+    for column, indexColumn := range map[string]string{"contact": "contact_index", "address": "address_index"} {
+        value, ok := values[column]
+        if !ok {
+            continue
+        }
+        ring := fieldcrypt.Default()
+        if ring == nil {
+            return fieldcrypt.ErrNoKeys
+        }
+        plaintext, _ := value.(string)
+        sealed, err := ring.Encrypt(column, plaintext)
+        if err != nil {
+            return err
+        }
+        values[column] = sealed
+        values[indexColumn] = ring.SearchIndex(plaintext)
+    }
+    return nil
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which needs no quoting in any
+// of the supported dialects (MySQL treats a backslash in a literal specially).
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+func escapeLike(s string) string {
+    return likeEscaper.Replace(s)
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+)
+
+type RefreshTokenRepository struct {
+    db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+    return &RefreshTokenRepository{db: db}
+}
+
+func (r *RefreshTokenRepository) Create(token *model.RefreshToken) error {
+    return r.db.Create(token).Error
+}
+
+func (r *RefreshTokenRepository) FindByHash(hash string) (model.RefreshToken, error) {
+    var token model.RefreshToken
+    err := r.db.Where("token_hash = ?", hash).First(&token).Error
+    return token, err
+}
+
+// MarkUsed flags an unused token as used. It reports false when the token
+// was already used, so only one of two concurrent refreshes can win.
+func (r *RefreshTokenRepository) MarkUsed(id uint, at time.Time) (bool, error) {
+    result := r.db.Model(&model.RefreshToken{}).
+        Where("id = ? AND used_at IS NULL", id).
+        Update("used_at", at)
+    return result.RowsAffected == 1, result.Error
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(familyID string, at time.Time) error {
+    return r.db.Model(&model.RefreshToken{}).
+        Where("family_id = ? AND revoked_at IS NULL", familyID).
+        Update("revoked_at", at).Error
+}
+
+func (r *RefreshTokenRepository) IsFamilyRevoked(familyID string) (bool, error) {
+    var count int64
+    err := r.db.Model(&model.RefreshToken{}).
+        Where("family_id = ? AND revoked_at IS NOT NULL", familyID).
+        Count(&count).Error
+    return count > 0, err
+}
+
+// RevokeUser revokes every session of the user and drops their pending
+// login challenges.
+func (r *RefreshTokenRepository) RevokeUser(userID uint, at time.Time) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ?", userID).Delete(&model.LoginChallenge{}).Error; err != nil {
+            return err
+        }
+        return tx.Model(&model.RefreshToken{}).
+            Where("user_id = ? AND revoked_at IS NULL", userID).
+            Update("revoked_at", at).Error
+    })
+}
+
+// CreateChallenge stores a login challenge, clearing out expired ones.
+func (r *RefreshTokenRepository) CreateChallenge(challenge *model.LoginChallenge) error {
+    if err := r.db.Where("expires_at < ?", time.Now()).Delete(&model.LoginChallenge{}).Error; err != nil {
+        return err
+    }
+    return r.db.Create(challenge).Error
+}
+
+func (r *RefreshTokenRepository) FindChallenge(hash string) (model.LoginChallenge, error) {
+    var challenge model.LoginChallenge
+    err := r.db.Where("token_hash = ?", hash).First(&challenge).Error
+    return challenge, err
+}
+
+// DeleteChallenge removes a challenge once used. It reports false when it
+// was already gone, so only one of two concurrent logins can complete it.
+func (r *RefreshTokenRepository) DeleteChallenge(id uint) (bool, error) {
+    result := r.db.Delete(&model.LoginChallenge{}, id)
+    return result.RowsAffected == 1, result.Error
+}
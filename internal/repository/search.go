@@ -0,0 +1,196 @@
+package repository
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/model"
+)
+
+// maxSearchTerms caps how many words of a search are used, which bounds the
+// size of the generated query.
+const maxSearchTerms = 8
+
+// PatientMatch is a search hit with its relevance; higher scores rank first.
+type PatientMatch struct {
+    model.Patient
+    Score float64
+}
+
+// splitWords lower-cases text and splits it into alphanumeric words.
+func splitWords(text string) []string {
+    return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+}
+
+// searchTerms splits text into unique words, at most maxSearchTerms.
+func searchTerms(text string) []string {
+    words := splitWords(text)
+
+    seen := make(map[string]bool, len(words))
+    var terms []string
+    for _, word := range words {
+        if seen[word] {
+            continue
+        }
+        seen[word] = true
+        terms = append(terms, word)
+        if len(terms) == maxSearchTerms {
+            break
+        }
+    }
+    return terms
+}
+
+// Search ranks patients by how well their name, contact and address match
+// text. Every term must match some field, as a prefix of a name or of a
+// word in contact or address. Contact and address are encrypted, so they
+// are matched through their blind index tokens, and a term shorter than
+// fieldcrypt.MinIndexedPrefix only matches a whole word of them. MySQL uses the FULLTEXT
+// index and SQLite the patients_fts FTS5 table when they exist; other
+// databases fall back to scoring LIKE matches.
+func (r *PatientRepository) Search(text string, limit int) ([]PatientMatch, error) {
+    terms := searchTerms(text)
+    if len(terms) == 0 {
+        return nil, nil
+    }
+    ring := fieldcrypt.Default()
+    if ring == nil {
+        return nil, fieldcrypt.ErrNoKeys
+    }
+    tokens := make([]string, len(terms))
+    for i, term := range terms {
+        tokens[i] = ring.SearchToken(term)
+    }
+
+    switch r.db.Dialector.Name() {
+    case "mysql":
+        return r.searchFullText(terms, tokens, limit)
+    case "sqlite":
+        if r.hasFTS5() {
+            return r.searchFTS5(terms, tokens, limit)
+        }
+    }
+    return r.searchLike(terms, tokens, limit)
+}
+
+func (r *PatientRepository) hasFTS5() bool {
+    r.ftsOnce.Do(func() {
+        var count int64
+        r.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'patients_fts'").Scan(&count)
+        r.fts = count > 0
+    })
+    return r.fts
+}
+
+func (r *PatientRepository) searchFullText(terms, tokens []string, limit int) ([]PatientMatch, error) {
+    words := make([]string, len(terms))
+    for i, term := range terms {
+        words[i] = "+(" + term + "* " + tokens[i] + ")"
+    }
+    against := strings.Join(words, " ")
+
+    var matches []PatientMatch
+    err := r.db.Model(&model.Patient{}).
+        Select("patients.*, MATCH(first_name, last_name, contact_index, address_index) AGAINST (? IN BOOLEAN MODE) AS score", against).
+        Where("MATCH(first_name, last_name, contact_index, address_index) AGAINST (? IN BOOLEAN MODE)", against).
+        Order("score DESC").Order("id").
+        Limit(limit).
+        Scan(&matches).Error
+    return matches, err
+}
+
+func (r *PatientRepository) searchFTS5(terms, tokens []string, limit int) ([]PatientMatch, error) {
+    phrases := make([]string, len(terms))
+    for i, term := range terms {
+        phrases[i] = `({first_name last_name} : "` + term + `"* OR {contact_index address_index} : "` + tokens[i] + `")`
+    }
+
+    // bm25 is lower for better matches; negate it so higher is better, and
+    // weight names above contact and address.
+    var matches []PatientMatch
+    err := r.db.Raw(`SELECT patients.*, -bm25(patients_fts, 10.0, 10.0, 4.0, 2.0) AS score
+        FROM patients_fts JOIN patients ON patients.id = patients_fts.rowid
+        WHERE patients_fts MATCH ? AND patients.deleted_at IS NULL
+        ORDER BY score DESC, patients.id LIMIT ?`, strings.Join(phrases, " AND "), limit).
+        Scan(&matches).Error
+    return matches, err
+}
+
+func (r *PatientRepository) searchLike(terms, tokens []string, limit int) ([]PatientMatch, error) {
+    var (
+        scores []string
+        args   []interface{}
+    )
+    tx := r.db.Model(&model.Patient{})
+    for i, term := range terms {
+        // The index has a space either side of every token.
+        prefix, token := term+"%", "% "+tokens[i]+" %"
+        tx = tx.Where("(LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? OR contact_index LIKE ? OR address_index LIKE ?)",
+            prefix, prefix, token, token)
+        scores = append(scores, fmt.Sprintf(`(CASE WHEN LOWER(first_name) = ? OR LOWER(last_name) = ? THEN %d
+            WHEN LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? THEN %d ELSE 0 END
+            + CASE WHEN contact_index LIKE ? THEN %d ELSE 0 END
+            + CASE WHEN address_index LIKE ? THEN %d ELSE 0 END)`,
+            scoreExactName, scoreNamePrefix, scoreContact, scoreAddress))
+        args = append(args, term, term, prefix, prefix, token, token)
+    }
+
+    var matches []PatientMatch
+    err := tx.Select("patients.*, "+strings.Join(scores, " + ")+" AS score", args...).
+        Order("score DESC").Order("id").
+        Limit(limit).
+        Scan(&matches).Error
+    return matches, err
+}
+
+// Per-term weights of the LIKE fallback, shared with the in-memory store.
+const (
+    scoreExactName  = 10
+    scoreNamePrefix = 5
+    scoreContact    = 4
+    scoreAddress    = 2
+)
+
+// likeScore scores patient against terms the same way searchLike does. The
+// boolean is false when some term matches no field.
+func likeScore(patient model.Patient, terms []string) (float64, bool) {
+    firstName, lastName := strings.ToLower(patient.FirstName), strings.ToLower(patient.LastName)
+    contact, address := splitWords(patient.Contact), splitWords(patient.Address)
+
+    var total float64
+    for _, term := range terms {
+        var score float64
+        switch {
+        case firstName == term || lastName == term:
+            score += scoreExactName
+        case strings.HasPrefix(firstName, term) || strings.HasPrefix(lastName, term):
+            score += scoreNamePrefix
+        }
+        if hasWordPrefix(contact, term) {
+            score += scoreContact
+        }
+        if hasWordPrefix(address, term) {
+            score += scoreAddress
+        }
+        if score == 0 {
+            return 0, false
+        }
+        total += score
+    }
+    return total, true
+}
+
+// hasWordPrefix matches term against words the way the blind index does:
+// terms shorter than fieldcrypt.MinIndexedPrefix only match whole words.
+func hasWordPrefix(words []string, term string) bool {
+    short := len([]rune(term)) < fieldcrypt.MinIndexedPrefix
+    for _, word := range words {
+        if word == term || !short && strings.HasPrefix(word, term) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+    "time"
+    "makerble-assessment/internal/model"
+)
+
+// PatientStore is the patient persistence the services depend on.
+// PatientRepository (GORM) and MemoryPatientRepository implement it.
+type PatientStore interface {
+    Create(patient *model.Patient) error
+    CreateBatch(patients []model.Patient) error
+    FindPage(query PatientQuery) ([]model.Patient, int64, error)
+    FindBatch(query PatientQuery, afterID uint, limit int) ([]model.Patient, error)
+    FindByID(id uint) (model.Patient, error)
+    Search(text string, limit int) ([]PatientMatch, error)
+    Update(id, expectedVersion uint, changes map[string]interface{}) (model.Patient, error)
+    Delete(id uint) error
+    FindDeletedPage(offset, limit int) ([]model.Patient, int64, error)
+    Restore(id uint) (model.Patient, error)
+    Merge(duplicateID, survivorID uint) error
+    Purge(id uint) error
+    PurgeDeletedBefore(cutoff time.Time, limit int) ([]uint, error)
+}
+
+// UserStore is the user persistence the services depend on.
+// UserRepository (GORM) and MemoryUserRepository implement it.
+type UserStore interface {
+    Create(user *model.User) error
+    FindPage(query UserQuery) ([]model.User, int64, error)
+    FindByID(id uint) (model.User, error)
+    FindByEmail(email string) (model.User, error)
+    FindRoles(names []string) ([]model.Role, error)
+    Update(user *model.User) error
+    ListRoles() ([]model.Role, error)
+    UpdateRole(role *model.Role) error
+    AdvanceTOTPStep(userID uint, step int64) (bool, error)
+    ReplaceRecoveryCodes(userID uint, hashes []string) error
+    UseRecoveryCode(userID uint, hash string, at time.Time) (bool, error)
+}
+
+// MedicalHistoryStore is the append-only store of medical history entries.
+// MedicalHistoryRepository (GORM) and MemoryMedicalHistoryRepository
+// implement it.
+type MedicalHistoryStore interface {
+    Create(entry *model.MedicalHistoryEntry) error
+    FindByPatients(patientIDs ...uint) ([]model.MedicalHistoryEntry, error)
+}
+
+// AuditStore is the append-only audit trail. Erase makes the changes of
+// purged patients' entries unreadable while keeping the entries.
+// AuditLogRepository (GORM) and MemoryAuditLogRepository implement it.
+type AuditStore interface {
+    Create(entries []model.AuditLog) error
+    FindPage(query AuditQuery) ([]model.AuditLog, int64, error)
+    Erase(patientIDs ...uint) error
+}
+
+// PatientIdentifierStore links patients to the IDs other systems know them
+// by. PatientIdentifierRepository (GORM) and
+// MemoryPatientIdentifierRepository implement it.
+type PatientIdentifierStore interface {
+    Create(identifier *model.PatientIdentifier) error
+    Find(system, value string) (model.PatientIdentifier, error)
+}
+
+// DeadLetterStore keeps inbound messages that could not be applied.
+// DeadLetterRepository (GORM) and MemoryDeadLetterRepository implement it.
+type DeadLetterStore interface {
+    Create(letter *model.DeadLetter) error
+    FindByID(id uint) (model.DeadLetter, error)
+    FindAfter(afterID uint, limit int) ([]model.DeadLetter, error)
+    Update(letter *model.DeadLetter) error
+    Delete(id uint) error
+}
+
+// AppointmentStore persists appointments. Create and Update return
+// ErrAppointmentOverlap instead of double-booking a doctor.
+// AppointmentRepository (GORM) and MemoryAppointmentRepository implement it.
+type AppointmentStore interface {
+    Create(appointment *model.Appointment) error
+    Update(appointment *model.Appointment) error
+    FindByID(id uint) (model.Appointment, error)
+    FindPage(query AppointmentQuery) ([]model.Appointment, int64, error)
+}
+
+// AvailabilityStore persists doctors' published schedules.
+// AvailabilityRepository (GORM) and MemoryAvailabilityRepository implement
+// it.
+type AvailabilityStore interface {
+    Find(doctorID uint) (model.DoctorSchedule, error)
+    Replace(schedule *model.DoctorSchedule) error
+}
+
+// RefreshTokenStore persists refresh tokens for AuthService.
+// RefreshTokenRepository (GORM) and MemoryRefreshTokenRepository implement it.
+type RefreshTokenStore interface {
+    Create(token *model.RefreshToken) error
+    FindByHash(hash string) (model.RefreshToken, error)
+    MarkUsed(id uint, at time.Time) (bool, error)
+    RevokeFamily(familyID string, at time.Time) error
+    IsFamilyRevoked(familyID string) (bool, error)
+    RevokeUser(userID uint, at time.Time) error
+    CreateChallenge(challenge *model.LoginChallenge) error
+    FindChallenge(hash string) (model.LoginChallenge, error)
+    DeleteChallenge(id uint) (bool, error)
+}
+
+// LimiterStore keeps the expiring counters behind rate limits. Each method
+// is one Redis command, or a short script of them, so it can be backed by
+// Redis or anything speaking its protocol to share limits between servers:
+// Incr is INCR, adding PEXPIRE when the count is 1, then PTTL; Get is GET and
+// PTTL; Set is SET with PX; Delete is DEL. Counters that expired read as 0.
+// MemoryLimiterStore implements it for a single server.
+type LimiterStore interface {
+    Incr(key string, ttl time.Duration) (int64, time.Duration, error)
+    Get(key string) (int64, time.Duration, error)
+    Set(key string, value int64, ttl time.Duration) error
+    Delete(keys ...string) error
+}
+
+var (
+    _ PatientStore = (*PatientRepository)(nil)
+    _ PatientStore = (*MemoryPatientRepository)(nil)
+    _ UserStore    = (*UserRepository)(nil)
+    _ UserStore    = (*MemoryUserRepository)(nil)
+
+    _ MedicalHistoryStore = (*MedicalHistoryRepository)(nil)
+    _ MedicalHistoryStore = (*MemoryMedicalHistoryRepository)(nil)
+
+    _ AuditStore = (*AuditLogRepository)(nil)
+    _ AuditStore = (*MemoryAuditLogRepository)(nil)
+
+    _ PatientIdentifierStore = (*PatientIdentifierRepository)(nil)
+    _ PatientIdentifierStore = (*MemoryPatientIdentifierRepository)(nil)
+
+    _ DeadLetterStore = (*DeadLetterRepository)(nil)
+    _ DeadLetterStore = (*MemoryDeadLetterRepository)(nil)
+
+    _ AppointmentStore = (*AppointmentRepository)(nil)
+    _ AppointmentStore = (*MemoryAppointmentRepository)(nil)
+
+    _ AvailabilityStore = (*AvailabilityRepository)(nil)
+    _ AvailabilityStore = (*MemoryAvailabilityRepository)(nil)
+
+    _ RefreshTokenStore = (*RefreshTokenRepository)(nil)
+    _ RefreshTokenStore = (*MemoryRefreshTokenRepository)(nil)
+
+    _ LimiterStore = (*MemoryLimiterStore)(nil)
+
+    _ Transactor = (*GormTransactor)(nil)
+    _ Transactor = Stores{}
+)
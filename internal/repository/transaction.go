@@ -0,0 +1,62 @@
+package repository
+
+import (
+    "gorm.io/gorm"
+)
+
+// Stores are the stores a patient write touches, the audit trail included.
+type Stores struct {
+    Patients    PatientStore
+    History     MedicalHistoryStore
+    Audit       AuditStore
+    Identifiers PatientIdentifierStore
+}
+
+// Transactor gives services their stores. Transaction runs fn with stores
+// bound to one transaction: if fn returns an error, none of the writes it
+// made through them are kept, so a change is never stored without its
+// audit entry. GormTransactor and Stores implement it.
+type Transactor interface {
+    Stores() Stores
+    Transaction(fn func(stores Stores) error) error
+}
+
+// GormTransactor runs transactions on a GORM database.
+type GormTransactor struct {
+    db     *gorm.DB
+    stores Stores
+}
+
+func NewTransactor(db *gorm.DB) *GormTransactor {
+    return &GormTransactor{db: db, stores: newGormStores(db)}
+}
+
+func (t *GormTransactor) Stores() Stores {
+    return t.stores
+}
+
+func (t *GormTransactor) Transaction(fn func(stores Stores) error) error {
+    return t.db.Transaction(func(tx *gorm.DB) error {
+        return fn(newGormStores(tx))
+    })
+}
+
+func newGormStores(db *gorm.DB) Stores {
+    return Stores{
+        Patients:    NewPatientRepository(db),
+        History:     NewMedicalHistoryRepository(db),
+        Audit:       NewAuditLogRepository(db),
+        Identifiers: NewPatientIdentifierRepository(db),
+    }
+}
+
+// Stores returns s, so a set of stores is itself a Transactor.
+func (s Stores) Stores() Stores {
+    return s
+}
+
+// Transaction runs fn with s directly. The in-memory stores have no
+// transactions: writes made before fn fails are kept.
+func (s Stores) Transaction(fn func(stores Stores) error) error {
+    return fn(s)
+}
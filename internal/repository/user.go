@@ -1,10 +1,20 @@
 package repository
 
 import (
+    "time"
     "gorm.io/gorm"
     "makerble-assessment/internal/model"
 )
 
+// UserQuery selects one page of users, ordered by ID. Zero-valued filters
+// are ignored.
+type UserQuery struct {
+    Offset int
+    Limit  int
+    Role   string
+    Active *bool
+}
+
 type UserRepository struct {
     db *gorm.DB
 }
@@ -13,8 +23,118 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
     return &UserRepository{db: db}
 }
 
+func (r *UserRepository) Create(user *model.User) error {
+    return r.db.Create(user).Error
+}
+
+// FindPage returns the users matching query along with the total number of
+// matches before pagination.
+func (r *UserRepository) FindPage(query UserQuery) ([]model.User, int64, error) {
+    tx := r.db.Model(&model.User{})
+    if query.Role != "" {
+        holders := r.db.Table("user_roles").
+            Select("user_roles.user_id").
+            Joins("JOIN roles ON roles.id = user_roles.role_id").
+            Where("roles.name = ?", query.Role)
+        tx = tx.Where("id IN (?)", holders)
+    }
+    if query.Active != nil {
+        if *query.Active {
+            tx = tx.Where("deactivated_at IS NULL")
+        } else {
+            tx = tx.Where("deactivated_at IS NOT NULL")
+        }
+    }
+    tx = tx.Session(&gorm.Session{})
+
+    var total int64
+    if err := tx.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+
+    var users []model.User
+    err := tx.Preload("Roles.Permissions").Order("id").Offset(query.Offset).Limit(query.Limit).Find(&users).Error
+    return users, total, err
+}
+
+func (r *UserRepository) FindByID(id uint) (model.User, error) {
+    var user model.User
+    err := r.db.Preload("Roles.Permissions").First(&user, id).Error
+    return user, err
+}
+
 func (r *UserRepository) FindByEmail(email string) (model.User, error) {
     var user model.User
-    err := r.db.Where("email = ?", email).First(&user).Error
+    err := r.db.Preload("Roles.Permissions").Where("email = ?", email).First(&user).Error
     return user, err
-}
\ No newline at end of file
+}
+
+// FindRoles loads the named roles with their permissions. Unknown names are
+// skipped, so callers compare the result length to detect them.
+func (r *UserRepository) FindRoles(names []string) ([]model.Role, error) {
+    var roles []model.Role
+    err := r.db.Preload("Permissions").Where("name IN ?", names).Order("name").Find(&roles).Error
+    return roles, err
+}
+
+// Update saves the user's fields and replaces its role assignments with
+// user.Roles. TOTPLastStep only moves through AdvanceTOTPStep, so a stale
+// copy cannot reopen a used code.
+func (r *UserRepository) Update(user *model.User) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Omit("Roles", "TOTPLastStep").Save(user).Error; err != nil {
+            return err
+        }
+        return tx.Model(user).Omit("Roles.*").Association("Roles").Replace(user.Roles)
+    })
+}
+
+// ListRoles returns every role with its permissions, by name.
+func (r *UserRepository) ListRoles() ([]model.Role, error) {
+    var roles []model.Role
+    err := r.db.Preload("Permissions").Order("name").Find(&roles).Error
+    return roles, err
+}
+
+// UpdateRole saves the role's own fields; its permissions are left as they
+// are.
+func (r *UserRepository) UpdateRole(role *model.Role) error {
+    return r.db.Omit("Permissions").Save(role).Error
+}
+
+// AdvanceTOTPStep records step as the user's last accepted TOTP step. It
+// reports false when a code of that step or a later one was already
+// accepted, so a code works once even when replayed concurrently.
+func (r *UserRepository) AdvanceTOTPStep(userID uint, step int64) (bool, error) {
+    result := r.db.Model(&model.User{}).
+        Where("id = ? AND totp_last_step < ?", userID, step).
+        Update("totp_last_step", step)
+    return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores the
+// given hashes instead. An empty list leaves the user without any.
+func (r *UserRepository) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+    return r.db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+            return err
+        }
+        if len(hashes) == 0 {
+            return nil
+        }
+        codes := make([]model.RecoveryCode, 0, len(hashes))
+        for _, hash := range hashes {
+            codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: hash})
+        }
+        return tx.Create(&codes).Error
+    })
+}
+
+// UseRecoveryCode marks the user's unused code with the given hash as used.
+// It reports false when there is no such code.
+func (r *UserRepository) UseRecoveryCode(userID uint, hash string, at time.Time) (bool, error) {
+    result := r.db.Model(&model.RecoveryCode{}).
+        Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+        Update("used_at", at)
+    return result.RowsAffected >= 1, result.Error
+}
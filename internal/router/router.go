@@ -0,0 +1,160 @@
+package router
+
+import (
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/handler"
+    "makerble-assessment/internal/middleware"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+    "makerble-assessment/internal/token"
+)
+
+// Config carries the non-database dependencies of the router. An unset
+// LoginLimit means service.DefaultLoginLimitConfig, so forgetting it never
+// turns throttling off. Limiter holds the login limits' counters; nil keeps
+// them in memory.
+type Config struct {
+    Keys       *token.KeySet
+    Auth       service.AuthConfig
+    LoginLimit service.LoginLimitConfig
+    Limiter    repository.LimiterStore
+}
+
+// New wires repositories, services and handlers on top of db and registers
+// every API route. The server and the end-to-end tests share it.
+func New(db *gorm.DB, cfg Config) *gin.Engine {
+    r := gin.Default()
+    // Client IPs come from the connection unless the server trusts a proxy
+    // (TRUSTED_PROXIES), so a forged X-Forwarded-For cannot dodge the login
+    // limits.
+    r.SetTrustedProxies(nil)
+
+    userRepo := repository.NewUserRepository(db)
+    stores := repository.NewTransactor(db)
+    patientRepo := stores.Stores().Patients
+    refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+    authService := service.NewAuthService(userRepo, refreshTokenRepo, cfg.Keys, cfg.Auth)
+    patientService := service.NewPatientService(stores)
+    userService := service.NewUserService(userRepo, refreshTokenRepo)
+    auditService := service.NewAuditService(stores.Stores().Audit)
+    appointmentRepo := repository.NewAppointmentRepository(db)
+    appointmentService := service.NewAppointmentService(appointmentRepo, patientRepo, userRepo)
+    availabilityService := service.NewAvailabilityService(repository.NewAvailabilityRepository(db), appointmentRepo, userRepo)
+    limiterStore := cfg.Limiter
+    if limiterStore == nil {
+        limiterStore = repository.NewMemoryLimiterStore()
+    }
+    loginLimit := cfg.LoginLimit
+    if loginLimit == (service.LoginLimitConfig{}) {
+        loginLimit = service.DefaultLoginLimitConfig()
+    }
+    authHandler := handler.NewAuthHandler(authService, service.NewLoginLimiter(limiterStore, loginLimit))
+    patientHandler := handler.NewPatientHandler(patientService, auditService)
+    userHandler := handler.NewUserHandler(userService)
+    auditHandler := handler.NewAuditHandler(auditService)
+    appointmentHandler := handler.NewAppointmentHandler(appointmentService)
+    availabilityHandler := handler.NewAvailabilityHandler(availabilityService)
+    fhirHandler := handler.NewFHIRHandler(patientService, auditService)
+
+    r.POST("/login", authHandler.Login)
+    r.POST("/auth/refresh", authHandler.Refresh)
+    r.POST("/auth/logout", authHandler.Logout)
+    r.POST("/auth/2fa/verify", authHandler.VerifyTwoFactor)
+    r.POST("/auth/2fa/enroll", authHandler.StartChallengeEnrollment)
+    r.POST("/auth/2fa/enroll/confirm", authHandler.ConfirmChallengeEnrollment)
+    r.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+    twoFactor := r.Group("/api/account/2fa").Use(middleware.Authenticate(authService))
+    {
+        twoFactor.POST("", authHandler.EnrollTwoFactor)
+        twoFactor.POST("/confirm", authHandler.ConfirmTwoFactor)
+        twoFactor.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+        twoFactor.POST("/disable", authHandler.DisableTwoFactor)
+    }
+
+    patients := r.Group("/api/patients").Use(middleware.Authenticate(authService))
+    {
+        read := middleware.RequirePermission(model.PermPatientRead)
+        write := middleware.RequirePermission(model.PermPatientWrite)
+
+        patients.POST("", write, patientHandler.Create)
+        patients.POST("/import", write, patientHandler.Import)
+        patients.GET("", read, patientHandler.List)
+        patients.GET("/search", read, patientHandler.Search)
+        patients.GET("/export", middleware.RequirePermission(model.PermPatientExport), patientHandler.Export)
+        patients.GET("/:id", read, patientHandler.Get)
+        patients.PUT("/:id", write, patientHandler.Update)
+        patients.DELETE("/:id", write, patientHandler.Delete)
+        patients.POST("/:id/merge", write, patientHandler.Merge)
+        patients.GET("/:id/medical-history", read, patientHandler.ListMedicalHistory)
+        patients.GET("/:id/summary.pdf", read, patientHandler.Summary)
+        patients.POST("/:id/medical-history", middleware.RequirePermission(model.PermMedicalHistoryWrite), patientHandler.AddMedicalHistoryEntry)
+    }
+
+    r.GET("/fhir/metadata", handler.FHIRErrors(), fhirHandler.Metadata)
+    fhirPatients := r.Group("/fhir/Patient").Use(handler.FHIRErrors(), middleware.Authenticate(authService))
+    {
+        read := middleware.RequirePermission(model.PermPatientRead)
+        write := middleware.RequirePermission(model.PermPatientWrite)
+
+        fhirPatients.GET("", read, fhirHandler.Search)
+        fhirPatients.GET("/:id", read, fhirHandler.Read)
+        fhirPatients.POST("", write, fhirHandler.Create)
+        fhirPatients.PUT("/:id", write, fhirHandler.Update)
+    }
+
+    appointments := r.Group("/api/appointments").Use(middleware.Authenticate(authService))
+    {
+        read := middleware.RequirePermission(model.PermAppointmentRead)
+        write := middleware.RequirePermission(model.PermAppointmentWrite)
+
+        appointments.POST("", write, appointmentHandler.Book)
+        appointments.GET("", read, appointmentHandler.List)
+        appointments.GET("/mine", middleware.RequirePermission(model.PermAppointmentAttend), appointmentHandler.Mine)
+        appointments.GET("/:id", read, appointmentHandler.Get)
+        appointments.PUT("/:id", write, appointmentHandler.Reschedule)
+        appointments.POST("/:id/cancel", write, appointmentHandler.Cancel)
+    }
+
+    doctors := r.Group("/api/doctors").Use(middleware.Authenticate(authService))
+    {
+        attend := middleware.RequirePermission(model.PermAppointmentAttend)
+        read := middleware.RequirePermission(model.PermAppointmentRead)
+
+        doctors.GET("/me/availability", attend, availabilityHandler.GetMine)
+        doctors.PUT("/me/availability", attend, availabilityHandler.SetMine)
+        doctors.GET("/:id/availability", read, availabilityHandler.Get)
+        doctors.GET("/:id/slots", read, availabilityHandler.Slots)
+    }
+
+    users := r.Group("/api/admin/users").Use(middleware.Authenticate(authService), middleware.RequirePermission(model.PermUserManage))
+    {
+        users.POST("", userHandler.Create)
+        users.GET("", userHandler.List)
+        users.GET("/:id", userHandler.Get)
+        users.PUT("/:id", userHandler.Update)
+        users.POST("/:id/deactivate", userHandler.Deactivate)
+        users.POST("/:id/activate", userHandler.Activate)
+        users.PUT("/:id/password", userHandler.ResetPassword)
+        users.DELETE("/:id/2fa", userHandler.ResetTwoFactor)
+    }
+
+    roles := r.Group("/api/admin/roles").Use(middleware.Authenticate(authService), middleware.RequirePermission(model.PermUserManage))
+    {
+        roles.GET("", userHandler.ListRoles)
+        roles.PUT("/:name", userHandler.UpdateRole)
+    }
+
+    trash := r.Group("/api/admin/patients/trash").Use(middleware.Authenticate(authService), middleware.RequirePermission(model.PermPatientTrash))
+    {
+        trash.GET("", patientHandler.ListDeleted)
+        trash.POST("/:id/restore", patientHandler.Restore)
+        trash.DELETE("/:id", patientHandler.Purge)
+    }
+
+    r.GET("/api/admin/audit-logs", middleware.Authenticate(authService), middleware.RequirePermission(model.PermAuditRead), auditHandler.List)
+
+    return r
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// MaxAppointmentLength caps how long a single booking may block a doctor.
+const MaxAppointmentLength = 8 * time.Hour
+
+var (
+    ErrAppointmentOverlap = &Error{Kind: KindConflict, Code: "appointment_overlap", Message: repository.ErrAppointmentOverlap.Error(),
+        Err: repository.ErrAppointmentOverlap}
+    ErrInvalidAppointment = &Error{Kind: KindValidation, Code: "invalid_appointment", Message: "invalid appointment"}
+    ErrUnknownPatient     = &Error{Kind: KindValidation, Code: "unknown_patient", Message: "patient does not exist",
+        Fields: []FieldError{{Field: "patient_id", Message: "does not exist"}}}
+    ErrNotADoctor = &Error{Kind: KindValidation, Code: "not_a_doctor", Message: "user is not an active doctor",
+        Fields: []FieldError{{Field: "doctor_id", Message: "is not an active doctor"}}}
+    ErrAppointmentNotScheduled = &Error{Kind: KindConflict, Code: "appointment_not_scheduled", Message: "only scheduled appointments can be changed"}
+)
+
+// AppointmentService books patients in with doctors. A doctor is any active
+// user holding the appointment:attend permission.
+type AppointmentService struct {
+    repo        repository.AppointmentStore
+    patientRepo repository.PatientStore
+    userRepo    repository.UserStore
+}
+
+// BookAppointmentInput times are RFC 3339 and must lie in the future.
+type BookAppointmentInput struct {
+    PatientID uint      `json:"patient_id" binding:"required"`
+    DoctorID  uint      `json:"doctor_id" binding:"required"`
+    StartsAt  time.Time `json:"starts_at" binding:"required"`
+    EndsAt    time.Time `json:"ends_at" binding:"required"`
+    Reason    string    `json:"reason" binding:"max=1000"`
+}
+
+// RescheduleAppointmentInput moves an appointment, optionally to another
+// doctor.
+type RescheduleAppointmentInput struct {
+    DoctorID uint      `json:"doctor_id"`
+    StartsAt time.Time `json:"starts_at" binding:"required"`
+    EndsAt   time.Time `json:"ends_at" binding:"required"`
+}
+
+type CancelAppointmentInput struct {
+    Reason string `json:"reason" binding:"max=1000"`
+}
+
+// ListAppointmentsInput is bound from the appointment list endpoint's query
+// string. From and To are RFC 3339 and keep appointments overlapping that
+// window.
+type ListAppointmentsInput struct {
+    Page      int       `form:"page" binding:"omitempty,min=1"`
+    Limit     int       `form:"limit" binding:"omitempty,min=1,max=100"`
+    DoctorID  uint      `form:"doctor_id"`
+    PatientID uint      `form:"patient_id"`
+    Status    string    `form:"status" binding:"omitempty,oneof=scheduled cancelled"`
+    From      time.Time `form:"from"`
+    To        time.Time `form:"to"`
+}
+
+// ListUpcomingInput is bound from the doctor's own appointment list.
+type ListUpcomingInput struct {
+    Page  int `form:"page" binding:"omitempty,min=1"`
+    Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type AppointmentResponse struct {
+    ID                 uint   `json:"id"`
+    PatientID          uint   `json:"patient_id"`
+    DoctorID           uint   `json:"doctor_id"`
+    StartsAt           string `json:"starts_at"`
+    EndsAt             string `json:"ends_at"`
+    Status             string `json:"status"`
+    Reason             string `json:"reason"`
+    CancellationReason string `json:"cancellation_reason,omitempty"`
+}
+
+type AppointmentListResponse struct {
+    Data []AppointmentResponse `json:"data"`
+    Meta PageMeta              `json:"meta"`
+}
+
+func NewAppointmentService(repo repository.AppointmentStore, patientRepo repository.PatientStore, userRepo repository.UserStore) *AppointmentService {
+    return &AppointmentService{repo: repo, patientRepo: patientRepo, userRepo: userRepo}
+}
+
+func (s *AppointmentService) Book(input BookAppointmentInput) (AppointmentResponse, error) {
+    if err := checkTimes(input.StartsAt, input.EndsAt); err != nil {
+        return AppointmentResponse{}, err
+    }
+    if _, err := s.patientRepo.FindByID(input.PatientID); err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return AppointmentResponse{}, ErrUnknownPatient
+        }
+        return AppointmentResponse{}, err
+    }
+    if err := checkDoctor(s.userRepo, input.DoctorID); err != nil {
+        return AppointmentResponse{}, err
+    }
+
+    appointment := model.Appointment{
+        PatientID: input.PatientID,
+        DoctorID:  input.DoctorID,
+        StartsAt:  input.StartsAt.UTC(),
+        EndsAt:    input.EndsAt.UTC(),
+        Status:    model.AppointmentScheduled,
+        Reason:    input.Reason,
+    }
+    if err := s.repo.Create(&appointment); err != nil {
+        return AppointmentResponse{}, overlapError(err)
+    }
+    return newAppointmentResponse(appointment), nil
+}
+
+func (s *AppointmentService) Get(id uint) (AppointmentResponse, error) {
+    appointment, err := s.repo.FindByID(id)
+    if err != nil {
+        return AppointmentResponse{}, notFound(err, "Appointment")
+    }
+    return newAppointmentResponse(appointment), nil
+}
+
+func (s *AppointmentService) List(input ListAppointmentsInput) (AppointmentListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    query := repository.AppointmentQuery{
+        Offset:    (page - 1) * limit,
+        Limit:     limit,
+        DoctorID:  input.DoctorID,
+        PatientID: input.PatientID,
+        Status:    input.Status,
+    }
+    if !input.From.IsZero() {
+        from := input.From.UTC()
+        query.From = &from
+    }
+    if !input.To.IsZero() {
+        to := input.To.UTC()
+        query.To = &to
+    }
+    return s.page(page, limit, query)
+}
+
+// Upcoming lists the scheduled appointments of one doctor that have not
+// ended yet, soonest first.
+func (s *AppointmentService) Upcoming(doctorID uint, input ListUpcomingInput) (AppointmentListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    now := time.Now().UTC()
+    return s.page(page, limit, repository.AppointmentQuery{
+        Offset:   (page - 1) * limit,
+        Limit:    limit,
+        DoctorID: doctorID,
+        Status:   model.AppointmentScheduled,
+        From:     &now,
+    })
+}
+
+func (s *AppointmentService) page(page, limit int, query repository.AppointmentQuery) (AppointmentListResponse, error) {
+    appointments, total, err := s.repo.FindPage(query)
+    if err != nil {
+        return AppointmentListResponse{}, err
+    }
+
+    response := AppointmentListResponse{
+        Data: make([]AppointmentResponse, 0, len(appointments)),
+        Meta: newPageMeta(page, limit, total),
+    }
+    for _, appointment := range appointments {
+        response.Data = append(response.Data, newAppointmentResponse(appointment))
+    }
+    return response, nil
+}
+
+func (s *AppointmentService) Reschedule(id uint, input RescheduleAppointmentInput) (AppointmentResponse, error) {
+    appointment, err := s.scheduled(id)
+    if err != nil {
+        return AppointmentResponse{}, err
+    }
+    if err := checkTimes(input.StartsAt, input.EndsAt); err != nil {
+        return AppointmentResponse{}, err
+    }
+    if input.DoctorID != 0 && input.DoctorID != appointment.DoctorID {
+        if err := checkDoctor(s.userRepo, input.DoctorID); err != nil {
+            return AppointmentResponse{}, err
+        }
+        appointment.DoctorID = input.DoctorID
+    }
+
+    appointment.StartsAt = input.StartsAt.UTC()
+    appointment.EndsAt = input.EndsAt.UTC()
+    if err := s.repo.Update(&appointment); err != nil {
+        return AppointmentResponse{}, overlapError(err)
+    }
+    return newAppointmentResponse(appointment), nil
+}
+
+// Cancel frees the doctor's time. Cancelled appointments are kept for the
+// record and can no longer be changed.
+func (s *AppointmentService) Cancel(id uint, input CancelAppointmentInput) (AppointmentResponse, error) {
+    appointment, err := s.scheduled(id)
+    if err != nil {
+        return AppointmentResponse{}, err
+    }
+
+    appointment.Status = model.AppointmentCancelled
+    appointment.CancellationReason = input.Reason
+    if err := s.repo.Update(&appointment); err != nil {
+        return AppointmentResponse{}, err
+    }
+    return newAppointmentResponse(appointment), nil
+}
+
+func (s *AppointmentService) scheduled(id uint) (model.Appointment, error) {
+    appointment, err := s.repo.FindByID(id)
+    if err != nil {
+        return model.Appointment{}, notFound(err, "Appointment")
+    }
+    if appointment.Status != model.AppointmentScheduled {
+        return model.Appointment{}, ErrAppointmentNotScheduled
+    }
+    return appointment, nil
+}
+
+// checkDoctor returns ErrNotADoctor unless id is an active user who can
+// attend appointments.
+func checkDoctor(users repository.UserStore, id uint) error {
+    user, err := users.FindByID(id)
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return ErrNotADoctor
+    }
+    if err != nil {
+        return err
+    }
+    if !user.Active() {
+        return ErrNotADoctor
+    }
+    for _, permission := range user.Permissions() {
+        if permission == model.PermAppointmentAttend {
+            return nil
+        }
+    }
+    return ErrNotADoctor
+}
+
+// overlapError reports a double booking from the store as
+// ErrAppointmentOverlap.
+func overlapError(err error) error {
+    if errors.Is(err, repository.ErrAppointmentOverlap) {
+        return ErrAppointmentOverlap
+    }
+    return err
+}
+
+func checkTimes(startsAt, endsAt time.Time) error {
+    switch {
+    case !endsAt.After(startsAt):
+        return ErrInvalidAppointment.with("ends_at", "must be after starts_at")
+    case endsAt.Sub(startsAt) > MaxAppointmentLength:
+        return ErrInvalidAppointment.with("ends_at", fmt.Sprintf("must be at most %s after starts_at", MaxAppointmentLength))
+    case !startsAt.After(time.Now()):
+        return ErrInvalidAppointment.with("starts_at", "must be in the future")
+    }
+    return nil
+}
+
+func newAppointmentResponse(appointment model.Appointment) AppointmentResponse {
+    return AppointmentResponse{
+        ID:                 appointment.ID,
+        PatientID:          appointment.PatientID,
+        DoctorID:           appointment.DoctorID,
+        StartsAt:           appointment.StartsAt.UTC().Format(time.RFC3339),
+        EndsAt:             appointment.EndsAt.UTC().Format(time.RFC3339),
+        Status:             appointment.Status,
+        Reason:             appointment.Reason,
+        CancellationReason: appointment.CancellationReason,
+    }
+}
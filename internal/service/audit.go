@@ -0,0 +1,179 @@
+package service
+
+import (
+    "encoding/json"
+    "reflect"
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// AuditService records who accessed or changed which patient record.
+type AuditService struct {
+    repo repository.AuditStore
+}
+
+// FieldChange is the value of one field before and after a write. Before is
+// null for created records and After for deleted ones.
+type FieldChange struct {
+    Before interface{} `json:"before"`
+    After  interface{} `json:"after"`
+}
+
+// ListAuditLogsInput is bound from the audit log endpoint's query string.
+// From and To are RFC 3339 timestamps and both ends are inclusive.
+type ListAuditLogsInput struct {
+    Page      int       `form:"page" binding:"omitempty,min=1"`
+    Limit     int       `form:"limit" binding:"omitempty,min=1,max=100"`
+    UserID    uint      `form:"user_id"`
+    PatientID uint      `form:"patient_id"`
+    From      time.Time `form:"from"`
+    To        time.Time `form:"to"`
+}
+
+// AuditLogResponse is one audit entry. RelatedPatientID is the other
+// patient of a merge. ChangesErased replaces Changes once the patient has
+// been purged.
+type AuditLogResponse struct {
+    ID               uint                   `json:"id"`
+    UserID           uint                   `json:"user_id"`
+    Action           string                 `json:"action"`
+    PatientID        uint                   `json:"patient_id"`
+    RelatedPatientID *uint                  `json:"related_patient_id,omitempty"`
+    Changes          map[string]FieldChange `json:"changes,omitempty"`
+    ChangesErased    bool                   `json:"changes_erased,omitempty"`
+    CreatedAt        string                 `json:"created_at"`
+}
+
+type AuditLogListResponse struct {
+    Data []AuditLogResponse `json:"data"`
+    Meta PageMeta           `json:"meta"`
+}
+
+func NewAuditService(repo repository.AuditStore) *AuditService {
+    return &AuditService{repo: repo}
+}
+
+// Record logs an action by userID on one patient. before and after are the
+// record's representation around a write, nil when it did not exist; only
+// fields that differ are kept. Reads pass nil for both.
+func (s *AuditService) Record(userID uint, action string, patientID uint, before, after interface{}) error {
+    entry, err := newAuditEntry(userID, action, patientID, before, after)
+    if err != nil {
+        return err
+    }
+    return s.repo.Create([]model.AuditLog{entry})
+}
+
+// RecordViews logs that userID saw each of the patients, for list and search
+// results.
+func (s *AuditService) RecordViews(userID uint, action string, patientIDs []uint) error {
+    return s.repo.Create(auditEntries(userID, action, patientIDs))
+}
+
+// newAuditEntry builds the entry Record stores. Services that write
+// patients use it to store the entry in the same transaction as the write.
+func newAuditEntry(userID uint, action string, patientID uint, before, after interface{}) (model.AuditLog, error) {
+    entry := model.AuditLog{UserID: userID, Action: action, PatientID: patientID}
+    if before != nil || after != nil {
+        changes, err := diffFields(before, after)
+        if err != nil {
+            return model.AuditLog{}, err
+        }
+        encoded, err := json.Marshal(changes)
+        if err != nil {
+            return model.AuditLog{}, err
+        }
+        entry.Changes = string(encoded)
+    }
+    return entry, nil
+}
+
+func auditEntries(userID uint, action string, patientIDs []uint) []model.AuditLog {
+    entries := make([]model.AuditLog, 0, len(patientIDs))
+    for _, patientID := range patientIDs {
+        entries = append(entries, model.AuditLog{UserID: userID, Action: action, PatientID: patientID})
+    }
+    return entries
+}
+
+func (s *AuditService) List(input ListAuditLogsInput) (AuditLogListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    query := repository.AuditQuery{
+        Offset:    (page - 1) * limit,
+        Limit:     limit,
+        UserID:    input.UserID,
+        PatientID: input.PatientID,
+    }
+    if !input.From.IsZero() {
+        query.From = &input.From
+    }
+    if !input.To.IsZero() {
+        query.To = &input.To
+    }
+
+    entries, total, err := s.repo.FindPage(query)
+    if err != nil {
+        return AuditLogListResponse{}, err
+    }
+
+    response := AuditLogListResponse{
+        Data: make([]AuditLogResponse, 0, len(entries)),
+        Meta: newPageMeta(page, limit, total),
+    }
+    for _, entry := range entries {
+        item := AuditLogResponse{
+            ID:               entry.ID,
+            UserID:           entry.UserID,
+            Action:           entry.Action,
+            PatientID:        entry.PatientID,
+            RelatedPatientID: entry.RelatedPatientID,
+            ChangesErased:    entry.ChangesErased,
+            CreatedAt:        entry.CreatedAt.Format(time.RFC3339),
+        }
+        if entry.Changes != "" {
+            if err := json.Unmarshal([]byte(entry.Changes), &item.Changes); err != nil {
+                return AuditLogListResponse{}, err
+            }
+        }
+        response.Data = append(response.Data, item)
+    }
+    return response, nil
+}
+
+// diffFields compares the JSON forms of before and after field by field.
+func diffFields(before, after interface{}) (map[string]FieldChange, error) {
+    beforeFields, err := jsonFields(before)
+    if err != nil {
+        return nil, err
+    }
+    afterFields, err := jsonFields(after)
+    if err != nil {
+        return nil, err
+    }
+
+    changes := make(map[string]FieldChange)
+    for name, value := range beforeFields {
+        if other, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, other) {
+            changes[name] = FieldChange{Before: value, After: afterFields[name]}
+        }
+    }
+    for name, value := range afterFields {
+        if _, ok := beforeFields[name]; !ok {
+            changes[name] = FieldChange{After: value}
+        }
+    }
+    return changes, nil
+}
+
+func jsonFields(value interface{}) (map[string]interface{}, error) {
+    fields := make(map[string]interface{})
+    if value == nil {
+        return fields, nil
+    }
+    encoded, err := json.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+    return fields, json.Unmarshal(encoded, &fields)
+}
@@ -1,16 +1,58 @@
 package service
 
 import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "errors"
     "time"
     "github.com/golang-jwt/jwt/v4"
     "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
     "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/token"
 )
 
+var (
+    ErrInvalidCredentials  = &Error{Kind: KindUnauthorized, Code: "invalid_credentials", Message: "invalid credentials"}
+    ErrInvalidRefreshToken = &Error{Kind: KindUnauthorized, Code: "invalid_refresh_token", Message: "invalid refresh token"}
+    ErrRefreshTokenReused  = &Error{Kind: KindUnauthorized, Code: "refresh_token_reused", Message: "refresh token reuse detected; session revoked"}
+    ErrInvalidToken        = &Error{Kind: KindUnauthorized, Code: "invalid_token", Message: "invalid token"}
+    ErrTokenRevoked        = &Error{Kind: KindUnauthorized, Code: "token_revoked", Message: "token has been revoked"}
+    ErrAccountDeactivated  = &Error{Kind: KindUnauthorized, Code: "account_deactivated", Message: "account is deactivated"}
+)
+
+// AuthConfig sets the lifetimes of issued tokens. ChallengeTTL is how long
+// a password check stays good for the second step of a two-factor login,
+// and TOTPIssuer names the service in authenticator apps.
+type AuthConfig struct {
+    AccessTokenTTL  time.Duration
+    RefreshTokenTTL time.Duration
+    ChallengeTTL    time.Duration
+    TOTPIssuer      string
+}
+
+func DefaultAuthConfig() AuthConfig {
+    return AuthConfig{
+        AccessTokenTTL:  15 * time.Minute,
+        RefreshTokenTTL: 30 * 24 * time.Hour,
+        ChallengeTTL:    5 * time.Minute,
+        TOTPIssuer:      "Makerble Hospital",
+    }
+}
+
+// unknownUserHash is a bcrypt hash, at the cost passwords are stored with,
+// that no password matches in practice. Login checks against it when the
+// email is unknown.
+const unknownUserHash = "$2a$10$2uPD6nRZmaCogY8rfWWR7u2P8Oq/KAg7Qim5JuVUTDhyPfE8U.YqS"
+
 type AuthService struct {
-    userRepo  *repository.UserRepository
-    jwtSecret string
+    userRepo  repository.UserStore
+    tokenRepo repository.RefreshTokenStore
+    keys      *token.KeySet
+    config    AuthConfig
 }
 
 type LoginInput struct {
@@ -18,58 +60,228 @@ type LoginInput struct {
     Password string `json:"password" binding:"required"`
 }
 
+type RefreshInput struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type UserResponse struct {
-    ID    uint   `json:"id"`
-    Email string `json:"email"`
-    Role  string `json:"role"`
+    ID               uint     `json:"id"`
+    Email            string   `json:"email"`
+    Roles            []string `json:"roles"`
+    Permissions      []string `json:"permissions"`
+    Active           bool     `json:"active"`
+    TwoFactorEnabled bool     `json:"two_factor_enabled"`
+}
+
+func newUserResponse(user model.User) UserResponse {
+    return UserResponse{
+        ID:               user.ID,
+        Email:            user.Email,
+        Roles:            user.RoleNames(),
+        Permissions:      user.Permissions(),
+        Active:           user.Active(),
+        TwoFactorEnabled: user.TwoFactorEnabled(),
+    }
+}
+
+// TokenResponse is returned by login and refresh. ExpiresIn is the access
+// token lifetime in seconds. When the password is right but a TOTP code is
+// still needed, login returns only TwoFactor. RecoveryCodes are shown once,
+// when a two-factor login enrolls.
+type TokenResponse struct {
+    Token         string              `json:"token,omitempty"`
+    RefreshToken  string              `json:"refresh_token,omitempty"`
+    ExpiresIn     int64               `json:"expires_in,omitempty"`
+    User          *UserResponse       `json:"user,omitempty"`
+    TwoFactor     *TwoFactorChallenge `json:"two_factor,omitempty"`
+    RecoveryCodes []string            `json:"recovery_codes,omitempty"`
 }
 
-func NewAuthService(userRepo *repository.UserRepository) *AuthService {
+func NewAuthService(userRepo repository.UserStore, tokenRepo repository.RefreshTokenStore, keys *token.KeySet, config AuthConfig) *AuthService {
     return &AuthService{
         userRepo:  userRepo,
-        jwtSecret: "mysecret123456", // Should be in .env
+        tokenRepo: tokenRepo,
+        keys:      keys,
+        config:    config,
     }
 }
 
-func (s *AuthService) Login(input LoginInput) (string, UserResponse, error) {
+// Login checks the password. Users with two-factor authentication, or
+// holding a role that requires it, get a challenge to complete with
+// VerifyTwoFactor, or with the enrollment methods when not yet enrolled,
+// instead of tokens.
+func (s *AuthService) Login(input LoginInput) (TokenResponse, error) {
     user, err := s.userRepo.FindByEmail(input.Email)
     if err != nil {
-        return "", UserResponse{}, errors.New("invalid credentials")
+        // Spend the same bcrypt time as for a real account, so response
+        // times do not tell which emails exist.
+        bcrypt.CompareHashAndPassword([]byte(unknownUserHash), []byte(input.Password))
+        return TokenResponse{}, ErrInvalidCredentials
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-        return "", UserResponse{}, errors.New("invalid credentials")
+        return TokenResponse{}, ErrInvalidCredentials
     }
+    if !user.Active() {
+        return TokenResponse{}, ErrAccountDeactivated
+    }
+
+    if user.TwoFactorEnabled() || user.TwoFactorRequired() {
+        return s.challenge(user)
+    }
+    return s.startSession(user)
+}
+
+// startSession issues the first tokens of a new session.
+func (s *AuthService) startSession(user model.User) (TokenResponse, error) {
+    familyID, err := randomToken(16)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    return s.issueTokens(user, familyID)
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "user_id": user.ID,
-        "role":    user.Role,
-        "exp":     time.Now().Add(time.Hour * 24).Unix(),
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// Each refresh token works once: presenting a used one means it leaked, so
+// the whole family, and every access token issued from it, is revoked.
+// Sessions of users a role now requires to enroll in two-factor
+// authentication are ended too, so they log in again and enroll.
+func (s *AuthService) Refresh(input RefreshInput) (TokenResponse, error) {
+    stored, err := s.tokenRepo.FindByHash(hashToken(input.RefreshToken))
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return TokenResponse{}, ErrInvalidRefreshToken
+    }
+    if err != nil {
+        return TokenResponse{}, err
+    }
+
+    now := time.Now()
+    if stored.RevokedAt != nil || now.After(stored.ExpiresAt) {
+        return TokenResponse{}, ErrInvalidRefreshToken
+    }
+
+    fresh, err := s.tokenRepo.MarkUsed(stored.ID, now)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    if !fresh {
+        if err := s.tokenRepo.RevokeFamily(stored.FamilyID, now); err != nil {
+            return TokenResponse{}, err
+        }
+        return TokenResponse{}, ErrRefreshTokenReused
+    }
+
+    user, err := s.userRepo.FindByID(stored.UserID)
+    if err != nil || !user.Active() {
+        return TokenResponse{}, ErrInvalidRefreshToken
+    }
+    if user.TwoFactorRequired() && !user.TwoFactorEnabled() {
+        if err := s.tokenRepo.RevokeFamily(stored.FamilyID, now); err != nil {
+            return TokenResponse{}, err
+        }
+        return TokenResponse{}, ErrTwoFactorLoginRequired
+    }
+    return s.issueTokens(user, stored.FamilyID)
+}
+
+// Logout revokes the session the refresh token belongs to. Unknown tokens
+// are ignored so logging out twice is harmless.
+func (s *AuthService) Logout(input RefreshInput) error {
+    stored, err := s.tokenRepo.FindByHash(hashToken(input.RefreshToken))
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    return s.tokenRepo.RevokeFamily(stored.FamilyID, time.Now())
+}
+
+func (s *AuthService) issueTokens(user model.User, familyID string) (TokenResponse, error) {
+    now := time.Now()
+    jti, err := randomToken(16)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+
+    // Permissions are resolved at issue time; role changes take effect on
+    // the next login or refresh.
+    tokenString, err := s.keys.Sign(jwt.MapClaims{
+        "user_id":     user.ID,
+        "roles":       user.RoleNames(),
+        "permissions": user.Permissions(),
+        "sid":         familyID,
+        "jti":         jti,
+        "iat":         now.Unix(),
+        "exp":         now.Add(s.config.AccessTokenTTL).Unix(),
     })
+    if err != nil {
+        return TokenResponse{}, err
+    }
 
-    tokenString, err := token.SignedString([]byte(s.jwtSecret))
+    refreshToken, err := randomToken(32)
     if err != nil {
-        return "", UserResponse{}, err
+        return TokenResponse{}, err
+    }
+    if err := s.tokenRepo.Create(&model.RefreshToken{
+        UserID:    user.ID,
+        FamilyID:  familyID,
+        TokenHash: hashToken(refreshToken),
+        ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+    }); err != nil {
+        return TokenResponse{}, err
     }
 
-    return tokenString, UserResponse{
-        ID:    user.ID,
-        Email: user.Email,
-        Role:  user.Role,
+    response := newUserResponse(user)
+    return TokenResponse{
+        Token:        tokenString,
+        RefreshToken: refreshToken,
+        ExpiresIn:    int64(s.config.AccessTokenTTL / time.Second),
+        User:         &response,
     }, nil
 }
 
+// JWKS returns the public verification keys for other services.
+func (s *AuthService) JWKS() token.JWKS {
+    return s.keys.JWKS()
+}
+
+// ValidateToken verifies an access token and rejects it once its session
+// has been revoked by logout or refresh token reuse.
 func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
-    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-        return []byte(s.jwtSecret), nil
-    })
+    token, err := jwt.Parse(tokenString, s.keys.Keyfunc)
     if err != nil {
-        return nil, err
+        return nil, &Error{Kind: KindUnauthorized, Code: ErrInvalidToken.Code, Message: ErrInvalidToken.Message, Err: err}
+    }
+
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok || !token.Valid {
+        return nil, ErrInvalidToken
     }
 
-    if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-        return claims, nil
+    if sid, ok := claims["sid"].(string); ok {
+        revoked, err := s.tokenRepo.IsFamilyRevoked(sid)
+        if err != nil {
+            return nil, err
+        }
+        if revoked {
+            return nil, ErrTokenRevoked
+        }
     }
 
-    return nil, errors.New("invalid token")
-}
\ No newline at end of file
+    return claims, nil
+}
+
+func randomToken(size int) (string, error) {
+    buf := make([]byte, size)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is the lookup key for a refresh token; only hashes are stored.
+func hashToken(refreshToken string) string {
+    sum := sha256.Sum256([]byte(refreshToken))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// MaxSlotRangeDays caps how many days one slot query may cover.
+const MaxSlotRangeDays = 31
+
+var (
+    ErrInvalidAvailability = &Error{Kind: KindValidation, Code: "invalid_availability", Message: "invalid availability"}
+    ErrNoAvailability      = &Error{Kind: KindNotFound, Code: "no_availability", Message: "doctor has not published availability"}
+)
+
+// AvailabilityService manages doctors' weekly schedules and turns them into
+// bookable slots.
+type AvailabilityService struct {
+    repo            repository.AvailabilityStore
+    appointmentRepo repository.AppointmentStore
+    userRepo        repository.UserStore
+}
+
+// WeeklyWindow is a recurring local time range. Weekday 0 is Sunday and
+// times are "HH:MM" in the doctor's timezone. End may be "24:00"; an End at
+// or before Start means the window runs past midnight into the next day.
+type WeeklyWindow struct {
+    Weekday int    `json:"weekday" binding:"min=0,max=6"`
+    Start   string `json:"start" binding:"required,datetime=15:04"`
+    End     string `json:"end" binding:"required"`
+}
+
+// AvailabilityInput replaces a doctor's whole published schedule. Timezone
+// is an IANA name such as "Europe/London" and leave days are local dates
+// as YYYY-MM-DD.
+type AvailabilityInput struct {
+    Timezone     string         `json:"timezone" binding:"required"`
+    SlotMinutes  int            `json:"slot_minutes" binding:"required,min=5,max=480"`
+    WorkingHours []WeeklyWindow `json:"working_hours" binding:"dive"`
+    Breaks       []WeeklyWindow `json:"breaks" binding:"dive"`
+    LeaveDays    []string       `json:"leave_days" binding:"dive,datetime=2006-01-02"`
+}
+
+type AvailabilityResponse struct {
+    DoctorID     uint           `json:"doctor_id"`
+    Timezone     string         `json:"timezone"`
+    SlotMinutes  int            `json:"slot_minutes"`
+    WorkingHours []WeeklyWindow `json:"working_hours"`
+    Breaks       []WeeklyWindow `json:"breaks"`
+    LeaveDays    []string       `json:"leave_days"`
+}
+
+// ListSlotsInput is bound from the slots endpoint's query string. From and
+// To are inclusive dates in the doctor's timezone. Timezone, when set, is
+// the zone the slot times are written in; it defaults to the doctor's.
+type ListSlotsInput struct {
+    From     time.Time `form:"from" time_format:"2006-01-02" binding:"required"`
+    To       time.Time `form:"to" time_format:"2006-01-02" binding:"required"`
+    Timezone string    `form:"timezone"`
+}
+
+type SlotResponse struct {
+    StartsAt string `json:"starts_at"`
+    EndsAt   string `json:"ends_at"`
+}
+
+type SlotListResponse struct {
+    DoctorID    uint           `json:"doctor_id"`
+    Timezone    string         `json:"timezone"`
+    SlotMinutes int            `json:"slot_minutes"`
+    Data        []SlotResponse `json:"data"`
+}
+
+func NewAvailabilityService(repo repository.AvailabilityStore, appointmentRepo repository.AppointmentStore, userRepo repository.UserStore) *AvailabilityService {
+    return &AvailabilityService{repo: repo, appointmentRepo: appointmentRepo, userRepo: userRepo}
+}
+
+func (s *AvailabilityService) Get(doctorID uint) (AvailabilityResponse, error) {
+    schedule, err := s.find(doctorID)
+    if err != nil {
+        return AvailabilityResponse{}, err
+    }
+    return newAvailabilityResponse(schedule), nil
+}
+
+// Set publishes a doctor's schedule, replacing the previous one. Existing
+// appointments are left alone even if they now fall outside working hours.
+func (s *AvailabilityService) Set(doctorID uint, input AvailabilityInput) (AvailabilityResponse, error) {
+    if err := checkDoctor(s.userRepo, doctorID); err != nil {
+        return AvailabilityResponse{}, err
+    }
+    if _, err := time.LoadLocation(input.Timezone); err != nil || input.Timezone == "" || input.Timezone == "Local" {
+        return AvailabilityResponse{}, ErrInvalidAvailability.with("timezone", fmt.Sprintf("unknown timezone %q", input.Timezone))
+    }
+
+    workingHours, err := sortedWindows("working_hours", input.WorkingHours)
+    if err != nil {
+        return AvailabilityResponse{}, err
+    }
+    // Compare each window with the next one around the week, so a Saturday
+    // night window is checked against Sunday morning.
+    for i := 0; len(workingHours) > 1 && i < len(workingHours); i++ {
+        current, next := workingHours[i], workingHours[(i+1)%len(workingHours)]
+        _, end := weekMinutes(current)
+        nextStart, _ := weekMinutes(next)
+        if i == len(workingHours)-1 {
+            nextStart += minutesPerWeek
+        }
+        if end > nextStart {
+            return AvailabilityResponse{}, ErrInvalidAvailability.with("working_hours", fmt.Sprintf("%s-%s and %s-%s overlap",
+                current.Start, current.End, next.Start, next.End))
+        }
+    }
+    breaks, err := sortedWindows("breaks", input.Breaks)
+    if err != nil {
+        return AvailabilityResponse{}, err
+    }
+
+    schedule := model.DoctorSchedule{DoctorID: doctorID, Timezone: input.Timezone, SlotMinutes: input.SlotMinutes}
+    for _, window := range workingHours {
+        schedule.WorkingHours = append(schedule.WorkingHours, model.WorkingHours{Weekday: window.Weekday, StartTime: window.Start, EndTime: window.End})
+    }
+    for _, window := range breaks {
+        schedule.Breaks = append(schedule.Breaks, model.ScheduleBreak{Weekday: window.Weekday, StartTime: window.Start, EndTime: window.End})
+    }
+    seen := make(map[string]bool)
+    leaveDays := append([]string(nil), input.LeaveDays...)
+    sort.Strings(leaveDays)
+    for _, date := range leaveDays {
+        if !seen[date] {
+            seen[date] = true
+            schedule.LeaveDays = append(schedule.LeaveDays, model.LeaveDay{Date: date})
+        }
+    }
+
+    if err := s.repo.Replace(&schedule); err != nil {
+        return AvailabilityResponse{}, err
+    }
+    return newAvailabilityResponse(schedule), nil
+}
+
+// Slots lists the doctor's free slots starting between two local dates.
+// Slots are cut from each stretch of working hours left after breaks,
+// starting at its beginning; slots that have already started and slots
+// overlapping a scheduled appointment are left out. A window belongs to the
+// day it starts on: a leave day drops the windows starting that day, and a
+// window running past midnight yields slots on the next morning.
+func (s *AvailabilityService) Slots(doctorID uint, input ListSlotsInput) (SlotListResponse, error) {
+    schedule, err := s.find(doctorID)
+    if err != nil {
+        return SlotListResponse{}, err
+    }
+    loc, err := time.LoadLocation(schedule.Timezone)
+    if err != nil {
+        return SlotListResponse{}, err
+    }
+    out := loc
+    if input.Timezone != "" {
+        if out, err = time.LoadLocation(input.Timezone); err != nil {
+            return SlotListResponse{}, ErrInvalidAvailability.with("timezone", fmt.Sprintf("unknown timezone %q", input.Timezone))
+        }
+    }
+
+    // Only the calendar dates of From and To matter.
+    from, to := localDate(input.From, time.UTC), localDate(input.To, time.UTC)
+    days := int(to.Sub(from).Hours()/24) + 1
+    if days < 1 || days > MaxSlotRangeDays {
+        return SlotListResponse{}, ErrInvalidAvailability.with("to", fmt.Sprintf("must be 0 to %d days after from", MaxSlotRangeDays-1))
+    }
+
+    // Windows from the evening before can reach into the range and slots
+    // at its end can run into the next day.
+    rangeStart := localDate(from, loc)
+    rangeEnd := localDate(to.AddDate(0, 0, 1), loc)
+    appointmentsFrom, appointmentsTo := rangeStart.UTC(), localDate(to.AddDate(0, 0, 2), loc).UTC()
+    appointments, _, err := s.appointmentRepo.FindPage(repository.AppointmentQuery{
+        Limit:    -1,
+        DoctorID: doctorID,
+        Status:   model.AppointmentScheduled,
+        From:     &appointmentsFrom,
+        To:       &appointmentsTo,
+    })
+    if err != nil {
+        return SlotListResponse{}, err
+    }
+
+    onLeave := make(map[string]bool)
+    for _, leave := range schedule.LeaveDays {
+        onLeave[leave.Date] = true
+    }
+    var free []interval
+    for day := -1; day < days; day++ {
+        date := from.AddDate(0, 0, day)
+        if onLeave[date.Format("2006-01-02")] {
+            continue
+        }
+        for _, hours := range schedule.WorkingHours {
+            if hours.Weekday == int(date.Weekday()) {
+                free = append(free, window(date, hours.StartTime, hours.EndTime, loc))
+            }
+        }
+    }
+    for day := -1; day <= days; day++ {
+        date := from.AddDate(0, 0, day)
+        for _, pause := range schedule.Breaks {
+            if pause.Weekday == int(date.Weekday()) {
+                free = subtract(free, window(date, pause.StartTime, pause.EndTime, loc))
+            }
+        }
+    }
+
+    length := time.Duration(schedule.SlotMinutes) * time.Minute
+    now := time.Now()
+    response := SlotListResponse{
+        DoctorID:    doctorID,
+        Timezone:    out.String(),
+        SlotMinutes: schedule.SlotMinutes,
+        Data:        []SlotResponse{},
+    }
+    for _, stretch := range free {
+        for start := stretch.start; !start.Add(length).After(stretch.end); start = start.Add(length) {
+            slot := interval{start, start.Add(length)}
+            if slot.start.Before(rangeStart) || !slot.start.Before(rangeEnd) || !slot.start.After(now) || booked(appointments, slot) {
+                continue
+            }
+            response.Data = append(response.Data, SlotResponse{
+                StartsAt: slot.start.In(out).Format(time.RFC3339),
+                EndsAt:   slot.end.In(out).Format(time.RFC3339),
+            })
+        }
+    }
+    return response, nil
+}
+
+func (s *AvailabilityService) find(doctorID uint) (model.DoctorSchedule, error) {
+    if err := checkDoctor(s.userRepo, doctorID); err != nil {
+        if errors.Is(err, ErrNotADoctor) {
+            return model.DoctorSchedule{}, &Error{Kind: KindNotFound, Code: "not_found", Message: "Doctor not found", Err: err}
+        }
+        return model.DoctorSchedule{}, err
+    }
+    schedule, err := s.repo.Find(doctorID)
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return model.DoctorSchedule{}, ErrNoAvailability
+    }
+    return schedule, err
+}
+
+const (
+    minutesPerDay  = 24 * 60
+    minutesPerWeek = 7 * minutesPerDay
+)
+
+// sortedWindows validates the windows of the named input field and orders
+// them by weekday and start.
+// "HH:MM" start times compare correctly as text.
+func sortedWindows(field string, windows []WeeklyWindow) ([]WeeklyWindow, error) {
+    out := append([]WeeklyWindow(nil), windows...)
+    for _, window := range out {
+        start, startOK := parseClock(window.Start, false)
+        end, endOK := parseClock(window.End, true)
+        switch {
+        case !startOK || !endOK:
+            return nil, ErrInvalidAvailability.with(field, fmt.Sprintf("%s-%s: times must be HH:MM, up to 24:00 for an end", window.Start, window.End))
+        case start == end:
+            return nil, ErrInvalidAvailability.with(field, fmt.Sprintf("%s-%s is empty", window.Start, window.End))
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Weekday != out[j].Weekday {
+            return out[i].Weekday < out[j].Weekday
+        }
+        return out[i].Start < out[j].Start
+    })
+    return out, nil
+}
+
+type interval struct {
+    start, end time.Time
+}
+
+// subtract removes cut from each interval in free.
+func subtract(free []interval, cut interval) []interval {
+    var out []interval
+    for _, span := range free {
+        if !cut.start.Before(span.end) || !cut.end.After(span.start) {
+            out = append(out, span)
+            continue
+        }
+        if span.start.Before(cut.start) {
+            out = append(out, interval{span.start, cut.start})
+        }
+        if cut.end.Before(span.end) {
+            out = append(out, interval{cut.end, span.end})
+        }
+    }
+    return out
+}
+
+func booked(appointments []model.Appointment, slot interval) bool {
+    for _, appointment := range appointments {
+        if appointment.StartsAt.Before(slot.end) && appointment.EndsAt.After(slot.start) {
+            return true
+        }
+    }
+    return false
+}
+
+// localDate is midnight of date's calendar day in loc.
+func localDate(date time.Time, loc *time.Location) time.Time {
+    return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+}
+
+// parseClock returns the minutes after midnight of an "HH:MM" time. "24:00"
+// is accepted when end is set.
+func parseClock(hhmm string, end bool) (int, bool) {
+    if end && hhmm == "24:00" {
+        return minutesPerDay, true
+    }
+    t, err := time.Parse("15:04", hhmm)
+    if err != nil {
+        return 0, false
+    }
+    return t.Hour()*60 + t.Minute(), true
+}
+
+// weekMinutes returns where a validated window starts and ends, in minutes
+// after Sunday midnight. The end is past the start even when the window
+// runs into the next day, and may be past the end of the week.
+func weekMinutes(window WeeklyWindow) (int, int) {
+    start, _ := parseClock(window.Start, false)
+    end, _ := parseClock(window.End, true)
+    if end <= start {
+        end += minutesPerDay
+    }
+    offset := window.Weekday * minutesPerDay
+    return offset + start, offset + end
+}
+
+// window places a validated window on date's calendar day in loc. Its end
+// falls on the next day when it is "24:00" or not after the start. Local
+// times are kept across daylight saving changes, so a window can be an hour
+// longer or shorter than its clock times suggest.
+func window(date time.Time, start, end string, loc *time.Location) interval {
+    startMinutes, _ := parseClock(start, false)
+    endMinutes, _ := parseClock(end, true)
+    if endMinutes <= startMinutes {
+        endMinutes += minutesPerDay
+    }
+    return interval{
+        time.Date(date.Year(), date.Month(), date.Day(), 0, startMinutes, 0, 0, loc),
+        time.Date(date.Year(), date.Month(), date.Day(), 0, endMinutes, 0, 0, loc),
+    }
+}
+
+func newAvailabilityResponse(schedule model.DoctorSchedule) AvailabilityResponse {
+    response := AvailabilityResponse{
+        DoctorID:     schedule.DoctorID,
+        Timezone:     schedule.Timezone,
+        SlotMinutes:  schedule.SlotMinutes,
+        WorkingHours: make([]WeeklyWindow, 0, len(schedule.WorkingHours)),
+        Breaks:       make([]WeeklyWindow, 0, len(schedule.Breaks)),
+        LeaveDays:    make([]string, 0, len(schedule.LeaveDays)),
+    }
+    for _, hours := range schedule.WorkingHours {
+        response.WorkingHours = append(response.WorkingHours, WeeklyWindow{Weekday: hours.Weekday, Start: hours.StartTime, End: hours.EndTime})
+    }
+    for _, pause := range schedule.Breaks {
+        response.Breaks = append(response.Breaks, WeeklyWindow{Weekday: pause.Weekday, Start: pause.StartTime, End: pause.EndTime})
+    }
+    for _, leave := range schedule.LeaveDays {
+        response.LeaveDays = append(response.LeaveDays, leave.Date)
+    }
+    return response
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// DeadLetterService keeps inbound messages that could not be applied until
+// they are reprocessed. Messages can hold patient data, so they are encrypted
+// at rest and removed once they go through.
+type DeadLetterService struct {
+    repo repository.DeadLetterStore
+}
+
+// DeadLetterResponse describes a dead letter without its message.
+type DeadLetterResponse struct {
+    ID        uint   `json:"id"`
+    Source    string `json:"source"`
+    Reason    string `json:"reason"`
+    Attempts  int    `json:"attempts"`
+    CreatedAt string `json:"created_at"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+// RetryResult is what became of one dead letter on a retry: Err is nil when
+// it went through and was removed.
+type RetryResult struct {
+    DeadLetterResponse
+    Err error
+}
+
+func NewDeadLetterService(repo repository.DeadLetterStore) *DeadLetterService {
+    return &DeadLetterService{repo: repo}
+}
+
+// Record keeps message, received from source, with the reason it failed.
+func (s *DeadLetterService) Record(source string, message []byte, reason string) error {
+    return s.repo.Create(&model.DeadLetter{Source: source, Message: string(message), Reason: reason, Attempts: 1})
+}
+
+// List returns up to limit dead letters with IDs above afterID, oldest
+// first.
+func (s *DeadLetterService) List(afterID uint, limit int) ([]DeadLetterResponse, error) {
+    letters, err := s.repo.FindAfter(afterID, limit)
+    if err != nil {
+        return nil, err
+    }
+    responses := make([]DeadLetterResponse, 0, len(letters))
+    for _, letter := range letters {
+        responses = append(responses, newDeadLetterResponse(letter))
+    }
+    return responses, nil
+}
+
+// Retry calls apply with the message of each dead letter, the given IDs or
+// all of them when there are none, oldest first. A letter is removed when
+// apply succeeds; otherwise its reason and attempt count are updated.
+func (s *DeadLetterService) Retry(apply func(message []byte) error, ids ...uint) ([]RetryResult, error) {
+    var letters []model.DeadLetter
+    if len(ids) == 0 {
+        var afterID uint
+        for {
+            batch, err := s.repo.FindAfter(afterID, DefaultPageSize)
+            if err != nil {
+                return nil, err
+            }
+            letters = append(letters, batch...)
+            if len(batch) < DefaultPageSize {
+                break
+            }
+            afterID = batch[len(batch)-1].ID
+        }
+    }
+    for _, id := range ids {
+        letter, err := s.repo.FindByID(id)
+        if err != nil {
+            return nil, notFound(err, "Dead letter")
+        }
+        letters = append(letters, letter)
+    }
+
+    results := make([]RetryResult, 0, len(letters))
+    for _, letter := range letters {
+        failure := apply([]byte(letter.Message))
+        if failure == nil {
+            if err := s.repo.Delete(letter.ID); err != nil {
+                return results, err
+            }
+        } else {
+            letter.Reason = failure.Error()
+            letter.Attempts++
+            letter.UpdatedAt = time.Now()
+            if err := s.repo.Update(&letter); err != nil {
+                return results, err
+            }
+        }
+        results = append(results, RetryResult{DeadLetterResponse: newDeadLetterResponse(letter), Err: failure})
+    }
+    return results, nil
+}
+
+func newDeadLetterResponse(letter model.DeadLetter) DeadLetterResponse {
+    return DeadLetterResponse{
+        ID:        letter.ID,
+        Source:    letter.Source,
+        Reason:    letter.Reason,
+        Attempts:  letter.Attempts,
+        CreatedAt: letter.CreatedAt.Format(time.RFC3339),
+        UpdatedAt: letter.UpdatedAt.Format(time.RFC3339),
+    }
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+    "math"
+    "sort"
+    "strings"
+    "time"
+    "unicode"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// Duplicate detection scores each existing patient that shares a birth year,
+// name prefix or contact with a new one. Name similarity, date of birth and
+// contact weigh in as below; candidates scoring DuplicateThreshold or more
+// are reported.
+const (
+    DuplicateThreshold = 0.7
+
+    duplicateNameWeight    = 0.5
+    duplicateDOBWeight     = 0.3
+    duplicateContactWeight = 0.2
+    // similarNameScore is the name similarity from which a name counts as
+    // matching rather than similar.
+    similarNameScore = 0.92
+    // maxDuplicates caps the candidates reported, best first;
+    // duplicateCandidateLimit caps the patients each lookup scores.
+    maxDuplicates           = 5
+    duplicateCandidateLimit = 100
+)
+
+// Reasons a DuplicateCandidate was reported.
+const (
+    MatchName             = "name"
+    MatchSimilarName      = "similar_name"
+    MatchDateOfBirth      = "date_of_birth"
+    MatchSimilarBirthDate = "similar_date_of_birth"
+    MatchContact          = "contact"
+)
+
+var ErrPossibleDuplicate = &Error{Kind: KindConflict, Code: "possible_duplicate",
+    Message: "Patient may already exist; review the duplicates, then merge into one or send force to create anyway"}
+
+// DuplicateCandidate is an existing patient a new one may duplicate. Score
+// runs from 0 to 1 and Matched lists what agrees.
+type DuplicateCandidate struct {
+    PatientID   uint     `json:"patient_id"`
+    FirstName   string   `json:"first_name"`
+    LastName    string   `json:"last_name"`
+    DateOfBirth string   `json:"date_of_birth"`
+    Score       float64  `json:"score"`
+    Matched     []string `json:"matched"`
+}
+
+// DuplicatesError is returned by Create when the new patient looks like
+// existing ones. It wraps ErrPossibleDuplicate.
+type DuplicatesError struct {
+    Candidates []DuplicateCandidate
+}
+
+func (e *DuplicatesError) Error() string {
+    return ErrPossibleDuplicate.Message
+}
+
+func (e *DuplicatesError) Unwrap() error {
+    return ErrPossibleDuplicate
+}
+
+// findDuplicates returns the live patients that score DuplicateThreshold or
+// more against patient, best first.
+func findDuplicates(repo repository.PatientStore, patient model.Patient) ([]DuplicateCandidate, error) {
+    dob := patient.DateOfBirth
+    yearStart := time.Date(dob.Year(), 1, 1, 0, 0, 0, 0, dob.Location())
+    yearEnd := yearStart.AddDate(1, 0, 0).Add(-time.Nanosecond)
+    queries := []repository.PatientQuery{{Limit: duplicateCandidateLimit, DOBFrom: &dob, DOBTo: &dob}}
+    for _, name := range []string{patient.LastName, patient.FirstName} {
+        if prefix := namePrefix(name); prefix != "" {
+            queries = append(queries, repository.PatientQuery{Limit: duplicateCandidateLimit, DOBFrom: &yearStart, DOBTo: &yearEnd, NamePrefix: prefix})
+        }
+    }
+
+    seen := make(map[uint]bool)
+    var candidates []model.Patient
+    for _, query := range queries {
+        patients, _, err := repo.FindPage(query)
+        if err != nil {
+            return nil, err
+        }
+        for _, existing := range patients {
+            if !seen[existing.ID] {
+                seen[existing.ID] = true
+                candidates = append(candidates, existing)
+            }
+        }
+    }
+    if len(contactDigits(patient.Contact)) >= minContactDigits {
+        matches, err := repo.Search(patient.Contact, duplicateCandidateLimit)
+        if err != nil {
+            return nil, err
+        }
+        for _, match := range matches {
+            if !seen[match.ID] {
+                seen[match.ID] = true
+                candidates = append(candidates, match.Patient)
+            }
+        }
+    }
+
+    var duplicates []DuplicateCandidate
+    for _, existing := range candidates {
+        score, matched := duplicateScore(patient, existing)
+        if score < DuplicateThreshold {
+            continue
+        }
+        duplicates = append(duplicates, DuplicateCandidate{
+            PatientID:   existing.ID,
+            FirstName:   existing.FirstName,
+            LastName:    existing.LastName,
+            DateOfBirth: existing.DateOfBirth.Format(time.RFC3339),
+            Score:       score,
+            Matched:     matched,
+        })
+    }
+    sort.SliceStable(duplicates, func(i, j int) bool {
+        if duplicates[i].Score != duplicates[j].Score {
+            return duplicates[i].Score > duplicates[j].Score
+        }
+        return duplicates[i].PatientID < duplicates[j].PatientID
+    })
+    if len(duplicates) > maxDuplicates {
+        duplicates = duplicates[:maxDuplicates]
+    }
+    return duplicates, nil
+}
+
+// duplicateScore weighs how alike a and b are, rounded to two places, and
+// names what matched.
+func duplicateScore(a, b model.Patient) (float64, []string) {
+    matched := []string{}
+
+    name := nameSimilarity(a, b)
+    switch {
+    case name >= similarNameScore:
+        matched = append(matched, MatchName)
+    case name >= DuplicateThreshold:
+        matched = append(matched, MatchSimilarName)
+    }
+
+    dob := 0.0
+    ay, am, ad := a.DateOfBirth.Date()
+    by, bm, bd := b.DateOfBirth.Date()
+    switch {
+    case ay == by && am == bm && ad == bd:
+        dob = 1
+        matched = append(matched, MatchDateOfBirth)
+    case ay == by && (am == bm || ad == bd || (int(am) == bd && ad == int(bm))):
+        // One part mistyped, or day and month swapped.
+        dob = 0.7
+        matched = append(matched, MatchSimilarBirthDate)
+    }
+
+    contact := 0.0
+    if sameContact(a.Contact, b.Contact) {
+        contact = 1
+        matched = append(matched, MatchContact)
+    }
+
+    score := duplicateNameWeight*name + duplicateDOBWeight*dob + duplicateContactWeight*contact
+    return math.Round(score*100) / 100, matched
+}
+
+// nameSimilarity averages the Jaro-Winkler similarity of the first and last
+// names, also trying them the other way round.
+func nameSimilarity(a, b model.Patient) float64 {
+    aFirst, aLast := normalizeName(a.FirstName), normalizeName(a.LastName)
+    bFirst, bLast := normalizeName(b.FirstName), normalizeName(b.LastName)
+    straight := (jaroWinkler(aFirst, bFirst) + jaroWinkler(aLast, bLast)) / 2
+    swapped := (jaroWinkler(aFirst, bLast) + jaroWinkler(aLast, bFirst)) / 2
+    return math.Max(straight, swapped)
+}
+
+// normalizeName lower-cases name and drops everything but letters, so that
+// "O'Neil" and "oneil" compare equal.
+func normalizeName(name string) []rune {
+    var letters []rune
+    for _, r := range strings.ToLower(name) {
+        if unicode.IsLetter(r) {
+            letters = append(letters, r)
+        }
+    }
+    return letters
+}
+
+func namePrefix(name string) string {
+    letters := normalizeName(name)
+    if len(letters) > 2 {
+        letters = letters[:2]
+    }
+    return string(letters)
+}
+
+// jaroWinkler is the Jaro similarity of a and b, boosted for a common prefix
+// of up to four runes.
+func jaroWinkler(a, b []rune) float64 {
+    if len(a) == 0 || len(b) == 0 {
+        return 0
+    }
+    window := max(len(a), len(b))/2 - 1
+    if window < 0 {
+        window = 0
+    }
+
+    aMatched := make([]bool, len(a))
+    bMatched := make([]bool, len(b))
+    matches := 0
+    for i := range a {
+        for j := max(0, i-window); j < min(len(b), i+window+1); j++ {
+            if !bMatched[j] && a[i] == b[j] {
+                aMatched[i], bMatched[j] = true, true
+                matches++
+                break
+            }
+        }
+    }
+    if matches == 0 {
+        return 0
+    }
+
+    transpositions, j := 0, 0
+    for i := range a {
+        if !aMatched[i] {
+            continue
+        }
+        for !bMatched[j] {
+            j++
+        }
+        if a[i] != b[j] {
+            transpositions++
+        }
+        j++
+    }
+
+    m := float64(matches)
+    jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+    prefix := 0
+    for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+        prefix++
+    }
+    return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// minContactDigits is the fewest digits a contact needs to be compared.
+const minContactDigits = 7
+
+// sameContact reports whether two phone numbers are the same once their
+// formatting is dropped, allowing for a country or trunk prefix on one.
+func sameContact(a, b string) bool {
+    a, b = contactDigits(a), contactDigits(b)
+    if len(a) < minContactDigits || len(b) < minContactDigits {
+        return false
+    }
+    if len(a) < len(b) {
+        a, b = b, a
+    }
+    return strings.HasSuffix(a, b)
+}
+
+func contactDigits(contact string) string {
+    var digits strings.Builder
+    for _, r := range contact {
+        if r >= '0' && r <= '9' {
+            digits.WriteRune(r)
+        }
+    }
+    return digits.String()
+}
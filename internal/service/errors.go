@@ -0,0 +1,81 @@
+package service
+
+import (
+    "errors"
+    "gorm.io/gorm"
+)
+
+// ErrorKind classifies a service error; the handlers turn each kind into one
+// HTTP status.
+type ErrorKind string
+
+const (
+    KindValidation           ErrorKind = "validation"
+    KindUnauthorized         ErrorKind = "unauthorized"
+    KindForbidden            ErrorKind = "forbidden"
+    KindNotFound             ErrorKind = "not_found"
+    KindConflict             ErrorKind = "conflict"
+    KindPreconditionFailed   ErrorKind = "precondition_failed"
+    KindPreconditionRequired ErrorKind = "precondition_required"
+    KindUnprocessable        ErrorKind = "unprocessable"
+    KindTooManyRequests      ErrorKind = "too_many_requests"
+    KindInternal             ErrorKind = "internal"
+)
+
+// FieldError names an input field and what is wrong with it.
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// Error is the error type every service returns for expected failures.
+// Code is a stable machine-readable identifier and Message is safe to show
+// to the caller. Anything that is not an *Error is treated as internal.
+type Error struct {
+    Kind    ErrorKind
+    Code    string
+    Message string
+    Fields  []FieldError
+    Err     error
+}
+
+func (e *Error) Error() string {
+    return e.Message
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+// AsError finds the *Error in err's chain. Errors from elsewhere become an
+// internal error that hides their text.
+func AsError(err error) *Error {
+    var serviceErr *Error
+    if errors.As(err, &serviceErr) {
+        return serviceErr
+    }
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return &Error{Kind: KindNotFound, Code: "not_found", Message: "Not found", Err: err}
+    }
+    return &Error{Kind: KindInternal, Code: "internal", Message: "Internal server error", Err: err}
+}
+
+// with returns an error for one occurrence of e: detail is appended to the
+// message and, when field is set, blamed on that field. errors.Is still
+// matches e.
+func (e *Error) with(field, detail string) *Error {
+    err := &Error{Kind: e.Kind, Code: e.Code, Message: e.Message + ": " + detail, Err: e}
+    if field != "" {
+        err.Fields = []FieldError{{Field: field, Message: detail}}
+    }
+    return err
+}
+
+// notFound names the missing resource when a store reports no record;
+// other errors pass through unchanged.
+func notFound(err error, resource string) error {
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return &Error{Kind: KindNotFound, Code: "not_found", Message: resource + " not found", Err: err}
+    }
+    return err
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "reflect"
+    "strings"
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/pdf"
+    "makerble-assessment/internal/repository"
+)
+
+// Formats accepted by Export.
+const (
+    ExportCSV    = "csv"
+    ExportNDJSON = "ndjson"
+)
+
+const exportBatchSize = 500
+
+var errInvalidExport = &Error{Kind: KindValidation, Code: "invalid_input", Message: "Invalid input"}
+
+// errUnsupportedSummaryText is returned for records the summary PDF's
+// Latin fonts cannot show faithfully.
+var errUnsupportedSummaryText = &Error{Kind: KindUnprocessable, Code: "unsupported_text", Message: "The summary PDF cannot show some characters of this record"}
+
+// ExportPatientsInput is bound from the export endpoint's query string. The
+// filters are those of ListPatientsInput.
+type ExportPatientsInput struct {
+    Format  string    `form:"format" binding:"omitempty,oneof=csv ndjson"`
+    Gender  string    `form:"gender" binding:"omitempty,oneof=Male Female Other"`
+    DOBFrom time.Time `form:"dob_from" time_format:"2006-01-02"`
+    DOBTo   time.Time `form:"dob_to" time_format:"2006-01-02"`
+    Name    string    `form:"name"`
+}
+
+// PatientExportRecord is one exported patient. CSV columns are its JSON
+// names, in field order.
+type PatientExportRecord struct {
+    ID          uint   `json:"id"`
+    FirstName   string `json:"first_name"`
+    LastName    string `json:"last_name"`
+    DateOfBirth string `json:"date_of_birth"`
+    Gender      string `json:"gender"`
+    Contact     string `json:"contact"`
+    Address     string `json:"address"`
+    CreatedAt   string `json:"created_at"`
+    UpdatedAt   string `json:"updated_at"`
+}
+
+func newPatientExportRecord(patient model.Patient) PatientExportRecord {
+    return PatientExportRecord{
+        ID:          patient.ID,
+        FirstName:   patient.FirstName,
+        LastName:    patient.LastName,
+        DateOfBirth: patient.DateOfBirth.Format(time.RFC3339),
+        Gender:      patient.Gender,
+        Contact:     patient.Contact,
+        Address:     patient.Address,
+        CreatedAt:   patient.CreatedAt.Format(time.RFC3339),
+        UpdatedAt:   patient.UpdatedAt.Format(time.RFC3339),
+    }
+}
+
+// Export writes every patient matching input to w in ID order. Patients are
+// read and written in batches, so memory use does not grow with the number
+// of patients. beforeBatch is called with the IDs of each batch before it is
+// written; an error from it stops the export. Nothing is written until the
+// first batch has been read, so an early failure leaves w untouched.
+func (s *PatientService) Export(w io.Writer, input ExportPatientsInput, beforeBatch func(patientIDs []uint) error) error {
+    query := repository.PatientQuery{Gender: input.Gender, NamePrefix: input.Name}
+    if !input.DOBFrom.IsZero() {
+        query.DOBFrom = &input.DOBFrom
+    }
+    if !input.DOBTo.IsZero() {
+        query.DOBTo = &input.DOBTo
+    }
+
+    var write func(PatientExportRecord) error
+    var flush func() error
+    switch input.Format {
+    case ExportCSV:
+        writer := csv.NewWriter(w)
+        header := exportColumns()
+        started := false
+        write = func(record PatientExportRecord) error {
+            if !started {
+                started = true
+                if err := writer.Write(header); err != nil {
+                    return err
+                }
+            }
+            return writer.Write(exportRow(record))
+        }
+        flush = func() error {
+            if !started {
+                started = true
+                writer.Write(header)
+            }
+            writer.Flush()
+            return writer.Error()
+        }
+    case ExportNDJSON:
+        encoder := json.NewEncoder(w)
+        write = func(record PatientExportRecord) error { return encoder.Encode(record) }
+        flush = func() error { return nil }
+    default:
+        return errInvalidExport.with("format", "must be one of: csv, ndjson")
+    }
+
+    var afterID uint
+    for {
+        patients, err := s.repo.FindBatch(query, afterID, exportBatchSize)
+        if err != nil {
+            return err
+        }
+        if len(patients) == 0 {
+            return flush()
+        }
+
+        ids := make([]uint, 0, len(patients))
+        for _, patient := range patients {
+            ids = append(ids, patient.ID)
+        }
+        if err := beforeBatch(ids); err != nil {
+            return err
+        }
+        for _, patient := range patients {
+            if err := write(newPatientExportRecord(patient)); err != nil {
+                return err
+            }
+        }
+        if err := flush(); err != nil {
+            return err
+        }
+        afterID = ids[len(ids)-1]
+    }
+}
+
+func exportColumns() []string {
+    recordType := reflect.TypeOf(PatientExportRecord{})
+    columns := make([]string, recordType.NumField())
+    for i := range columns {
+        columns[i] = strings.Split(recordType.Field(i).Tag.Get("json"), ",")[0]
+    }
+    return columns
+}
+
+// exportRow formats record as CSV fields. Text that a spreadsheet would run
+// as a formula is prefixed with an apostrophe.
+func exportRow(record PatientExportRecord) []string {
+    value := reflect.ValueOf(record)
+    row := make([]string, value.NumField())
+    for i := range row {
+        field := fmt.Sprint(value.Field(i).Interface())
+        if isFormula(field) {
+            field = "'" + field
+        }
+        row[i] = field
+    }
+    return row
+}
+
+// isFormula reports whether a spreadsheet could read field as a formula.
+// A leading + or - only starts one when letters or other symbols follow, so
+// phone numbers such as +44 20 7946 0000 are left as they are: made of
+// digits, spaces and ()-./ alone they cannot call a function.
+func isFormula(field string) bool {
+    if field == "" {
+        return false
+    }
+    switch field[0] {
+    case '=', '@', '\t', '\r':
+        return true
+    case '+', '-':
+        return strings.TrimLeft(field[1:], "0123456789 ()-./") != ""
+    }
+    return false
+}
+
+// SummaryPDF renders a patient's demographics and medical history as a PDF
+// the patient can be given.
+func (s *PatientService) SummaryPDF(id uint, now time.Time) ([]byte, error) {
+    patient, err := s.Get(id)
+    if err != nil {
+        return nil, err
+    }
+
+    name := patient.FirstName + " " + patient.LastName
+    doc := pdf.New("Patient summary: " + name)
+    doc.SetFooter("Confidential patient record: " + name)
+    doc.Heading("Patient Summary")
+    doc.Text("Generated " + now.UTC().Format("2 January 2006 15:04 UTC"))
+
+    doc.Subheading("Demographics")
+    dob, _ := time.Parse(time.RFC3339, patient.DateOfBirth)
+    for _, field := range []struct{ label, value string }{
+        {"Name", name},
+        {"Date of birth", dob.Format("2 January 2006")},
+        {"Gender", patient.Gender},
+        {"Contact", patient.Contact},
+        {"Address", patient.Address},
+        {"Patient ID", fmt.Sprint(patient.ID)},
+    } {
+        if field.value == "" {
+            field.value = "Not recorded"
+        }
+        doc.Field(field.label, field.value)
+    }
+
+    doc.Subheading("Medical History")
+    if len(patient.MedicalHistory) == 0 {
+        doc.Text("No entries.")
+    }
+    for _, entry := range patient.MedicalHistory {
+        created, _ := time.Parse(time.RFC3339, entry.CreatedAt)
+        doc.Space(4)
+        doc.BoldText(created.Format("2 January 2006") + " - " + strings.ToUpper(entry.Kind[:1]) + entry.Kind[1:])
+        doc.Text(entry.Description)
+    }
+
+    var out bytes.Buffer
+    if _, err := doc.WriteTo(&out); err != nil {
+        if errors.Is(err, pdf.ErrUnsupportedText) {
+            return nil, errUnsupportedSummaryText.with("", "only Latin characters are supported")
+        }
+        return nil, err
+    }
+    return out.Bytes(), nil
+}
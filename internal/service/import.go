@@ -0,0 +1,322 @@
+package service
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "reflect"
+    "strings"
+    "github.com/go-playground/validator/v10"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+// Formats accepted by Import.
+const (
+    ImportCSV    = "csv"
+    ImportNDJSON = "ndjson"
+)
+
+const DefaultImportBatchSize = 500
+
+// ImportOptions is bound from the import endpoint's query string. Force
+// imports rows that look like existing patients, as CreatePatientInput's
+// Force does for one patient.
+type ImportOptions struct {
+    Format    string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+    DryRun    bool   `form:"dry_run"`
+    BatchSize int    `form:"batch_size" binding:"omitempty,min=1,max=1000"`
+    Force     bool   `form:"force"`
+}
+
+// ImportRowError lists what is wrong with one row. Line is the line of the
+// input the row starts on; a CSV header is line 1.
+type ImportRowError struct {
+    Line   int          `json:"line"`
+    Errors []FieldError `json:"errors"`
+}
+
+// ImportReport summarises an import. Valid rows are imported unless DryRun
+// is set; invalid rows are skipped and listed in Errors.
+type ImportReport struct {
+    DryRun     bool             `json:"dry_run"`
+    Total      int              `json:"total"`
+    Valid      int              `json:"valid"`
+    Imported   int              `json:"imported"`
+    PatientIDs []uint           `json:"patient_ids"`
+    Errors     []ImportRowError `json:"errors"`
+}
+
+// importRecord holds the fields of CreatePatientInput a file may set: its
+// columns in CSV and its keys in NDJSON. Whether to import duplicates is
+// up to ImportOptions.Force, not the rows.
+type importRecord struct {
+    FirstName   string `json:"first_name"`
+    LastName    string `json:"last_name"`
+    DateOfBirth string `json:"date_of_birth"`
+    Gender      string `json:"gender"`
+    Contact     string `json:"contact"`
+    Address     string `json:"address"`
+}
+
+func (r importRecord) input() CreatePatientInput {
+    return CreatePatientInput{
+        FirstName:   r.FirstName,
+        LastName:    r.LastName,
+        DateOfBirth: r.DateOfBirth,
+        Gender:      r.Gender,
+        Contact:     r.Contact,
+        Address:     r.Address,
+    }
+}
+
+// importRow is a parsed row before validation. err is set when the row
+// could not even be decoded.
+type importRow struct {
+    line   int
+    record importRecord
+    err    *FieldError
+}
+
+var errInvalidImport = &Error{Kind: KindValidation, Code: "invalid_import", Message: "invalid import file"}
+
+// Import reads patients as CSV with a header row or as NDJSON, one
+// CreatePatientInput object without force per line, and validates every row
+// with the rules Create applies; unless options.Force is set, rows that look
+// like existing patients are rejected as Create would refuse them. Nothing
+// is written while the file itself is malformed. Otherwise the valid rows are inserted in transactions of
+// options.BatchSize rows, each audited as an import by userID; if one fails,
+// the report still lists the patients imported by earlier batches.
+func (s *PatientService) Import(userID uint, r io.Reader, options ImportOptions) (ImportReport, error) {
+    var rows []importRow
+    var err error
+    switch options.Format {
+    case ImportCSV:
+        rows, err = readCSVRows(r)
+    case ImportNDJSON:
+        rows, err = readNDJSONRows(r)
+    default:
+        return ImportReport{}, errInvalidImport.with("format", "must be one of: csv, ndjson")
+    }
+    if err != nil {
+        return ImportReport{}, err
+    }
+
+    report := ImportReport{DryRun: options.DryRun, Total: len(rows), PatientIDs: []uint{}, Errors: []ImportRowError{}}
+    valid := make([]model.Patient, 0, len(rows))
+    for _, row := range rows {
+        patient, fields := validateImportRow(row)
+        if len(fields) == 0 && !options.Force {
+            if fields, err = s.importDuplicates(patient); err != nil {
+                return ImportReport{}, err
+            }
+        }
+        if len(fields) > 0 {
+            report.Errors = append(report.Errors, ImportRowError{Line: row.line, Errors: fields})
+            continue
+        }
+        valid = append(valid, patient)
+    }
+    report.Valid = len(valid)
+    if options.DryRun {
+        return report, nil
+    }
+
+    batchSize := options.BatchSize
+    if batchSize < 1 {
+        batchSize = DefaultImportBatchSize
+    }
+    for start := 0; start < len(valid); start += batchSize {
+        batch := valid[start:min(start+batchSize, len(valid))]
+        err := s.stores.Transaction(func(stores repository.Stores) error {
+            if err := stores.Patients.CreateBatch(batch); err != nil {
+                return err
+            }
+            ids := make([]uint, 0, len(batch))
+            for _, patient := range batch {
+                ids = append(ids, patient.ID)
+            }
+            return stores.Audit.Create(auditEntries(userID, model.AuditPatientImport, ids))
+        })
+        if err != nil {
+            return report, err
+        }
+        for _, patient := range batch {
+            report.PatientIDs = append(report.PatientIDs, patient.ID)
+        }
+        report.Imported += len(batch)
+    }
+    return report, nil
+}
+
+// importDuplicates describes the existing patients patient may duplicate.
+func (s *PatientService) importDuplicates(patient model.Patient) ([]FieldError, error) {
+    duplicates, err := findDuplicates(s.repo, patient)
+    if err != nil {
+        return nil, err
+    }
+    fields := make([]FieldError, 0, len(duplicates))
+    for _, duplicate := range duplicates {
+        fields = append(fields, FieldError{Message: fmt.Sprintf("may duplicate patient %d (score %.2f)", duplicate.PatientID, duplicate.Score)})
+    }
+    return fields, nil
+}
+
+func validateImportRow(row importRow) (model.Patient, []FieldError) {
+    if row.err != nil {
+        return model.Patient{}, []FieldError{*row.err}
+    }
+
+    input := row.record.input()
+    fields := validateImportInput(input)
+    if input.DateOfBirth == "" {
+        return model.Patient{}, fields
+    }
+    patient, err := newPatient(input)
+    if err != nil {
+        fields = append(fields, AsError(err).Fields...)
+    }
+    return patient, fields
+}
+
+// importValidator applies the binding tags of CreatePatientInput, the rules
+// its request bodies are bound with, to imported rows, reporting fields by
+// their JSON names.
+var importValidator = newImportValidator()
+
+func newImportValidator() *validator.Validate {
+    v := validator.New()
+    v.SetTagName("binding")
+    v.RegisterTagNameFunc(func(field reflect.StructField) string {
+        return strings.Split(field.Tag.Get("json"), ",")[0]
+    })
+    return v
+}
+
+func validateImportInput(input CreatePatientInput) []FieldError {
+    var fieldErrors validator.ValidationErrors
+    if err := importValidator.Struct(input); !errors.As(err, &fieldErrors) {
+        return nil
+    }
+
+    var fields []FieldError
+    for _, fieldErr := range fieldErrors {
+        message := "failed the " + fieldErr.Tag() + " rule"
+        switch fieldErr.Tag() {
+        case "required":
+            message = "is required"
+        case "oneof":
+            message = "must be one of: " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+        }
+        fields = append(fields, FieldError{Field: fieldErr.Field(), Message: message})
+    }
+    return fields
+}
+
+// importColumns maps CSV header names to importRecord fields by their JSON
+// names; required lists the columns the header must have, those required
+// by CreatePatientInput.
+func importColumns() (columns map[string]int, required []string) {
+    columns = make(map[string]int)
+    recordType := reflect.TypeOf(importRecord{})
+    inputType := reflect.TypeOf(CreatePatientInput{})
+    for i := 0; i < recordType.NumField(); i++ {
+        field := recordType.Field(i)
+        name := strings.Split(field.Tag.Get("json"), ",")[0]
+        columns[name] = i
+        if inputField, _ := inputType.FieldByName(field.Name); strings.Contains(inputField.Tag.Get("binding"), "required") {
+            required = append(required, name)
+        }
+    }
+    return columns, required
+}
+
+func readCSVRows(r io.Reader) ([]importRow, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    header, err := reader.Read()
+    if errors.Is(err, io.EOF) {
+        return nil, errInvalidImport.with("", "missing header row")
+    }
+    if err != nil {
+        return nil, errInvalidImport.with("", err.Error())
+    }
+
+    // Spreadsheets often save CSV with a byte order mark.
+    header[0] = strings.TrimPrefix(header[0], "\ufeff")
+    columns, required := importColumns()
+    fieldIndex := make([]int, len(header))
+    seen := make(map[string]bool)
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(name))
+        index, ok := columns[name]
+        if !ok {
+            return nil, errInvalidImport.with(name, "unknown column")
+        }
+        if seen[name] {
+            return nil, errInvalidImport.with(name, "duplicate column")
+        }
+        seen[name] = true
+        fieldIndex[i] = index
+    }
+    for _, name := range required {
+        if !seen[name] {
+            return nil, errInvalidImport.with(name, "missing column")
+        }
+    }
+
+    var rows []importRow
+    for {
+        record, err := reader.Read()
+        if errors.Is(err, io.EOF) {
+            return rows, nil
+        }
+        if err != nil {
+            return nil, errInvalidImport.with("", err.Error())
+        }
+
+        line, _ := reader.FieldPos(0)
+        row := importRow{line: line}
+        if len(record) != len(header) {
+            row.err = &FieldError{Message: fmt.Sprintf("has %d fields, want %d", len(record), len(header))}
+            rows = append(rows, row)
+            continue
+        }
+        fields := reflect.ValueOf(&row.record).Elem()
+        for i, value := range record {
+            fields.Field(fieldIndex[i]).SetString(strings.TrimSpace(value))
+        }
+        rows = append(rows, row)
+    }
+}
+
+func readNDJSONRows(r io.Reader) ([]importRow, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+    var rows []importRow
+    for line := 1; scanner.Scan(); line++ {
+        text := bytes.TrimSpace(scanner.Bytes())
+        if len(text) == 0 {
+            continue
+        }
+
+        row := importRow{line: line}
+        decoder := json.NewDecoder(bytes.NewReader(text))
+        decoder.DisallowUnknownFields()
+        if err := decoder.Decode(&row.record); err != nil {
+            row.err = &FieldError{Message: "invalid JSON: " + err.Error()}
+        }
+        rows = append(rows, row)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, errInvalidImport.with("", err.Error())
+    }
+    return rows, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+    "strings"
+    "time"
+    "makerble-assessment/internal/repository"
+)
+
+var ErrTooManyAttempts = &Error{Kind: KindTooManyRequests, Code: "too_many_attempts", Message: "too many login attempts; try again later"}
+
+// lockoutMemory is how long a run of lockouts is remembered: each lockout
+// within it lasts twice as long as the one before.
+const lockoutMemory = 24 * time.Hour
+
+// LoginLimitConfig sets how logins are throttled. A zero limit is off.
+type LoginLimitConfig struct {
+    // IPRequests attempts are allowed from one IP per RequestWindow, failed
+    // or not, which bounds the password hashing an IP can cause.
+    IPRequests    int
+    RequestWindow time.Duration
+    // AccountFailures failed attempts on one account, or IPFailures from
+    // one IP, within FailureWindow lock it out for Lockout, doubling with
+    // each further lockout up to MaxLockout.
+    AccountFailures int
+    IPFailures      int
+    FailureWindow   time.Duration
+    Lockout         time.Duration
+    MaxLockout      time.Duration
+}
+
+func DefaultLoginLimitConfig() LoginLimitConfig {
+    return LoginLimitConfig{
+        IPRequests:      30,
+        RequestWindow:   time.Minute,
+        AccountFailures: 5,
+        IPFailures:      50,
+        FailureWindow:   15 * time.Minute,
+        Lockout:         time.Minute,
+        MaxLockout:      time.Hour,
+    }
+}
+
+// RateLimitError refuses an attempt made too soon. It wraps
+// ErrTooManyAttempts; RetryAfter is when the caller may try again.
+type RateLimitError struct {
+    RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+    return ErrTooManyAttempts.Message
+}
+
+func (e *RateLimitError) Unwrap() error {
+    return ErrTooManyAttempts
+}
+
+// LoginLimiter throttles password guessing per client IP and per account,
+// keeping its counters in a LimiterStore. Callers check each attempt with
+// Allow before verifying it and report the outcome with Fail or Succeed.
+type LoginLimiter struct {
+    store  repository.LimiterStore
+    config LoginLimitConfig
+}
+
+func NewLoginLimiter(store repository.LimiterStore, config LoginLimitConfig) *LoginLimiter {
+    return &LoginLimiter{store: store, config: config}
+}
+
+// Allow counts an attempt from ip on account and refuses it with a
+// *RateLimitError while either is locked out or ip is over its request
+// rate.
+func (l *LoginLimiter) Allow(ip, account string) error {
+    var wait time.Duration
+    for _, subject := range []string{ipSubject(ip), accountSubject(account)} {
+        locked, ttl, err := l.store.Get("login:lock:" + subject)
+        if err != nil {
+            return err
+        }
+        if locked > 0 && ttl > wait {
+            wait = ttl
+        }
+    }
+    if wait > 0 {
+        return &RateLimitError{RetryAfter: wait}
+    }
+
+    if l.config.IPRequests > 0 && l.config.RequestWindow > 0 {
+        count, ttl, err := l.store.Incr("login:rate:"+ipSubject(ip), l.config.RequestWindow)
+        if err != nil {
+            return err
+        }
+        if count > int64(l.config.IPRequests) {
+            return &RateLimitError{RetryAfter: ttl}
+        }
+    }
+    return nil
+}
+
+// Fail records a failed attempt from ip on account, locking out whichever
+// reaches its limit.
+func (l *LoginLimiter) Fail(ip, account string) error {
+    limits := []struct {
+        subject string
+        limit   int
+    }{
+        {ipSubject(ip), l.config.IPFailures},
+        {accountSubject(account), l.config.AccountFailures},
+    }
+    for _, limit := range limits {
+        if limit.limit <= 0 || l.config.FailureWindow <= 0 || l.config.Lockout <= 0 {
+            continue
+        }
+        failures, _, err := l.store.Incr("login:failures:"+limit.subject, l.config.FailureWindow)
+        if err != nil {
+            return err
+        }
+        if failures < int64(limit.limit) {
+            continue
+        }
+
+        streak, _, err := l.store.Incr("login:lockouts:"+limit.subject, max(lockoutMemory, l.config.MaxLockout))
+        if err != nil {
+            return err
+        }
+        if err := l.store.Set("login:lock:"+limit.subject, 1, l.lockout(streak)); err != nil {
+            return err
+        }
+        if err := l.store.Delete("login:failures:" + limit.subject); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Succeed clears the failures and lockout run of account. Those of the IP
+// are kept, so signing in to one account buys no extra guesses at others.
+func (l *LoginLimiter) Succeed(account string) error {
+    subject := accountSubject(account)
+    return l.store.Delete("login:failures:"+subject, "login:lockouts:"+subject)
+}
+
+// lockout is the length of the streak-th lockout in a run.
+func (l *LoginLimiter) lockout(streak int64) time.Duration {
+    lockout := l.config.Lockout
+    for i := int64(1); i < streak && (l.config.MaxLockout <= 0 || lockout < l.config.MaxLockout); i++ {
+        lockout *= 2
+    }
+    if l.config.MaxLockout > 0 && lockout > l.config.MaxLockout {
+        lockout = l.config.MaxLockout
+    }
+    return lockout
+}
+
+func ipSubject(ip string) string {
+    return "ip:" + ip
+}
+
+// accountSubject keys an account by its email as typed, less case and
+// surrounding space, so unknown emails are throttled like real ones.
+func accountSubject(email string) string {
+    return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
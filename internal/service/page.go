@@ -0,0 +1,36 @@
+package service
+
+const (
+    DefaultPageSize = 20
+    MaxPageSize     = 100
+)
+
+type PageMeta struct {
+    Page       int   `json:"page"`
+    Limit      int   `json:"limit"`
+    Total      int64 `json:"total"`
+    TotalPages int   `json:"total_pages"`
+}
+
+// pageBounds applies the defaults and the size cap to a requested page.
+func pageBounds(page, limit int) (int, int) {
+    if page < 1 {
+        page = 1
+    }
+    if limit < 1 {
+        limit = DefaultPageSize
+    }
+    if limit > MaxPageSize {
+        limit = MaxPageSize
+    }
+    return page, limit
+}
+
+func newPageMeta(page, limit int, total int64) PageMeta {
+    return PageMeta{
+        Page:       page,
+        Limit:      limit,
+        Total:      total,
+        TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+    }
+}
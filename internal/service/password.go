@@ -0,0 +1,54 @@
+package service
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "golang.org/x/crypto/bcrypt"
+)
+
+const (
+    MinPasswordLength = 12
+    // MaxPasswordLength is bcrypt's input limit in bytes.
+    MaxPasswordLength = 72
+)
+
+var ErrWeakPassword = &Error{Kind: KindValidation, Code: "weak_password", Message: "password does not meet the policy"}
+
+// ValidatePassword enforces the password policy: 12 to 72 bytes, at least
+// one upper case letter, one lower case letter and one digit, and not
+// containing the local part of the account's email address.
+func ValidatePassword(password, email string) error {
+    if len(password) < MinPasswordLength {
+        return ErrWeakPassword.with("password", fmt.Sprintf("must be at least %d characters", MinPasswordLength))
+    }
+    if len(password) > MaxPasswordLength {
+        return ErrWeakPassword.with("password", fmt.Sprintf("must be at most %d bytes", MaxPasswordLength))
+    }
+
+    var upper, lower, digit bool
+    for _, r := range password {
+        switch {
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsDigit(r):
+            digit = true
+        }
+    }
+    if !upper || !lower || !digit {
+        return ErrWeakPassword.with("password", "must contain upper and lower case letters and a digit")
+    }
+
+    local, _, _ := strings.Cut(strings.ToLower(email), "@")
+    if len(local) >= 3 && strings.Contains(strings.ToLower(password), local) {
+        return ErrWeakPassword.with("password", "must not contain the email address")
+    }
+    return nil
+}
+
+func hashPassword(password string) (string, error) {
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    return string(hash), err
+}
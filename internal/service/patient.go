@@ -3,100 +3,252 @@ package service
 import (
     "errors"
     "time"
+    "gorm.io/gorm"
     "makerble-assessment/internal/model"
     "makerble-assessment/internal/repository"
 )
 
+var (
+    ErrVersionConflict = &Error{Kind: KindPreconditionFailed, Code: "version_conflict", Message: repository.ErrVersionConflict.Error(),
+        Err: repository.ErrVersionConflict}
+    ErrInvalidDateOfBirth = &Error{Kind: KindValidation, Code: "invalid_date_of_birth", Message: "invalid date of birth",
+        Fields: []FieldError{{Field: "date_of_birth", Message: "must be an RFC 3339 timestamp"}}}
+    ErrMergeSelf = &Error{Kind: KindValidation, Code: "merge_self", Message: "a patient cannot be merged into itself",
+        Fields: []FieldError{{Field: "duplicate_id", Message: "must differ from the patient kept"}}}
+    ErrPatientMerged = &Error{Kind: KindConflict, Code: "patient_merged", Message: "Patient was merged into another and cannot be restored",
+        Err: repository.ErrPatientMerged}
+)
+
+// PatientService manages patient records. Every write is stored together
+// with its audit entry, in one transaction, on behalf of the user ID each
+// write method takes; the system itself acts as user 0.
 type PatientService struct {
-    repo *repository.PatientRepository
+    stores      repository.Transactor
+    repo        repository.PatientStore
+    historyRepo repository.MedicalHistoryStore
 }
 
+// CreatePatientInput is a new patient. Unless Force is set, Create refuses
+// one that looks like an existing patient.
 type CreatePatientInput struct {
-    FirstName      string `json:"first_name" binding:"required"`
-    LastName       string `json:"last_name" binding:"required"`
-    DateOfBirth    string `json:"date_of_birth" binding:"required"`
-    Gender         string `json:"gender" binding:"required,oneof=Male Female Other"`
-    Contact        string `json:"contact"`
-    Address        string `json:"address"`
+    FirstName   string `json:"first_name" binding:"required"`
+    LastName    string `json:"last_name" binding:"required"`
+    DateOfBirth string `json:"date_of_birth" binding:"required"`
+    Gender      string `json:"gender" binding:"required,oneof=Male Female Other"`
+    Contact     string `json:"contact"`
+    Address     string `json:"address"`
+    Force       bool   `json:"force"`
+}
+
+// PatientIdentifier is the ID another system knows a patient by. System
+// names the issuer, e.g. an HL7 assigning authority.
+type PatientIdentifier struct {
+    System string
+    Value  string
+}
+
+// MergePatientsInput names the duplicate to fold into the patient kept.
+type MergePatientsInput struct {
+    DuplicateID uint `json:"duplicate_id" binding:"required,min=1"`
 }
 
 type UpdatePatientInput struct {
-    FirstName      string `json:"first_name"`
-    LastName       string `json:"last_name"`
-    DateOfBirth    string `json:"date_of_birth"`
-    Gender         string `json:"gender" binding:"omitempty,oneof=Male Female Other"`
-    Contact        string `json:"contact"`
-    Address        string `json:"address"`
+    FirstName   string `json:"first_name"`
+    LastName    string `json:"last_name"`
+    DateOfBirth string `json:"date_of_birth"`
+    Gender      string `json:"gender" binding:"omitempty,oneof=Male Female Other"`
+    Contact     string `json:"contact"`
+    Address     string `json:"address"`
 }
 
+// MedicalHistoryInput is a new entry for a patient's medical history.
 type MedicalHistoryInput struct {
-    MedicalHistory string `json:"medical_history" binding:"required"`
+    Kind        string `json:"kind" binding:"required,oneof=diagnosis allergy medication procedure note"`
+    Description string `json:"description" binding:"required,max=10000"`
+}
+
+// ListPatientsInput is bound from the list endpoints' query string.
+type ListPatientsInput struct {
+    Page    int       `form:"page" binding:"omitempty,min=1"`
+    Limit   int       `form:"limit" binding:"omitempty,min=1,max=100"`
+    Sort    string    `form:"sort" binding:"omitempty,oneof=name date_of_birth created_at"`
+    Order   string    `form:"order" binding:"omitempty,oneof=asc desc"`
+    Gender  string    `form:"gender" binding:"omitempty,oneof=Male Female Other"`
+    DOBFrom time.Time `form:"dob_from" time_format:"2006-01-02"`
+    DOBTo   time.Time `form:"dob_to" time_format:"2006-01-02"`
+    Name    string    `form:"name"`
+}
+
+type PatientListResponse struct {
+    Data []PatientResponse `json:"data"`
+    Meta PageMeta          `json:"meta"`
+}
+
+// SearchPatientsInput is bound from the search endpoints' query string.
+type SearchPatientsInput struct {
+    Q     string `form:"q" binding:"required,min=2,max=100"`
+    Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type PatientSearchResult struct {
+    PatientResponse
+    Score float64 `json:"score"`
+}
+
+type PatientSearchResponse struct {
+    Data []PatientSearchResult `json:"data"`
 }
 
 type PatientResponse struct {
-    ID             uint   `json:"id"`
-    FirstName      string `json:"first_name"`
-    LastName       string `json:"last_name"`
-    DateOfBirth    string `json:"date_of_birth"`
-    Gender         string `json:"gender"`
-    Contact        string `json:"contact"`
-    Address        string `json:"address"`
-    MedicalHistory string `json:"medical_history"`
+    ID             uint                          `json:"id"`
+    FirstName      string                        `json:"first_name"`
+    LastName       string                        `json:"last_name"`
+    DateOfBirth    string                        `json:"date_of_birth"`
+    Gender         string                        `json:"gender"`
+    Contact        string                        `json:"contact"`
+    Address        string                        `json:"address"`
+    Version        uint                          `json:"version"`
+    MedicalHistory []MedicalHistoryEntryResponse `json:"medical_history"`
+}
+
+// ListDeletedPatientsInput is bound from the trash endpoint's query string.
+type ListDeletedPatientsInput struct {
+    Page  int `form:"page" binding:"omitempty,min=1"`
+    Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
 }
 
-func NewPatientService(repo *repository.PatientRepository) *PatientService {
-    return &PatientService{repo: repo}
+// DeletedPatientResponse is a patient in the trash. MergedIntoID is set
+// when it went there by being merged into that patient.
+type DeletedPatientResponse struct {
+    PatientResponse
+    DeletedAt    string `json:"deleted_at"`
+    MergedIntoID *uint  `json:"merged_into_id,omitempty"`
 }
 
-func (s *PatientService) Create(input CreatePatientInput) (PatientResponse, error) {
+type DeletedPatientListResponse struct {
+    Data []DeletedPatientResponse `json:"data"`
+    Meta PageMeta                 `json:"meta"`
+}
+
+// MedicalHistoryEntryResponse is one history entry. AuthorID is null for
+// notes migrated from the old free-text field.
+type MedicalHistoryEntryResponse struct {
+    ID          uint   `json:"id"`
+    Kind        string `json:"kind"`
+    Description string `json:"description"`
+    AuthorID    *uint  `json:"author_id"`
+    CreatedAt   string `json:"created_at"`
+}
+
+type MedicalHistoryListResponse struct {
+    Data []MedicalHistoryEntryResponse `json:"data"`
+}
+
+func NewPatientService(stores repository.Transactor) *PatientService {
+    return &PatientService{stores: stores, repo: stores.Stores().Patients, historyRepo: stores.Stores().History}
+}
+
+// Create stores a new patient. Unless input.Force is set, a patient that
+// scores DuplicateThreshold or more against existing ones is refused with a
+// *DuplicatesError listing them.
+func (s *PatientService) Create(userID uint, input CreatePatientInput) (PatientResponse, error) {
+    patient, err := newPatient(input)
+    if err != nil {
+        return PatientResponse{}, err
+    }
+    if !input.Force {
+        duplicates, err := findDuplicates(s.repo, patient)
+        if err != nil {
+            return PatientResponse{}, err
+        }
+        if len(duplicates) > 0 {
+            return PatientResponse{}, &DuplicatesError{Candidates: duplicates}
+        }
+    }
+
+    var response PatientResponse
+    err = s.stores.Transaction(func(stores repository.Stores) error {
+        if err := stores.Patients.Create(&patient); err != nil {
+            return err
+        }
+        response = newPatientResponse(patient, nil)
+        return record(stores, userID, model.AuditPatientCreate, patient.ID, nil, response)
+    })
+    if err != nil {
+        return PatientResponse{}, err
+    }
+    return response, nil
+}
+
+func newPatient(input CreatePatientInput) (model.Patient, error) {
     dob, err := time.Parse(time.RFC3339, input.DateOfBirth)
     if err != nil {
-        return PatientResponse{}, errors.New("invalid date of birth")
+        return model.Patient{}, ErrInvalidDateOfBirth
     }
 
-    patient := model.Patient{
+    return model.Patient{
         FirstName:   input.FirstName,
         LastName:    input.LastName,
         DateOfBirth: dob,
         Gender:      input.Gender,
         Contact:     input.Contact,
         Address:     input.Address,
+        Version:     1,
+    }, nil
+}
+
+func (s *PatientService) List(input ListPatientsInput) (PatientListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    query := repository.PatientQuery{
+        Offset:     (page - 1) * limit,
+        Limit:      limit,
+        Sort:       input.Sort,
+        Descending: input.Order == "desc",
+        Gender:     input.Gender,
+        NamePrefix: input.Name,
+    }
+    if !input.DOBFrom.IsZero() {
+        query.DOBFrom = &input.DOBFrom
+    }
+    if !input.DOBTo.IsZero() {
+        query.DOBTo = &input.DOBTo
     }
 
-    if err := s.repo.Create(&patient); err != nil {
-        return PatientResponse{}, err
+    patients, total, err := s.repo.FindPage(query)
+    if err != nil {
+        return PatientListResponse{}, err
     }
 
-    return PatientResponse{
-        ID:             patient.ID,
-        FirstName:      patient.FirstName,
-        LastName:       patient.LastName,
-        DateOfBirth:    patient.DateOfBirth.Format(time.RFC3339),
-        Gender:         patient.Gender,
-        Contact:        patient.Contact,
-        Address:        patient.Address,
-        MedicalHistory: patient.MedicalHistory,
-    }, nil
+    data, err := s.patientResponses(patients)
+    if err != nil {
+        return PatientListResponse{}, err
+    }
+    return PatientListResponse{Data: data, Meta: newPageMeta(page, limit, total)}, nil
 }
 
-func (s *PatientService) List() ([]PatientResponse, error) {
-    patients, err := s.repo.FindAll()
+func (s *PatientService) Search(input SearchPatientsInput) (PatientSearchResponse, error) {
+    limit := input.Limit
+    if limit < 1 {
+        limit = DefaultPageSize
+    }
+
+    matches, err := s.repo.Search(input.Q, limit)
     if err != nil {
-        return nil, err
+        return PatientSearchResponse{}, err
     }
 
-    var response []PatientResponse
-    for _, patient := range patients {
-        response = append(response, PatientResponse{
-            ID:             patient.ID,
-            FirstName:      patient.FirstName,
-            LastName:       patient.LastName,
-            DateOfBirth:    patient.DateOfBirth.Format(time.RFC3339),
-            Gender:         patient.Gender,
-            Contact:        patient.Contact,
-            Address:        patient.Address,
-            MedicalHistory: patient.MedicalHistory,
-        })
+    patients := make([]model.Patient, 0, len(matches))
+    for _, match := range matches {
+        patients = append(patients, match.Patient)
+    }
+    data, err := s.patientResponses(patients)
+    if err != nil {
+        return PatientSearchResponse{}, err
+    }
+
+    response := PatientSearchResponse{Data: make([]PatientSearchResult, 0, len(matches))}
+    for i, match := range matches {
+        response.Data = append(response.Data, PatientSearchResult{PatientResponse: data[i], Score: match.Score})
     }
 
     return response, nil
@@ -105,82 +257,397 @@ func (s *PatientService) List() ([]PatientResponse, error) {
 func (s *PatientService) Get(id uint) (PatientResponse, error) {
     patient, err := s.repo.FindByID(id)
     if err != nil {
-        return PatientResponse{}, err
+        return PatientResponse{}, notFound(err, "Patient")
     }
 
-    return PatientResponse{
-        ID:             patient.ID,
-        FirstName:      patient.FirstName,
-        LastName:       patient.LastName,
-        DateOfBirth:    patient.DateOfBirth.Format(time.RFC3339),
-        Gender:         patient.Gender,
-        Contact:        patient.Contact,
-        Address:        patient.Address,
-        MedicalHistory: patient.MedicalHistory,
-    }, nil
+    return s.patientResponse(patient)
 }
 
-func (s *PatientService) Update(id uint, input UpdatePatientInput) (PatientResponse, error) {
-    patient, err := s.repo.FindByID(id)
-    if err != nil {
-        return PatientResponse{}, err
-    }
-
+// Update changes only the fields that are set. A non-zero expectedVersion
+// must match the patient's current version, otherwise ErrVersionConflict is
+// returned and nothing is written.
+func (s *PatientService) Update(userID, id, expectedVersion uint, input UpdatePatientInput) (PatientResponse, error) {
+    changes := make(map[string]interface{})
     if input.FirstName != "" {
-        patient.FirstName = input.FirstName
+        changes["first_name"] = input.FirstName
     }
     if input.LastName != "" {
-        patient.LastName = input.LastName
+        changes["last_name"] = input.LastName
     }
     if input.DateOfBirth != "" {
         dob, err := time.Parse(time.RFC3339, input.DateOfBirth)
         if err != nil {
-            return PatientResponse{}, errors.New("invalid date of birth")
+            return PatientResponse{}, ErrInvalidDateOfBirth
         }
-        patient.DateOfBirth = dob
+        changes["date_of_birth"] = dob
     }
     if input.Gender != "" {
-        patient.Gender = input.Gender
+        changes["gender"] = input.Gender
     }
     if input.Contact != "" {
-        patient.Contact = input.Contact
+        changes["contact"] = input.Contact
     }
     if input.Address != "" {
-        patient.Address = input.Address
+        changes["address"] = input.Address
     }
+    return s.update(userID, id, expectedVersion, changes)
+}
 
-    if err := s.repo.Update(&patient); err != nil {
+// Replace overwrites every field of the patient with input, as a FHIR
+// update does: an empty contact or address clears it. expectedVersion works
+// as in Update.
+func (s *PatientService) Replace(userID, id, expectedVersion uint, input CreatePatientInput) (PatientResponse, error) {
+    patient, err := newPatient(input)
+    if err != nil {
         return PatientResponse{}, err
     }
+    return s.update(userID, id, expectedVersion, map[string]interface{}{
+        "first_name":    patient.FirstName,
+        "last_name":     patient.LastName,
+        "date_of_birth": patient.DateOfBirth,
+        "gender":        patient.Gender,
+        "contact":       patient.Contact,
+        "address":       patient.Address,
+    })
+}
 
-    return PatientResponse{
-        ID:             patient.ID,
-        FirstName:      patient.FirstName,
-        LastName:       patient.LastName,
-        DateOfBirth:    patient.DateOfBirth.Format(time.RFC3339),
-        Gender:         patient.Gender,
-        Contact:        patient.Contact,
-        Address:        patient.Address,
-        MedicalHistory: patient.MedicalHistory,
-    }, nil
+// update writes changes and audits them as an update by userID.
+func (s *PatientService) update(userID, id, expectedVersion uint, changes map[string]interface{}) (PatientResponse, error) {
+    var patient model.Patient
+    err := s.stores.Transaction(func(stores repository.Stores) error {
+        var err error
+        patient, err = updatePatient(stores, userID, id, expectedVersion, changes)
+        return err
+    })
+    if err != nil {
+        return PatientResponse{}, err
+    }
+    return s.patientResponse(patient)
 }
 
-func (s *PatientService) Delete(id uint) error {
-    return s.repo.Delete(id)
+// updatePatient is update within the caller's transaction.
+func updatePatient(stores repository.Stores, userID, id, expectedVersion uint, changes map[string]interface{}) (model.Patient, error) {
+    before, err := stores.Patients.FindByID(id)
+    if err != nil {
+        return model.Patient{}, notFound(err, "Patient")
+    }
+    patient := before
+    if len(changes) == 0 {
+        if expectedVersion != 0 && patient.Version != expectedVersion {
+            return model.Patient{}, ErrVersionConflict
+        }
+    } else {
+        patient, err = stores.Patients.Update(id, expectedVersion, changes)
+        if errors.Is(err, repository.ErrVersionConflict) {
+            return model.Patient{}, ErrVersionConflict
+        }
+        if err != nil {
+            return model.Patient{}, notFound(err, "Patient")
+        }
+    }
+    return patient, record(stores, userID, model.AuditPatientUpdate, id, newPatientResponse(before, nil), newPatientResponse(patient, nil))
 }
 
-func (s *PatientService) UpdateMedicalHistory(id uint, medicalHistory string) (PatientResponse, error) {
-    patient, err := s.repo.FindByID(id)
+// SaveByIdentifier creates the patient another system knows by identifier,
+// or updates the one already linked to it, and reports whether it created
+// one. An update writes the name, date of birth and gender, and the contact
+// and address when they are set or listed in clear ("contact", "address").
+// A patient linked to the identifier but in the trash is reported as not
+// found rather than created again. New patients skip duplicate detection:
+// the sending system cannot review candidates, and refusing a message would
+// lose the admission, so duplicates are merged afterwards.
+func (s *PatientService) SaveByIdentifier(userID uint, identifier PatientIdentifier, input CreatePatientInput, clear ...string) (PatientResponse, bool, error) {
+    patient, err := newPatient(input)
+    if err != nil {
+        return PatientResponse{}, false, err
+    }
+
+    created := false
+    err = s.stores.Transaction(func(stores repository.Stores) error {
+        linked, err := stores.Identifiers.Find(identifier.System, identifier.Value)
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            if err := stores.Patients.Create(&patient); err != nil {
+                return err
+            }
+            created = true
+            if err := stores.Identifiers.Create(&model.PatientIdentifier{PatientID: patient.ID, System: identifier.System, Value: identifier.Value}); err != nil {
+                return err
+            }
+            return record(stores, userID, model.AuditPatientCreate, patient.ID, nil, newPatientResponse(patient, nil))
+        }
+        if err != nil {
+            return err
+        }
+
+        changes := map[string]interface{}{
+            "first_name":    patient.FirstName,
+            "last_name":     patient.LastName,
+            "date_of_birth": patient.DateOfBirth,
+            "gender":        patient.Gender,
+        }
+        if patient.Contact != "" {
+            changes["contact"] = patient.Contact
+        }
+        if patient.Address != "" {
+            changes["address"] = patient.Address
+        }
+        for _, field := range clear {
+            if field == "contact" || field == "address" {
+                changes[field] = ""
+            }
+        }
+        patient, err = updatePatient(stores, userID, linked.PatientID, 0, changes)
+        return err
+    })
+    if err != nil {
+        return PatientResponse{}, false, err
+    }
+    response, err := s.patientResponse(patient)
+    return response, created, err
+}
+
+func (s *PatientService) Delete(userID, id uint) error {
+    return s.stores.Transaction(func(stores repository.Stores) error {
+        before, err := stores.Patients.FindByID(id)
+        if err != nil {
+            return notFound(err, "Patient")
+        }
+        if err := stores.Patients.Delete(id); err != nil {
+            return notFound(err, "Patient")
+        }
+        return record(stores, userID, model.AuditPatientDelete, id, newPatientResponse(before, nil), nil)
+    })
+}
+
+// ListDeleted returns a page of the trash, most recently deleted first.
+func (s *PatientService) ListDeleted(input ListDeletedPatientsInput) (DeletedPatientListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    patients, total, err := s.repo.FindDeletedPage((page-1)*limit, limit)
+    if err != nil {
+        return DeletedPatientListResponse{}, err
+    }
+
+    responses, err := s.patientResponses(patients)
+    if err != nil {
+        return DeletedPatientListResponse{}, err
+    }
+    data := make([]DeletedPatientResponse, 0, len(patients))
+    for i, patient := range patients {
+        data = append(data, DeletedPatientResponse{
+            PatientResponse: responses[i],
+            DeletedAt:       patient.DeletedAt.Time.UTC().Format(time.RFC3339),
+            MergedIntoID:    patient.MergedIntoID,
+        })
+    }
+    return DeletedPatientListResponse{Data: data, Meta: newPageMeta(page, limit, total)}, nil
+}
+
+// Restore takes a patient out of the trash. A duplicate that was merged
+// away is refused with ErrPatientMerged, since its records now belong to the
+// patient it was merged into.
+func (s *PatientService) Restore(userID, id uint) (PatientResponse, error) {
+    var patient model.Patient
+    err := s.stores.Transaction(func(stores repository.Stores) error {
+        var err error
+        patient, err = stores.Patients.Restore(id)
+        if errors.Is(err, repository.ErrPatientMerged) {
+            return ErrPatientMerged
+        }
+        if err != nil {
+            return notFound(err, "Deleted patient")
+        }
+        return record(stores, userID, model.AuditPatientRestore, id, nil, nil)
+    })
     if err != nil {
         return PatientResponse{}, err
     }
+    return s.patientResponse(patient)
+}
+
+// Merge folds the patient duplicateID into survivorID. The duplicate's
+// medical history, appointments and identifiers in other systems move to the
+// survivor, which also takes its contact and address where it has none, and
+// the duplicate goes to the trash marked as merged. Each patient's audit
+// entry names the other. expectedVersion applies to the survivor, as in
+// Update.
+func (s *PatientService) Merge(userID, survivorID, duplicateID, expectedVersion uint) (PatientResponse, error) {
+    if survivorID == duplicateID {
+        return PatientResponse{}, ErrMergeSelf
+    }
+
+    var survivor model.Patient
+    err := s.stores.Transaction(func(stores repository.Stores) error {
+        before, err := stores.Patients.FindByID(survivorID)
+        if err != nil {
+            return notFound(err, "Patient")
+        }
+        duplicate, err := stores.Patients.FindByID(duplicateID)
+        if err != nil {
+            return notFound(err, "Duplicate patient")
+        }
+
+        changes := make(map[string]interface{})
+        if before.Contact == "" && duplicate.Contact != "" {
+            changes["contact"] = duplicate.Contact
+        }
+        if before.Address == "" && duplicate.Address != "" {
+            changes["address"] = duplicate.Address
+        }
+        // The survivor's version goes up even without changes: its history
+        // grows.
+        survivor, err = stores.Patients.Update(survivorID, expectedVersion, changes)
+        if errors.Is(err, repository.ErrVersionConflict) {
+            return ErrVersionConflict
+        }
+        if err != nil {
+            return err
+        }
+        if err := stores.Patients.Merge(duplicateID, survivorID); err != nil {
+            return notFound(err, "Patient")
+        }
 
-    patient.MedicalHistory = medicalHistory
-    if err := s.repo.Update(&patient); err != nil {
+        entry, err := newAuditEntry(userID, model.AuditPatientMerge, survivorID, newPatientResponse(before, nil), newPatientResponse(survivor, nil))
+        if err != nil {
+            return err
+        }
+        entry.RelatedPatientID = &duplicateID
+        return stores.Audit.Create([]model.AuditLog{
+            entry,
+            {UserID: userID, Action: model.AuditPatientMerge, PatientID: duplicateID, RelatedPatientID: &survivorID},
+        })
+    })
+    if err != nil {
         return PatientResponse{}, err
     }
+    return s.patientResponse(survivor)
+}
 
-    return PatientResponse{
+// Purge permanently erases a patient in the trash, with its medical history
+// and appointments. It cannot be undone.
+func (s *PatientService) Purge(userID, id uint) error {
+    return s.stores.Transaction(func(stores repository.Stores) error {
+        if err := stores.Patients.Purge(id); err != nil {
+            return notFound(err, "Deleted patient")
+        }
+        // Their audit diffs go with them; the entries stay. The new entry
+        // names the patient only, since a snapshot would undo the erasure.
+        if err := stores.Audit.Erase(id); err != nil {
+            return err
+        }
+        return record(stores, userID, model.AuditPatientPurge, id, nil, nil)
+    })
+}
+
+// PurgeDeletedBefore purges up to limit patients deleted before cutoff, all
+// of them when limit is 0, and returns their IDs. The purges and their audit
+// entries share one transaction, so the limit bounds how long it runs.
+func (s *PatientService) PurgeDeletedBefore(userID uint, cutoff time.Time, limit int) ([]uint, error) {
+    var ids []uint
+    err := s.stores.Transaction(func(stores repository.Stores) error {
+        var err error
+        if ids, err = stores.Patients.PurgeDeletedBefore(cutoff, limit); err != nil || len(ids) == 0 {
+            return err
+        }
+        if err := stores.Audit.Erase(ids...); err != nil {
+            return err
+        }
+        return stores.Audit.Create(auditEntries(userID, model.AuditPatientPurge, ids))
+    })
+    if err != nil {
+        return nil, err
+    }
+    return ids, nil
+}
+
+// AddMedicalHistoryEntry appends an entry written by authorID to the
+// patient's history. Existing entries are never changed. The history is
+// part of the patient's representation, so its version goes up.
+func (s *PatientService) AddMedicalHistoryEntry(patientID, authorID uint, input MedicalHistoryInput) (MedicalHistoryEntryResponse, error) {
+    entry := model.MedicalHistoryEntry{
+        PatientID:   patientID,
+        AuthorID:    &authorID,
+        Kind:        input.Kind,
+        Description: input.Description,
+    }
+    var response MedicalHistoryEntryResponse
+    err := s.stores.Transaction(func(stores repository.Stores) error {
+        if _, err := stores.Patients.FindByID(patientID); err != nil {
+            return notFound(err, "Patient")
+        }
+        if err := stores.History.Create(&entry); err != nil {
+            return err
+        }
+        if _, err := stores.Patients.Update(patientID, 0, nil); err != nil {
+            return err
+        }
+        response = newMedicalHistoryEntryResponse(entry)
+        return record(stores, authorID, model.AuditMedicalHistoryAdd, patientID, nil, response)
+    })
+    if err != nil {
+        return MedicalHistoryEntryResponse{}, err
+    }
+    return response, nil
+}
+
+// ListMedicalHistory returns the patient's history, oldest entry first.
+func (s *PatientService) ListMedicalHistory(patientID uint) (MedicalHistoryListResponse, error) {
+    if _, err := s.repo.FindByID(patientID); err != nil {
+        return MedicalHistoryListResponse{}, notFound(err, "Patient")
+    }
+
+    entries, err := s.historyRepo.FindByPatients(patientID)
+    if err != nil {
+        return MedicalHistoryListResponse{}, err
+    }
+    response := MedicalHistoryListResponse{Data: make([]MedicalHistoryEntryResponse, 0, len(entries))}
+    for _, entry := range entries {
+        response.Data = append(response.Data, newMedicalHistoryEntryResponse(entry))
+    }
+    return response, nil
+}
+
+// record stores an audit entry through stores, in the caller's transaction.
+func record(stores repository.Stores, userID uint, action string, patientID uint, before, after interface{}) error {
+    entry, err := newAuditEntry(userID, action, patientID, before, after)
+    if err != nil {
+        return err
+    }
+    return stores.Audit.Create([]model.AuditLog{entry})
+}
+
+func (s *PatientService) patientResponse(patient model.Patient) (PatientResponse, error) {
+    responses, err := s.patientResponses([]model.Patient{patient})
+    if err != nil {
+        return PatientResponse{}, err
+    }
+    return responses[0], nil
+}
+
+// patientResponses builds responses for patients, loading all of their
+// histories in one query.
+func (s *PatientService) patientResponses(patients []model.Patient) ([]PatientResponse, error) {
+    ids := make([]uint, 0, len(patients))
+    for _, patient := range patients {
+        ids = append(ids, patient.ID)
+    }
+    entries, err := s.historyRepo.FindByPatients(ids...)
+    if err != nil {
+        return nil, err
+    }
+    history := make(map[uint][]model.MedicalHistoryEntry)
+    for _, entry := range entries {
+        history[entry.PatientID] = append(history[entry.PatientID], entry)
+    }
+
+    responses := make([]PatientResponse, 0, len(patients))
+    for _, patient := range patients {
+        responses = append(responses, newPatientResponse(patient, history[patient.ID]))
+    }
+    return responses, nil
+}
+
+func newPatientResponse(patient model.Patient, history []model.MedicalHistoryEntry) PatientResponse {
+    response := PatientResponse{
         ID:             patient.ID,
         FirstName:      patient.FirstName,
         LastName:       patient.LastName,
@@ -188,6 +655,21 @@ func (s *PatientService) UpdateMedicalHistory(id uint, medicalHistory string) (P
         Gender:         patient.Gender,
         Contact:        patient.Contact,
         Address:        patient.Address,
-        MedicalHistory: patient.MedicalHistory,
-    }, nil
-}
\ No newline at end of file
+        Version:        patient.Version,
+        MedicalHistory: make([]MedicalHistoryEntryResponse, 0, len(history)),
+    }
+    for _, entry := range history {
+        response.MedicalHistory = append(response.MedicalHistory, newMedicalHistoryEntryResponse(entry))
+    }
+    return response
+}
+
+func newMedicalHistoryEntryResponse(entry model.MedicalHistoryEntry) MedicalHistoryEntryResponse {
+    return MedicalHistoryEntryResponse{
+        ID:          entry.ID,
+        Kind:        entry.Kind,
+        Description: entry.Description,
+        AuthorID:    entry.AuthorID,
+        CreatedAt:   entry.CreatedAt.Format(time.RFC3339),
+    }
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+    "context"
+    "log"
+    "time"
+)
+
+// RetentionConfig sets how long deleted patients stay in the trash before
+// they are purged. A zero Retention keeps them until purged by hand.
+// BatchSize caps how many patients one run purges.
+type RetentionConfig struct {
+    Retention time.Duration
+    Interval  time.Duration
+    BatchSize int
+}
+
+func DefaultRetentionConfig() RetentionConfig {
+    return RetentionConfig{Interval: time.Hour, BatchSize: 100}
+}
+
+// RetentionJob purges patients that have been in the trash longer than the
+// retention period. Each purge is written to the audit log with user ID 0.
+type RetentionJob struct {
+    patients *PatientService
+    config   RetentionConfig
+}
+
+func NewRetentionJob(patients *PatientService, config RetentionConfig) *RetentionJob {
+    return &RetentionJob{patients: patients, config: config}
+}
+
+// RunOnce purges up to one batch of the patients deleted more than the
+// retention period before now, oldest IDs first, and returns their IDs.
+func (j *RetentionJob) RunOnce(now time.Time) ([]uint, error) {
+    if j.config.Retention <= 0 {
+        return nil, nil
+    }
+    return j.patients.PurgeDeletedBefore(0, now.Add(-j.config.Retention), j.batchSize())
+}
+
+func (j *RetentionJob) batchSize() int {
+    if j.config.BatchSize <= 0 {
+        return DefaultRetentionConfig().BatchSize
+    }
+    return j.config.BatchSize
+}
+
+// Run calls RunOnce every interval until ctx is cancelled. After a full
+// batch it runs again straight away, so a backlog drains in short
+// transactions. Failures are logged and retried on the next tick.
+func (j *RetentionJob) Run(ctx context.Context) {
+    if j.config.Retention <= 0 {
+        return
+    }
+    interval := j.config.Interval
+    if interval <= 0 {
+        interval = DefaultRetentionConfig().Interval
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        ids, err := j.RunOnce(time.Now())
+        if err != nil {
+            log.Printf("Retention purge failed: %v", err)
+        } else if len(ids) > 0 {
+            log.Printf("Retention purge removed %d deleted patients", len(ids))
+        }
+        if err == nil && len(ids) == j.batchSize() {
+            select {
+            case <-ctx.Done():
+                return
+            default:
+                continue
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "encoding/base32"
+    "encoding/binary"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// TOTP codes follow RFC 6238 with the parameters every authenticator app
+// defaults to: HMAC-SHA1, six digits and a 30 second step. A code is
+// accepted one step either side of the server's clock to allow for drift.
+const (
+    totpDigits     = 6
+    totpModulus    = 1000000
+    totpPeriod     = 30
+    totpSkew       = 1
+    totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() (string, error) {
+    buf := make([]byte, totpSecretSize)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPStep is the number of the time step at t.
+func TOTPStep(t time.Time) int64 {
+    return t.Unix() / totpPeriod
+}
+
+// TOTPCode is the code for secret, base32 encoded as in provisioning URIs,
+// at time step step.
+func TOTPCode(secret string, step int64) (string, error) {
+    key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+    if err != nil {
+        return "", err
+    }
+
+    var counter [8]byte
+    binary.BigEndian.PutUint64(counter[:], uint64(step))
+    mac := hmac.New(sha1.New, key)
+    mac.Write(counter[:])
+    sum := mac.Sum(nil)
+
+    offset := sum[len(sum)-1] & 0x0f
+    value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+    return fmt.Sprintf("%0*d", totpDigits, value%totpModulus), nil
+}
+
+// matchTOTP returns the step within the allowed skew of now whose code is
+// code, or false when there is none.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+    if len(code) != totpDigits {
+        return 0, false
+    }
+    current := TOTPStep(now)
+    for step := current - totpSkew; step <= current+totpSkew; step++ {
+        expected, err := TOTPCode(secret, step)
+        if err != nil {
+            return 0, false
+        }
+        if hmac.Equal([]byte(expected), []byte(code)) {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+// totpURI is the otpauth:// URI authenticator apps read from a QR code.
+func totpURI(issuer, account, secret string) string {
+    query := url.Values{}
+    query.Set("secret", secret)
+    query.Set("issuer", issuer)
+    query.Set("algorithm", "SHA1")
+    query.Set("digits", fmt.Sprint(totpDigits))
+    query.Set("period", fmt.Sprint(totpPeriod))
+    label := url.PathEscape(issuer + ":" + account)
+    return "otpauth://totp/" + label + "?" + query.Encode()
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+    "crypto/rand"
+    "encoding/base32"
+    "errors"
+    "strings"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+var (
+    ErrInvalidChallenge       = &Error{Kind: KindUnauthorized, Code: "invalid_challenge_token", Message: "invalid or expired two-factor challenge"}
+    ErrInvalidTwoFactorCode   = &Error{Kind: KindUnauthorized, Code: "invalid_two_factor_code", Message: "invalid two-factor code"}
+    ErrEnrollmentRequired     = &Error{Kind: KindConflict, Code: "two_factor_enrollment_required", Message: "two-factor authentication is required; enroll first"}
+    ErrTwoFactorEnabled       = &Error{Kind: KindConflict, Code: "two_factor_enabled", Message: "two-factor authentication is already enabled"}
+    ErrTwoFactorNotEnabled    = &Error{Kind: KindConflict, Code: "two_factor_not_enabled", Message: "two-factor authentication is not enabled"}
+    ErrEnrollmentNotStarted   = &Error{Kind: KindConflict, Code: "two_factor_enrollment_not_started", Message: "start two-factor enrollment first"}
+    ErrTwoFactorRoleRequired  = &Error{Kind: KindForbidden, Code: "two_factor_required", Message: "a role of this account requires two-factor authentication"}
+    ErrTwoFactorLoginRequired = &Error{Kind: KindUnauthorized, Code: "two_factor_login_required", Message: "a role of this account now requires two-factor authentication; log in again to enroll"}
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time; each
+// is recoveryCodeSize random bytes shown as base32.
+const (
+    recoveryCodeCount = 10
+    recoveryCodeSize  = 5
+)
+
+// TwoFactorChallenge is returned by login in place of tokens. The challenge
+// token is opaque and stands for the password check; send it with a code to
+// /auth/2fa/verify, or, when EnrollmentRequired, enroll first. It is used up
+// once the login completes.
+type TwoFactorChallenge struct {
+    ChallengeToken     string `json:"challenge_token"`
+    ExpiresIn          int64  `json:"expires_in"`
+    EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+type ChallengeInput struct {
+    ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// ChallengeCodeInput completes a challenge. Code is a TOTP code or, to
+// verify a login, one of the user's recovery codes.
+type ChallengeCodeInput struct {
+    ChallengeToken string `json:"challenge_token" binding:"required"`
+    Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeInput struct {
+    Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorSetup is the secret of a pending enrollment. ProvisioningURI is
+// the otpauth:// URI to show as a QR code; Secret is for typing in by hand.
+type TwoFactorSetup struct {
+    Secret          string `json:"secret"`
+    ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse lists new recovery codes. They are shown once.
+type RecoveryCodesResponse struct {
+    RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// challenge stores a short-lived random token proving user passed the
+// password check. Only its hash is kept, as with refresh tokens, and unlike
+// a signed token it is worthless to any other service.
+func (s *AuthService) challenge(user model.User) (TokenResponse, error) {
+    challengeToken, err := randomToken(32)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    if err := s.tokenRepo.CreateChallenge(&model.LoginChallenge{
+        UserID:    user.ID,
+        TokenHash: hashToken(challengeToken),
+        ExpiresAt: time.Now().Add(s.config.ChallengeTTL),
+    }); err != nil {
+        return TokenResponse{}, err
+    }
+    return TokenResponse{TwoFactor: &TwoFactorChallenge{
+        ChallengeToken:     challengeToken,
+        ExpiresIn:          int64(s.config.ChallengeTTL / time.Second),
+        EnrollmentRequired: !user.TwoFactorEnabled(),
+    }}, nil
+}
+
+// findChallenge looks up an unexpired challenge by its token.
+func (s *AuthService) findChallenge(challengeToken string) (model.LoginChallenge, error) {
+    challenge, err := s.tokenRepo.FindChallenge(hashToken(challengeToken))
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return model.LoginChallenge{}, ErrInvalidChallenge
+    }
+    if err != nil {
+        return model.LoginChallenge{}, err
+    }
+    if time.Now().After(challenge.ExpiresAt) {
+        return model.LoginChallenge{}, ErrInvalidChallenge
+    }
+    return challenge, nil
+}
+
+// ChallengeAccount returns the email a challenge was issued to, so code
+// attempts can be limited like password attempts.
+func (s *AuthService) ChallengeAccount(challengeToken string) (string, error) {
+    user, _, err := s.challengedUser(challengeToken)
+    if err != nil {
+        return "", err
+    }
+    return user.Email, nil
+}
+
+// challengedUser loads the challenge and the still active user it was
+// issued to.
+func (s *AuthService) challengedUser(challengeToken string) (model.User, model.LoginChallenge, error) {
+    challenge, err := s.findChallenge(challengeToken)
+    if err != nil {
+        return model.User{}, model.LoginChallenge{}, err
+    }
+    user, err := s.userRepo.FindByID(challenge.UserID)
+    if err != nil {
+        return model.User{}, model.LoginChallenge{}, ErrInvalidChallenge
+    }
+    if !user.Active() {
+        return model.User{}, model.LoginChallenge{}, ErrAccountDeactivated
+    }
+    return user, challenge, nil
+}
+
+// completeChallenge uses up challenge and starts the session. Of two
+// requests completing the same challenge only one gets tokens.
+func (s *AuthService) completeChallenge(user model.User, challenge model.LoginChallenge) (TokenResponse, error) {
+    deleted, err := s.tokenRepo.DeleteChallenge(challenge.ID)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    if !deleted {
+        return TokenResponse{}, ErrInvalidChallenge
+    }
+    return s.startSession(user)
+}
+
+// VerifyTwoFactor completes a login with a TOTP code or an unused recovery
+// code and starts the session.
+func (s *AuthService) VerifyTwoFactor(input ChallengeCodeInput) (TokenResponse, error) {
+    user, challenge, err := s.challengedUser(input.ChallengeToken)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    if !user.TwoFactorEnabled() {
+        return TokenResponse{}, ErrEnrollmentRequired
+    }
+    if err := s.checkCode(user, input.Code); err != nil {
+        return TokenResponse{}, err
+    }
+    return s.completeChallenge(user, challenge)
+}
+
+// StartChallengeEnrollment begins enrollment for a user who must enroll
+// before their login can complete.
+func (s *AuthService) StartChallengeEnrollment(input ChallengeInput) (TwoFactorSetup, error) {
+    user, _, err := s.challengedUser(input.ChallengeToken)
+    if err != nil {
+        return TwoFactorSetup{}, err
+    }
+    return s.startEnrollment(user)
+}
+
+// ConfirmChallengeEnrollment enables two-factor authentication with a first
+// code from the authenticator and completes the login. The response carries
+// the user's recovery codes.
+func (s *AuthService) ConfirmChallengeEnrollment(input ChallengeCodeInput) (TokenResponse, error) {
+    user, challenge, err := s.challengedUser(input.ChallengeToken)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    codes, err := s.confirmEnrollment(&user, input.Code)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    tokens, err := s.completeChallenge(user, challenge)
+    if err != nil {
+        return TokenResponse{}, err
+    }
+    tokens.RecoveryCodes = codes
+    return tokens, nil
+}
+
+// EnrollTwoFactor begins enrollment for a signed-in user.
+func (s *AuthService) EnrollTwoFactor(userID uint) (TwoFactorSetup, error) {
+    user, err := s.userRepo.FindByID(userID)
+    if err != nil {
+        return TwoFactorSetup{}, notFound(err, "User")
+    }
+    return s.startEnrollment(user)
+}
+
+// ConfirmTwoFactor enables a signed-in user's pending enrollment.
+func (s *AuthService) ConfirmTwoFactor(userID uint, input TwoFactorCodeInput) (RecoveryCodesResponse, error) {
+    user, err := s.userRepo.FindByID(userID)
+    if err != nil {
+        return RecoveryCodesResponse{}, notFound(err, "User")
+    }
+    codes, err := s.confirmEnrollment(&user, input.Code)
+    if err != nil {
+        return RecoveryCodesResponse{}, err
+    }
+    return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes replaces all of a user's recovery codes, used or
+// not, once a current code is given.
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, input TwoFactorCodeInput) (RecoveryCodesResponse, error) {
+    user, err := s.userRepo.FindByID(userID)
+    if err != nil {
+        return RecoveryCodesResponse{}, notFound(err, "User")
+    }
+    if !user.TwoFactorEnabled() {
+        return RecoveryCodesResponse{}, ErrTwoFactorNotEnabled
+    }
+    if err := s.checkCode(user, input.Code); err != nil {
+        return RecoveryCodesResponse{}, err
+    }
+    codes, err := s.newRecoveryCodes(user.ID)
+    if err != nil {
+        return RecoveryCodesResponse{}, err
+    }
+    return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off once a current code
+// is given, unless a role of the user requires it.
+func (s *AuthService) DisableTwoFactor(userID uint, input TwoFactorCodeInput) error {
+    user, err := s.userRepo.FindByID(userID)
+    if err != nil {
+        return notFound(err, "User")
+    }
+    if !user.TwoFactorEnabled() {
+        return ErrTwoFactorNotEnabled
+    }
+    if user.TwoFactorRequired() {
+        return ErrTwoFactorRoleRequired
+    }
+    if err := s.checkCode(user, input.Code); err != nil {
+        return err
+    }
+    return clearTwoFactor(s.userRepo, &user)
+}
+
+// startEnrollment gives user a new secret, replacing any earlier pending
+// one. It is only checked once confirmed.
+func (s *AuthService) startEnrollment(user model.User) (TwoFactorSetup, error) {
+    if user.TwoFactorEnabled() {
+        return TwoFactorSetup{}, ErrTwoFactorEnabled
+    }
+    secret, err := newTOTPSecret()
+    if err != nil {
+        return TwoFactorSetup{}, err
+    }
+    user.TOTPSecret = secret
+    if err := s.userRepo.Update(&user); err != nil {
+        return TwoFactorSetup{}, err
+    }
+    return TwoFactorSetup{Secret: secret, ProvisioningURI: totpURI(s.config.TOTPIssuer, user.Email, secret)}, nil
+}
+
+// confirmEnrollment enables the pending secret if code is its current code
+// and returns new recovery codes.
+func (s *AuthService) confirmEnrollment(user *model.User, code string) ([]string, error) {
+    if user.TwoFactorEnabled() {
+        return nil, ErrTwoFactorEnabled
+    }
+    if user.TOTPSecret == "" {
+        return nil, ErrEnrollmentNotStarted
+    }
+    now := time.Now()
+    step, ok := matchTOTP(user.TOTPSecret, normalizeCode(code), now)
+    if !ok {
+        return nil, ErrInvalidTwoFactorCode
+    }
+
+    user.TOTPEnabledAt = &now
+    if err := s.userRepo.Update(user); err != nil {
+        return nil, err
+    }
+    if _, err := s.userRepo.AdvanceTOTPStep(user.ID, step); err != nil {
+        return nil, err
+    }
+    return s.newRecoveryCodes(user.ID)
+}
+
+// checkCode accepts a TOTP code not used before, or an unused recovery
+// code, which is then used up.
+func (s *AuthService) checkCode(user model.User, code string) error {
+    code = normalizeCode(code)
+    now := time.Now()
+    if step, ok := matchTOTP(user.TOTPSecret, code, now); ok {
+        fresh, err := s.userRepo.AdvanceTOTPStep(user.ID, step)
+        if err != nil {
+            return err
+        }
+        if !fresh {
+            return ErrInvalidTwoFactorCode
+        }
+        return nil
+    }
+
+    used, err := s.userRepo.UseRecoveryCode(user.ID, hashToken(code), now)
+    if err != nil {
+        return err
+    }
+    if !used {
+        return ErrInvalidTwoFactorCode
+    }
+    return nil
+}
+
+func (s *AuthService) newRecoveryCodes(userID uint) ([]string, error) {
+    codes := make([]string, 0, recoveryCodeCount)
+    hashes := make([]string, 0, recoveryCodeCount)
+    buf := make([]byte, recoveryCodeSize)
+    for i := 0; i < recoveryCodeCount; i++ {
+        if _, err := rand.Read(buf); err != nil {
+            return nil, err
+        }
+        code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+        codes = append(codes, code[:4]+"-"+code[4:])
+        hashes = append(hashes, hashToken(code))
+    }
+    if err := s.userRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// normalizeCode drops the spaces and dashes people type into codes and
+// lower-cases recovery codes.
+func normalizeCode(code string) string {
+    return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// clearTwoFactor turns two-factor authentication off for user and discards
+// its secret and recovery codes.
+func clearTwoFactor(repo repository.UserStore, user *model.User) error {
+    user.TOTPSecret = ""
+    user.TOTPEnabledAt = nil
+    if err := repo.Update(user); err != nil {
+        return err
+    }
+    return repo.ReplaceRecoveryCodes(user.ID, nil)
+}
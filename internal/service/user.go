@@ -0,0 +1,404 @@
+package service
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+)
+
+var (
+    ErrEmailTaken = &Error{Kind: KindConflict, Code: "email_taken", Message: "email is already in use",
+        Fields: []FieldError{{Field: "email", Message: "is already in use"}}}
+    ErrUnknownRole          = &Error{Kind: KindValidation, Code: "unknown_role", Message: "unknown role"}
+    ErrCannotDeactivateSelf = &Error{Kind: KindValidation, Code: "cannot_deactivate_self", Message: "you cannot deactivate your own account"}
+    ErrCannotDemoteSelf     = &Error{Kind: KindValidation, Code: "cannot_demote_self", Message: "you cannot remove the admin role from your own account"}
+    ErrLastAdmin            = &Error{Kind: KindConflict, Code: "last_admin", Message: "the last active admin cannot lose the admin role"}
+)
+
+// roleHolderBatchSize is how many holders of a role are loaded at a time.
+const roleHolderBatchSize = 100
+
+// UserService is the administrators' view of user accounts.
+type UserService struct {
+    repo      repository.UserStore
+    tokenRepo repository.RefreshTokenStore
+}
+
+type CreateUserInput struct {
+    Email    string   `json:"email" binding:"required,email"`
+    Password string   `json:"password" binding:"required"`
+    Roles    []string `json:"roles" binding:"required,min=1,dive,required"`
+}
+
+// UpdateUserInput changes the fields that are set. Roles, when given,
+// replace all of the user's roles.
+type UpdateUserInput struct {
+    Email string   `json:"email" binding:"omitempty,email"`
+    Roles []string `json:"roles" binding:"omitempty,min=1,dive,required"`
+}
+
+type ResetPasswordInput struct {
+    Password string `json:"password" binding:"required"`
+}
+
+// ListUsersInput is bound from the user list endpoint's query string.
+type ListUsersInput struct {
+    Page   int    `form:"page" binding:"omitempty,min=1"`
+    Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+    Role   string `form:"role"`
+    Status string `form:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+// UpdateRoleInput changes a role's policy. TwoFactorRequired makes its
+// holders enroll in two-factor authentication on their next login.
+type UpdateRoleInput struct {
+    TwoFactorRequired *bool `json:"two_factor_required" binding:"required"`
+}
+
+type RoleResponse struct {
+    Name              string   `json:"name"`
+    Permissions       []string `json:"permissions"`
+    TwoFactorRequired bool     `json:"two_factor_required"`
+}
+
+func newRoleResponse(role model.Role) RoleResponse {
+    permissions := make([]string, 0, len(role.Permissions))
+    for _, permission := range role.Permissions {
+        permissions = append(permissions, permission.Name)
+    }
+    sort.Strings(permissions)
+    return RoleResponse{Name: role.Name, Permissions: permissions, TwoFactorRequired: role.TwoFactorRequired}
+}
+
+type UserListResponse struct {
+    Data []UserResponse `json:"data"`
+    Meta PageMeta       `json:"meta"`
+}
+
+func NewUserService(repo repository.UserStore, tokenRepo repository.RefreshTokenStore) *UserService {
+    return &UserService{repo: repo, tokenRepo: tokenRepo}
+}
+
+func (s *UserService) Create(input CreateUserInput) (UserResponse, error) {
+    if err := ValidatePassword(input.Password, input.Email); err != nil {
+        return UserResponse{}, err
+    }
+    if err := s.checkEmailFree(input.Email, 0); err != nil {
+        return UserResponse{}, err
+    }
+    roles, err := s.resolveRoles(input.Roles)
+    if err != nil {
+        return UserResponse{}, err
+    }
+
+    hash, err := hashPassword(input.Password)
+    if err != nil {
+        return UserResponse{}, err
+    }
+    user := model.User{Email: input.Email, Password: hash, Roles: roles}
+    if err := s.repo.Create(&user); err != nil {
+        return UserResponse{}, err
+    }
+    return newUserResponse(user), nil
+}
+
+func (s *UserService) List(input ListUsersInput) (UserListResponse, error) {
+    page, limit := pageBounds(input.Page, input.Limit)
+    query := repository.UserQuery{
+        Offset: (page - 1) * limit,
+        Limit:  limit,
+        Role:   input.Role,
+    }
+    if input.Status != "" {
+        active := input.Status == "active"
+        query.Active = &active
+    }
+
+    users, total, err := s.repo.FindPage(query)
+    if err != nil {
+        return UserListResponse{}, err
+    }
+
+    response := UserListResponse{
+        Data: make([]UserResponse, 0, len(users)),
+        Meta: newPageMeta(page, limit, total),
+    }
+    for _, user := range users {
+        response.Data = append(response.Data, newUserResponse(user))
+    }
+    return response, nil
+}
+
+func (s *UserService) Get(id uint) (UserResponse, error) {
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return UserResponse{}, notFound(err, "User")
+    }
+    return newUserResponse(user), nil
+}
+
+// Update changes a user's email and roles. A change of roles ends the
+// user's sessions, so they sign in again with the new permissions. actorID
+// is the administrator making the request, who cannot remove the admin role
+// from themselves; nobody can remove it from the last active admin.
+func (s *UserService) Update(actorID, id uint, input UpdateUserInput) (UserResponse, error) {
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return UserResponse{}, notFound(err, "User")
+    }
+
+    if input.Email != "" && input.Email != user.Email {
+        if err := s.checkEmailFree(input.Email, user.ID); err != nil {
+            return UserResponse{}, err
+        }
+        user.Email = input.Email
+    }
+    rolesChanged := false
+    if len(input.Roles) > 0 {
+        roles, err := s.resolveRoles(input.Roles)
+        if err != nil {
+            return UserResponse{}, err
+        }
+        if hasRole(user.Roles, model.RoleAdmin) && !hasRole(roles, model.RoleAdmin) {
+            if err := s.checkCanDemote(actorID, user); err != nil {
+                return UserResponse{}, err
+            }
+        }
+        rolesChanged = !sameRoles(user.Roles, roles)
+        user.Roles = roles
+    }
+
+    if err := s.repo.Update(&user); err != nil {
+        return UserResponse{}, err
+    }
+    if rolesChanged {
+        if err := s.tokenRepo.RevokeUser(user.ID, time.Now()); err != nil {
+            return UserResponse{}, err
+        }
+    }
+    return newUserResponse(user), nil
+}
+
+// checkCanDemote refuses to take the admin role from the acting admin or
+// from the last active admin.
+func (s *UserService) checkCanDemote(actorID uint, user model.User) error {
+    if actorID == user.ID {
+        return ErrCannotDemoteSelf
+    }
+    active := true
+    _, admins, err := s.repo.FindPage(repository.UserQuery{Role: model.RoleAdmin, Active: &active, Limit: 1})
+    if err != nil {
+        return err
+    }
+    if admins <= 1 && user.Active() {
+        return ErrLastAdmin
+    }
+    return nil
+}
+
+func hasRole(roles []model.Role, name string) bool {
+    for _, role := range roles {
+        if role.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+func sameRoles(a, b []model.Role) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for _, role := range a {
+        if !hasRole(b, role.Name) {
+            return false
+        }
+    }
+    return true
+}
+
+// Deactivate disables a user's account and ends all of their sessions.
+// actorID is the administrator making the request, who cannot lock
+// themselves out.
+func (s *UserService) Deactivate(actorID, id uint) (UserResponse, error) {
+    if actorID == id {
+        return UserResponse{}, ErrCannotDeactivateSelf
+    }
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return UserResponse{}, notFound(err, "User")
+    }
+    if !user.Active() {
+        return newUserResponse(user), nil
+    }
+
+    now := time.Now()
+    user.DeactivatedAt = &now
+    if err := s.repo.Update(&user); err != nil {
+        return UserResponse{}, err
+    }
+    if err := s.tokenRepo.RevokeUser(user.ID, now); err != nil {
+        return UserResponse{}, err
+    }
+    return newUserResponse(user), nil
+}
+
+func (s *UserService) Activate(id uint) (UserResponse, error) {
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return UserResponse{}, notFound(err, "User")
+    }
+    if user.Active() {
+        return newUserResponse(user), nil
+    }
+
+    user.DeactivatedAt = nil
+    if err := s.repo.Update(&user); err != nil {
+        return UserResponse{}, err
+    }
+    return newUserResponse(user), nil
+}
+
+// ResetPassword sets a new password and ends all of the user's sessions.
+func (s *UserService) ResetPassword(id uint, input ResetPasswordInput) error {
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return notFound(err, "User")
+    }
+    if err := ValidatePassword(input.Password, user.Email); err != nil {
+        return err
+    }
+
+    if user.Password, err = hashPassword(input.Password); err != nil {
+        return err
+    }
+    if err := s.repo.Update(&user); err != nil {
+        return err
+    }
+    return s.tokenRepo.RevokeUser(user.ID, time.Now())
+}
+
+// ResetTwoFactor turns a user's two-factor authentication off, for when
+// they lost their authenticator and recovery codes, and ends their sessions.
+// A role requiring it makes them enroll again on their next login.
+func (s *UserService) ResetTwoFactor(id uint) (UserResponse, error) {
+    user, err := s.repo.FindByID(id)
+    if err != nil {
+        return UserResponse{}, notFound(err, "User")
+    }
+    if err := clearTwoFactor(s.repo, &user); err != nil {
+        return UserResponse{}, err
+    }
+    if err := s.tokenRepo.RevokeUser(user.ID, time.Now()); err != nil {
+        return UserResponse{}, err
+    }
+    return newUserResponse(user), nil
+}
+
+func (s *UserService) ListRoles() ([]RoleResponse, error) {
+    roles, err := s.repo.ListRoles()
+    if err != nil {
+        return nil, err
+    }
+    responses := make([]RoleResponse, 0, len(roles))
+    for _, role := range roles {
+        responses = append(responses, newRoleResponse(role))
+    }
+    return responses, nil
+}
+
+// UpdateRole sets the two-factor policy of the named role. Turning it on
+// ends the sessions of holders who have not enrolled, so the policy applies
+// from their next login rather than when their refresh token runs out.
+func (s *UserService) UpdateRole(name string, input UpdateRoleInput) (RoleResponse, error) {
+    roles, err := s.repo.FindRoles([]string{name})
+    if err != nil {
+        return RoleResponse{}, err
+    }
+    if len(roles) == 0 {
+        return RoleResponse{}, &Error{Kind: KindNotFound, Code: "not_found", Message: "Role not found"}
+    }
+
+    role := roles[0]
+    enforce := *input.TwoFactorRequired && !role.TwoFactorRequired
+    role.TwoFactorRequired = *input.TwoFactorRequired
+    if err := s.repo.UpdateRole(&role); err != nil {
+        return RoleResponse{}, err
+    }
+    if enforce {
+        if err := s.revokeUnenrolled(role.Name); err != nil {
+            return RoleResponse{}, err
+        }
+    }
+    return newRoleResponse(role), nil
+}
+
+// revokeUnenrolled revokes the sessions of the role's holders without
+// two-factor authentication, a page of roleHolderBatchSize at a time.
+func (s *UserService) revokeUnenrolled(role string) error {
+    now := time.Now()
+    for offset := 0; ; offset += roleHolderBatchSize {
+        users, _, err := s.repo.FindPage(repository.UserQuery{Offset: offset, Limit: roleHolderBatchSize, Role: role})
+        if err != nil {
+            return err
+        }
+        for _, user := range users {
+            if user.TwoFactorEnabled() {
+                continue
+            }
+            if err := s.tokenRepo.RevokeUser(user.ID, now); err != nil {
+                return err
+            }
+        }
+        if len(users) < roleHolderBatchSize {
+            return nil
+        }
+    }
+}
+
+func (s *UserService) checkEmailFree(email string, ownerID uint) error {
+    existing, err := s.repo.FindByEmail(email)
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if existing.ID != ownerID {
+        return ErrEmailTaken
+    }
+    return nil
+}
+
+func (s *UserService) resolveRoles(names []string) ([]model.Role, error) {
+    unique := make([]string, 0, len(names))
+    seen := make(map[string]bool)
+    for _, name := range names {
+        if !seen[name] {
+            seen[name] = true
+            unique = append(unique, name)
+        }
+    }
+
+    roles, err := s.repo.FindRoles(unique)
+    if err != nil {
+        return nil, err
+    }
+    if len(roles) != len(unique) {
+        for _, role := range roles {
+            delete(seen, role.Name)
+        }
+        missing := make([]string, 0, len(seen))
+        for _, name := range unique {
+            if seen[name] {
+                missing = append(missing, name)
+            }
+        }
+        return nil, ErrUnknownRole.with("roles", strings.Join(missing, ", "))
+    }
+    return roles, nil
+}
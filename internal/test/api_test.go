@@ -0,0 +1,324 @@
+package test
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "golang.org/x/crypto/bcrypt"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/service"
+)
+
+func TestAPI_Login(t *testing.T) {
+    env := newTestEnv(t)
+
+    tests := []struct {
+        name       string
+        body       interface{}
+        wantStatus int
+    }{
+        {name: "valid credentials", body: service.LoginInput{Email: receptionistEmail, Password: seedPassword}, wantStatus: http.StatusOK},
+        {name: "wrong password", body: service.LoginInput{Email: receptionistEmail, Password: "nope"}, wantStatus: http.StatusUnauthorized},
+        {name: "invalid email", body: map[string]string{"email": "not-an-email", "password": "x"}, wantStatus: http.StatusBadRequest},
+        {name: "missing password", body: map[string]string{"email": receptionistEmail}, wantStatus: http.StatusBadRequest},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, http.MethodPost, "/login", "", tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+
+            if tt.wantStatus == http.StatusOK {
+                var resp struct {
+                    Token string               `json:"token"`
+                    User  service.UserResponse `json:"user"`
+                }
+                decodeJSON(t, w, &resp)
+                if resp.Token == "" || !reflect.DeepEqual(resp.User.Roles, []string{"receptionist"}) {
+                    t.Errorf("Unexpected login response: %s", w.Body.String())
+                }
+            }
+        })
+    }
+}
+
+func TestAPI_RefreshAndLogout(t *testing.T) {
+    env := newTestEnv(t)
+
+    w := env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: doctorEmail, Password: seedPassword})
+    var login service.TokenResponse
+    decodeJSON(t, w, &login)
+
+    w = env.do(t, http.MethodPost, "/auth/refresh", "", service.RefreshInput{RefreshToken: login.RefreshToken})
+    if w.Code != http.StatusOK {
+        t.Fatalf("Refresh status = %d: %s", w.Code, w.Body.String())
+    }
+    var refreshed service.TokenResponse
+    decodeJSON(t, w, &refreshed)
+
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        body       interface{}
+        wantStatus int
+    }{
+        {"refresh without body", http.MethodPost, "/auth/refresh", "", map[string]string{}, http.StatusBadRequest},
+        {"refresh with unknown token", http.MethodPost, "/auth/refresh", "", service.RefreshInput{RefreshToken: "nope"}, http.StatusUnauthorized},
+        {"refreshed access token works", http.MethodGet, "/api/patients", refreshed.Token, nil, http.StatusOK},
+        {"logout", http.MethodPost, "/auth/logout", "", service.RefreshInput{RefreshToken: refreshed.RefreshToken}, http.StatusNoContent},
+        {"access token revoked after logout", http.MethodGet, "/api/patients", refreshed.Token, nil, http.StatusUnauthorized},
+        {"refresh after logout", http.MethodPost, "/auth/refresh", "", service.RefreshInput{RefreshToken: refreshed.RefreshToken}, http.StatusUnauthorized},
+        {"logout without body", http.MethodPost, "/auth/logout", "", nil, http.StatusBadRequest},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, tt.method, tt.path, tt.token, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+}
+
+func TestAPI_AuthMiddleware(t *testing.T) {
+    env := newTestEnv(t)
+    receptionistToken := env.login(t, receptionistEmail)
+
+    tests := []struct {
+        name       string
+        header     string
+        wantStatus int
+    }{
+        {name: "missing header", header: "", wantStatus: http.StatusUnauthorized},
+        {name: "malformed header", header: "Token a b", wantStatus: http.StatusUnauthorized},
+        {name: "invalid token", header: "Bearer not-a-jwt", wantStatus: http.StatusUnauthorized},
+        {name: "bare token", header: receptionistToken, wantStatus: http.StatusOK},
+        {name: "bearer token", header: "Bearer " + receptionistToken, wantStatus: http.StatusOK},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest(http.MethodGet, "/api/patients", nil)
+            if tt.header != "" {
+                req.Header.Set("Authorization", tt.header)
+            }
+            w := httptest.NewRecorder()
+            env.Router.ServeHTTP(w, req)
+
+            if w.Code != tt.wantStatus {
+                t.Errorf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+}
+
+func TestAPI_PatientRoutes(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+
+    patientPath := fmt.Sprintf("/patients/%d", patient.ID)
+    create := service.CreatePatientInput{
+        FirstName:   "John",
+        LastName:    "Doe",
+        DateOfBirth: "1990-01-01T00:00:00Z",
+        Gender:      "Male",
+    }
+
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        body       interface{}
+        wantStatus int
+    }{
+        {"receptionist creates", http.MethodPost, "/api/patients", receptionist, create, http.StatusCreated},
+        {"receptionist create invalid body", http.MethodPost, "/api/patients", receptionist, map[string]string{"first_name": "x"}, http.StatusBadRequest},
+        {"receptionist create invalid gender", http.MethodPost, "/api/patients", receptionist, map[string]string{"first_name": "a", "last_name": "b", "date_of_birth": "1990-01-01T00:00:00Z", "gender": "X"}, http.StatusBadRequest},
+        {"receptionist lists", http.MethodGet, "/api/patients", receptionist, nil, http.StatusOK},
+        {"receptionist lists filtered page", http.MethodGet, "/api/patients?page=1&limit=5&sort=name&order=desc&gender=Female&dob_from=1990-01-01&name=ja", receptionist, nil, http.StatusOK},
+        {"receptionist list limit too large", http.MethodGet, "/api/patients?limit=1000", receptionist, nil, http.StatusBadRequest},
+        {"receptionist list unknown sort", http.MethodGet, "/api/patients?sort=contact", receptionist, nil, http.StatusBadRequest},
+        {"receptionist list invalid dob", http.MethodGet, "/api/patients?dob_to=01-02-1990", receptionist, nil, http.StatusBadRequest},
+        {"receptionist gets", http.MethodGet, "/api" + patientPath, receptionist, nil, http.StatusOK},
+        {"receptionist get invalid id", http.MethodGet, "/api/patients/abc", receptionist, nil, http.StatusBadRequest},
+        {"receptionist get unknown", http.MethodGet, "/api/patients/9999", receptionist, nil, http.StatusNotFound},
+        {"receptionist updates", http.MethodPut, "/api" + patientPath, receptionist, service.UpdatePatientInput{Contact: "123"}, http.StatusOK},
+        {"receptionist update unknown", http.MethodPut, "/api/patients/9999", receptionist, service.UpdatePatientInput{Contact: "123"}, http.StatusNotFound},
+        {"doctor lists", http.MethodGet, "/api/patients", doctor, nil, http.StatusOK},
+        {"doctor gets", http.MethodGet, "/api" + patientPath, doctor, nil, http.StatusOK},
+        {"doctor adds history", http.MethodPost, "/api" + patientPath + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "diagnosis", Description: "Asthma"}, http.StatusCreated},
+        {"doctor history missing body", http.MethodPost, "/api" + patientPath + "/medical-history", doctor, map[string]string{}, http.StatusBadRequest},
+        {"doctor history unknown kind", http.MethodPost, "/api" + patientPath + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "rumour", Description: "x"}, http.StatusBadRequest},
+        {"doctor history unknown patient", http.MethodPost, "/api/patients/9999/medical-history", doctor, service.MedicalHistoryInput{Kind: "note", Description: "x"}, http.StatusNotFound},
+        {"doctor lists history", http.MethodGet, "/api" + patientPath + "/medical-history", doctor, nil, http.StatusOK},
+        {"receptionist lists history", http.MethodGet, "/api" + patientPath + "/medical-history", receptionist, nil, http.StatusOK},
+        {"history of unknown patient", http.MethodGet, "/api/patients/9999/medical-history", receptionist, nil, http.StatusNotFound},
+        {"history can no longer be overwritten", http.MethodPut, "/api" + patientPath + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "note", Description: "x"}, http.StatusNotFound},
+        {"doctor cannot create", http.MethodPost, "/api/patients", doctor, create, http.StatusForbidden},
+        {"doctor cannot delete", http.MethodDelete, "/api" + patientPath, doctor, nil, http.StatusForbidden},
+        {"receptionist cannot add history", http.MethodPost, "/api" + patientPath + "/medical-history", receptionist, service.MedicalHistoryInput{Kind: "note", Description: "x"}, http.StatusForbidden},
+        {"doctor cannot update details", http.MethodPut, "/api" + patientPath, doctor, service.UpdatePatientInput{Contact: "123"}, http.StatusForbidden},
+        {"old role routes are gone", http.MethodGet, "/api/doctor/patients", doctor, nil, http.StatusNotFound},
+        {"anonymous list", http.MethodGet, "/api/patients", "", nil, http.StatusUnauthorized},
+        {"anonymous doctor get", http.MethodGet, "/api" + patientPath, "", nil, http.StatusUnauthorized},
+        {"receptionist deletes", http.MethodDelete, "/api" + patientPath, receptionist, nil, http.StatusNoContent},
+        {"deleted patient is gone", http.MethodGet, "/api" + patientPath, doctor, nil, http.StatusNotFound},
+    }
+
+    // Cases run in order against one database; later cases depend on earlier
+    // ones. Updates match any version; TestAPI_PatientETag covers If-Match.
+    anyVersion := map[string]string{"If-Match": "*"}
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, tt.method, tt.path, tt.token, anyVersion, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+}
+
+func TestAPI_PatientResponses(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+
+    w := env.do(t, http.MethodPost, "/api/patients", receptionist, service.CreatePatientInput{
+        FirstName:   "John",
+        LastName:    "Doe",
+        DateOfBirth: "1990-01-01T00:00:00Z",
+        Gender:      "Male",
+        Contact:     "1234567890",
+    })
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Create status = %d: %s", w.Code, w.Body.String())
+    }
+    var created service.PatientResponse
+    decodeJSON(t, w, &created)
+
+    path := fmt.Sprintf("/api/patients/%d", created.ID)
+    w = env.do(t, http.MethodPost, path+"/medical-history", doctor, service.MedicalHistoryInput{Kind: "allergy", Description: "Penicillin"})
+    if w.Code != http.StatusCreated {
+        t.Fatalf("History status = %d: %s", w.Code, w.Body.String())
+    }
+
+    w = env.do(t, http.MethodGet, path, doctor, nil)
+    var got service.PatientResponse
+    decodeJSON(t, w, &got)
+    if len(got.MedicalHistory) != 1 || got.MedicalHistory[0].Kind != "allergy" || got.MedicalHistory[0].Description != "Penicillin" ||
+        got.MedicalHistory[0].AuthorID == nil || got.Contact != "1234567890" || got.DateOfBirth != "1990-01-01T00:00:00Z" {
+        t.Errorf("Unexpected patient: %+v", got)
+    }
+
+    w = env.do(t, http.MethodGet, "/api/patients", receptionist, nil)
+    var list service.PatientListResponse
+    decodeJSON(t, w, &list)
+    if len(list.Data) != 1 || list.Data[0].ID != created.ID || list.Meta.Total != 1 {
+        t.Errorf("Unexpected patient list: %+v", list)
+    }
+}
+
+
+func TestAPI_PatientETag(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    token := env.login(t, receptionistEmail)
+    path := fmt.Sprintf("/api/patients/%d", patient.ID)
+
+    w := env.do(t, http.MethodGet, path, token, nil)
+    if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+        t.Fatalf("GET: status %d, ETag %q", w.Code, w.Header().Get("ETag"))
+    }
+
+    tests := []struct {
+        name       string
+        ifMatch    string
+        body       service.UpdatePatientInput
+        wantStatus int
+        wantETag   string
+    }{
+        {"current version", `"1"`, service.UpdatePatientInput{Contact: "555"}, http.StatusOK, `"2"`},
+        {"stale version", `"1"`, service.UpdatePatientInput{Address: "1 Oak Ave"}, http.StatusPreconditionFailed, ""},
+        {"weak tag never matches", `W/"2"`, service.UpdatePatientInput{Address: "1 Oak Ave"}, http.StatusPreconditionFailed, ""},
+        {"malformed", "2", service.UpdatePatientInput{Address: "1 Oak Ave"}, http.StatusPreconditionFailed, ""},
+        {"any version", "*", service.UpdatePatientInput{Address: "1 Oak Ave"}, http.StatusOK, `"3"`},
+        {"no header", "", service.UpdatePatientInput{Gender: "Other"}, http.StatusPreconditionRequired, ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, http.MethodPut, path, token, map[string]string{"If-Match": tt.ifMatch}, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if got := w.Header().Get("ETag"); got != tt.wantETag {
+                t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+            }
+        })
+    }
+
+    var stored service.PatientResponse
+    decodeJSON(t, env.do(t, http.MethodGet, path, token, nil), &stored)
+    if stored.Contact != "555" || stored.Address != "1 Oak Ave" || stored.Gender != "Female" || stored.Version != 3 {
+        t.Errorf("Unexpected patient: %+v", stored)
+    }
+
+    // The history is part of the representation, so adding to it changes the
+    // ETag and an update based on the old one is refused.
+    doctor := env.login(t, doctorEmail)
+    if w := env.do(t, http.MethodPost, path+"/medical-history", doctor, service.MedicalHistoryInput{Kind: "note", Description: "Seen"}); w.Code != http.StatusCreated {
+        t.Fatalf("Add history: status %d: %s", w.Code, w.Body.String())
+    }
+    if w := env.do(t, http.MethodGet, path, token, nil); w.Header().Get("ETag") != `"4"` {
+        t.Errorf("ETag after adding history = %q, want %q", w.Header().Get("ETag"), `"4"`)
+    }
+    if w := env.doWithHeaders(t, http.MethodPut, path, token, map[string]string{"If-Match": `"3"`}, service.UpdatePatientInput{Contact: "556"}); w.Code != http.StatusPreconditionFailed {
+        t.Errorf("Update with pre-history ETag: status %d, want %d", w.Code, http.StatusPreconditionFailed)
+    }
+}
+
+func TestAPI_MultiRoleUser(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+
+    var roles []model.Role
+    if err := env.DB.Where("name IN ?", []string{model.RoleReceptionist, model.RoleDoctor}).Find(&roles).Error; err != nil || len(roles) != 2 {
+        t.Fatalf("Failed to load seeded roles: %v", err)
+    }
+    hash, _ := bcrypt.GenerateFromPassword([]byte(seedPassword), bcrypt.MinCost)
+    if err := env.DB.Create(&model.User{Email: "both@example.com", Password: string(hash), Roles: roles}).Error; err != nil {
+        t.Fatalf("Failed to create user: %v", err)
+    }
+    token := env.login(t, "both@example.com")
+
+    path := fmt.Sprintf("/api/patients/%d", patient.ID)
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        body       interface{}
+        wantStatus int
+    }{
+        {"reads", http.MethodGet, path, nil, http.StatusOK},
+        {"updates details", http.MethodPut, path, service.UpdatePatientInput{Contact: "555"}, http.StatusOK},
+        {"adds history", http.MethodPost, path + "/medical-history", service.MedicalHistoryInput{Kind: "diagnosis", Description: "Asthma"}, http.StatusCreated},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if w := env.doWithHeaders(t, tt.method, tt.path, token, map[string]string{"If-Match": "*"}, tt.body); w.Code != tt.wantStatus {
+                t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+}
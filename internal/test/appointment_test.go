@@ -0,0 +1,237 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestAppointmentService(t *testing.T) {
+    db := newTestDB(t)
+    // Run against both stores so the in-memory store stays a faithful fake.
+    stores := map[string]struct {
+        appointments repository.AppointmentStore
+        patients     repository.PatientStore
+        users        repository.UserStore
+        tokens       repository.RefreshTokenStore
+    }{
+        "gorm": {repository.NewAppointmentRepository(db), repository.NewPatientRepository(db), repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryAppointmentRepository(), repository.NewMemoryPatientRepository(), repository.NewMemoryUserRepository(),
+            repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    // Whole hours tomorrow, so every test time is in the future.
+    base := time.Now().UTC().Truncate(time.Hour).Add(24 * time.Hour)
+    at := func(hour, minute int) time.Time {
+        return base.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            users := service.NewUserService(store.users, store.tokens)
+            newUser := func(email, role string) uint {
+                user, err := users.Create(service.CreateUserInput{Email: email, Password: strongPassword, Roles: []string{role}})
+                if err != nil {
+                    t.Fatalf("Failed to create %s: %v", role, err)
+                }
+                return user.ID
+            }
+            doctor := newUser("house@example.com", model.RoleDoctor)
+            otherDoctor := newUser("wilson@example.com", model.RoleDoctor)
+            receptionist := newUser("front@example.com", model.RoleReceptionist)
+
+            patient, err := newPatientService(store.patients).Create(0, service.CreatePatientInput{
+                FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female",
+            })
+            if err != nil {
+                t.Fatalf("Failed to create patient: %v", err)
+            }
+
+            svc := service.NewAppointmentService(store.appointments, store.patients, store.users)
+            book := func(doctorID uint, startsAt, endsAt time.Time) (service.AppointmentResponse, error) {
+                return svc.Book(service.BookAppointmentInput{PatientID: patient.ID, DoctorID: doctorID, StartsAt: startsAt, EndsAt: endsAt, Reason: "Checkup"})
+            }
+
+            first, err := book(doctor, at(9, 0), at(9, 30))
+            if err != nil {
+                t.Fatalf("Failed to book appointment: %v", err)
+            }
+            if first.Status != model.AppointmentScheduled || first.StartsAt != at(9, 0).Format(time.RFC3339) || first.DoctorID != doctor {
+                t.Errorf("Unexpected appointment: %+v", first)
+            }
+
+            rejected := []struct {
+                name     string
+                doctorID uint
+                startsAt time.Time
+                endsAt   time.Time
+                want     error
+            }{
+                {"overlaps the end", doctor, at(9, 15), at(9, 45), service.ErrAppointmentOverlap},
+                {"contains another", doctor, at(8, 0), at(10, 0), service.ErrAppointmentOverlap},
+                {"ends before it starts", doctor, at(11, 0), at(10, 0), service.ErrInvalidAppointment},
+                {"too long", doctor, at(11, 0), at(20, 0), service.ErrInvalidAppointment},
+                {"in the past", doctor, time.Now().Add(-time.Hour), time.Now().Add(-30 * time.Minute), service.ErrInvalidAppointment},
+                {"not a doctor", receptionist, at(9, 0), at(9, 30), service.ErrNotADoctor},
+                {"unknown doctor", 9999, at(9, 0), at(9, 30), service.ErrNotADoctor},
+            }
+            for _, tt := range rejected {
+                if _, err := book(tt.doctorID, tt.startsAt, tt.endsAt); !errors.Is(err, tt.want) {
+                    t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+                }
+            }
+            if _, err := svc.Book(service.BookAppointmentInput{PatientID: 9999, DoctorID: doctor, StartsAt: at(12, 0), EndsAt: at(12, 30)}); !errors.Is(err, service.ErrUnknownPatient) {
+                t.Errorf("Expected ErrUnknownPatient, got %v", err)
+            }
+
+            // Back to back is fine, and other doctors are unaffected.
+            second, err := book(doctor, at(9, 30), at(10, 0))
+            if err != nil {
+                t.Fatalf("Failed to book adjacent appointment: %v", err)
+            }
+            if _, err := book(otherDoctor, at(9, 0), at(9, 30)); err != nil {
+                t.Fatalf("Failed to book another doctor: %v", err)
+            }
+
+            // Rescheduling ignores the appointment itself but not its neighbours.
+            if _, err := svc.Reschedule(first.ID, service.RescheduleAppointmentInput{StartsAt: at(8, 45), EndsAt: at(9, 15)}); err != nil {
+                t.Errorf("Failed to reschedule into its own slot: %v", err)
+            }
+            if _, err := svc.Reschedule(first.ID, service.RescheduleAppointmentInput{StartsAt: at(9, 15), EndsAt: at(9, 45)}); !errors.Is(err, service.ErrAppointmentOverlap) {
+                t.Errorf("Expected ErrAppointmentOverlap, got %v", err)
+            }
+            if _, err := svc.Reschedule(9999, service.RescheduleAppointmentInput{StartsAt: at(9, 0), EndsAt: at(9, 30)}); !errors.Is(err, gorm.ErrRecordNotFound) {
+                t.Errorf("Expected gorm.ErrRecordNotFound, got %v", err)
+            }
+
+            // Cancelling frees the slot and locks the appointment.
+            cancelled, err := svc.Cancel(second.ID, service.CancelAppointmentInput{Reason: "Patient unwell"})
+            if err != nil {
+                t.Fatalf("Failed to cancel: %v", err)
+            }
+            if cancelled.Status != model.AppointmentCancelled || cancelled.CancellationReason != "Patient unwell" {
+                t.Errorf("Unexpected cancelled appointment: %+v", cancelled)
+            }
+            if _, err := svc.Cancel(second.ID, service.CancelAppointmentInput{}); !errors.Is(err, service.ErrAppointmentNotScheduled) {
+                t.Errorf("Expected ErrAppointmentNotScheduled, got %v", err)
+            }
+            if _, err := svc.Reschedule(second.ID, service.RescheduleAppointmentInput{StartsAt: at(14, 0), EndsAt: at(14, 30)}); !errors.Is(err, service.ErrAppointmentNotScheduled) {
+                t.Errorf("Expected ErrAppointmentNotScheduled, got %v", err)
+            }
+            third, err := book(doctor, at(9, 30), at(10, 0))
+            if err != nil {
+                t.Fatalf("Failed to book a cancelled slot: %v", err)
+            }
+
+            upcoming, err := svc.Upcoming(doctor, service.ListUpcomingInput{})
+            if err != nil {
+                t.Fatalf("Failed to list upcoming appointments: %v", err)
+            }
+            if got := appointmentIDs(upcoming.Data); fmt.Sprint(got) != fmt.Sprint([]uint{first.ID, third.ID}) || upcoming.Meta.Total != 2 {
+                t.Errorf("Upcoming = %v, want [%d %d]", got, first.ID, third.ID)
+            }
+
+            lists := []struct {
+                input service.ListAppointmentsInput
+                want  int64
+            }{
+                {service.ListAppointmentsInput{}, 4},
+                {service.ListAppointmentsInput{DoctorID: doctor}, 3},
+                {service.ListAppointmentsInput{PatientID: patient.ID, Status: model.AppointmentCancelled}, 1},
+                {service.ListAppointmentsInput{From: at(9, 30), To: at(10, 0)}, 2},
+                {service.ListAppointmentsInput{From: at(10, 0)}, 0},
+            }
+            for _, tt := range lists {
+                list, err := svc.List(tt.input)
+                if err != nil {
+                    t.Fatalf("Failed to list appointments: %v", err)
+                }
+                if list.Meta.Total != tt.want || int64(len(list.Data)) != tt.want {
+                    t.Errorf("List(%+v) returned %d of %d appointments, want %d", tt.input, len(list.Data), list.Meta.Total, tt.want)
+                }
+            }
+        })
+    }
+}
+
+func appointmentIDs(appointments []service.AppointmentResponse) []uint {
+    ids := make([]uint, 0, len(appointments))
+    for _, appointment := range appointments {
+        ids = append(ids, appointment.ID)
+    }
+    return ids
+}
+
+func TestAPI_Appointments(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    doctorUser, err := repository.NewUserRepository(env.DB).FindByEmail(doctorEmail)
+    if err != nil {
+        t.Fatalf("Failed to find doctor: %v", err)
+    }
+    startsAt := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+    booking := map[string]interface{}{
+        "patient_id": patient.ID,
+        "doctor_id":  doctorUser.ID,
+        "starts_at":  startsAt.Format(time.RFC3339),
+        "ends_at":    startsAt.Add(30 * time.Minute).Format(time.RFC3339),
+    }
+
+    w := env.do(t, http.MethodPost, "/api/appointments", receptionist, booking)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+    }
+    var booked service.AppointmentResponse
+    decodeJSON(t, w, &booked)
+    path := fmt.Sprintf("/api/appointments/%d", booked.ID)
+
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        body       interface{}
+        wantStatus int
+    }{
+        {"double booking", http.MethodPost, "/api/appointments", receptionist, booking, http.StatusConflict},
+        {"doctor cannot book", http.MethodPost, "/api/appointments", doctor, booking, http.StatusForbidden},
+        {"missing times", http.MethodPost, "/api/appointments", receptionist, map[string]interface{}{"patient_id": patient.ID, "doctor_id": doctorUser.ID}, http.StatusBadRequest},
+        {"receptionist get", http.MethodGet, path, receptionist, nil, http.StatusOK},
+        {"unknown appointment", http.MethodGet, "/api/appointments/9999", receptionist, nil, http.StatusNotFound},
+        {"receptionist list", http.MethodGet, "/api/appointments?status=scheduled", receptionist, nil, http.StatusOK},
+        {"bad status filter", http.MethodGet, "/api/appointments?status=done", receptionist, nil, http.StatusBadRequest},
+        {"admin cannot list", http.MethodGet, "/api/appointments", admin, nil, http.StatusForbidden},
+        {"receptionist has no own appointments", http.MethodGet, "/api/appointments/mine", receptionist, nil, http.StatusForbidden},
+        {"doctor own appointments", http.MethodGet, "/api/appointments/mine", doctor, nil, http.StatusOK},
+        {"reschedule", http.MethodPut, path, receptionist, map[string]interface{}{"starts_at": startsAt.Add(time.Hour).Format(time.RFC3339), "ends_at": startsAt.Add(90 * time.Minute).Format(time.RFC3339)}, http.StatusOK},
+        {"cancel without reason", http.MethodPost, path + "/cancel", receptionist, nil, http.StatusOK},
+        {"cancel twice", http.MethodPost, path + "/cancel", receptionist, map[string]interface{}{"reason": "again"}, http.StatusConflict},
+        {"anonymous", http.MethodGet, "/api/appointments", "", nil, http.StatusUnauthorized},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, tt.method, tt.path, tt.token, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+
+    w = env.do(t, http.MethodGet, "/api/appointments/mine", doctor, nil)
+    var mine service.AppointmentListResponse
+    decodeJSON(t, w, &mine)
+    if len(mine.Data) != 0 {
+        t.Errorf("Cancelled appointments should not be upcoming: %s", w.Body.String())
+    }
+}
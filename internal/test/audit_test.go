@@ -0,0 +1,230 @@
+package test
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "reflect"
+    "testing"
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestAuditService(t *testing.T) {
+    // Run against both stores so the in-memory store stays a faithful fake.
+    stores := map[string]repository.AuditStore{
+        "gorm":   repository.NewAuditLogRepository(newTestDB(t)),
+        "memory": repository.NewMemoryAuditLogRepository(),
+    }
+
+    before := service.PatientResponse{ID: 1, FirstName: "Jane", Contact: "111", Address: "1 Elm St"}
+    after := before
+    after.Contact = "222"
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            svc := service.NewAuditService(store)
+            start := time.Now().Add(-time.Second)
+
+            records := []func() error{
+                func() error { return svc.Record(10, model.AuditPatientCreate, 1, nil, before) },
+                func() error { return svc.Record(20, model.AuditPatientRead, 1, nil, nil) },
+                func() error { return svc.Record(10, model.AuditPatientUpdate, 1, before, after) },
+                func() error { return svc.RecordViews(20, model.AuditPatientList, []uint{1, 2}) },
+                func() error { return svc.Record(20, model.AuditPatientDelete, 2, service.PatientResponse{ID: 2}, nil) },
+            }
+            for _, record := range records {
+                if err := record(); err != nil {
+                    t.Fatalf("Failed to record: %v", err)
+                }
+            }
+
+            all, err := svc.List(service.ListAuditLogsInput{})
+            if err != nil {
+                t.Fatalf("Failed to list: %v", err)
+            }
+            var actions []string
+            for _, entry := range all.Data {
+                actions = append(actions, entry.Action)
+            }
+            want := []string{"patient.delete", "patient.list", "patient.list", "patient.update", "patient.read", "patient.create"}
+            if all.Meta.Total != 6 || len(actions) != 6 || actions[0] != want[0] || actions[5] != want[5] || !reflect.DeepEqual(sorted(actions), sorted(want)) {
+                t.Errorf("Actions = %v (total %d), want newest first %v", actions, all.Meta.Total, want)
+            }
+
+            updates, _ := svc.List(service.ListAuditLogsInput{UserID: 10, PatientID: 1, Limit: 1})
+            wantChanges := map[string]service.FieldChange{"contact": {Before: "111", After: "222"}}
+            if len(updates.Data) != 1 || updates.Data[0].Action != "patient.update" || !reflect.DeepEqual(updates.Data[0].Changes, wantChanges) {
+                t.Errorf("Unexpected update entry: %+v", updates.Data)
+            }
+            if updates.Meta.Total != 2 || updates.Meta.TotalPages != 2 {
+                t.Errorf("Unexpected meta: %+v", updates.Meta)
+            }
+
+            created, _ := svc.List(service.ListAuditLogsInput{UserID: 10, Page: 2, Limit: 1})
+            if len(created.Data) != 1 || created.Data[0].Changes["first_name"] != (service.FieldChange{After: "Jane"}) {
+                t.Errorf("Unexpected create entry: %+v", created.Data)
+            }
+
+            deleted, _ := svc.List(service.ListAuditLogsInput{PatientID: 2, UserID: 20})
+            if deleted.Meta.Total != 2 || deleted.Data[0].Changes["id"] != (service.FieldChange{Before: float64(2)}) {
+                t.Errorf("Unexpected entries for patient 2: %+v", deleted.Data)
+            }
+
+            if inRange, _ := svc.List(service.ListAuditLogsInput{From: start, To: time.Now().Add(time.Second)}); inRange.Meta.Total != 6 {
+                t.Errorf("Got %d entries in range, want 6", inRange.Meta.Total)
+            }
+            if future, _ := svc.List(service.ListAuditLogsInput{From: time.Now().Add(time.Hour)}); future.Meta.Total != 0 {
+                t.Errorf("Got %d entries from the future, want 0", future.Meta.Total)
+            }
+
+            // Erasing patient 1 keeps their entries but not their diffs.
+            if err := store.Erase(1); err != nil {
+                t.Fatalf("Failed to erase: %v", err)
+            }
+            erased, _ := svc.List(service.ListAuditLogsInput{PatientID: 1, UserID: 10})
+            for _, entry := range erased.Data {
+                if entry.Changes != nil || !entry.ChangesErased {
+                    t.Errorf("Entry %d not erased: %+v", entry.ID, entry)
+                }
+            }
+            if erased.Meta.Total != 2 {
+                t.Errorf("Got %d entries after erasing, want 2", erased.Meta.Total)
+            }
+            if kept, _ := svc.List(service.ListAuditLogsInput{PatientID: 2, UserID: 20}); kept.Data[0].ChangesErased || kept.Data[0].Changes == nil {
+                t.Errorf("Entry of another patient lost its diff: %+v", kept.Data[0])
+            }
+        })
+    }
+}
+
+func TestAuditLog_AppendOnly(t *testing.T) {
+    db := newTestDB(t)
+    entry := []model.AuditLog{{UserID: 1, Action: model.AuditPatientRead, PatientID: 1}}
+    if err := repository.NewAuditLogRepository(db).Create(entry); err != nil {
+        t.Fatalf("Failed to create entry: %v", err)
+    }
+
+    if err := db.Model(&model.AuditLog{}).Where("id = ?", entry[0].ID).Update("action", "patient.update").Error; err == nil {
+        t.Error("Expected updating an audit entry to fail")
+    }
+    if err := db.Delete(&model.AuditLog{}, entry[0].ID).Error; err == nil {
+        t.Error("Expected deleting an audit entry to fail")
+    }
+}
+
+// Writes and their audit entries share a transaction: a write that cannot
+// be audited is not kept.
+func TestAPI_WriteRolledBackWhenAuditFails(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    if err := env.DB.Exec("DROP TABLE audit_logs").Error; err != nil {
+        t.Fatalf("Failed to drop audit table: %v", err)
+    }
+
+    path := fmt.Sprintf("/api/patients/%d", patient.ID)
+    steps := []struct {
+        method string
+        path   string
+        token  string
+        body   interface{}
+    }{
+        {http.MethodPost, "/api/patients", receptionist, service.CreatePatientInput{FirstName: "John", LastName: "Doe", DateOfBirth: "1990-01-01T00:00:00Z", Gender: "Male"}},
+        {http.MethodPut, path, receptionist, service.UpdatePatientInput{Contact: "555"}},
+        {http.MethodPost, path + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "note", Description: "Seen today"}},
+        {http.MethodDelete, path, receptionist, nil},
+    }
+    for _, step := range steps {
+        if w := env.doWithHeaders(t, step.method, step.path, step.token, map[string]string{"If-Match": "*"}, step.body); w.Code != http.StatusInternalServerError {
+            t.Errorf("%s %s status = %d, want 500: %s", step.method, step.path, w.Code, w.Body.String())
+        }
+    }
+
+    var patients []model.Patient
+    if err := env.DB.Unscoped().Find(&patients).Error; err != nil {
+        t.Fatalf("Failed to load patients: %v", err)
+    }
+    if len(patients) != 1 || patients[0].Contact != patient.Contact || patients[0].Version != patient.Version || patients[0].DeletedAt.Valid {
+        t.Errorf("Unaudited writes were kept: %+v", patients)
+    }
+    var entries int64
+    env.DB.Model(&model.MedicalHistoryEntry{}).Count(&entries)
+    if entries != 0 {
+        t.Errorf("Got %d history entries, want 0", entries)
+    }
+}
+
+func TestAPI_AuditLog(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    w := env.do(t, http.MethodPost, "/api/patients", receptionist, service.CreatePatientInput{
+        FirstName: "John", LastName: "Doe", DateOfBirth: "1990-01-01T00:00:00Z", Gender: "Male",
+    })
+    var patient service.PatientResponse
+    decodeJSON(t, w, &patient)
+    path := fmt.Sprintf("/api/patients/%d", patient.ID)
+
+    steps := []struct {
+        method string
+        path   string
+        token  string
+        body   interface{}
+    }{
+        {http.MethodGet, path, doctor, nil},
+        {http.MethodPost, path + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "note", Description: "Seen today"}},
+        {http.MethodGet, "/api/patients/search?q=john", doctor, nil},
+        {http.MethodPut, path, receptionist, service.UpdatePatientInput{Contact: "555"}},
+        {http.MethodGet, "/api/patients", receptionist, nil},
+        {http.MethodDelete, path, receptionist, nil},
+        {http.MethodGet, path, doctor, nil}, // not found: not audited
+    }
+    for _, step := range steps {
+        env.doWithHeaders(t, step.method, step.path, step.token, map[string]string{"If-Match": "*"}, step.body)
+    }
+
+    query := func(token string, params url.Values) (int, service.AuditLogListResponse) {
+        w := env.do(t, http.MethodGet, "/api/admin/audit-logs?"+params.Encode(), token, nil)
+        var logs service.AuditLogListResponse
+        if w.Code == http.StatusOK {
+            decodeJSON(t, w, &logs)
+        }
+        return w.Code, logs
+    }
+
+    if code, _ := query(receptionist, nil); code != http.StatusForbidden {
+        t.Errorf("Receptionist audit query status = %d, want 403", code)
+    }
+    if code, _ := query(admin, url.Values{"from": {"yesterday"}}); code != http.StatusBadRequest {
+        t.Errorf("Invalid from status = %d, want 400", code)
+    }
+
+    code, logs := query(admin, url.Values{"patient_id": {fmt.Sprint(patient.ID)}})
+    if code != http.StatusOK {
+        t.Fatalf("Audit query status = %d", code)
+    }
+    var actions []string
+    for _, entry := range logs.Data {
+        actions = append(actions, entry.Action)
+    }
+    want := []string{"patient.delete", "patient.list", "patient.update", "patient.search", "medical_history.add", "patient.read", "patient.create"}
+    if !reflect.DeepEqual(actions, want) {
+        t.Errorf("Actions = %v, want %v", actions, want)
+    }
+    wantUpdate := map[string]service.FieldChange{"contact": {Before: "", After: "555"}, "version": {Before: float64(2), After: float64(3)}}
+    if update := logs.Data[2]; !reflect.DeepEqual(update.Changes, wantUpdate) {
+        t.Errorf("Unexpected update diff: %+v", update.Changes)
+    }
+
+    doctorID := fmt.Sprint(logs.Data[len(logs.Data)-2].UserID)
+    _, byDoctor := query(admin, url.Values{"user_id": {doctorID}, "to": {time.Now().Add(time.Minute).Format(time.RFC3339)}})
+    if byDoctor.Meta.Total != 3 {
+        t.Errorf("Got %d doctor entries, want 3: %+v", byDoctor.Meta.Total, byDoctor.Data)
+    }
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "testing"
+    "time"
+    "github.com/golang-jwt/jwt/v4"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestAuthService_Login(t *testing.T) {
+    env := newTestEnv(t)
+
+    tests := []struct {
+        name            string
+        input           service.LoginInput
+        wantRoles       []string
+        wantPermissions []string
+        wantErr         bool
+    }{
+        {
+            name:            "receptionist",
+            input:           service.LoginInput{Email: receptionistEmail, Password: seedPassword},
+            wantRoles:       []string{"receptionist"},
+            wantPermissions: []string{"appointment:read", "appointment:write", "patient:read", "patient:write"},
+        },
+        {
+            name:            "doctor",
+            input:           service.LoginInput{Email: doctorEmail, Password: seedPassword},
+            wantRoles:       []string{"doctor"},
+            wantPermissions: []string{"appointment:attend", "medical_history:write", "patient:read"},
+        },
+        {name: "wrong password", input: service.LoginInput{Email: doctorEmail, Password: "wrong"}, wantErr: true},
+        {name: "unknown email", input: service.LoginInput{Email: "nobody@example.com", Password: seedPassword}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tokens, err := env.AuthService.Login(tt.input)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                if tokens.Token != "" || tokens.RefreshToken != "" {
+                    t.Error("Expected no tokens on failed login")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to log in: %v", err)
+            }
+
+            user := tokens.User
+            if user.Email != tt.input.Email || user.ID == 0 || !reflect.DeepEqual(user.Roles, tt.wantRoles) ||
+                !reflect.DeepEqual(user.Permissions, tt.wantPermissions) {
+                t.Errorf("Unexpected user: %+v", user)
+            }
+            if tokens.RefreshToken == "" || tokens.ExpiresIn != int64(service.DefaultAuthConfig().AccessTokenTTL.Seconds()) {
+                t.Errorf("Unexpected token response: %+v", tokens)
+            }
+
+            claims, err := env.AuthService.ValidateToken(tokens.Token)
+            if err != nil {
+                t.Fatalf("Issued token does not validate: %v", err)
+            }
+            if fmt.Sprint(claims["roles"]) != fmt.Sprint(tt.wantRoles) || fmt.Sprint(claims["permissions"]) != fmt.Sprint(tt.wantPermissions) {
+                t.Errorf("Token claims roles=%v permissions=%v, want %v %v", claims["roles"], claims["permissions"], tt.wantRoles, tt.wantPermissions)
+            }
+        })
+    }
+}
+
+func TestAuthService_ValidateToken(t *testing.T) {
+    env := newTestEnv(t)
+    valid := env.login(t, receptionistEmail)
+
+    sign := func(secret string, claims jwt.MapClaims) string {
+        token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+        if err != nil {
+            t.Fatalf("Failed to sign test token: %v", err)
+        }
+        return token
+    }
+
+    tests := []struct {
+        name    string
+        token   string
+        wantErr bool
+    }{
+        {name: "issued by login", token: valid},
+        {name: "malformed", token: "not-a-jwt", wantErr: true},
+        {
+            name:    "wrong signature",
+            token:   sign("some-other-secret", jwt.MapClaims{"user_id": 1, "permissions": []string{"patient:read"}, "exp": time.Now().Add(time.Hour).Unix()}),
+            wantErr: true,
+        },
+        {
+            name:    "expired",
+            token:   sign(testJWTSecret, jwt.MapClaims{"user_id": 1, "permissions": []string{"patient:read"}, "exp": time.Now().Add(-time.Hour).Unix()}),
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            claims, err := env.AuthService.ValidateToken(tt.token)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("Expected an error, got claims %v", claims)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to validate token: %v", err)
+            }
+            if claims["user_id"] == nil {
+                t.Error("Expected user_id claim")
+            }
+        })
+    }
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+    env := newTestEnv(t)
+    login := func() service.TokenResponse {
+        tokens, err := env.AuthService.Login(service.LoginInput{Email: doctorEmail, Password: seedPassword})
+        if err != nil {
+            t.Fatalf("Failed to log in: %v", err)
+        }
+        return tokens
+    }
+
+    t.Run("rotates the refresh token", func(t *testing.T) {
+        first := login()
+        second, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: first.RefreshToken})
+        if err != nil {
+            t.Fatalf("Failed to refresh: %v", err)
+        }
+        if second.RefreshToken == first.RefreshToken || second.Token == first.Token || second.User.Email != doctorEmail {
+            t.Errorf("Expected a new token pair, got %+v", second)
+        }
+        if _, err := env.AuthService.ValidateToken(second.Token); err != nil {
+            t.Errorf("Refreshed access token does not validate: %v", err)
+        }
+        if _, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: second.RefreshToken}); err != nil {
+            t.Errorf("Failed to refresh with the rotated token: %v", err)
+        }
+    })
+
+    t.Run("reuse revokes the family", func(t *testing.T) {
+        first := login()
+        second, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: first.RefreshToken})
+        if err != nil {
+            t.Fatalf("Failed to refresh: %v", err)
+        }
+
+        if _, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: first.RefreshToken}); !errors.Is(err, service.ErrRefreshTokenReused) {
+            t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+        }
+        if _, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: second.RefreshToken}); !errors.Is(err, service.ErrInvalidRefreshToken) {
+            t.Errorf("Expected the rest of the family to be revoked, got %v", err)
+        }
+        for _, access := range []string{first.Token, second.Token} {
+            if _, err := env.AuthService.ValidateToken(access); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Expected access token to be revoked, got %v", err)
+            }
+        }
+
+        // Other sessions of the same user are unaffected.
+        other := login()
+        if _, err := env.AuthService.ValidateToken(other.Token); err != nil {
+            t.Errorf("Unrelated session should stay valid: %v", err)
+        }
+    })
+
+    t.Run("unknown token", func(t *testing.T) {
+        if _, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: "nope"}); !errors.Is(err, service.ErrInvalidRefreshToken) {
+            t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+        }
+    })
+
+    t.Run("expired token", func(t *testing.T) {
+        shortLived := service.NewAuthService(repository.NewUserRepository(env.DB), repository.NewRefreshTokenRepository(env.DB),
+            newTestKeys(t), service.AuthConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: -time.Second})
+        tokens, err := shortLived.Login(service.LoginInput{Email: doctorEmail, Password: seedPassword})
+        if err != nil {
+            t.Fatalf("Failed to log in: %v", err)
+        }
+        if _, err := shortLived.Refresh(service.RefreshInput{RefreshToken: tokens.RefreshToken}); !errors.Is(err, service.ErrInvalidRefreshToken) {
+            t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+        }
+    })
+}
+
+func TestAuthService_Logout(t *testing.T) {
+    env := newTestEnv(t)
+    tokens, err := env.AuthService.Login(service.LoginInput{Email: receptionistEmail, Password: seedPassword})
+    if err != nil {
+        t.Fatalf("Failed to log in: %v", err)
+    }
+
+    if err := env.AuthService.Logout(service.RefreshInput{RefreshToken: tokens.RefreshToken}); err != nil {
+        t.Fatalf("Failed to log out: %v", err)
+    }
+    if _, err := env.AuthService.ValidateToken(tokens.Token); !errors.Is(err, service.ErrTokenRevoked) {
+        t.Errorf("Expected access token to be revoked after logout, got %v", err)
+    }
+    if _, err := env.AuthService.Refresh(service.RefreshInput{RefreshToken: tokens.RefreshToken}); !errors.Is(err, service.ErrInvalidRefreshToken) {
+        t.Errorf("Expected refresh after logout to fail, got %v", err)
+    }
+    if err := env.AuthService.Logout(service.RefreshInput{RefreshToken: tokens.RefreshToken}); err != nil {
+        t.Errorf("Logging out twice should succeed: %v", err)
+    }
+}
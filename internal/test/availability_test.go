@@ -0,0 +1,292 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+// Monday to Friday, nine to five in New York with a lunch break.
+func weekdaySchedule() service.AvailabilityInput {
+    input := service.AvailabilityInput{Timezone: "America/New_York", SlotMinutes: 30}
+    for weekday := 1; weekday <= 5; weekday++ {
+        input.WorkingHours = append(input.WorkingHours,
+            service.WeeklyWindow{Weekday: weekday, Start: "13:00", End: "17:00"},
+            service.WeeklyWindow{Weekday: weekday, Start: "09:00", End: "12:00"})
+        input.Breaks = append(input.Breaks, service.WeeklyWindow{Weekday: weekday, Start: "10:00", End: "10:30"})
+    }
+    return input
+}
+
+func TestAvailabilityService(t *testing.T) {
+    db := newTestDB(t)
+    // Run against both stores so the in-memory store stays a faithful fake.
+    stores := map[string]struct {
+        availability repository.AvailabilityStore
+        appointments repository.AppointmentStore
+        patients     repository.PatientStore
+        users        repository.UserStore
+        tokens       repository.RefreshTokenStore
+    }{
+        "gorm": {repository.NewAvailabilityRepository(db), repository.NewAppointmentRepository(db), repository.NewPatientRepository(db),
+            repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryAvailabilityRepository(), repository.NewMemoryAppointmentRepository(), repository.NewMemoryPatientRepository(),
+            repository.NewMemoryUserRepository(), repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            users := service.NewUserService(store.users, store.tokens)
+            doctor, err := users.Create(service.CreateUserInput{Email: "grey@example.com", Password: strongPassword, Roles: []string{model.RoleDoctor}})
+            if err != nil {
+                t.Fatalf("Failed to create doctor: %v", err)
+            }
+            receptionist, err := users.Create(service.CreateUserInput{Email: "desk@example.com", Password: strongPassword, Roles: []string{model.RoleReceptionist}})
+            if err != nil {
+                t.Fatalf("Failed to create receptionist: %v", err)
+            }
+
+            svc := service.NewAvailabilityService(store.availability, store.appointments, store.users)
+            if _, err := svc.Slots(doctor.ID, service.ListSlotsInput{From: mustDate(t, "2030-01-07"), To: mustDate(t, "2030-01-07")}); !errors.Is(err, service.ErrNoAvailability) {
+                t.Errorf("Expected ErrNoAvailability before publishing, got %v", err)
+            }
+
+            input := weekdaySchedule()
+            input.LeaveDays = []string{"2030-01-08", "2030-01-08"}
+            saved, err := svc.Set(doctor.ID, input)
+            if err != nil {
+                t.Fatalf("Failed to set availability: %v", err)
+            }
+            if saved.WorkingHours[0] != (service.WeeklyWindow{Weekday: 1, Start: "09:00", End: "12:00"}) || !reflect.DeepEqual(saved.LeaveDays, []string{"2030-01-08"}) {
+                t.Errorf("Unexpected availability: %+v", saved)
+            }
+            if got, err := svc.Get(doctor.ID); err != nil || !reflect.DeepEqual(got, saved) {
+                t.Errorf("Get = %+v, %v; want %+v", got, err, saved)
+            }
+
+            invalid := []struct {
+                name   string
+                modify func(*service.AvailabilityInput)
+            }{
+                {"unknown timezone", func(in *service.AvailabilityInput) { in.Timezone = "Mars/Olympus" }},
+                {"empty window", func(in *service.AvailabilityInput) { in.Breaks[0].End = "10:00" }},
+                {"end past midnight", func(in *service.AvailabilityInput) { in.WorkingHours[0].End = "24:30" }},
+                {"start at midnight", func(in *service.AvailabilityInput) { in.WorkingHours[0].Start = "24:00" }},
+                {"overlapping hours", func(in *service.AvailabilityInput) { in.WorkingHours[0].Start = "11:00" }},
+                {"overnight overlaps the next morning", func(in *service.AvailabilityInput) {
+                    in.WorkingHours = append(in.WorkingHours, service.WeeklyWindow{Weekday: 0, Start: "22:00", End: "09:30"})
+                }},
+                {"saturday night overlaps sunday", func(in *service.AvailabilityInput) {
+                    in.WorkingHours = append(in.WorkingHours, service.WeeklyWindow{Weekday: 6, Start: "23:00", End: "02:00"},
+                        service.WeeklyWindow{Weekday: 0, Start: "01:00", End: "03:00"})
+                }},
+            }
+            for _, tt := range invalid {
+                input := weekdaySchedule()
+                tt.modify(&input)
+                if _, err := svc.Set(doctor.ID, input); !errors.Is(err, service.ErrInvalidAvailability) {
+                    t.Errorf("%s: expected ErrInvalidAvailability, got %v", tt.name, err)
+                }
+            }
+            if _, err := svc.Set(receptionist.ID, weekdaySchedule()); !errors.Is(err, service.ErrNotADoctor) {
+                t.Errorf("Expected ErrNotADoctor, got %v", err)
+            }
+
+            patient, err := newPatientService(store.patients).Create(0, service.CreatePatientInput{
+                FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female",
+            })
+            if err != nil {
+                t.Fatalf("Failed to create patient: %v", err)
+            }
+            newYork, _ := time.LoadLocation("America/New_York")
+            _, err = service.NewAppointmentService(store.appointments, store.patients, store.users).Book(service.BookAppointmentInput{
+                PatientID: patient.ID,
+                DoctorID:  doctor.ID,
+                StartsAt:  time.Date(2030, 1, 7, 14, 0, 0, 0, newYork),
+                EndsAt:    time.Date(2030, 1, 7, 14, 45, 0, 0, newYork),
+            })
+            if err != nil {
+                t.Fatalf("Failed to book appointment: %v", err)
+            }
+
+            // Monday 7 January 2030 has 13 slots less the two the
+            // appointment touches; Tuesday is a leave day.
+            slots, err := svc.Slots(doctor.ID, service.ListSlotsInput{From: mustDate(t, "2030-01-07"), To: mustDate(t, "2030-01-08")})
+            if err != nil {
+                t.Fatalf("Failed to list slots: %v", err)
+            }
+            var starts []string
+            for _, slot := range slots.Data {
+                starts = append(starts, slot.StartsAt[11:16])
+            }
+            want := []string{"09:00", "09:30", "10:30", "11:00", "11:30", "13:00", "13:30", "15:00", "15:30", "16:00", "16:30"}
+            if !reflect.DeepEqual(starts, want) || slots.Timezone != "America/New_York" {
+                t.Errorf("Slot starts = %v in %s, want %v", starts, slots.Timezone, want)
+            }
+            if slots.Data[0].StartsAt != "2030-01-07T09:00:00-05:00" || slots.Data[0].EndsAt != "2030-01-07T09:30:00-05:00" {
+                t.Errorf("Unexpected first slot: %+v", slots.Data[0])
+            }
+
+            // Local hours stay put across the daylight saving change on
+            // 10 March 2030, so the UTC time moves.
+            slots, err = svc.Slots(doctor.ID, service.ListSlotsInput{From: mustDate(t, "2030-03-04"), To: mustDate(t, "2030-03-11"), Timezone: "UTC"})
+            if err != nil {
+                t.Fatalf("Failed to list slots: %v", err)
+            }
+            firstOfDay := make(map[string]string)
+            for _, slot := range slots.Data {
+                if day := slot.StartsAt[:10]; firstOfDay[day] == "" {
+                    firstOfDay[day] = slot.StartsAt
+                }
+            }
+            if firstOfDay["2030-03-04"] != "2030-03-04T14:00:00Z" || firstOfDay["2030-03-11"] != "2030-03-11T13:00:00Z" || len(firstOfDay) != 6 {
+                t.Errorf("Unexpected first slots per day: %v", firstOfDay)
+            }
+
+            ranges := []service.ListSlotsInput{
+                {From: mustDate(t, "2030-01-08"), To: mustDate(t, "2030-01-07")},
+                {From: mustDate(t, "2030-01-01"), To: mustDate(t, "2030-03-01")},
+                {From: mustDate(t, "2030-01-07"), To: mustDate(t, "2030-01-07"), Timezone: "Nowhere/Special"},
+            }
+            for _, input := range ranges {
+                if _, err := svc.Slots(doctor.ID, input); !errors.Is(err, service.ErrInvalidAvailability) {
+                    t.Errorf("Slots(%+v): expected ErrInvalidAvailability, got %v", input, err)
+                }
+            }
+
+            // Past slots are never offered.
+            past := service.ListSlotsInput{From: time.Now().AddDate(0, 0, -7), To: time.Now().AddDate(0, 0, -1)}
+            if slots, err := svc.Slots(doctor.ID, past); err != nil || len(slots.Data) != 0 {
+                t.Errorf("Expected no slots in the past, got %d, %v", len(slots.Data), err)
+            }
+        })
+    }
+}
+
+// Night shifts run past midnight and keep their local hours across the
+// daylight saving change, which in London falls at 01:00 on 28 March 2027.
+func TestAvailabilityService_Overnight(t *testing.T) {
+    db := newTestDB(t)
+    users := repository.NewUserRepository(db)
+    doctor, err := service.NewUserService(users, repository.NewRefreshTokenRepository(db)).Create(service.CreateUserInput{
+        Email: "night@example.com", Password: strongPassword, Roles: []string{model.RoleDoctor},
+    })
+    if err != nil {
+        t.Fatalf("Failed to create doctor: %v", err)
+    }
+
+    svc := service.NewAvailabilityService(repository.NewAvailabilityRepository(db), repository.NewAppointmentRepository(db), users)
+    _, err = svc.Set(doctor.ID, service.AvailabilityInput{
+        Timezone:    "Europe/London",
+        SlotMinutes: 60,
+        WorkingHours: []service.WeeklyWindow{
+            {Weekday: 6, Start: "22:00", End: "06:00"}, // Saturday night
+            {Weekday: 0, Start: "20:00", End: "24:00"}, // Sunday evening
+        },
+        Breaks:    []service.WeeklyWindow{{Weekday: 6, Start: "23:30", End: "00:30"}},
+        LeaveDays: []string{"2027-04-03"},
+    })
+    if err != nil {
+        t.Fatalf("Failed to set availability: %v", err)
+    }
+
+    slotsBetween := func(from, to string) []string {
+        t.Helper()
+        slots, err := svc.Slots(doctor.ID, service.ListSlotsInput{From: mustDate(t, from), To: mustDate(t, to)})
+        if err != nil {
+            t.Fatalf("Failed to list slots: %v", err)
+        }
+        var starts []string
+        for _, slot := range slots.Data {
+            starts = append(starts, slot.StartsAt+"/"+slot.EndsAt[11:])
+        }
+        return starts
+    }
+
+    // The shift is seven hours long that night. The midnight break leaves
+    // 22:00-23:30 and 00:30-06:00, cut into hour slots from their starts.
+    want := []string{
+        "2027-03-27T22:00:00Z/23:00:00Z",
+        "2027-03-28T00:30:00Z/02:30:00+01:00",
+        "2027-03-28T02:30:00+01:00/03:30:00+01:00",
+        "2027-03-28T03:30:00+01:00/04:30:00+01:00",
+        "2027-03-28T04:30:00+01:00/05:30:00+01:00",
+        "2027-03-28T20:00:00+01:00/21:00:00+01:00",
+        "2027-03-28T21:00:00+01:00/22:00:00+01:00",
+        "2027-03-28T22:00:00+01:00/23:00:00+01:00",
+        "2027-03-28T23:00:00+01:00/00:00:00+01:00",
+    }
+    if got := slotsBetween("2027-03-27", "2027-03-28"); !reflect.DeepEqual(got, want) {
+        t.Errorf("Slots = %v, want %v", got, want)
+    }
+
+    // Asking for Sunday alone still includes the end of Saturday's shift.
+    if got := slotsBetween("2027-03-28", "2027-03-28"); len(got) != 8 || got[0] != want[1] {
+        t.Errorf("Sunday slots = %v", got)
+    }
+
+    // Saturday 3 April is a leave day: no shift starts that night, but the
+    // one from the Saturday before is long over.
+    if got := slotsBetween("2027-04-03", "2027-04-04"); len(got) != 4 || got[0] != "2027-04-04T20:00:00+01:00/21:00:00+01:00" {
+        t.Errorf("Slots around leave = %v", got)
+    }
+}
+
+func TestAPI_DoctorAvailability(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    doctorUser, err := repository.NewUserRepository(env.DB).FindByEmail(doctorEmail)
+    if err != nil {
+        t.Fatalf("Failed to find doctor: %v", err)
+    }
+    slots := fmt.Sprintf("/api/doctors/%d/slots", doctorUser.ID)
+
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        body       interface{}
+        wantStatus int
+    }{
+        {"slots before publishing", http.MethodGet, slots + "?from=2030-01-07&to=2030-01-07", receptionist, nil, http.StatusNotFound},
+        {"doctor publishes", http.MethodPut, "/api/doctors/me/availability", doctor, weekdaySchedule(), http.StatusOK},
+        {"bad slot length", http.MethodPut, "/api/doctors/me/availability", doctor, map[string]interface{}{"timezone": "UTC", "slot_minutes": 1}, http.StatusBadRequest},
+        {"bad clock time", http.MethodPut, "/api/doctors/me/availability", doctor,
+            map[string]interface{}{"timezone": "UTC", "slot_minutes": 30, "working_hours": []map[string]interface{}{{"weekday": 1, "start": "9am", "end": "17:00"}}}, http.StatusBadRequest},
+        {"receptionist cannot publish", http.MethodPut, "/api/doctors/me/availability", receptionist, weekdaySchedule(), http.StatusForbidden},
+        {"doctor reads own", http.MethodGet, "/api/doctors/me/availability", doctor, nil, http.StatusOK},
+        {"receptionist reads doctor's", http.MethodGet, fmt.Sprintf("/api/doctors/%d/availability", doctorUser.ID), receptionist, nil, http.StatusOK},
+        {"receptionist lists slots", http.MethodGet, slots + "?from=2030-01-07&to=2030-01-11", receptionist, nil, http.StatusOK},
+        {"missing range", http.MethodGet, slots, receptionist, nil, http.StatusBadRequest},
+        {"range too long", http.MethodGet, slots + "?from=2030-01-01&to=2030-06-01", receptionist, nil, http.StatusBadRequest},
+        {"not a doctor", http.MethodGet, "/api/doctors/9999/slots?from=2030-01-07&to=2030-01-07", receptionist, nil, http.StatusNotFound},
+        {"admin cannot list slots", http.MethodGet, slots + "?from=2030-01-07&to=2030-01-07", admin, nil, http.StatusForbidden},
+        {"anonymous", http.MethodGet, slots + "?from=2030-01-07&to=2030-01-07", "", nil, http.StatusUnauthorized},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, tt.method, tt.path, tt.token, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+
+    w := env.do(t, http.MethodGet, slots+"?from=2030-01-07&to=2030-01-11&timezone=Asia/Kolkata", receptionist, nil)
+    var week service.SlotListResponse
+    decodeJSON(t, w, &week)
+    if len(week.Data) != 5*13 || week.Data[0].StartsAt != "2030-01-07T19:30:00+05:30" {
+        t.Errorf("Got %d slots starting %+v, want 65 starting at 19:30 IST", len(week.Data), week.Data)
+    }
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+    "testing"
+    "github.com/go-sql-driver/mysql"
+    "makerble-assessment/internal/config"
+)
+
+func TestDBConfig_DSN(t *testing.T) {
+    tests := []struct {
+        name   string
+        config config.DBConfig
+        want   string
+    }{
+        {
+            name:   "mysql",
+            config: config.DBConfig{Driver: config.DriverMySQL, Host: "db", Port: "3306", User: "app", Password: "secret", Name: "clinic"},
+            want:   "app:secret@tcp(db:3306)/clinic?loc=Local&parseTime=true&charset=utf8mb4",
+        },
+        {
+            name:   "postgres defaults",
+            config: config.DBConfig{Driver: config.DriverPostgres, Host: "db", User: "app", Password: "secret", Name: "clinic"},
+            want:   "host='db' port='5432' user='app' password='secret' dbname='clinic' sslmode='disable' TimeZone=UTC",
+        },
+        {
+            // Unquoted, the space would end the password and the rest
+            // would be read as another parameter.
+            name:   "postgres password with spaces and quotes",
+            config: config.DBConfig{Driver: config.DriverPostgres, Host: "db", Port: "6543", User: "app", Password: `p a'ss\ sslmode=disable`, Name: "clinic", SSLMode: "require"},
+            want:   `host='db' port='6543' user='app' password='p a\'ss\\ sslmode=disable' dbname='clinic' sslmode='require' TimeZone=UTC`,
+        },
+        {
+            name:   "postgres empty password",
+            config: config.DBConfig{Driver: config.DriverPostgres, Host: "db", User: "app", Name: "clinic"},
+            want:   "host='db' port='5432' user='app' password='' dbname='clinic' sslmode='disable' TimeZone=UTC",
+        },
+        {
+            name:   "sqlite file",
+            config: config.DBConfig{Driver: config.DriverSQLite, Name: "/tmp/app.db"},
+            want:   "file:/tmp/app.db?_foreign_keys=on",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := tt.config.DSN()
+            if err != nil {
+                t.Fatalf("DSN failed: %v", err)
+            }
+            if got != tt.want {
+                t.Errorf("DSN = %s, want %s", got, tt.want)
+            }
+        })
+    }
+
+    // A MySQL password with DSN delimiters in it must parse back intact.
+    password := "p@ss/w:rd?x=1"
+    dsn, err := config.DBConfig{Driver: config.DriverMySQL, Host: "db", Port: "3306", User: "app", Password: password, Name: "clinic"}.DSN()
+    if err != nil {
+        t.Fatalf("DSN failed: %v", err)
+    }
+    parsed, err := mysql.ParseDSN(dsn)
+    if err != nil || parsed.User != "app" || parsed.Passwd != password || parsed.Addr != "db:3306" || parsed.DBName != "clinic" {
+        t.Errorf("ParseDSN(%s) = %+v, %v", dsn, parsed, err)
+    }
+
+    if _, err := (config.DBConfig{Driver: "oracle"}).DSN(); err == nil {
+        t.Errorf("Expected an error for an unsupported driver")
+    }
+}
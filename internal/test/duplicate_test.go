@@ -0,0 +1,273 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/handler"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestPatientService_Duplicates(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        svc := newPatientService(store)
+        jane, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-03-08T00:00:00Z", Gender: "Female", Contact: "(555) 123-4567"})
+        if err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+
+        tests := []struct {
+            name        string
+            input       service.CreatePatientInput
+            wantMatched []string
+        }{
+            {"misspelt name", service.CreatePatientInput{FirstName: "Jayne", LastName: "Doe", DateOfBirth: "1995-03-08T00:00:00Z"},
+                []string{service.MatchName, service.MatchDateOfBirth}},
+            {"names swapped", service.CreatePatientInput{FirstName: "Doe", LastName: "Jane", DateOfBirth: "1995-03-08T00:00:00Z"},
+                []string{service.MatchName, service.MatchDateOfBirth}},
+            {"similar name", service.CreatePatientInput{FirstName: "Janet", LastName: "Dow", DateOfBirth: "1995-03-08T00:00:00Z"},
+                []string{service.MatchSimilarName, service.MatchDateOfBirth}},
+            {"day and month swapped", service.CreatePatientInput{FirstName: "jane", LastName: "DOE", DateOfBirth: "1995-08-03T00:00:00Z"},
+                []string{service.MatchName, service.MatchSimilarBirthDate}},
+            {"same contact, other day", service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-03-20T00:00:00Z", Contact: "+1 555 123 4567"},
+                []string{service.MatchName, service.MatchSimilarBirthDate, service.MatchContact}},
+            {"other patient", service.CreatePatientInput{FirstName: "John", LastName: "Smith", DateOfBirth: "1995-03-08T00:00:00Z"}, nil},
+            {"other year", service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1996-03-08T00:00:00Z"}, nil},
+        }
+
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                tt.input.Gender = "Female"
+                created, err := svc.Create(0, tt.input)
+                if tt.wantMatched == nil {
+                    if err != nil {
+                        t.Fatalf("Expected no duplicates, got %v", err)
+                    }
+                    if err := svc.Delete(0, created.ID); err != nil {
+                        t.Fatalf("Failed to delete patient: %v", err)
+                    }
+                    return
+                }
+
+                var duplicates *service.DuplicatesError
+                if !errors.As(err, &duplicates) || !errors.Is(err, service.ErrPossibleDuplicate) {
+                    t.Fatalf("Expected a DuplicatesError, got %v", err)
+                }
+                if len(duplicates.Candidates) != 1 {
+                    t.Fatalf("Expected one candidate, got %+v", duplicates.Candidates)
+                }
+                candidate := duplicates.Candidates[0]
+                if candidate.PatientID != jane.ID || candidate.Score < service.DuplicateThreshold || candidate.Score > 1 {
+                    t.Errorf("Unexpected candidate: %+v", candidate)
+                }
+                if !reflect.DeepEqual(candidate.Matched, tt.wantMatched) {
+                    t.Errorf("Matched = %v, want %v", candidate.Matched, tt.wantMatched)
+                }
+
+                // Force creates the patient anyway.
+                tt.input.Force = true
+                created, err = svc.Create(0, tt.input)
+                if err != nil {
+                    t.Fatalf("Forced create: %v", err)
+                }
+                if err := svc.Delete(0, created.ID); err != nil {
+                    t.Fatalf("Failed to delete patient: %v", err)
+                }
+            })
+        }
+    })
+}
+
+func TestPatientService_Merge(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        svc := newPatientService(store)
+        survivor, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Address: "1 Elm St"})
+        if err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+        duplicate, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jayne", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Contact: "555 0100", Address: "2 Oak Ave", Force: true})
+        if err != nil {
+            t.Fatalf("Failed to create duplicate: %v", err)
+        }
+
+        if _, err := svc.Merge(0, survivor.ID, survivor.ID, 0); !errors.Is(err, service.ErrMergeSelf) {
+            t.Errorf("Merging a patient into itself: expected ErrMergeSelf, got %v", err)
+        }
+        if _, err := svc.Merge(0, survivor.ID, duplicate.ID, 2); !errors.Is(err, service.ErrVersionConflict) {
+            t.Errorf("Merging into a stale version: expected ErrVersionConflict, got %v", err)
+        }
+
+        // The survivor keeps its address and takes the contact it lacked.
+        merged, err := svc.Merge(0, survivor.ID, duplicate.ID, 1)
+        if err != nil {
+            t.Fatalf("Failed to merge: %v", err)
+        }
+        if merged.FirstName != "Jane" || merged.Contact != "555 0100" || merged.Address != "1 Elm St" || merged.Version != 2 {
+            t.Errorf("Unexpected merged patient: %+v", merged)
+        }
+        if _, err := svc.Get(duplicate.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Merged duplicate should be gone, got %v", err)
+        }
+        if _, err := svc.Merge(0, survivor.ID, duplicate.ID, 0); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Merging a merged duplicate again: expected gorm.ErrRecordNotFound, got %v", err)
+        }
+
+        trash, err := svc.ListDeleted(service.ListDeletedPatientsInput{})
+        if err != nil || len(trash.Data) != 1 || trash.Data[0].ID != duplicate.ID || trash.Data[0].MergedIntoID == nil || *trash.Data[0].MergedIntoID != survivor.ID {
+            t.Fatalf("Unexpected trash: %+v, %v", trash, err)
+        }
+        if _, err := svc.Restore(0, duplicate.ID); !errors.Is(err, service.ErrPatientMerged) {
+            t.Errorf("Restoring a merged duplicate: expected ErrPatientMerged, got %v", err)
+        }
+        if _, err := svc.Get(duplicate.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Refused restore should leave the duplicate in the trash, got %v", err)
+        }
+    })
+}
+
+func TestPatientRepository_MergeMovesDependents(t *testing.T) {
+    env := newTestEnv(t)
+    survivor := seedPatient(t, env.DB, "Jane")
+    duplicate := seedPatient(t, env.DB, "Jayne")
+    other := seedPatient(t, env.DB, "John")
+
+    for _, id := range []uint{survivor.ID, duplicate.ID, other.ID} {
+        if err := env.DB.Create(&model.MedicalHistoryEntry{PatientID: id, Kind: model.EntryNote, Description: "Seen"}).Error; err != nil {
+            t.Fatalf("Failed to seed history: %v", err)
+        }
+        start := time.Now().Add(time.Duration(id) * time.Hour)
+        if err := env.DB.Create(&model.Appointment{PatientID: id, DoctorID: 2, StartsAt: start, EndsAt: start.Add(time.Hour), Status: model.AppointmentScheduled}).Error; err != nil {
+            t.Fatalf("Failed to seed appointment: %v", err)
+        }
+        if err := env.DB.Create(&model.PatientIdentifier{PatientID: id, System: "PAS", Value: fmt.Sprint("MRN", id)}).Error; err != nil {
+            t.Fatalf("Failed to seed identifier: %v", err)
+        }
+    }
+
+    merged, err := env.PatientService.Merge(1, survivor.ID, duplicate.ID, 0)
+    if err != nil {
+        t.Fatalf("Failed to merge: %v", err)
+    }
+    if len(merged.MedicalHistory) != 2 {
+        t.Errorf("Merged patient should have both histories: %+v", merged.MedicalHistory)
+    }
+
+    counts := []struct {
+        name  string
+        model interface{}
+    }{
+        {"medical history", &model.MedicalHistoryEntry{}},
+        {"appointments", &model.Appointment{}},
+        {"identifiers", &model.PatientIdentifier{}},
+    }
+    for _, tt := range counts {
+        for id, want := range map[uint]int64{survivor.ID: 2, duplicate.ID: 0, other.ID: 1} {
+            var count int64
+            if err := env.DB.Model(tt.model).Where("patient_id = ?", id).Count(&count).Error; err != nil {
+                t.Fatalf("Failed to count %s: %v", tt.name, err)
+            }
+            if count != want {
+                t.Errorf("Patient %d has %d %s rows, want %d", id, count, tt.name, want)
+            }
+        }
+    }
+
+    // Each side of the merge has an entry naming the other.
+    audit := service.NewAuditService(repository.NewAuditLogRepository(env.DB))
+    for id, related := range map[uint]uint{survivor.ID: duplicate.ID, duplicate.ID: survivor.ID} {
+        logs, err := audit.List(service.ListAuditLogsInput{PatientID: id})
+        if err != nil {
+            t.Fatalf("Failed to list audit logs: %v", err)
+        }
+        if len(logs.Data) != 1 || logs.Data[0].Action != model.AuditPatientMerge || logs.Data[0].UserID != 1 ||
+            logs.Data[0].RelatedPatientID == nil || *logs.Data[0].RelatedPatientID != related {
+            t.Errorf("Unexpected audit entries for patient %d: %+v", id, logs.Data)
+        }
+    }
+
+    // A refused restore is rolled back.
+    if _, err := env.PatientService.Restore(0, duplicate.ID); !errors.Is(err, service.ErrPatientMerged) {
+        t.Errorf("Restoring a merged duplicate: expected ErrPatientMerged, got %v", err)
+    }
+    if _, err := env.PatientService.Get(duplicate.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+        t.Errorf("Refused restore should leave the duplicate in the trash, got %v", err)
+    }
+}
+
+func TestAPI_PatientDuplicates(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    input := service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female"}
+    var jane service.PatientResponse
+    decodeJSON(t, env.do(t, http.MethodPost, "/api/patients", receptionist, input), &jane)
+
+    input.FirstName = "Jayne"
+    w := env.do(t, http.MethodPost, "/api/patients", receptionist, input)
+    if w.Code != http.StatusConflict {
+        t.Fatalf("Create duplicate: status %d: %s", w.Code, w.Body.String())
+    }
+    var conflict handler.ErrorResponse
+    decodeJSON(t, w, &conflict)
+    if conflict.Code != "possible_duplicate" || len(conflict.Duplicates) != 1 || conflict.Duplicates[0].PatientID != jane.ID || conflict.Duplicates[0].FirstName != "Jane" {
+        t.Errorf("Unexpected conflict: %+v", conflict)
+    }
+    var matches int64
+    env.DB.Model(&model.AuditLog{}).Where("action = ? AND patient_id = ?", model.AuditPatientMatch, jane.ID).Count(&matches)
+    if matches != 1 {
+        t.Errorf("Shown candidates should be audited, got %d entries", matches)
+    }
+
+    input.Force = true
+    var jayne service.PatientResponse
+    w = env.do(t, http.MethodPost, "/api/patients", receptionist, input)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Forced create: status %d: %s", w.Code, w.Body.String())
+    }
+    decodeJSON(t, w, &jayne)
+
+    path := fmt.Sprintf("/api/patients/%d/merge", jane.ID)
+    anyVersion := map[string]string{"If-Match": "*"}
+    tests := []struct {
+        name       string
+        token      string
+        headers    map[string]string
+        body       interface{}
+        wantStatus int
+    }{
+        {"no write permission", doctor, anyVersion, service.MergePatientsInput{DuplicateID: jayne.ID}, http.StatusForbidden},
+        {"missing duplicate", receptionist, anyVersion, map[string]int{}, http.StatusBadRequest},
+        {"itself", receptionist, anyVersion, service.MergePatientsInput{DuplicateID: jane.ID}, http.StatusBadRequest},
+        {"unknown duplicate", receptionist, anyVersion, service.MergePatientsInput{DuplicateID: 9999}, http.StatusNotFound},
+        {"missing If-Match", receptionist, nil, service.MergePatientsInput{DuplicateID: jayne.ID}, http.StatusPreconditionRequired},
+        {"stale version", receptionist, map[string]string{"If-Match": `"2"`}, service.MergePatientsInput{DuplicateID: jayne.ID}, http.StatusPreconditionFailed},
+        {"merged", receptionist, map[string]string{"If-Match": `"1"`}, service.MergePatientsInput{DuplicateID: jayne.ID}, http.StatusOK},
+        {"merged again", receptionist, anyVersion, service.MergePatientsInput{DuplicateID: jayne.ID}, http.StatusNotFound},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, http.MethodPost, path, tt.token, tt.headers, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if tt.wantStatus == http.StatusOK && w.Header().Get("ETag") != `"2"` {
+                t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), `"2"`)
+            }
+        })
+    }
+
+    w = env.do(t, http.MethodPost, fmt.Sprintf("/api/admin/patients/trash/%d/restore", jayne.ID), admin, nil)
+    var refused handler.ErrorResponse
+    decodeJSON(t, w, &refused)
+    if w.Code != http.StatusConflict || refused.Code != "patient_merged" {
+        t.Errorf("Restore merged duplicate: status %d, %+v", w.Code, refused)
+    }
+}
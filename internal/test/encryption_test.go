@@ -0,0 +1,301 @@
+package test
+
+import (
+    "bytes"
+    "errors"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func newTestKey(t *testing.T, id string, fill byte) *fieldcrypt.Key {
+    t.Helper()
+
+    key, err := fieldcrypt.NewKey(id, bytes.Repeat([]byte{fill}, fieldcrypt.KeySize))
+    if err != nil {
+        t.Fatalf("Failed to build key: %v", err)
+    }
+    return key
+}
+
+func TestKeyRing_EncryptDecrypt(t *testing.T) {
+    old := newTestKey(t, "old", 1)
+    ring, err := fieldcrypt.NewKeyRing(newTestKey(t, "new", 2), old)
+    if err != nil {
+        t.Fatalf("Failed to build key ring: %v", err)
+    }
+    oldRing, _ := fieldcrypt.NewKeyRing(old)
+
+    sealed, err := ring.Encrypt("contact", "9876543210")
+    if err != nil {
+        t.Fatalf("Failed to encrypt: %v", err)
+    }
+    if strings.Contains(sealed, "9876543210") || fieldcrypt.KeyID(sealed) != "new" {
+        t.Fatalf("Unexpected ciphertext %q", sealed)
+    }
+    if again, _ := ring.Encrypt("contact", "9876543210"); again == sealed {
+        t.Error("Encrypting twice should use a fresh nonce")
+    }
+    sealedByOld, _ := oldRing.Encrypt("contact", "1112223333")
+    // Swap one ciphertext character for a different valid one.
+    tampered := []byte(sealed)
+    middle := len("enc:v1:new:") + 20
+    if tampered[middle] == 'A' {
+        tampered[middle] = 'B'
+    } else {
+        tampered[middle] = 'A'
+    }
+
+    tests := []struct {
+        name    string
+        column  string
+        value   string
+        want    string
+        wantErr error
+    }{
+        {name: "current key", column: "contact", value: sealed, want: "9876543210"},
+        {name: "retired key", column: "contact", value: sealedByOld, want: "1112223333"},
+        {name: "plaintext passes through", column: "contact", value: "legacy value", want: "legacy value"},
+        {name: "empty", column: "contact", value: "", want: ""},
+        {name: "other column", column: "address", value: sealed, wantErr: fieldcrypt.ErrTampered},
+        {name: "unknown key", column: "contact", value: strings.Replace(sealed, ":new:", ":gone:", 1), wantErr: fieldcrypt.ErrUnknownKey},
+        {name: "tampered", column: "contact", value: string(tampered), wantErr: fieldcrypt.ErrTampered},
+        {name: "malformed", column: "contact", value: "enc:v1:new:%%%", wantErr: fieldcrypt.ErrMalformed},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ring.Decrypt(tt.column, tt.value)
+            if tt.wantErr != nil {
+                if !errors.Is(err, tt.wantErr) {
+                    t.Fatalf("Expected %v, got %q, %v", tt.wantErr, got, err)
+                }
+                return
+            }
+            if err != nil || got != tt.want {
+                t.Errorf("Decrypt = %q, %v; want %q", got, err, tt.want)
+            }
+        })
+    }
+
+    if ring.NeedsRotation(sealed) || !ring.NeedsRotation(sealedByOld) || !ring.NeedsRotation("legacy value") || ring.NeedsRotation("") {
+        t.Error("NeedsRotation should flag plaintext and retired keys only")
+    }
+}
+
+func TestKeyRing_SearchIndex(t *testing.T) {
+    ring, err := fieldcrypt.NewKeyRing(newTestKey(t, "k", 1))
+    if err != nil {
+        t.Fatalf("Failed to build key ring: %v", err)
+    }
+
+    index := ring.SearchIndex("1 Oak Avenue")
+    tokens := strings.Fields(index)
+    if !sort.StringsAreSorted(tokens) {
+        t.Errorf("Tokens are not sorted: %q", index)
+    }
+    if ring.SearchIndex("Avenue, Oak 1") != index {
+        t.Error("The index should not depend on word order")
+    }
+    // "1" is indexed whole; "oak" and "ave", "aven", "avenu", "avenue" as
+    // prefixes of at least three characters.
+    if len(tokens) != 6 {
+        t.Errorf("Got %d tokens, want 6: %q", len(tokens), index)
+    }
+    for _, term := range []string{"1", "oak", "ave", "avenue"} {
+        if !strings.Contains(index, " "+ring.SearchToken(term)+" ") {
+            t.Errorf("Index lacks a token for %q", term)
+        }
+    }
+    for _, term := range []string{"o", "oa", "a", "av"} {
+        if strings.Contains(index, " "+ring.SearchToken(term)+" ") {
+            t.Errorf("Index holds a token for the short prefix %q", term)
+        }
+    }
+    if ring.SearchIndex(" ,. ") != "" {
+        t.Error("Text without words should give an empty index")
+    }
+
+    // With its own key the index outlives a rotation; without, it is keyed
+    // from the current key.
+    rotated, _ := fieldcrypt.NewKeyRing(newTestKey(t, "k2", 2), newTestKey(t, "k", 1))
+    if rotated.SearchIndex("1 Oak Avenue") == index {
+        t.Error("Without an index key the index should follow the current key")
+    }
+    indexKey := newTestKey(t, fieldcrypt.IndexKeyID, 3)
+    ring.SetIndexKey(indexKey)
+    rotated.SetIndexKey(indexKey)
+    if ring.SearchIndex("1 Oak Avenue") != rotated.SearchIndex("1 Oak Avenue") {
+        t.Error("A shared index key should give the same index after rotation")
+    }
+}
+
+func TestPatientRepository_EncryptsAtRest(t *testing.T) {
+    env := newTestEnv(t)
+    created, err := env.PatientService.Create(0, service.CreatePatientInput{
+        FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female",
+        Contact: "9876543210", Address: "456 Elm St",
+    })
+    if err != nil {
+        t.Fatalf("Failed to create patient: %v", err)
+    }
+    if _, err := env.PatientService.Update(0, created.ID, 0, service.UpdatePatientInput{Address: "1 Oak Ave"}); err != nil {
+        t.Fatalf("Failed to update patient: %v", err)
+    }
+    if err := env.DB.Create(&model.MedicalHistoryEntry{PatientID: created.ID, Kind: model.EntryNote, Description: "Allergic to penicillin"}).Error; err != nil {
+        t.Fatalf("Failed to seed history: %v", err)
+    }
+
+    var contact, address, description string
+    env.DB.Raw("SELECT contact FROM patients WHERE id = ?", created.ID).Scan(&contact)
+    env.DB.Raw("SELECT address FROM patients WHERE id = ?", created.ID).Scan(&address)
+    env.DB.Raw("SELECT description FROM medical_history_entries WHERE patient_id = ?", created.ID).Scan(&description)
+    for column, value := range map[string]string{"contact": contact, "address": address, "description": description} {
+        if fieldcrypt.KeyID(value) != "test" {
+            t.Errorf("Column %s is stored as %q, want ciphertext", column, value)
+        }
+    }
+
+    patient, err := env.PatientService.Get(created.ID)
+    if err != nil || patient.Contact != "9876543210" || patient.Address != "1 Oak Ave" {
+        t.Errorf("Get = %+v, %v; want decrypted values", patient, err)
+    }
+    var entry model.MedicalHistoryEntry
+    if err := env.DB.Where("patient_id = ?", created.ID).First(&entry).Error; err != nil || entry.Description != "Allergic to penicillin" {
+        t.Errorf("History entry = %+v, %v; want decrypted description", entry, err)
+    }
+
+    results, err := env.PatientService.Search(service.SearchPatientsInput{Q: "oak"})
+    if err != nil || len(results.Data) != 1 || results.Data[0].ID != created.ID {
+        t.Errorf("Search by updated address = %+v, %v", results, err)
+    }
+    if results, _ := env.PatientService.Search(service.SearchPatientsInput{Q: "elm"}); len(results.Data) != 0 {
+        t.Errorf("Old address should no longer match: %+v", results)
+    }
+}
+
+func TestRotateEncryption(t *testing.T) {
+    env := newTestEnv(t)
+    jane := seedPatient(t, env.DB, "Jane")
+    if err := env.DB.Create(&model.MedicalHistoryEntry{PatientID: jane.ID, Kind: model.EntryNote, Description: "Seen"}).Error; err != nil {
+        t.Fatalf("Failed to seed history: %v", err)
+    }
+    audit := repository.NewAuditLogRepository(env.DB)
+    diff := `{"contact":{"before":"1","after":"2"}}`
+    if err := audit.Create([]model.AuditLog{{UserID: 1, Action: model.AuditPatientUpdate, PatientID: jane.ID, Changes: diff}}); err != nil {
+        t.Fatalf("Failed to seed audit entry: %v", err)
+    }
+    // Rows written before encryption was enabled are still plaintext.
+    env.DB.Exec("INSERT INTO patients (first_name, last_name, gender, date_of_birth, contact, address, version) VALUES ('John', 'Legacy', 'Male', '1970-07-07', '5551234567', '1 Oak Ave', 1)")
+
+    previous := fieldcrypt.Default()
+    t.Cleanup(func() { fieldcrypt.Use(previous) })
+    ring, err := fieldcrypt.NewKeyRing(newTestKey(t, "next", 9), newTestKey(t, "test", testEncryptionKey[0]))
+    if err != nil {
+        t.Fatalf("Failed to build key ring: %v", err)
+    }
+    fieldcrypt.Use(ring)
+
+    result, err := repository.RotateEncryption(env.DB, ring, 1)
+    if err != nil {
+        t.Fatalf("Failed to rotate: %v", err)
+    }
+    if result.Patients != 2 || result.MedicalHistory != 1 || result.AuditKeys != 1 {
+        t.Errorf("Unexpected rotation result: %+v", result)
+    }
+    if again, _ := repository.RotateEncryption(env.DB, ring, 1); again != (repository.RotationResult{}) {
+        t.Errorf("Second rotation should be a no-op: %+v", again)
+    }
+
+    var stored []string
+    env.DB.Raw("SELECT contact FROM patients UNION ALL SELECT address FROM patients UNION ALL SELECT description FROM medical_history_entries UNION ALL SELECT secret FROM audit_keys").Scan(&stored)
+    for _, value := range stored {
+        if value != "" && fieldcrypt.KeyID(value) != "next" {
+            t.Errorf("Value %q was not re-encrypted with the new key", value)
+        }
+    }
+
+    // Audit diffs stay readable through their re-encrypted key.
+    if entries, _, err := audit.FindPage(repository.AuditQuery{PatientID: jane.ID, Limit: 1}); err != nil || len(entries) != 1 || entries[0].Changes != diff {
+        t.Errorf("Audit entries after rotation = %+v, %v", entries, err)
+    }
+
+    // The search index is rebuilt for the new key.
+    for _, q := range []string{"555123", "oak"} {
+        results, err := env.PatientService.Search(service.SearchPatientsInput{Q: q})
+        if err != nil || len(results.Data) != 1 || results.Data[0].LastName != "Legacy" {
+            t.Errorf("Search %q after rotation = %+v, %v", q, results, err)
+        }
+    }
+}
+
+func TestLoadEncryptionKeys(t *testing.T) {
+    first, _ := fieldcrypt.GenerateKey("k2")
+    second, _ := fieldcrypt.GenerateKey("k1")
+    keyFile := filepath.Join(t.TempDir(), "keys")
+    if err := os.WriteFile(keyFile, []byte("# current key first\n"+first+"\n\n"+second+"\n"), 0o600); err != nil {
+        t.Fatalf("Failed to write key file: %v", err)
+    }
+    emptyFile := filepath.Join(t.TempDir(), "empty")
+    os.WriteFile(emptyFile, []byte("# nothing here\n"), 0o600)
+    index, _ := fieldcrypt.GenerateKey(fieldcrypt.IndexKeyID)
+    indexKey, _ := fieldcrypt.ParseKey(index)
+    // A ring whose current key is the index key derives the same index key.
+    indexRing, _ := fieldcrypt.NewKeyRing(indexKey)
+    // This key was committed to the repository once.
+    leaked := "dev-1=gpA/GMesXVS2AkK7CAIl5xx5qZNlQanZwfR1dbuOtNU="
+
+    tests := []struct {
+        name      string
+        env       map[string]string
+        wantErr   bool
+        wantKid   string
+        wantIndex bool
+    }{
+        {name: "nothing configured", env: map[string]string{}, wantErr: true},
+        {name: "env", env: map[string]string{"ENCRYPTION_KEYS": second + ", " + first}, wantKid: "k1"},
+        {name: "key file wins", env: map[string]string{"ENCRYPTION_KEY_FILE": keyFile, "ENCRYPTION_KEYS": second}, wantKid: "k2"},
+        {name: "missing key file", env: map[string]string{"ENCRYPTION_KEY_FILE": filepath.Join(t.TempDir(), "nope")}, wantErr: true},
+        {name: "empty key file", env: map[string]string{"ENCRYPTION_KEY_FILE": emptyFile}, wantErr: true},
+        {name: "short key", env: map[string]string{"ENCRYPTION_KEYS": "k=c2hvcnQ="}, wantErr: true},
+        {name: "duplicate id", env: map[string]string{"ENCRYPTION_KEYS": first + "," + first}, wantErr: true},
+        {name: "index key", env: map[string]string{"ENCRYPTION_KEYS": index + "," + second + "," + first}, wantKid: "k1", wantIndex: true},
+        {name: "two index keys", env: map[string]string{"ENCRYPTION_KEYS": second + "," + index + "," + index}, wantErr: true},
+        {name: "only an index key", env: map[string]string{"ENCRYPTION_KEYS": index}, wantErr: true},
+        {name: "compromised current key", env: map[string]string{"ENCRYPTION_KEYS": leaked + "," + first}, wantErr: true},
+        {name: "compromised index key", env: map[string]string{"ENCRYPTION_KEYS": second + ",index" + leaked[len("dev-1"):]}, wantErr: true},
+        {name: "compromised retired key", env: map[string]string{"ENCRYPTION_KEYS": second + "," + leaked}, wantKid: "k1"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, key := range []string{"ENCRYPTION_KEY_FILE", "ENCRYPTION_KEYS"} {
+                t.Setenv(key, tt.env[key])
+            }
+
+            ring, err := config.LoadEncryptionKeys()
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to load keys: %v", err)
+            }
+            if ring.CurrentKeyID() != tt.wantKid {
+                t.Errorf("Current key = %q, want %q", ring.CurrentKeyID(), tt.wantKid)
+            }
+            if indexed := ring.SearchToken("oak") == indexRing.SearchToken("oak"); indexed != tt.wantIndex {
+                t.Errorf("Index keyed by the index entry = %v, want %v", indexed, tt.wantIndex)
+            }
+        })
+    }
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "github.com/gin-gonic/gin"
+    "makerble-assessment/internal/handler"
+    "makerble-assessment/internal/service"
+)
+
+func TestServiceErrors(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+
+    _, updateErr := env.PatientService.Update(0, patient.ID, 0, service.UpdatePatientInput{DateOfBirth: "yesterday"})
+    _, createErr := env.PatientService.Create(0, service.CreatePatientInput{FirstName: "a", LastName: "b", DateOfBirth: "1990", Gender: "Male"})
+    _, getErr := env.PatientService.Get(patient.ID + 100)
+    deleteErr := env.PatientService.Delete(0, patient.ID + 100)
+    _, conflictErr := env.PatientService.Update(0, patient.ID, 7, service.UpdatePatientInput{Contact: "1"})
+
+    tests := []struct {
+        name     string
+        err      error
+        wantKind service.ErrorKind
+        wantCode string
+    }{
+        {"update with invalid date of birth", updateErr, service.KindValidation, "invalid_date_of_birth"},
+        {"create with invalid date of birth", createErr, service.KindValidation, "invalid_date_of_birth"},
+        {"get unknown patient", getErr, service.KindNotFound, "not_found"},
+        {"delete unknown patient", deleteErr, service.KindNotFound, "not_found"},
+        {"stale version", conflictErr, service.KindPreconditionFailed, "version_conflict"},
+        {"unexpected error", errors.New("connection refused"), service.KindInternal, "internal"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if tt.err == nil {
+                t.Fatal("Expected an error, got nil")
+            }
+            got := service.AsError(tt.err)
+            if got.Kind != tt.wantKind || got.Code != tt.wantCode {
+                t.Errorf("Got kind %q code %q, want %q %q", got.Kind, got.Code, tt.wantKind, tt.wantCode)
+            }
+        })
+    }
+
+    // Internal errors never leak their text.
+    if got := service.AsError(errors.New("connection refused")); got.Message != "Internal server error" {
+        t.Errorf("Internal error message = %q", got.Message)
+    }
+}
+
+func TestAPI_ErrorResponses(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    path := fmt.Sprintf("/api/patients/%d", patient.ID)
+
+    tests := []struct {
+        name        string
+        method      string
+        path        string
+        token       string
+        headers     map[string]string
+        body        interface{}
+        wantStatus  int
+        wantCode    string
+        wantDetails []service.FieldError
+    }{
+        {
+            name: "missing and invalid fields", method: http.MethodPost, path: "/api/patients", token: receptionist,
+            body:       map[string]string{"first_name": "John", "gender": "X"},
+            wantStatus: http.StatusBadRequest, wantCode: "invalid_input",
+            wantDetails: []service.FieldError{
+                {Field: "last_name", Message: "is required"},
+                {Field: "date_of_birth", Message: "is required"},
+                {Field: "gender", Message: "must be one of: Male, Female, Other"},
+            },
+        },
+        {
+            name: "invalid date of birth on create", method: http.MethodPost, path: "/api/patients", token: receptionist,
+            body:       service.CreatePatientInput{FirstName: "John", LastName: "Doe", DateOfBirth: "1990-01-01", Gender: "Male"},
+            wantStatus: http.StatusBadRequest, wantCode: "invalid_date_of_birth",
+            wantDetails: []service.FieldError{{Field: "date_of_birth", Message: "must be an RFC 3339 timestamp"}},
+        },
+        {
+            name: "invalid date of birth on update", method: http.MethodPut, path: path, token: receptionist, headers: map[string]string{"If-Match": "*"},
+            body:       service.UpdatePatientInput{DateOfBirth: "yesterday"},
+            wantStatus: http.StatusBadRequest, wantCode: "invalid_date_of_birth",
+            wantDetails: []service.FieldError{{Field: "date_of_birth", Message: "must be an RFC 3339 timestamp"}},
+        },
+        {
+            name: "invalid query parameter", method: http.MethodGet, path: "/api/patients?limit=1000", token: receptionist,
+            wantStatus: http.StatusBadRequest, wantCode: "invalid_input",
+            wantDetails: []service.FieldError{{Field: "limit", Message: "must be at most 100"}},
+        },
+        {
+            name: "invalid id", method: http.MethodGet, path: "/api/patients/abc", token: receptionist,
+            wantStatus: http.StatusBadRequest, wantCode: "invalid_id",
+            wantDetails: []service.FieldError{{Field: "id", Message: "must be a positive integer"}},
+        },
+        {name: "delete unknown patient", method: http.MethodDelete, path: "/api/patients/9999", token: receptionist, wantStatus: http.StatusNotFound, wantCode: "not_found"},
+        {
+            name: "stale version", method: http.MethodPut, path: path, token: receptionist, headers: map[string]string{"If-Match": `"7"`},
+            body:       service.UpdatePatientInput{Contact: "1"},
+            wantStatus: http.StatusPreconditionFailed, wantCode: "version_conflict",
+        },
+        {name: "missing token", method: http.MethodGet, path: "/api/patients", wantStatus: http.StatusUnauthorized, wantCode: "unauthorized"},
+        {name: "bad token", method: http.MethodGet, path: "/api/patients", token: "not-a-jwt", wantStatus: http.StatusUnauthorized, wantCode: "invalid_token"},
+        {name: "missing permission", method: http.MethodDelete, path: path, token: doctor, wantStatus: http.StatusForbidden, wantCode: "forbidden"},
+        {
+            name: "wrong password", method: http.MethodPost, path: "/login",
+            body:       service.LoginInput{Email: receptionistEmail, Password: "nope"},
+            wantStatus: http.StatusUnauthorized, wantCode: "invalid_credentials",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, tt.method, tt.path, tt.token, tt.headers, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+
+            var resp handler.ErrorResponse
+            decodeJSON(t, w, &resp)
+            if resp.Code != tt.wantCode || resp.Message == "" {
+                t.Errorf("Unexpected error body: %s", w.Body.String())
+            }
+            if !reflect.DeepEqual(resp.Details, tt.wantDetails) {
+                t.Errorf("Details = %+v, want %+v", resp.Details, tt.wantDetails)
+            }
+        })
+    }
+}
+
+func TestRespondError_ShowsOnlyServiceMessage(t *testing.T) {
+    notFound := &service.Error{Kind: service.KindNotFound, Code: "not_found", Message: "Patient not found", Err: errors.New("record not found in patients")}
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+
+    handler.RespondError(c, fmt.Errorf("find patient 7 on replica db-2: %w", notFound))
+    var body handler.ErrorResponse
+    decodeJSON(t, w, &body)
+    if w.Code != http.StatusNotFound || body.Message != "Patient not found" {
+        t.Errorf("Got status %d, message %q; want 404 with the service message", w.Code, body.Message)
+    }
+}
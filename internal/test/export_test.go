@@ -0,0 +1,286 @@
+package test
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/pdf"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestPatientService_Export(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        // Enough patients for more than one batch.
+        patients := make([]model.Patient, 520)
+        for i := range patients {
+            gender := "Male"
+            if i%2 == 0 {
+                gender = "Female"
+            }
+            patients[i] = model.Patient{FirstName: fmt.Sprintf("P%03d", i), LastName: "Doe", Gender: gender, DateOfBirth: mustDate(t, "1990-01-01"), Version: 1}
+        }
+        patients[0].Address = "=HYPERLINK(\"http://example.com\")"
+        patients[0].Contact = "+44 20 7946 0000"
+        patients[1].Contact = "-2+3*cmd|' /C calc'!A0"
+        if err := store.CreateBatch(patients); err != nil {
+            t.Fatalf("Failed to seed patients: %v", err)
+        }
+        if err := store.Delete(patients[2].ID); err != nil {
+            t.Fatalf("Failed to delete patient: %v", err)
+        }
+        svc := newPatientService(store)
+
+        var out bytes.Buffer
+        var batches []int
+        err := svc.Export(&out, service.ExportPatientsInput{Format: service.ExportCSV}, func(ids []uint) error {
+            batches = append(batches, len(ids))
+            return nil
+        })
+        if err != nil {
+            t.Fatalf("Failed to export: %v", err)
+        }
+        if !reflect.DeepEqual(batches, []int{500, 19}) {
+            t.Errorf("Batches = %v, want [500 19]", batches)
+        }
+
+        records, err := csv.NewReader(&out).ReadAll()
+        if err != nil {
+            t.Fatalf("Export is not valid CSV: %v", err)
+        }
+        wantHeader := []string{"id", "first_name", "last_name", "date_of_birth", "gender", "contact", "address", "created_at", "updated_at"}
+        if len(records) != 520 || !reflect.DeepEqual(records[0], wantHeader) {
+            t.Fatalf("Got %d records with header %v", len(records), records[0])
+        }
+        first := records[1]
+        if first[1] != "P000" || first[3] != "1990-01-01T00:00:00Z" || first[5] != "+44 20 7946 0000" || first[6] != "'=HYPERLINK(\"http://example.com\")" {
+            t.Errorf("Unexpected first row: %q", first)
+        }
+        if second := records[2]; second[5] != "'-2+3*cmd|' /C calc'!A0" {
+            t.Errorf("Unexpected second row: %q", second)
+        }
+        for i := 2; i < len(records); i++ {
+            previous, _ := strconv.Atoi(records[i-1][0])
+            current, _ := strconv.Atoi(records[i][0])
+            if current <= previous || records[i][1] == "P002" {
+                t.Fatalf("Row %d out of order or deleted: %q", i, records[i])
+            }
+        }
+
+        out.Reset()
+        err = svc.Export(&out, service.ExportPatientsInput{Format: service.ExportNDJSON, Gender: "Female", Name: "p00"}, func([]uint) error { return nil })
+        if err != nil {
+            t.Fatalf("Failed to export: %v", err)
+        }
+        var names []string
+        scanner := bufio.NewScanner(&out)
+        for scanner.Scan() {
+            var record service.PatientExportRecord
+            if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+                t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+            }
+            names = append(names, record.FirstName)
+        }
+        if want := []string{"P000", "P004", "P006", "P008"}; !reflect.DeepEqual(names, want) {
+            t.Errorf("Filtered export = %v, want %v", names, want)
+        }
+
+        // A failing hook stops the export before anything is written.
+        out.Reset()
+        hookErr := errors.New("audit unavailable")
+        if err := svc.Export(&out, service.ExportPatientsInput{Format: service.ExportCSV}, func([]uint) error { return hookErr }); !errors.Is(err, hookErr) || out.Len() != 0 {
+            t.Errorf("Export with failing hook = %v and %d bytes", err, out.Len())
+        }
+
+        // An empty export still has a header.
+        out.Reset()
+        if err := svc.Export(&out, service.ExportPatientsInput{Format: service.ExportCSV, Name: "nobody"}, func([]uint) error { return nil }); err != nil || out.String() != strings.Join(wantHeader, ",")+"\n" {
+            t.Errorf("Empty export = %q, %v", out.String(), err)
+        }
+    })
+}
+
+func TestPatientService_ExportImportRoundTrip(t *testing.T) {
+    source := newPatientService(repository.NewMemoryPatientRepository())
+    contacts := []string{"+44 20 7946 0000", "-", "(555) 123-4567"}
+    for _, contact := range contacts {
+        input := service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1990-01-01T00:00:00Z", Gender: "Female", Contact: contact, Address: "1 Elm St", Force: true}
+        if _, err := source.Create(0, input); err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+    }
+
+    var exported bytes.Buffer
+    if err := source.Export(&exported, service.ExportPatientsInput{Format: service.ExportCSV}, func([]uint) error { return nil }); err != nil {
+        t.Fatalf("Failed to export: %v", err)
+    }
+    records, err := csv.NewReader(&exported).ReadAll()
+    if err != nil {
+        t.Fatalf("Export is not valid CSV: %v", err)
+    }
+    // Keep the columns an import accepts, as a spreadsheet user would.
+    var imported bytes.Buffer
+    writer := csv.NewWriter(&imported)
+    for _, record := range records {
+        writer.Write(record[1:7])
+    }
+    writer.Flush()
+
+    target := newPatientService(repository.NewMemoryPatientRepository())
+    report, err := target.Import(0, &imported, service.ImportOptions{Format: service.ImportCSV})
+    if err != nil || report.Imported != len(contacts) {
+        t.Fatalf("Import = %+v, %v", report, err)
+    }
+    for i, id := range report.PatientIDs {
+        if patient, err := target.Get(id); err != nil || patient.Contact != contacts[i] {
+            t.Errorf("Re-imported contact = %q, %v; want %q", patient.Contact, err, contacts[i])
+        }
+    }
+}
+
+func TestPatientService_SummaryPDF(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    for i := 0; i < 40; i++ {
+        entry := model.MedicalHistoryEntry{PatientID: patient.ID, Kind: model.EntryNote, Description: fmt.Sprintf("Visit %d (follow-up) — %s", i, strings.Repeat("observed ", 20))}
+        if err := env.DB.Create(&entry).Error; err != nil {
+            t.Fatalf("Failed to seed history: %v", err)
+        }
+    }
+
+    document, err := env.PatientService.SummaryPDF(patient.ID, time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("Failed to render summary: %v", err)
+    }
+    checkPDF(t, document)
+
+    for _, want := range []string{"(Jane Doe)", "(5 May 1995)", "(456 Elm St)", "(Generated 2 January 2030 03:04 UTC)", `(Visit 0 \(follow-up\) ` + "\x97"} {
+        if !bytes.Contains(document, []byte(want)) {
+            t.Errorf("Summary does not contain %q", want)
+        }
+    }
+    if pages := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(document); pages == nil || string(pages[1]) == "1" {
+        t.Errorf("A long history should span several pages")
+    }
+
+    if _, err := env.PatientService.SummaryPDF(patient.ID+100, time.Now()); service.AsError(err).Kind != service.KindNotFound {
+        t.Errorf("Unknown patient: expected not found, got %v", err)
+    }
+
+    // Latin-1 accents are in the fonts' encoding; other scripts are refused
+    // rather than printed as question marks.
+    accented := seedPatient(t, env.DB, "José")
+    if document, err := env.PatientService.SummaryPDF(accented.ID, time.Now()); err != nil || !bytes.Contains(document, []byte("(Jos\xe9 Doe)")) {
+        t.Errorf("Accented name: %v", err)
+    }
+    cyrillic := seedPatient(t, env.DB, "Анна")
+    document, err = env.PatientService.SummaryPDF(cyrillic.ID, time.Now())
+    if serviceErr := service.AsError(err); serviceErr.Kind != service.KindUnprocessable || serviceErr.Code != "unsupported_text" || document != nil {
+        t.Errorf("Cyrillic name: expected unsupported_text, got %d bytes, %v", len(document), err)
+    }
+    if _, err := pdf.New("Summary").WriteTo(io.Discard); err != nil {
+        t.Errorf("Empty document: %v", err)
+    }
+    doc := pdf.New("Summary")
+    doc.Text("李")
+    if n, err := doc.WriteTo(io.Discard); !errors.Is(err, pdf.ErrUnsupportedText) || n != 0 {
+        t.Errorf("WriteTo with CJK text = %d, %v; want ErrUnsupportedText", n, err)
+    }
+}
+
+// checkPDF verifies the file structure: header, trailer and that every
+// cross-reference entry points at its object.
+func checkPDF(t *testing.T, document []byte) {
+    t.Helper()
+
+    if !bytes.HasPrefix(document, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(document, []byte("%%EOF\n")) {
+        t.Fatalf("Not a PDF file")
+    }
+    startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(document)
+    if startxref == nil {
+        t.Fatalf("Missing startxref")
+    }
+    xref, _ := strconv.Atoi(string(startxref[1]))
+    if !bytes.HasPrefix(document[xref:], []byte("xref\n")) {
+        t.Fatalf("startxref does not point at the xref table")
+    }
+    entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(document[xref:], -1)
+    for i, entry := range entries {
+        offset, _ := strconv.Atoi(string(entry[1]))
+        if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(document[offset:], []byte(want)) {
+            t.Errorf("xref entry %d points at %q", i+1, document[offset:offset+10])
+        }
+    }
+}
+
+func TestAPI_ExportPatients(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    seedPatient(t, env.DB, "John")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    summaryPath := fmt.Sprintf("/api/patients/%d/summary.pdf", patient.ID)
+    greek := seedPatient(t, env.DB, "Ελένη")
+    tests := []struct {
+        name            string
+        path            string
+        token           string
+        wantStatus      int
+        wantContentType string
+        wantLines       int
+    }{
+        {name: "receptionist cannot export", path: "/api/patients/export", token: receptionist, wantStatus: http.StatusForbidden},
+        {name: "anonymous", path: "/api/patients/export", wantStatus: http.StatusUnauthorized},
+        {name: "invalid format", path: "/api/patients/export?format=xlsx", token: admin, wantStatus: http.StatusBadRequest, wantContentType: "application/json; charset=utf-8"},
+        {name: "csv by default", path: "/api/patients/export", token: admin, wantStatus: http.StatusOK, wantContentType: "text/csv; charset=utf-8", wantLines: 4},
+        {name: "ndjson", path: "/api/patients/export?format=ndjson&name=jan", token: admin, wantStatus: http.StatusOK, wantContentType: "application/x-ndjson", wantLines: 1},
+        {name: "receptionist summary", path: summaryPath, token: receptionist, wantStatus: http.StatusOK, wantContentType: "application/pdf"},
+        {name: "doctor summary", path: summaryPath, token: doctor, wantStatus: http.StatusOK, wantContentType: "application/pdf"},
+        {name: "unknown patient summary", path: "/api/patients/9999/summary.pdf", token: doctor, wantStatus: http.StatusNotFound},
+        {name: "non-Latin summary", path: fmt.Sprintf("/api/patients/%d/summary.pdf", greek.ID), token: doctor, wantStatus: http.StatusUnprocessableEntity, wantContentType: "application/json; charset=utf-8"},
+        {name: "anonymous summary", path: summaryPath, wantStatus: http.StatusUnauthorized},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, http.MethodGet, tt.path, tt.token, nil)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+                t.Errorf("Content-Type = %q, want %q", w.Header().Get("Content-Type"), tt.wantContentType)
+            }
+            if tt.wantLines > 0 && strings.Count(w.Body.String(), "\n") != tt.wantLines {
+                t.Errorf("Got %q, want %d lines", w.Body.String(), tt.wantLines)
+            }
+            if tt.wantContentType == "application/pdf" {
+                checkPDF(t, w.Body.Bytes())
+            }
+        })
+    }
+
+    var logs service.AuditLogListResponse
+    decodeJSON(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/admin/audit-logs?patient_id=%d", patient.ID), admin, nil), &logs)
+    var actions []string
+    for _, entry := range logs.Data {
+        actions = append(actions, entry.Action)
+    }
+    want := []string{"patient.summary", "patient.summary", "patient.export", "patient.export"}
+    if !reflect.DeepEqual(actions, want) {
+        t.Errorf("Actions = %v, want %v", actions, want)
+    }
+}
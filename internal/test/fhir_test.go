@@ -0,0 +1,261 @@
+package test
+
+import (
+    "errors"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "makerble-assessment/internal/fhir"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestFHIRPatient_Mapping(t *testing.T) {
+    patient := service.PatientResponse{ID: 7, FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Contact: "+44 20 7946 0000", Address: "1 Elm St", Version: 3}
+    resource := fhir.NewPatient(patient)
+    want := fhir.Patient{
+        ResourceType: "Patient",
+        ID:           "7",
+        Meta:         &fhir.Meta{VersionID: "3"},
+        Name:         []fhir.HumanName{{Use: "official", Family: "Doe", Given: []string{"Jane"}}},
+        Telecom:      []fhir.ContactPoint{{System: "phone", Value: "+44 20 7946 0000"}},
+        Gender:       "female",
+        BirthDate:    "1995-05-05",
+        Address:      []fhir.Address{{Use: "home", Text: "1 Elm St"}},
+    }
+    if !reflect.DeepEqual(resource, want) {
+        t.Errorf("NewPatient = %+v, want %+v", resource, want)
+    }
+    input, err := resource.PatientInput()
+    wantInput := service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Contact: "+44 20 7946 0000", Address: "1 Elm St"}
+    if err != nil || input != wantInput {
+        t.Errorf("Round trip = %+v, %v; want %+v", input, err, wantInput)
+    }
+
+    tests := []struct {
+        name       string
+        resource   fhir.Patient
+        want       service.CreatePatientInput
+        wantFields []string
+    }{
+        {
+            name: "official name, current phone and structured address",
+            resource: fhir.Patient{
+                ResourceType: "Patient",
+                Name:         []fhir.HumanName{{Use: "old", Family: "Smith", Given: []string{"J"}}, {Use: "official", Family: "Doe", Given: []string{"Mary", "Jane"}}},
+                Telecom:      []fhir.ContactPoint{{System: "email", Value: "jane@example.com"}, {System: "phone", Use: "old", Value: "111"}, {System: "phone", Value: "222"}},
+                Gender:       "other",
+                BirthDate:    "1980-02-29",
+                Address:      []fhir.Address{{Use: "old", Text: "Gone"}, {Line: []string{"1 Elm St", "Flat 2"}, City: "Leeds", PostalCode: "LS1 1AA"}},
+            },
+            want: service.CreatePatientInput{FirstName: "Mary Jane", LastName: "Doe", DateOfBirth: "1980-02-29T00:00:00Z", Gender: "Other", Contact: "222", Address: "1 Elm St, Flat 2, Leeds, LS1 1AA"},
+        },
+        {
+            name:     "usual name without contact details",
+            resource: fhir.Patient{ResourceType: "Patient", Name: []fhir.HumanName{{Use: "maiden", Family: "Roe"}, {Use: "usual", Family: "Doe", Given: []string{"Jo"}}}, Gender: "male", BirthDate: "2001-12-31"},
+            want:     service.CreatePatientInput{FirstName: "Jo", LastName: "Doe", DateOfBirth: "2001-12-31T00:00:00Z", Gender: "Male"},
+        },
+        {
+            name:       "everything missing",
+            resource:   fhir.Patient{ResourceType: "Observation"},
+            wantFields: []string{"Patient.resourceType", "Patient.name.given", "Patient.name.family", "Patient.birthDate", "Patient.gender"},
+        },
+        {
+            name:       "partial date and unknown gender",
+            resource:   fhir.Patient{ResourceType: "Patient", Name: []fhir.HumanName{{Family: "Doe", Given: []string{"Jo"}}}, Gender: "unknown", BirthDate: "1980"},
+            wantFields: []string{"Patient.birthDate", "Patient.gender"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            input, err := tt.resource.PatientInput()
+            if tt.wantFields == nil {
+                if err != nil || input != tt.want {
+                    t.Errorf("PatientInput = %+v, %v; want %+v", input, err, tt.want)
+                }
+                return
+            }
+            var fields []string
+            for _, field := range service.AsError(err).Fields {
+                fields = append(fields, field.Field)
+            }
+            if !reflect.DeepEqual(fields, tt.wantFields) {
+                t.Errorf("Invalid fields = %v, want %v", fields, tt.wantFields)
+            }
+        })
+    }
+}
+
+func TestAPI_FHIRPatient(t *testing.T) {
+    env := newTestEnv(t)
+    seedPatient(t, env.DB, "Janet")
+    seedPatient(t, env.DB, "John")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+
+    // The capability statement is public.
+    w := env.do(t, http.MethodGet, "/fhir/metadata", "", nil)
+    var capability fhir.CapabilityStatement
+    decodeJSON(t, w, &capability)
+    if w.Code != http.StatusOK || capability.FHIRVersion != "4.0.1" || capability.Rest[0].Resource[0].Type != "Patient" || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/fhir+json") {
+        t.Fatalf("Metadata: status %d, %+v", w.Code, capability)
+    }
+
+    create := fhir.Patient{
+        ResourceType: "Patient",
+        Name:         []fhir.HumanName{{Use: "official", Family: "Doe", Given: []string{"Jane"}}},
+        Telecom:      []fhir.ContactPoint{{System: "phone", Value: "5551234567"}},
+        Gender:       "female",
+        BirthDate:    "1990-01-01",
+        Address:      []fhir.Address{{Text: "1 Oak Ave"}},
+    }
+    w = env.do(t, http.MethodPost, "/fhir/Patient", receptionist, create)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Create: status %d: %s", w.Code, w.Body.String())
+    }
+    var created fhir.Patient
+    decodeJSON(t, w, &created)
+    path := "/fhir/Patient/" + created.ID
+    if w.Header().Get("Location") != "http://example.com"+path+"/_history/1" || w.Header().Get("ETag") != `W/"1"` || created.Telecom[0].Value != "5551234567" {
+        t.Errorf("Create: Location %q, ETag %q, %+v", w.Header().Get("Location"), w.Header().Get("ETag"), created)
+    }
+
+    w = env.do(t, http.MethodGet, path, doctor, nil)
+    var read fhir.Patient
+    decodeJSON(t, w, &read)
+    if w.Code != http.StatusOK || !reflect.DeepEqual(read, created) || w.Header().Get("ETag") != `W/"1"` {
+        t.Errorf("Read: status %d, %+v", w.Code, read)
+    }
+
+    // An update replaces the resource: the address left out is cleared.
+    update := created
+    update.Telecom = []fhir.ContactPoint{{System: "phone", Value: "5559999999"}}
+    update.Address = nil
+    w = env.doWithHeaders(t, http.MethodPut, path, receptionist, map[string]string{"If-Match": `W/"1"`}, update)
+    var updated fhir.Patient
+    decodeJSON(t, w, &updated)
+    if w.Code != http.StatusOK || updated.Meta.VersionID != "2" || updated.Telecom[0].Value != "5559999999" || updated.Address != nil || w.Header().Get("ETag") != `W/"2"` {
+        t.Errorf("Update: status %d, %+v", w.Code, updated)
+    }
+
+    id := created.ID
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        headers    map[string]string
+        body       interface{}
+        wantStatus int
+        wantIssue  string
+    }{
+        {name: "stale version", method: http.MethodPut, path: path, token: receptionist, headers: map[string]string{"If-Match": `W/"1"`}, body: update, wantStatus: http.StatusPreconditionFailed, wantIssue: "conflict"},
+        {name: "no If-Match", method: http.MethodPut, path: path, token: receptionist, body: update, wantStatus: http.StatusPreconditionRequired, wantIssue: "required"},
+        {name: "id mismatch", method: http.MethodPut, path: "/fhir/Patient/9999", token: receptionist, headers: map[string]string{"If-Match": "*"}, body: update, wantStatus: http.StatusBadRequest, wantIssue: "invalid"},
+        {name: "invalid resource", method: http.MethodPost, path: "/fhir/Patient", token: receptionist, body: fhir.Patient{ResourceType: "Patient"}, wantStatus: http.StatusBadRequest, wantIssue: "invalid"},
+        {name: "malformed body", method: http.MethodPost, path: "/fhir/Patient", token: receptionist, body: []byte("{"), wantStatus: http.StatusBadRequest, wantIssue: "invalid"},
+        {name: "unknown patient", method: http.MethodGet, path: "/fhir/Patient/9999", token: doctor, wantStatus: http.StatusNotFound, wantIssue: "not-found"},
+        {name: "anonymous", method: http.MethodGet, path: path, wantStatus: http.StatusUnauthorized, wantIssue: "login"},
+        {name: "doctor cannot create", method: http.MethodPost, path: "/fhir/Patient", token: doctor, body: create, wantStatus: http.StatusForbidden, wantIssue: "forbidden"},
+        {name: "unsupported search parameter", method: http.MethodGet, path: "/fhir/Patient?identifier=123", token: doctor, wantStatus: http.StatusBadRequest, wantIssue: "invalid"},
+        {name: "invalid birthdate", method: http.MethodGet, path: "/fhir/Patient?birthdate=gt1990-01-01", token: doctor, wantStatus: http.StatusBadRequest, wantIssue: "invalid"},
+        {name: "update unknown patient", method: http.MethodPut, path: "/fhir/Patient/9999", token: receptionist, headers: map[string]string{"If-Match": "*"}, body: func() fhir.Patient { p := update; p.ID = "9999"; return p }(), wantStatus: http.StatusNotFound, wantIssue: "not-found"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, tt.method, tt.path, tt.token, tt.headers, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            var outcome fhir.OperationOutcome
+            decodeJSON(t, w, &outcome)
+            if outcome.ResourceType != "OperationOutcome" || len(outcome.Issue) == 0 || outcome.Issue[0].Code != tt.wantIssue || outcome.Issue[0].Severity != "error" {
+                t.Errorf("Unexpected outcome: %s", w.Body.String())
+            }
+            if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/fhir+json") {
+                t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+            }
+        })
+    }
+
+    searches := []struct {
+        query     string
+        wantNames []string
+        wantTotal int64
+        wantNext  bool
+    }{
+        {query: "name=jan", wantNames: []string{"Janet", "Jane"}, wantTotal: 2},
+        {query: "family=doe&gender=female&birthdate=ge1990-01-01", wantNames: []string{"Janet", "John", "Jane"}, wantTotal: 3},
+        {query: "birthdate=le1994-12-31", wantNames: []string{"Jane"}, wantTotal: 1},
+        {query: "birthdate=1990-01-01", wantNames: []string{"Jane"}, wantTotal: 1},
+        {query: "birthdate=le1990-01-01&birthdate=ge1990-01-01", wantNames: []string{"Jane"}, wantTotal: 1},
+        {query: "gender=male", wantNames: []string{}, wantTotal: 0},
+        {query: "_count=1&page=1", wantNames: []string{"Janet"}, wantTotal: 3, wantNext: true},
+    }
+    for _, tt := range searches {
+        t.Run("search "+tt.query, func(t *testing.T) {
+            w := env.do(t, http.MethodGet, "/fhir/Patient?"+tt.query, doctor, nil)
+            if w.Code != http.StatusOK {
+                t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+            }
+            var bundle fhir.Bundle
+            decodeJSON(t, w, &bundle)
+            names := []string{}
+            for _, entry := range bundle.Entry {
+                names = append(names, entry.Resource.Name[0].Given[0])
+                if entry.FullURL != "http://example.com/fhir/Patient/"+entry.Resource.ID {
+                    t.Errorf("fullUrl = %q", entry.FullURL)
+                }
+            }
+            if bundle.Type != "searchset" || bundle.Total != tt.wantTotal || !reflect.DeepEqual(sorted(names), sorted(tt.wantNames)) {
+                t.Errorf("Bundle: total %d, names %v; want %d, %v", bundle.Total, names, tt.wantTotal, tt.wantNames)
+            }
+            hasNext := false
+            for _, link := range bundle.Link {
+                hasNext = hasNext || link.Relation == "next" && strings.Contains(link.URL, "page=2")
+            }
+            if hasNext != tt.wantNext || bundle.Link[0].Relation != "self" {
+                t.Errorf("Links = %+v", bundle.Link)
+            }
+        })
+    }
+
+    // Reads and writes are audited like the rest of the API.
+    var actions []string
+    var entries []model.AuditLog
+    env.DB.Where("patient_id = ?", id).Order("id").Find(&entries)
+    for _, entry := range entries {
+        actions = append(actions, entry.Action)
+    }
+    if len(actions) < 3 || actions[0] != model.AuditPatientCreate || actions[1] != model.AuditPatientRead || actions[2] != model.AuditPatientUpdate {
+        t.Errorf("Audit actions = %v", actions)
+    }
+}
+
+func TestPatientService_Replace(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        svc := newPatientService(store)
+        created, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1990-01-01T00:00:00Z", Gender: "Female", Contact: "555", Address: "1 Elm St"})
+        if err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+
+        replaced, err := svc.Replace(0, created.ID, created.Version, service.CreatePatientInput{FirstName: "Janet", LastName: "Doe", DateOfBirth: "1991-01-01T00:00:00Z", Gender: "Other"})
+        if err != nil || replaced.FirstName != "Janet" || replaced.Contact != "" || replaced.Address != "" || replaced.Version != 2 {
+            t.Errorf("Replace = %+v, %v", replaced, err)
+        }
+        if _, err := svc.Replace(0, created.ID, created.Version, service.CreatePatientInput{FirstName: "Jo", LastName: "Doe", DateOfBirth: "1991-01-01T00:00:00Z", Gender: "Other"}); !errors.Is(err, service.ErrVersionConflict) {
+            t.Errorf("Stale replace: expected ErrVersionConflict, got %v", err)
+        }
+        if _, err := svc.Replace(0, created.ID+100, 0, service.CreatePatientInput{FirstName: "Jo", LastName: "Doe", DateOfBirth: "1991-01-01T00:00:00Z", Gender: "Other"}); service.AsError(err).Kind != service.KindNotFound {
+            t.Errorf("Unknown patient: expected not found, got %v", err)
+        }
+        if _, err := svc.Replace(0, created.ID, 0, service.CreatePatientInput{FirstName: "Jo", LastName: "Doe", DateOfBirth: "yesterday", Gender: "Other"}); !errors.Is(err, service.ErrInvalidDateOfBirth) {
+            t.Errorf("Invalid date: expected ErrInvalidDateOfBirth, got %v", err)
+        }
+    })
+}
@@ -0,0 +1,227 @@
+package test
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http/httptest"
+    "sort"
+    "testing"
+    "time"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/fieldcrypt"
+    "makerble-assessment/internal/migration"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/router"
+    "makerble-assessment/internal/service"
+    "makerble-assessment/internal/token"
+)
+
+// Credentials of the users seeded by the 0002_seed_default_users and
+// 0006_admin_users migrations.
+const (
+    receptionistEmail = "recep@example.com"
+    doctorEmail       = "doc@example.com"
+    adminEmail        = "admin@example.com"
+    seedPassword      = "password123"
+    testJWTSecret     = "test-secret"
+)
+
+// testEncryptionKey is the field encryption key every test database uses.
+var testEncryptionKey = bytes.Repeat([]byte{7}, fieldcrypt.KeySize)
+
+func init() {
+    gin.SetMode(gin.TestMode)
+
+    key, err := fieldcrypt.NewKey("test", testEncryptionKey)
+    if err != nil {
+        panic(err)
+    }
+    ring, err := fieldcrypt.NewKeyRing(key)
+    if err != nil {
+        panic(err)
+    }
+    fieldcrypt.Use(ring)
+}
+
+// testEnv is a fully wired application backed by a private in-memory SQLite
+// database, so tests need neither MySQL nor a .env file.
+type testEnv struct {
+    DB             *gorm.DB
+    PatientService *service.PatientService
+    AuthService    *service.AuthService
+    Router         *gin.Engine
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+    t.Helper()
+
+    db, err := config.DBConfig{Driver: config.DriverSQLite}.Open()
+    if err != nil {
+        t.Fatalf("Failed to open test database: %v", err)
+    }
+    if _, err := migration.NewMigrator(db).Up(); err != nil {
+        t.Fatalf("Failed to migrate test database: %v", err)
+    }
+
+    t.Cleanup(func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+    return db
+}
+
+// forEachPatientStore runs fn as a subtest against a fresh GORM store and a
+// fresh in-memory store, so the in-memory store stays a faithful fake. The
+// GORM store uses FTS5 when built with -tags sqlite_fts5.
+func forEachPatientStore(t *testing.T, fn func(t *testing.T, store repository.PatientStore)) {
+    t.Helper()
+
+    stores := []struct {
+        name  string
+        store func() repository.PatientStore
+    }{
+        {"gorm", func() repository.PatientStore { return repository.NewPatientRepository(newTestDB(t)) }},
+        {"memory", func() repository.PatientStore { return repository.NewMemoryPatientRepository() }},
+    }
+    for _, s := range stores {
+        t.Run(s.name, func(t *testing.T) {
+            fn(t, s.store())
+        })
+    }
+}
+
+// newPatientService serves patients from store, with in-memory history,
+// audit and identifier stores.
+func newPatientService(store repository.PatientStore) *service.PatientService {
+    return service.NewPatientService(repository.Stores{
+        Patients:    store,
+        History:     repository.NewMemoryMedicalHistoryRepository(),
+        Audit:       repository.NewMemoryAuditLogRepository(),
+        Identifiers: repository.NewMemoryPatientIdentifierRepository(),
+    })
+}
+
+func newTestKeys(t *testing.T) *token.KeySet {
+    t.Helper()
+
+    keys, err := token.NewKeySet(token.NewHMACKey("", []byte(testJWTSecret)))
+    if err != nil {
+        t.Fatalf("Failed to build key set: %v", err)
+    }
+    return keys
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+    t.Helper()
+
+    db := newTestDB(t)
+    keys := newTestKeys(t)
+    // The seeded doctor role requires two-factor authentication. Most tests
+    // sign doctors in with their password alone; the two-factor tests turn
+    // it back on.
+    setTwoFactorRequired(t, db, model.RoleDoctor, false)
+    return &testEnv{
+        DB:             db,
+        PatientService: service.NewPatientService(repository.NewTransactor(db)),
+        AuthService:    service.NewAuthService(repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db), keys, service.DefaultAuthConfig()),
+        Router:         router.New(db, router.Config{Keys: keys, Auth: service.DefaultAuthConfig()}),
+    }
+}
+
+func setTwoFactorRequired(t *testing.T, db *gorm.DB, role string, required bool) {
+    t.Helper()
+
+    if err := db.Model(&model.Role{}).Where("name = ?", role).Update("two_factor_required", required).Error; err != nil {
+        t.Fatalf("Failed to set the two-factor policy of %s: %v", role, err)
+    }
+}
+
+func seedPatient(t *testing.T, db *gorm.DB, firstName string) model.Patient {
+    t.Helper()
+
+    dob, _ := time.Parse(time.RFC3339, "1995-05-05T00:00:00Z")
+    patient := model.Patient{
+        FirstName:   firstName,
+        LastName:    "Doe",
+        DateOfBirth: dob,
+        Gender:      "Female",
+        Contact:     "9876543210",
+        Address:     "456 Elm St",
+    }
+    if err := db.Create(&patient).Error; err != nil {
+        t.Fatalf("Failed to seed test patient: %v", err)
+    }
+    return patient
+}
+
+func mustDate(t *testing.T, value string) time.Time {
+    t.Helper()
+
+    date, err := time.Parse("2006-01-02", value)
+    if err != nil {
+        t.Fatalf("Invalid test date %q: %v", value, err)
+    }
+    return date
+}
+
+func sorted(values []string) []string {
+    out := append([]string(nil), values...)
+    sort.Strings(out)
+    return out
+}
+
+func (env *testEnv) login(t *testing.T, email string) string {
+    t.Helper()
+
+    tokens, err := env.AuthService.Login(service.LoginInput{Email: email, Password: seedPassword})
+    if err != nil {
+        t.Fatalf("Failed to log in as %s: %v", email, err)
+    }
+    return tokens.Token
+}
+
+// do sends a request through the router. A non-empty token is sent as a
+// Bearer Authorization header and a non-nil body is encoded as JSON, unless
+// it is a []byte, which is sent as it is.
+func (env *testEnv) do(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+    t.Helper()
+    return env.doWithHeaders(t, method, path, token, nil, body)
+}
+
+// doWithHeaders is do with extra request headers.
+func (env *testEnv) doWithHeaders(t *testing.T, method, path, token string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+    t.Helper()
+
+    payload, raw := body.([]byte)
+    if body != nil && !raw {
+        var err error
+        if payload, err = json.Marshal(body); err != nil {
+            t.Fatalf("Failed to encode request body: %v", err)
+        }
+    }
+
+    req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+    req.Header.Set("Content-Type", "application/json")
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    for name, value := range headers {
+        req.Header.Set(name, value)
+    }
+
+    w := httptest.NewRecorder()
+    env.Router.ServeHTTP(w, req)
+    return w
+}
+
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+    t.Helper()
+
+    if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+        t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+    }
+}
@@ -0,0 +1,359 @@
+package test
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "net"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+    "makerble-assessment/internal/hl7"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+// adtMessage builds an ADT message of event with the given PID fields
+// (PID-1 onwards), segments separated by carriage returns.
+func adtMessage(event, controlID string, pid ...string) string {
+    return "MSH|^~\\&|PAS|GENERAL|MAKERBLE|HOSPITAL|20260101120000||ADT^" + event + "^ADT_A01|" + controlID + "|P|2.5.1\r" +
+        "EVN|" + event + "|20260101120000\r" +
+        "PID|" + strings.Join(pid, "|") + "\r" +
+        "PV1|1|I"
+}
+
+func TestHL7_Parse(t *testing.T) {
+    message, err := hl7.Parse([]byte("MSH#$*@!#PAS#GENERAL\nPID#1##123$$$AUTH$MR*456##O@F@Brien$Mary Jane$$$$$L##"))
+    if err != nil {
+        t.Fatalf("Failed to parse: %v", err)
+    }
+    if message.Delimiters != (hl7.Delimiters{Field: '#', Component: '$', Repetition: '*', Escape: '@', Subcomponent: '!'}) {
+        t.Errorf("Delimiters = %+v", message.Delimiters)
+    }
+    if got := message.Segment("MSH").Field(3); got != "PAS" {
+        t.Errorf("MSH-3 = %q, want PAS", got)
+    }
+    if got := message.Segment("MSH").Field(1); got != "#" {
+        t.Errorf("MSH-1 = %q, want #", got)
+    }
+    identifiers := message.Repetitions(message.Segment("PID").Field(3))
+    if len(identifiers) != 2 || message.Component(identifiers[0], 4) != "AUTH" || message.Component(identifiers[1], 1) != "456" {
+        t.Errorf("PID-3 = %q", identifiers)
+    }
+    if got := message.Value("PID", 5, 1); got != "O#Brien" {
+        t.Errorf("Unescaped family name = %q, want O#Brien", got)
+    }
+    if got := message.Value("PID", 5, 2); got != "Mary Jane" {
+        t.Errorf("Given name = %q", got)
+    }
+    if got := message.Value("PID", 40, 1); got != "" {
+        t.Errorf("Missing field = %q", got)
+    }
+    if got := message.Value("ZZZ", 1, 1); got != "" {
+        t.Errorf("Missing segment = %q", got)
+    }
+
+    escaped := hl7.DefaultDelimiters.Escaped(`a|b^c~d\e&f`)
+    if escaped != `a\F\b\S\c\R\d\E\e\T\f` {
+        t.Errorf("Escaped = %q", escaped)
+    }
+    if got := (&hl7.Message{Delimiters: hl7.DefaultDelimiters}).Unescape(escaped + `\.br\`); got != `a|b^c~d\e&f` {
+        t.Errorf("Unescape(Escaped) = %q", got)
+    }
+
+    for _, data := range []string{"", "PID|1", "MSH|^~", "MSH|^^\\&", "MSHA^~\\&"} {
+        if _, err := hl7.Parse([]byte(data)); !errors.Is(err, hl7.ErrNoHeader) {
+            t.Errorf("Parse(%q): expected ErrNoHeader, got %v", data, err)
+        }
+    }
+}
+
+func TestHL7_PatientFromPID(t *testing.T) {
+    tests := []struct {
+        name           string
+        pid            []string
+        wantIdentifier service.PatientIdentifier
+        wantInput      service.CreatePatientInput
+        wantClear      []string
+        wantIssues     []string
+    }{
+        {
+            name:           "full record",
+            pid:            []string{"1", "", "X1^^^LAB^PI~12345^^^CITY^MR", "", "Roe^Jo^^^^^M~Doe^Jane^Ann^^^^L", "", "19850314083000", "F", "", "", "12 High St^Flat 3^Leeds^^LS1 1AA^GBR^H", "", "^NET^Internet^jane@example.com~(020) 7946 0000^PRN^PH", "", "", "", "", "", ""},
+            wantIdentifier: service.PatientIdentifier{System: "CITY", Value: "12345"},
+            wantInput:      service.CreatePatientInput{FirstName: "Jane Ann", LastName: "Doe", DateOfBirth: "1985-03-14T00:00:00Z", Gender: "Female", Contact: "(020) 7946 0000", Address: "12 High St, Flat 3, Leeds, LS1 1AA, GBR"},
+        },
+        {
+            name:           "sending facility issues the identifier; phone from parts",
+            pid:            []string{"1", "", "777", "", "Smith^John", "", "19700101", "M", "", "", "", "", "^PRN^PH^^44^20^79460000^12", "555"},
+            wantIdentifier: service.PatientIdentifier{System: "GENERAL", Value: "777"},
+            wantInput:      service.CreatePatientInput{FirstName: "John", LastName: "Smith", DateOfBirth: "1970-01-01T00:00:00Z", Gender: "Male", Contact: "+44 20 79460000 x12"},
+        },
+        {
+            name:           "business phone when home is empty; nulls clear",
+            pid:            []string{"1", "", "777", "", "Smith^Sam", "", "19700101", "A", "", "", `""`, "", "", "555-0100"},
+            wantIdentifier: service.PatientIdentifier{System: "GENERAL", Value: "777"},
+            wantInput:      service.CreatePatientInput{FirstName: "Sam", LastName: "Smith", DateOfBirth: "1970-01-01T00:00:00Z", Gender: "Other", Contact: "555-0100"},
+            wantClear:      []string{"address"},
+        },
+        {
+            name:           "null phone",
+            pid:            []string{"1", "", "777", "", "Smith^Sam", "", "19700101", "O", "", "", "", "", `""`},
+            wantIdentifier: service.PatientIdentifier{System: "GENERAL", Value: "777"},
+            wantInput:      service.CreatePatientInput{FirstName: "Sam", LastName: "Smith", DateOfBirth: "1970-01-01T00:00:00Z", Gender: "Other"},
+            wantClear:      []string{"contact"},
+        },
+        {
+            name:       "nothing usable",
+            pid:        []string{"1", "", "", "", "Smith", "", "1970", "U"},
+            wantIssues: []string{"PID-3", "PID-5", "PID-7", "PID-8"},
+        },
+        {
+            name:       "invalid date",
+            pid:        []string{"1", "", "777", "", "Smith^Sam", "", "19701301", "M"},
+            wantIssues: []string{"PID-7"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            message, err := hl7.Parse([]byte(adtMessage("A01", "1", tt.pid...)))
+            if err != nil {
+                t.Fatalf("Failed to parse: %v", err)
+            }
+            identifier, input, clear, issues := hl7.PatientFromPID(message)
+            var locations []string
+            for _, issue := range issues {
+                locations = append(locations, issue.Location)
+            }
+            if !reflect.DeepEqual(locations, tt.wantIssues) {
+                t.Fatalf("Issues = %v, want %v", issues, tt.wantIssues)
+            }
+            if identifier != tt.wantIdentifier || input != tt.wantInput || !reflect.DeepEqual(clear, tt.wantClear) {
+                t.Errorf("PatientFromPID = %+v, %+v, %v; want %+v, %+v, %v", identifier, input, clear, tt.wantIdentifier, tt.wantInput, tt.wantClear)
+            }
+        })
+    }
+
+    message, _ := hl7.Parse([]byte("MSH|^~\\&|PAS|GENERAL|||||ADT^A01|1|P|2.5.1"))
+    if _, _, _, issues := hl7.PatientFromPID(message); len(issues) != 1 || issues[0].Location != "PID" {
+        t.Errorf("Expected a missing PID segment to be reported, got %v", issues)
+    }
+}
+
+func TestHL7_ReadMessage(t *testing.T) {
+    var stream bytes.Buffer
+    stream.WriteString("\r\n")
+    hl7.WriteMessage(&stream, []byte("first"))
+    hl7.WriteMessage(&stream, bytes.Repeat([]byte("x"), 5000))
+    hl7.WriteMessage(&stream, []byte("third"))
+    reader := bufio.NewReader(&stream)
+
+    for _, want := range []string{"first", strings.Repeat("x", 5000), "third"} {
+        message, err := hl7.ReadMessage(reader, 5000)
+        if err != nil || string(message) != want {
+            t.Fatalf("ReadMessage = %.20q, %v; want %.20q", message, err, want)
+        }
+    }
+    if _, err := hl7.ReadMessage(reader, 5000); err == nil {
+        t.Error("Expected an error at the end of the stream")
+    }
+
+    stream.Reset()
+    hl7.WriteMessage(&stream, bytes.Repeat([]byte("x"), 5001))
+    if _, err := hl7.ReadMessage(bufio.NewReader(&stream), 5000); !errors.Is(err, hl7.ErrMessageTooLarge) {
+        t.Errorf("Expected ErrMessageTooLarge, got %v", err)
+    }
+    if _, err := hl7.ReadMessage(bufio.NewReader(strings.NewReader("\x0bcut short")), 5000); err == nil {
+        t.Error("Expected an error for an unterminated frame")
+    }
+}
+
+// startHL7Server serves ingester on a local port and returns a client
+// connected to it.
+func startHL7Server(t *testing.T, ingester *hl7.Ingester) *hl7.Client {
+    t.Helper()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Failed to listen: %v", err)
+    }
+    server := &hl7.Server{Handler: ingester, IdleTimeout: time.Minute}
+    done := make(chan error, 1)
+    go func() { done <- server.Serve(listener) }()
+
+    client, err := hl7.Dial(listener.Addr().String(), 5*time.Second)
+    if err != nil {
+        t.Fatalf("Failed to connect: %v", err)
+    }
+    t.Cleanup(func() {
+        client.Close()
+        server.Close()
+        if err := <-done; !errors.Is(err, hl7.ErrServerClosed) {
+            t.Errorf("Serve returned %v", err)
+        }
+    })
+    return client
+}
+
+func TestHL7_Ingest(t *testing.T) {
+    db := newTestDB(t)
+    patients := service.NewPatientService(repository.NewTransactor(db))
+    deadLetters := service.NewDeadLetterService(repository.NewDeadLetterRepository(db))
+    client := startHL7Server(t, hl7.NewIngester(patients, deadLetters))
+
+    send := func(message string) *hl7.Message {
+        t.Helper()
+        reply, err := client.Send([]byte(message))
+        if err != nil {
+            t.Fatalf("Failed to send: %v", err)
+        }
+        ack, err := hl7.Parse(reply)
+        if err != nil {
+            t.Fatalf("Failed to parse ACK %q: %v", reply, err)
+        }
+        return ack
+    }
+    findPatient := func(system, value string) model.Patient {
+        t.Helper()
+        var identifier model.PatientIdentifier
+        if err := db.Where(&model.PatientIdentifier{System: system, Value: value}).First(&identifier).Error; err != nil {
+            t.Fatalf("No patient for %s %s: %v", system, value, err)
+        }
+        var patient model.Patient
+        if err := db.Unscoped().First(&patient, identifier.PatientID).Error; err != nil {
+            t.Fatalf("Failed to load patient: %v", err)
+        }
+        return patient
+    }
+
+    // Admission creates the patient; the ACK goes back to the sender.
+    ack := send(adtMessage("A01", "MSG1", "1", "", "12345^^^CITY^MR", "", "Doe^Jane", "", "19850314", "F", "", "", "12 High St^^Leeds", "", "5551234567"))
+    if ack.Value("MSA", 1, 1) != hl7.AckAccept || ack.Value("MSA", 2, 1) != "MSG1" {
+        t.Fatalf("A01: unexpected ACK %+v", ack.Segments)
+    }
+    msh := ack.Segment("MSH")
+    if msh.Field(3) != "MAKERBLE" || msh.Field(5) != "PAS" || msh.Field(6) != "GENERAL" || ack.Value("MSH", 9, 1) != "ACK" || ack.Value("MSH", 9, 2) != "A01" || msh.Field(12) != "2.5.1" || msh.Field(10) == "MSG1" {
+        t.Errorf("A01: unexpected ACK header %q", msh.Fields)
+    }
+    jane := findPatient("CITY", "12345")
+    if jane.FirstName != "Jane" || jane.DateOfBirth.Format("2006-01-02") != "1985-03-14" || jane.Contact != "5551234567" || jane.Address != "12 High St, Leeds" || jane.Version != 1 {
+        t.Errorf("A01: stored %+v", jane)
+    }
+
+    // An update with the same identifier changes that patient: an empty
+    // phone is left alone and a null address is cleared.
+    ack = send(adtMessage("A08", "MSG2", "1", "", "12345^^^CITY^MR", "", "Doe^Janet", "", "19850314", "F", "", "", `""`, "", ""))
+    updated := findPatient("CITY", "12345")
+    if ack.Value("MSA", 1, 1) != hl7.AckAccept || updated.ID != jane.ID || updated.FirstName != "Janet" || updated.Contact != "5551234567" || updated.Address != "" || updated.Version != 2 {
+        t.Errorf("A08: ACK %s, stored %+v", ack.Value("MSA", 1, 1), updated)
+    }
+
+    // The same MRN from another authority is another patient.
+    ack = send(adtMessage("A04", "MSG3", "1", "", "12345^^^COUNTY^MR", "", "Roe^Richard", "", "19600101", "M"))
+    if ack.Value("MSA", 1, 1) != hl7.AckAccept || findPatient("COUNTY", "12345").ID == jane.ID {
+        t.Errorf("A04: expected a new patient, ACK %s", ack.Value("MSA", 1, 1))
+    }
+
+    var entries []model.AuditLog
+    db.Where("patient_id = ?", jane.ID).Order("id").Find(&entries)
+    if len(entries) != 2 || entries[0].Action != model.AuditPatientCreate || entries[1].Action != model.AuditPatientUpdate || entries[1].UserID != 0 {
+        t.Errorf("Audit entries = %+v", entries)
+    }
+
+    rejected := []struct {
+        name      string
+        message   string
+        wantCode  string
+        wantError string
+        wantKept  bool
+    }{
+        {name: "invalid PID", message: adtMessage("A01", "MSG4", "1", "", "999^^^CITY^MR", "", "Doe", "", "1985", "F"), wantCode: hl7.AckError, wantError: "PID^1^5", wantKept: true},
+        {name: "unsupported event", message: adtMessage("A03", "MSG5", "1", "", "12345^^^CITY^MR", "", "Doe^Jane", "", "19850314", "F"), wantCode: hl7.AckReject, wantError: "MSH^1^9"},
+        {name: "unsupported type", message: "MSH|^~\\&|LAB|GENERAL|||20260101||ORU^R01|MSG6|P|2.5.1\rOBX|1", wantCode: hl7.AckReject, wantError: "MSH^1^9"},
+        {name: "not HL7", message: "hello", wantCode: hl7.AckReject, wantError: "MSH^1^1", wantKept: true},
+    }
+    for _, tt := range rejected {
+        t.Run(tt.name, func(t *testing.T) {
+            var before int64
+            db.Model(&model.DeadLetter{}).Count(&before)
+            ack := send(tt.message)
+            if ack.Value("MSA", 1, 1) != tt.wantCode || ack.Segment("ERR").Field(2) != tt.wantError || ack.Value("MSA", 3, 1) == "" {
+                t.Errorf("Unexpected ACK %q", ack.Segments)
+            }
+            var after int64
+            db.Model(&model.DeadLetter{}).Count(&after)
+            if kept := after > before; kept != tt.wantKept {
+                t.Errorf("Kept as dead letter: %v, want %v", kept, tt.wantKept)
+            }
+        })
+    }
+
+    letters, err := deadLetters.List(0, 10)
+    if err != nil || len(letters) != 2 || !strings.HasPrefix(letters[0].Reason, "PID-5: ") || letters[0].Attempts != 1 || !strings.HasPrefix(letters[0].Source, "127.0.0.1:") {
+        t.Fatalf("Dead letters = %+v, %v", letters, err)
+    }
+    var stored model.DeadLetter
+    db.First(&stored, letters[0].ID)
+    if !strings.Contains(stored.Message, "999^^^CITY^MR") {
+        t.Errorf("Dead letter message = %q", stored.Message)
+    }
+    var raw string
+    db.Raw("SELECT message FROM dead_letters WHERE id = ?", letters[0].ID).Scan(&raw)
+    if strings.Contains(raw, "999^^^CITY^MR") {
+        t.Error("Dead letter message is stored in plain text")
+    }
+}
+
+func TestHL7_Reprocess(t *testing.T) {
+    db := newTestDB(t)
+    patients := service.NewPatientService(repository.NewTransactor(db))
+    deadLetters := service.NewDeadLetterService(repository.NewDeadLetterRepository(db))
+    ingester := hl7.NewIngester(patients, deadLetters)
+
+    admit := adtMessage("A01", "MSG1", "1", "", "12345^^^CITY^MR", "", "Doe^Jane", "", "19850314", "F")
+    update := adtMessage("A08", "MSG2", "1", "", "12345^^^CITY^MR", "", "Doe^Janet", "", "19850314", "F")
+    if ack, _ := hl7.Parse(ingester.HandleMessage("test", []byte(admit))); ack.Value("MSA", 1, 1) != hl7.AckAccept {
+        t.Fatalf("A01 not accepted: %q", ack.Segments)
+    }
+    var identifier model.PatientIdentifier
+    db.First(&identifier)
+    if err := patients.Delete(1, identifier.PatientID); err != nil {
+        t.Fatalf("Failed to delete patient: %v", err)
+    }
+
+    // An update for a patient in the trash fails until they are restored.
+    ack, _ := hl7.Parse(ingester.HandleMessage("test", []byte(update)))
+    if ack.Value("MSA", 1, 1) != hl7.AckError || ack.Segment("ERR").Field(2) != "PID^1^3" || ack.Value("ERR", 3, 1) != "204" {
+        t.Fatalf("Update of a deleted patient: %q", ack.Segments)
+    }
+    ingester.HandleMessage("test", []byte("garbage"))
+
+    results, err := ingester.Reprocess()
+    if err != nil || len(results) != 2 || results[0].Err == nil || results[0].Attempts != 2 || results[1].Err == nil {
+        t.Fatalf("Reprocess while deleted = %+v, %v", results, err)
+    }
+
+    if _, err := patients.Restore(1, identifier.PatientID); err != nil {
+        t.Fatalf("Failed to restore patient: %v", err)
+    }
+    results, err = ingester.Reprocess(results[0].ID)
+    if err != nil || len(results) != 1 || results[0].Err != nil {
+        t.Fatalf("Reprocess after restore = %+v, %v", results, err)
+    }
+    restored, _ := patients.Get(identifier.PatientID)
+    if restored.FirstName != "Janet" {
+        t.Errorf("Reprocessed update not applied: %+v", restored)
+    }
+
+    // Only the garbage is left.
+    letters, _ := deadLetters.List(0, 10)
+    if len(letters) != 1 || letters[0].Attempts != 2 {
+        t.Errorf("Dead letters = %+v", letters)
+    }
+    if _, err := ingester.Reprocess(results[0].ID); service.AsError(err).Kind != service.KindNotFound {
+        t.Errorf("Reprocessing a removed dead letter: expected not found, got %v", err)
+    }
+}
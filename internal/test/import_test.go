@@ -0,0 +1,267 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+const importCSV = "\ufeffLast_Name,first_name,date_of_birth,gender,contact,address\n" +
+    "Doe,Jane,1995-05-05T00:00:00Z,Female,9876543210,\"456 Elm St, Springfield\"\n" +
+    "Smith,John,1980-01-01T00:00:00Z,Man,,\n" +
+    ",Janet,yesterday,Female,,\n" +
+    "Fudd,Elmer\n" +
+    "Roe,Richard,1970-07-07T00:00:00Z,Male,5551234567,1 Oak Ave\n"
+
+const importNDJSON = `{"first_name":"Jane","last_name":"Doe","date_of_birth":"1995-05-05T00:00:00Z","gender":"Female"}
+
+{"first_name":"John","last_name":"Smith","date_of_birth":"1980-01-01","gender":"Male"}
+{"first_name":"Janet",
+{"first_name":"Elmer","last_name":"Fudd","date_of_birth":"1960-06-06T00:00:00Z","gender":"Male","ssn":"123"}
+{"first_name":"Richard","last_name":"Roe","date_of_birth":"1970-07-07T00:00:00Z","gender":"Male"}
+`
+
+func TestPatientService_Import(t *testing.T) {
+    tests := []struct {
+        name       string
+        format     string
+        input      string
+        wantErrors []service.ImportRowError
+        wantNames  []string
+    }{
+        {
+            name: "csv", format: service.ImportCSV, input: importCSV,
+            wantErrors: []service.ImportRowError{
+                {Line: 3, Errors: []service.FieldError{{Field: "gender", Message: "must be one of: Male, Female, Other"}}},
+                {Line: 4, Errors: []service.FieldError{
+                    {Field: "last_name", Message: "is required"},
+                    {Field: "date_of_birth", Message: "must be an RFC 3339 timestamp"},
+                }},
+                {Line: 5, Errors: []service.FieldError{{Message: "has 2 fields, want 6"}}},
+            },
+            wantNames: []string{"Jane", "Richard"},
+        },
+        {
+            name: "ndjson", format: service.ImportNDJSON, input: importNDJSON,
+            wantErrors: []service.ImportRowError{
+                {Line: 3, Errors: []service.FieldError{{Field: "date_of_birth", Message: "must be an RFC 3339 timestamp"}}},
+                {Line: 4, Errors: []service.FieldError{{Message: "invalid JSON: unexpected EOF"}}},
+                {Line: 5, Errors: []service.FieldError{{Message: `invalid JSON: json: unknown field "ssn"`}}},
+            },
+            wantNames: []string{"Jane", "Richard"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+                svc := newPatientService(store)
+
+                dryRun, err := svc.Import(0, strings.NewReader(tt.input), service.ImportOptions{Format: tt.format, DryRun: true})
+                if err != nil {
+                    t.Fatalf("Failed to dry-run import: %v", err)
+                }
+                if !dryRun.DryRun || dryRun.Total != 5 || dryRun.Valid != 2 || dryRun.Imported != 0 || len(dryRun.PatientIDs) != 0 {
+                    t.Errorf("Unexpected dry-run report: %+v", dryRun)
+                }
+                if !reflect.DeepEqual(dryRun.Errors, tt.wantErrors) {
+                    t.Errorf("Dry-run errors = %+v, want %+v", dryRun.Errors, tt.wantErrors)
+                }
+                if list, _ := svc.List(service.ListPatientsInput{}); list.Meta.Total != 0 {
+                    t.Fatalf("A dry run stored %d patients", list.Meta.Total)
+                }
+
+                report, err := svc.Import(0, strings.NewReader(tt.input), service.ImportOptions{Format: tt.format, BatchSize: 1})
+                if err != nil {
+                    t.Fatalf("Failed to import: %v", err)
+                }
+                if report.DryRun || report.Imported != 2 || len(report.PatientIDs) != 2 || !reflect.DeepEqual(report.Errors, tt.wantErrors) {
+                    t.Errorf("Unexpected report: %+v", report)
+                }
+
+                var names []string
+                for _, id := range report.PatientIDs {
+                    patient, err := svc.Get(id)
+                    if err != nil {
+                        t.Fatalf("Failed to get imported patient: %v", err)
+                    }
+                    names = append(names, patient.FirstName)
+                }
+                if !reflect.DeepEqual(names, tt.wantNames) {
+                    t.Errorf("Imported %v, want %v", names, tt.wantNames)
+                }
+            })
+        })
+    }
+
+    // Imported contact details are searchable like any others.
+    svc := newPatientService(repository.NewPatientRepository(newTestDB(t)))
+    if _, err := svc.Import(0, strings.NewReader(importCSV), service.ImportOptions{Format: service.ImportCSV}); err != nil {
+        t.Fatalf("Failed to import: %v", err)
+    }
+    if results, err := svc.Search(service.SearchPatientsInput{Q: "springfield"}); err != nil || len(results.Data) != 1 {
+        t.Errorf("Search for an imported address = %+v, %v", results, err)
+    }
+}
+
+func TestPatientService_ImportRejectsMalformedFiles(t *testing.T) {
+    svc := newPatientService(repository.NewMemoryPatientRepository())
+
+    tests := []struct {
+        name      string
+        format    string
+        input     string
+        wantField string
+    }{
+        {name: "unknown format", format: "xlsx", input: importCSV, wantField: "format"},
+        {name: "empty csv", format: service.ImportCSV, input: ""},
+        {name: "unknown column", format: service.ImportCSV, input: "first_name,last_name,date_of_birth,gender,ssn\n", wantField: "ssn"},
+        {name: "missing column", format: service.ImportCSV, input: "first_name,last_name,gender\n", wantField: "date_of_birth"},
+        {name: "duplicate column", format: service.ImportCSV, input: "first_name,last_name,date_of_birth,gender,gender\n", wantField: "gender"},
+        {name: "force column", format: service.ImportCSV, input: "first_name,last_name,date_of_birth,gender,force\nJane,Doe,1995-05-05T00:00:00Z,Female,true\n", wantField: "force"},
+        {name: "broken quoting", format: service.ImportCSV, input: "first_name,last_name,date_of_birth,gender\n\"Jane,Doe,x,Female\n"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            report, err := svc.Import(0, strings.NewReader(tt.input), service.ImportOptions{Format: tt.format})
+            var serviceErr *service.Error
+            if !errors.As(err, &serviceErr) || serviceErr.Kind != service.KindValidation || serviceErr.Code != "invalid_import" {
+                t.Fatalf("Expected an invalid_import error, got %+v, %v", report, err)
+            }
+            if tt.wantField != "" && (len(serviceErr.Fields) != 1 || serviceErr.Fields[0].Field != tt.wantField) {
+                t.Errorf("Fields = %+v, want %s", serviceErr.Fields, tt.wantField)
+            }
+        })
+    }
+
+    if list, _ := svc.List(service.ListPatientsInput{}); list.Meta.Total != 0 {
+        t.Errorf("Malformed files stored %d patients", list.Meta.Total)
+    }
+}
+
+func TestPatientService_ImportDuplicates(t *testing.T) {
+    tests := []struct {
+        name   string
+        format string
+        input  string
+    }{
+        {
+            name: "csv", format: service.ImportCSV,
+            input: "first_name,last_name,date_of_birth,gender\n" +
+                "Jane,Doe,1995-05-05T00:00:00Z,Female\n" +
+                "Richard,Roe,1970-07-07T00:00:00Z,Male\n",
+        },
+        {
+            name: "ndjson", format: service.ImportNDJSON,
+            input: `{"first_name":"Jane","last_name":"Doe","date_of_birth":"1995-05-05T00:00:00Z","gender":"Female"}` + "\n" +
+                `{"first_name":"Richard","last_name":"Roe","date_of_birth":"1970-07-07T00:00:00Z","gender":"Male"}` + "\n",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+                svc := newPatientService(store)
+                existing, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female"})
+                if err != nil {
+                    t.Fatalf("Failed to seed patient: %v", err)
+                }
+
+                report, err := svc.Import(0, strings.NewReader(tt.input), service.ImportOptions{Format: tt.format})
+                if err != nil {
+                    t.Fatalf("Failed to import: %v", err)
+                }
+                wantErrors := []service.ImportRowError{{Line: 2, Errors: []service.FieldError{{Message: fmt.Sprintf("may duplicate patient %d (score 0.80)", existing.ID)}}}}
+                if tt.format == service.ImportNDJSON {
+                    wantErrors[0].Line = 1
+                }
+                if report.Imported != 1 || !reflect.DeepEqual(report.Errors, wantErrors) {
+                    t.Errorf("Unexpected report: %+v, want errors %+v", report, wantErrors)
+                }
+
+                // Force imports the duplicate; Richard is a duplicate by now.
+                forced, err := svc.Import(0, strings.NewReader(tt.input), service.ImportOptions{Format: tt.format, Force: true})
+                if err != nil || forced.Imported != 2 || len(forced.Errors) != 0 {
+                    t.Errorf("Forced import = %+v, %v; want 2 imported", forced, err)
+                }
+            })
+        })
+    }
+
+    // Rows cannot force themselves through.
+    svc := newPatientService(repository.NewMemoryPatientRepository())
+    row := `{"first_name":"Jane","last_name":"Doe","date_of_birth":"1995-05-05T00:00:00Z","gender":"Female","force":true}`
+    report, err := svc.Import(0, strings.NewReader(row), service.ImportOptions{Format: service.ImportNDJSON})
+    want := []service.ImportRowError{{Line: 1, Errors: []service.FieldError{{Message: `invalid JSON: json: unknown field "force"`}}}}
+    if err != nil || report.Imported != 0 || !reflect.DeepEqual(report.Errors, want) {
+        t.Errorf("Import with a force key = %+v, %v; want %+v", report, err, want)
+    }
+}
+
+func TestAPI_ImportPatients(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    csvType := map[string]string{"Content-Type": "text/csv"}
+    ndjsonType := map[string]string{"Content-Type": "application/x-ndjson"}
+    tests := []struct {
+        name         string
+        path         string
+        token        string
+        headers      map[string]string
+        body         string
+        wantStatus   int
+        wantImported int
+    }{
+        {"doctor cannot import", "/api/patients/import", doctor, csvType, importCSV, http.StatusForbidden, 0},
+        {"anonymous", "/api/patients/import", "", csvType, importCSV, http.StatusUnauthorized, 0},
+        {"unknown content type", "/api/patients/import", receptionist, nil, importCSV, http.StatusBadRequest, 0},
+        {"invalid batch size", "/api/patients/import?batch_size=5000", receptionist, csvType, importCSV, http.StatusBadRequest, 0},
+        {"malformed csv", "/api/patients/import", receptionist, csvType, "first_name,ssn\n", http.StatusBadRequest, 0},
+        {"dry run", "/api/patients/import?dry_run=true", receptionist, csvType, importCSV, http.StatusOK, 0},
+        {"csv", "/api/patients/import", receptionist, csvType, importCSV, http.StatusOK, 2},
+        {"ndjson", "/api/patients/import?batch_size=1&force=true", receptionist, ndjsonType, importNDJSON, http.StatusOK, 2},
+        {"format parameter wins", "/api/patients/import?format=ndjson&force=true", receptionist, csvType, importNDJSON, http.StatusOK, 2},
+    }
+
+    var imported []uint
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.doWithHeaders(t, http.MethodPost, tt.path, tt.token, tt.headers, []byte(tt.body))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+
+            var report service.ImportReport
+            decodeJSON(t, w, &report)
+            if report.Imported != tt.wantImported || len(report.Errors) != 3 {
+                t.Errorf("Unexpected report: %s", w.Body.String())
+            }
+            imported = append(imported, report.PatientIDs...)
+        })
+    }
+
+    var count int64
+    env.DB.Model(&model.Patient{}).Count(&count)
+    if count != 6 || len(imported) != 6 {
+        t.Errorf("Stored %d patients and reported %d, want 6", count, len(imported))
+    }
+
+    var logs service.AuditLogListResponse
+    decodeJSON(t, env.do(t, http.MethodGet, fmt.Sprintf("/api/admin/audit-logs?patient_id=%d", imported[0]), admin, nil), &logs)
+    if len(logs.Data) != 1 || logs.Data[0].Action != model.AuditPatientImport {
+        t.Errorf("Unexpected audit entries: %+v", logs.Data)
+    }
+}
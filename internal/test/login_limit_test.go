@@ -0,0 +1,186 @@
+package test
+
+import (
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+    "makerble-assessment/internal/handler"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/router"
+    "makerble-assessment/internal/service"
+)
+
+// retryAfter returns how long err asks the caller to wait, or 0 when it is
+// not a rate limit refusal.
+func retryAfter(t *testing.T, err error) time.Duration {
+    t.Helper()
+
+    var rateLimit *service.RateLimitError
+    if err == nil {
+        return 0
+    }
+    if !errors.As(err, &rateLimit) || !errors.Is(err, service.ErrTooManyAttempts) {
+        t.Fatalf("Expected a RateLimitError, got %v", err)
+    }
+    return rateLimit.RetryAfter
+}
+
+func TestLoginLimiter_Lockout(t *testing.T) {
+    limiter := service.NewLoginLimiter(repository.NewMemoryLimiterStore(), service.LoginLimitConfig{
+        AccountFailures: 3,
+        FailureWindow:   time.Minute,
+        Lockout:         100 * time.Millisecond,
+        MaxLockout:      250 * time.Millisecond,
+    })
+    const ip, other = "192.0.2.1", "198.51.100.7"
+
+    // lockOut fails enough times to lock the account and returns the wait.
+    lockOut := func(account string) time.Duration {
+        t.Helper()
+        for i := 0; i < 3; i++ {
+            if wait := retryAfter(t, limiter.Allow(ip, account)); wait != 0 {
+                t.Fatalf("Attempt %d refused before the limit, retry after %v", i+1, wait)
+            }
+            if err := limiter.Fail(ip, account); err != nil {
+                t.Fatalf("Failed to record failure: %v", err)
+            }
+        }
+        return retryAfter(t, limiter.Allow(ip, account))
+    }
+
+    if wait := lockOut(doctorEmail); wait <= 0 || wait > 100*time.Millisecond {
+        t.Errorf("First lockout = %v, want up to 100ms", wait)
+    }
+    // The lockout is per account, whatever the IP or the email's case.
+    if wait := retryAfter(t, limiter.Allow(other, "  DOC@example.com")); wait == 0 {
+        t.Error("Locked account should be refused from another IP")
+    }
+    if wait := retryAfter(t, limiter.Allow(ip, receptionistEmail)); wait != 0 {
+        t.Errorf("Another account should not be locked, retry after %v", wait)
+    }
+
+    // Each further lockout doubles, up to the maximum.
+    time.Sleep(110 * time.Millisecond)
+    if wait := lockOut(doctorEmail); wait <= 100*time.Millisecond || wait > 200*time.Millisecond {
+        t.Errorf("Second lockout = %v, want 100ms to 200ms", wait)
+    }
+    time.Sleep(210 * time.Millisecond)
+    if wait := lockOut(doctorEmail); wait <= 200*time.Millisecond || wait > 250*time.Millisecond {
+        t.Errorf("Third lockout = %v, want 200ms to 250ms", wait)
+    }
+
+    // Signing in starts the run over.
+    time.Sleep(260 * time.Millisecond)
+    if err := limiter.Succeed(doctorEmail); err != nil {
+        t.Fatalf("Failed to record success: %v", err)
+    }
+    if wait := lockOut(doctorEmail); wait <= 0 || wait > 100*time.Millisecond {
+        t.Errorf("Lockout after a sign-in = %v, want up to 100ms", wait)
+    }
+}
+
+func TestLoginLimiter_IPLimits(t *testing.T) {
+    const ip, other = "192.0.2.1", "198.51.100.7"
+
+    rate := service.NewLoginLimiter(repository.NewMemoryLimiterStore(), service.LoginLimitConfig{IPRequests: 2, RequestWindow: time.Minute})
+    for _, account := range []string{doctorEmail, receptionistEmail} {
+        if err := rate.Allow(ip, account); err != nil {
+            t.Fatalf("Attempt on %s refused: %v", account, err)
+        }
+    }
+    if wait := retryAfter(t, rate.Allow(ip, adminEmail)); wait <= 0 || wait > time.Minute {
+        t.Errorf("Attempt over the IP rate: retry after %v, want up to 1m", wait)
+    }
+    if err := rate.Allow(other, doctorEmail); err != nil {
+        t.Errorf("Another IP should be allowed: %v", err)
+    }
+
+    // Failures on different accounts add up against the IP.
+    failures := service.NewLoginLimiter(repository.NewMemoryLimiterStore(), service.LoginLimitConfig{
+        IPFailures:    2,
+        FailureWindow: time.Minute,
+        Lockout:       time.Minute,
+    })
+    for _, account := range []string{doctorEmail, receptionistEmail} {
+        if err := failures.Fail(ip, account); err != nil {
+            t.Fatalf("Failed to record failure: %v", err)
+        }
+    }
+    if wait := retryAfter(t, failures.Allow(ip, adminEmail)); wait == 0 {
+        t.Error("IP should be locked out")
+    }
+    if err := failures.Allow(other, adminEmail); err != nil {
+        t.Errorf("Another IP should be allowed: %v", err)
+    }
+}
+
+func TestAPI_LoginLimit(t *testing.T) {
+    env := newTestEnv(t)
+    env.Router = router.New(env.DB, router.Config{
+        Keys:       newTestKeys(t),
+        Auth:       service.DefaultAuthConfig(),
+        LoginLimit: service.LoginLimitConfig{AccountFailures: 2, FailureWindow: time.Minute, Lockout: time.Minute},
+    })
+
+    wrong := service.LoginInput{Email: doctorEmail, Password: "wrong"}
+    for i := 0; i < 2; i++ {
+        if w := env.do(t, http.MethodPost, "/login", "", wrong); w.Code != http.StatusUnauthorized {
+            t.Fatalf("Failed attempt %d: status %d", i+1, w.Code)
+        }
+    }
+
+    // Once locked, even the right password is refused.
+    w := env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: doctorEmail, Password: seedPassword})
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+        t.Fatalf("Locked login: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+    }
+    var refused handler.ErrorResponse
+    decodeJSON(t, w, &refused)
+    if refused.Code != "too_many_attempts" {
+        t.Errorf("Unexpected error: %+v", refused)
+    }
+
+    if w := env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: receptionistEmail, Password: seedPassword}); w.Code != http.StatusOK {
+        t.Errorf("Another account: status %d", w.Code)
+    }
+}
+
+func TestAPI_LoginLimitDefaults(t *testing.T) {
+    // The harness leaves LoginLimit unset, which means the defaults.
+    env := newTestEnv(t)
+    limits := service.DefaultLoginLimitConfig()
+
+    wrong := service.LoginInput{Email: doctorEmail, Password: "wrong"}
+    for i := 0; i < limits.AccountFailures; i++ {
+        if w := env.do(t, http.MethodPost, "/login", "", wrong); w.Code != http.StatusUnauthorized {
+            t.Fatalf("Failed attempt %d: status %d", i+1, w.Code)
+        }
+    }
+    if w := env.do(t, http.MethodPost, "/login", "", wrong); w.Code != http.StatusTooManyRequests {
+        t.Errorf("Attempt past the default limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+    }
+}
+
+func TestAPI_LoginRateIgnoresForwardedFor(t *testing.T) {
+    env := newTestEnv(t)
+    env.Router = router.New(env.DB, router.Config{
+        Keys:       newTestKeys(t),
+        Auth:       service.DefaultAuthConfig(),
+        LoginLimit: service.LoginLimitConfig{IPRequests: 2, RequestWindow: time.Minute},
+    })
+
+    // Without a trusted proxy, a forged X-Forwarded-For does not make each
+    // attempt look like a new client.
+    for i, forwarded := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+        w := env.doWithHeaders(t, http.MethodPost, "/login", "", map[string]string{"X-Forwarded-For": forwarded},
+            service.LoginInput{Email: doctorEmail, Password: seedPassword})
+        want := http.StatusOK
+        if i == 2 {
+            want = http.StatusTooManyRequests
+        }
+        if w.Code != want {
+            t.Errorf("Attempt %d: status %d, want %d", i+1, w.Code, want)
+        }
+    }
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestPatientService_MemoryStore(t *testing.T) {
+    store := repository.NewMemoryPatientRepository()
+    svc := newPatientService(store)
+
+    created, err := svc.Create(0, service.CreatePatientInput{
+        FirstName:   "Jane",
+        LastName:    "Doe",
+        DateOfBirth: "1995-05-05T00:00:00Z",
+        Gender:      "Female",
+    })
+    if err != nil {
+        t.Fatalf("Failed to create patient: %v", err)
+    }
+
+    if _, err := svc.Update(0, created.ID, 0, service.UpdatePatientInput{Address: "1 Oak Ave"}); err != nil {
+        t.Fatalf("Failed to update patient: %v", err)
+    }
+    if _, err := svc.AddMedicalHistoryEntry(created.ID, 7, service.MedicalHistoryInput{Kind: model.EntryDiagnosis, Description: "Asthma"}); err != nil {
+        t.Fatalf("Failed to add medical history: %v", err)
+    }
+
+    got, err := svc.Get(created.ID)
+    if err != nil {
+        t.Fatalf("Failed to get patient: %v", err)
+    }
+    if got.Address != "1 Oak Ave" || len(got.MedicalHistory) != 1 || got.MedicalHistory[0].Description != "Asthma" || got.FirstName != "Jane" {
+        t.Errorf("Unexpected patient: %+v", got)
+    }
+
+    if err := svc.Delete(0, created.ID); err != nil {
+        t.Fatalf("Failed to delete patient: %v", err)
+    }
+    if _, err := store.FindByID(created.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+        t.Errorf("Expected gorm.ErrRecordNotFound after delete, got %v", err)
+    }
+    if list, _ := svc.List(service.ListPatientsInput{}); list.Meta.Total != 0 {
+        t.Errorf("Got %d patients after delete, want 0", list.Meta.Total)
+    }
+}
+
+func TestAuthService_MemoryStore(t *testing.T) {
+    store := repository.NewMemoryUserRepository()
+    hash, _ := bcrypt.GenerateFromPassword([]byte(seedPassword), bcrypt.MinCost)
+    doctor := model.Role{Name: model.RoleDoctor, Permissions: []model.Permission{{Name: model.PermPatientRead}}}
+    if err := store.Create(&model.User{Email: doctorEmail, Password: string(hash), Roles: []model.Role{doctor}}); err != nil {
+        t.Fatalf("Failed to create user: %v", err)
+    }
+    if err := store.Create(&model.User{Email: doctorEmail, Password: string(hash)}); err == nil {
+        t.Error("Expected duplicate email to be rejected")
+    }
+
+    svc := service.NewAuthService(store, repository.NewMemoryRefreshTokenRepository(), newTestKeys(t), service.DefaultAuthConfig())
+    tokens, err := svc.Login(service.LoginInput{Email: doctorEmail, Password: seedPassword})
+    if err != nil || !reflect.DeepEqual(tokens.User.Permissions, []string{model.PermPatientRead}) {
+        t.Fatalf("Login = %+v, %v; want doctor", tokens.User, err)
+    }
+    if _, err := svc.Refresh(service.RefreshInput{RefreshToken: tokens.RefreshToken}); err != nil {
+        t.Errorf("Failed to refresh: %v", err)
+    }
+    if _, err := svc.Login(service.LoginInput{Email: "nobody@example.com", Password: seedPassword}); err == nil {
+        t.Error("Expected unknown email to fail")
+    }
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+    "errors"
+    "testing"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/migration"
+    "makerble-assessment/internal/repository"
+)
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+    db, err := config.DBConfig{Driver: config.DriverSQLite}.Open()
+    if err != nil {
+        t.Fatalf("Failed to open database: %v", err)
+    }
+
+    migrator := migration.NewMigrator(db)
+    total := len(migration.All())
+
+    if err := migrator.CheckCurrent(); !errors.Is(err, migration.ErrPendingMigrations) {
+        t.Fatalf("Expected pending migrations on an empty database, got %v", err)
+    }
+
+    ran, err := migrator.Up()
+    if err != nil {
+        t.Fatalf("Failed to apply migrations: %v", err)
+    }
+    if len(ran) != total {
+        t.Errorf("Applied %d migrations, want %d", len(ran), total)
+    }
+    if err := migrator.CheckCurrent(); err != nil {
+        t.Errorf("Expected schema to be current after up: %v", err)
+    }
+    if !db.Migrator().HasTable("patients") || !db.Migrator().HasTable("users") {
+        t.Error("Expected users and patients tables after up")
+    }
+
+    rolledBack, err := migrator.Down(1)
+    if err != nil {
+        t.Fatalf("Failed to roll back: %v", err)
+    }
+    if len(rolledBack) != 1 || rolledBack[0].Version != ran[len(ran)-1].Version {
+        t.Errorf("Rolled back %+v, want the latest migration", rolledBack)
+    }
+
+    statuses, err := migrator.Status()
+    if err != nil {
+        t.Fatalf("Failed to read status: %v", err)
+    }
+    if last := statuses[len(statuses)-1]; last.Applied {
+        t.Errorf("Expected %04d_%s to be pending after down", last.Version, last.Name)
+    }
+
+    if _, err := migrator.Down(total); err != nil {
+        t.Fatalf("Failed to roll back all migrations: %v", err)
+    }
+    if db.Migrator().HasTable("patients") {
+        t.Error("Expected patients table to be dropped after full rollback")
+    }
+}
+
+
+func TestMigration_RolesFromRoleColumn(t *testing.T) {
+    db := newTestDB(t)
+    migrator := migration.NewMigrator(db)
+
+    // Rolling back the roles migration restores the single role column...
+    if _, err := migrator.Down(len(migration.All()) - 4); err != nil {
+        t.Fatalf("Failed to roll back: %v", err)
+    }
+    var role string
+    if err := db.Table("users").Where("email = ?", doctorEmail).Pluck("role", &role).Error; err != nil || role != "doctor" {
+        t.Fatalf("role column = %q, %v; want doctor", role, err)
+    }
+    if db.Migrator().HasTable("user_roles") {
+        t.Error("Expected user_roles to be dropped")
+    }
+
+    // ...and applying it again turns the column back into role assignments.
+    if _, err := migrator.Up(); err != nil {
+        t.Fatalf("Failed to reapply migrations: %v", err)
+    }
+    user, err := repository.NewUserRepository(db).FindByEmail(doctorEmail)
+    if err != nil {
+        t.Fatalf("Failed to load user: %v", err)
+    }
+    if names := user.RoleNames(); len(names) != 1 || names[0] != "doctor" {
+        t.Errorf("Roles = %v, want [doctor]", names)
+    }
+    if db.Migrator().HasColumn("users", "role") {
+        t.Error("Expected users.role to be dropped")
+    }
+}
+
+func TestMigration_MedicalHistoryFromFreeText(t *testing.T) {
+    db := newTestDB(t)
+    migrator := migration.NewMigrator(db)
+    patient := seedPatient(t, db, "Jane")
+
+    // Roll back to the free-text column and fill it in...
+    if _, err := migrator.Down(len(migration.All()) - 6); err != nil {
+        t.Fatalf("Failed to roll back: %v", err)
+    }
+    if err := db.Table("patients").Where("id = ?", patient.ID).UpdateColumn("medical_history", "Asthma since 2001").Error; err != nil {
+        t.Fatalf("Failed to set medical history: %v", err)
+    }
+
+    // ...then migrate forward again: the text becomes an unattributed note.
+    if _, err := migrator.Up(); err != nil {
+        t.Fatalf("Failed to reapply migrations: %v", err)
+    }
+    entries, err := repository.NewMedicalHistoryRepository(db).FindByPatients(patient.ID)
+    if err != nil {
+        t.Fatalf("Failed to load history: %v", err)
+    }
+    if len(entries) != 1 || entries[0].Kind != "note" || entries[0].Description != "Asthma since 2001" || entries[0].AuthorID != nil {
+        t.Errorf("Unexpected history: %+v", entries)
+    }
+    if db.Migrator().HasColumn("patients", "medical_history") {
+        t.Error("Expected patients.medical_history to be dropped")
+    }
+}
\ No newline at end of file
@@ -1,12 +1,9 @@
 package test
 
 import (
-    "fmt"
-    "os"
+    "errors"
+    "reflect"
     "testing"
-    "time" // Add time import
-    "github.com/joho/godotenv"
-    "gorm.io/driver/mysql"
     "gorm.io/gorm"
     "makerble-assessment/internal/model"
     "makerble-assessment/internal/repository"
@@ -14,82 +11,351 @@ import (
 )
 
 func TestPatientService_Create(t *testing.T) {
-    if err := godotenv.Load(); err != nil {
-        t.Fatal("Error loading .env file")
+    tests := []struct {
+        name    string
+        input   service.CreatePatientInput
+        wantErr bool
+    }{
+        {
+            name: "valid patient",
+            input: service.CreatePatientInput{
+                FirstName:   "Jane",
+                LastName:    "Doe",
+                DateOfBirth: "1995-05-05T00:00:00Z",
+                Gender:      "Female",
+                Contact:     "9876543210",
+                Address:     "456 Elm St",
+            },
+        },
+        {
+            name: "without optional fields",
+            input: service.CreatePatientInput{
+                FirstName:   "John",
+                LastName:    "Roe",
+                DateOfBirth: "1980-01-31T00:00:00Z",
+                Gender:      "Male",
+            },
+        },
+        {
+            name: "invalid date of birth",
+            input: service.CreatePatientInput{
+                FirstName:   "Jane",
+                LastName:    "Doe",
+                DateOfBirth: "05/05/1995",
+                Gender:      "Female",
+            },
+            wantErr: true,
+        },
     }
 
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-        os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
-    db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-    if err != nil {
-        t.Fatalf("Failed to connect to test database: %v", err)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            env := newTestEnv(t)
+
+            patient, err := env.PatientService.Create(0, tt.input)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to create patient: %v", err)
+            }
+
+            if patient.ID == 0 {
+                t.Error("Patient ID should not be zero after creation")
+            }
+            if patient.FirstName != tt.input.FirstName || patient.DateOfBirth != tt.input.DateOfBirth {
+                t.Errorf("Created patient does not match input: got %+v, want %+v", patient, tt.input)
+            }
+        })
     }
+}
+
+func TestPatientService_List(t *testing.T) {
+    seed := []model.Patient{
+        {FirstName: "Ann", LastName: "Zimmer", Gender: "Female", DateOfBirth: mustDate(t, "1990-01-01")},
+        {FirstName: "Ben", LastName: "Young", Gender: "Male", DateOfBirth: mustDate(t, "1985-06-15")},
+        {FirstName: "Cal", LastName: "Annis", Gender: "Male", DateOfBirth: mustDate(t, "2001-12-31")},
+        {FirstName: "Dee", LastName: "Xu", Gender: "Other", DateOfBirth: mustDate(t, "1970-03-03")},
+        {FirstName: "Eve", LastName: "100%_Real", Gender: "Female", DateOfBirth: mustDate(t, "1999-09-09")},
+    }
+
+    tests := []struct {
+        name      string
+        input     service.ListPatientsInput
+        wantNames []string
+        wantTotal int64
+        wantPages int
+    }{
+        {name: "defaults", input: service.ListPatientsInput{}, wantNames: []string{"Ann", "Ben", "Cal", "Dee", "Eve"}, wantTotal: 5, wantPages: 1},
+        {name: "first page", input: service.ListPatientsInput{Limit: 2}, wantNames: []string{"Ann", "Ben"}, wantTotal: 5, wantPages: 3},
+        {name: "last page", input: service.ListPatientsInput{Page: 3, Limit: 2}, wantNames: []string{"Eve"}, wantTotal: 5, wantPages: 3},
+        {name: "past the end", input: service.ListPatientsInput{Page: 9, Limit: 2}, wantNames: []string{}, wantTotal: 5, wantPages: 3},
+        {name: "sort by name", input: service.ListPatientsInput{Sort: "name"}, wantNames: []string{"Eve", "Cal", "Dee", "Ben", "Ann"}, wantTotal: 5, wantPages: 1},
+        {name: "sort by dob desc", input: service.ListPatientsInput{Sort: "date_of_birth", Order: "desc"}, wantNames: []string{"Cal", "Eve", "Ann", "Ben", "Dee"}, wantTotal: 5, wantPages: 1},
+        {name: "created_at desc", input: service.ListPatientsInput{Sort: "created_at", Order: "desc", Limit: 1}, wantNames: []string{"Eve"}, wantTotal: 5, wantPages: 5},
+        {name: "gender", input: service.ListPatientsInput{Gender: "Male"}, wantNames: []string{"Ben", "Cal"}, wantTotal: 2, wantPages: 1},
+        {name: "dob range", input: service.ListPatientsInput{DOBFrom: mustDate(t, "1985-06-15"), DOBTo: mustDate(t, "1999-09-09")}, wantNames: []string{"Ann", "Ben", "Eve"}, wantTotal: 3, wantPages: 1},
+        {name: "name prefix matches first or last name", input: service.ListPatientsInput{Name: "an"}, wantNames: []string{"Ann", "Cal"}, wantTotal: 2, wantPages: 1},
+        {name: "wildcards are literal", input: service.ListPatientsInput{Name: "100%_"}, wantNames: []string{"Eve"}, wantTotal: 1, wantPages: 1},
+        {name: "percent alone matches nothing", input: service.ListPatientsInput{Name: "%"}, wantNames: []string{}, wantTotal: 0, wantPages: 0},
+        {name: "combined filters", input: service.ListPatientsInput{Gender: "Female", Name: "a"}, wantNames: []string{"Ann"}, wantTotal: 1, wantPages: 1},
+    }
+
+    // The GORM and in-memory stores must agree on every query.
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        for _, patient := range seed {
+            if err := store.Create(&patient); err != nil {
+                t.Fatalf("Failed to seed patient: %v", err)
+            }
+        }
+        svc := newPatientService(store)
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                list, err := svc.List(tt.input)
+                if err != nil {
+                    t.Fatalf("Failed to list patients: %v", err)
+                }
 
-    if err := db.AutoMigrate(&model.Patient{}); err != nil {
-        t.Fatalf("Failed to migrate test database: %v", err)
+                names := make([]string, 0, len(list.Data))
+                for _, patient := range list.Data {
+                    names = append(names, patient.FirstName)
+                }
+                if !reflect.DeepEqual(names, tt.wantNames) {
+                    t.Errorf("Got patients %v, want %v", names, tt.wantNames)
+                }
+                if list.Meta.Total != tt.wantTotal || list.Meta.TotalPages != tt.wantPages {
+                    t.Errorf("Got meta %+v, want total %d and %d pages", list.Meta, tt.wantTotal, tt.wantPages)
+                }
+            })
+        }
+    })
+}
+
+func TestPatientService_Get(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+
+    tests := []struct {
+        name    string
+        id      uint
+        wantErr bool
+    }{
+        {name: "existing patient", id: patient.ID},
+        {name: "unknown patient", id: patient.ID + 100, wantErr: true},
     }
 
-    repo := repository.NewPatientRepository(db)
-    svc := service.NewPatientService(repo)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            retrieved, err := env.PatientService.Get(tt.id)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to get patient: %v", err)
+            }
 
-    input := service.CreatePatientInput{
-        FirstName:   "Jane",
-        LastName:    "Doe",
-        DateOfBirth: "1995-05-05T00:00:00Z", // Use string
-        Gender:      "Female",
-        Contact:     "9876543210",
-        Address:     "456 Elm St",
+            if retrieved.ID != patient.ID || retrieved.FirstName != patient.FirstName {
+                t.Errorf("Retrieved patient does not match: got %+v, want %+v", retrieved, patient)
+            }
+        })
     }
+}
 
-    patient, err := svc.Create(input) // Pass input, not &input
-    if err != nil {
-        t.Fatalf("Failed to create patient: %v", err)
+func TestPatientService_Update(t *testing.T) {
+    tests := []struct {
+        name    string
+        missing bool
+        input   service.UpdatePatientInput
+        check   func(t *testing.T, got service.PatientResponse)
+        wantErr bool
+    }{
+        {
+            name:  "partial update keeps other fields",
+            input: service.UpdatePatientInput{Contact: "5550000000"},
+            check: func(t *testing.T, got service.PatientResponse) {
+                if got.Contact != "5550000000" || got.FirstName != "Jane" || got.Address != "456 Elm St" {
+                    t.Errorf("Unexpected patient after partial update: %+v", got)
+                }
+            },
+        },
+        {
+            name: "all fields",
+            input: service.UpdatePatientInput{
+                FirstName:   "Janet",
+                LastName:    "Smith",
+                DateOfBirth: "1990-02-03T00:00:00Z",
+                Gender:      "Other",
+                Contact:     "111",
+                Address:     "1 Oak Ave",
+            },
+            check: func(t *testing.T, got service.PatientResponse) {
+                if got.FirstName != "Janet" || got.LastName != "Smith" || got.DateOfBirth != "1990-02-03T00:00:00Z" ||
+                    got.Gender != "Other" || got.Contact != "111" || got.Address != "1 Oak Ave" {
+                    t.Errorf("Unexpected patient after full update: %+v", got)
+                }
+            },
+        },
+        {
+            name:    "invalid date of birth",
+            input:   service.UpdatePatientInput{DateOfBirth: "yesterday"},
+            wantErr: true,
+        },
+        {
+            name:    "unknown patient",
+            missing: true,
+            input:   service.UpdatePatientInput{FirstName: "Nobody"},
+            wantErr: true,
+        },
     }
 
-    if patient.ID == 0 {
-        t.Error("Patient ID should not be zero after creation")
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            env := newTestEnv(t)
+            patient := seedPatient(t, env.DB, "Jane")
+            id := patient.ID
+            if tt.missing {
+                id += 100
+            }
+
+            updated, err := env.PatientService.Update(0, id, 0, tt.input)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to update patient: %v", err)
+            }
+            tt.check(t, updated)
+
+            stored, err := env.PatientService.Get(id)
+            if err != nil {
+                t.Fatalf("Failed to reload patient: %v", err)
+            }
+            tt.check(t, stored)
+        })
     }
 }
 
-func TestPatientService_Get(t *testing.T) {
-    if err := godotenv.Load(); err != nil {
-        t.Fatal("Error loading .env file")
+func TestPatientService_UpdateVersion(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        svc := newPatientService(store)
+        created, err := svc.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female"})
+        if err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+        if created.Version != 1 {
+            t.Fatalf("New patient has version %d, want 1", created.Version)
+        }
+
+        // Two writers start from version 1 and change different fields.
+        first, err := svc.Update(0, created.ID, 1, service.UpdatePatientInput{Contact: "555"})
+        if err != nil {
+            t.Fatalf("Failed to update patient: %v", err)
+        }
+        if first.Version != 2 {
+            t.Errorf("Version after update = %d, want 2", first.Version)
+        }
+        if _, err := svc.Update(0, created.ID, 1, service.UpdatePatientInput{Address: "1 Oak Ave"}); !errors.Is(err, service.ErrVersionConflict) {
+            t.Fatalf("Expected ErrVersionConflict for a stale version, got %v", err)
+        }
+        if _, err := svc.Update(0, created.ID, 1, service.UpdatePatientInput{}); !errors.Is(err, service.ErrVersionConflict) {
+            t.Errorf("Expected ErrVersionConflict for an empty stale update, got %v", err)
+        }
+
+        // Without a version the update applies, touching only its own field.
+        second, err := svc.Update(0, created.ID, 0, service.UpdatePatientInput{Address: "1 Oak Ave"})
+        if err != nil {
+            t.Fatalf("Failed to update patient: %v", err)
+        }
+        if second.Contact != "555" || second.Address != "1 Oak Ave" || second.Version != 3 {
+            t.Errorf("Unexpected patient: %+v", second)
+        }
+
+        if _, err := svc.Update(0, created.ID+100, 3, service.UpdatePatientInput{Contact: "1"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Expected gorm.ErrRecordNotFound, got %v", err)
+        }
+    })
+}
+
+func TestPatientService_Delete(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+
+    if err := env.PatientService.Delete(0, patient.ID); err != nil {
+        t.Fatalf("Failed to delete patient: %v", err)
+    }
+    if _, err := env.PatientService.Get(patient.ID); err == nil {
+        t.Error("Expected deleted patient to be unavailable")
     }
 
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-        os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
-    db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+    list, err := env.PatientService.List(service.ListPatientsInput{})
     if err != nil {
-        t.Fatalf("Failed to connect to test database: %v", err)
+        t.Fatalf("Failed to list patients: %v", err)
     }
-
-    if err := db.AutoMigrate(&model.Patient{}); err != nil {
-        t.Fatalf("Failed to migrate test database: %v", err)
+    if list.Meta.Total != 0 || len(list.Data) != 0 {
+        t.Errorf("Got %d patients after delete, want 0", list.Meta.Total)
     }
+}
 
-    repo := repository.NewPatientRepository(db)
-    svc := service.NewPatientService(repo)
+func TestPatientService_MedicalHistory(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    other := seedPatient(t, env.DB, "John")
 
-    dob, _ := time.Parse(time.RFC3339, "1995-05-05T00:00:00Z")
-    patient := model.Patient{
-        FirstName:   "Jane",
-        LastName:    "Doe",
-        DateOfBirth: dob,
-        Gender:      "Female",
-        Contact:     "9876543210",
-        Address:     "456 Elm St",
+    appends := []struct {
+        patientID uint
+        authorID  uint
+        input     service.MedicalHistoryInput
+    }{
+        {patient.ID, 2, service.MedicalHistoryInput{Kind: model.EntryDiagnosis, Description: "Asthma"}},
+        {other.ID, 2, service.MedicalHistoryInput{Kind: model.EntryNote, Description: "Someone else's note"}},
+        {patient.ID, 5, service.MedicalHistoryInput{Kind: model.EntryAllergy, Description: "Penicillin"}},
     }
-
-    if err := db.Create(&patient).Error; err != nil {
-        t.Fatalf("Failed to seed test patient: %v", err)
+    for _, tt := range appends {
+        entry, err := env.PatientService.AddMedicalHistoryEntry(tt.patientID, tt.authorID, tt.input)
+        if err != nil {
+            t.Fatalf("Failed to add entry: %v", err)
+        }
+        if entry.ID == 0 || entry.AuthorID == nil || *entry.AuthorID != tt.authorID || entry.CreatedAt == "" {
+            t.Errorf("Unexpected entry: %+v", entry)
+        }
     }
 
-    retrieved, err := svc.Get(patient.ID)
+    history, err := env.PatientService.ListMedicalHistory(patient.ID)
     if err != nil {
-        t.Fatalf("Failed to get patient: %v", err)
+        t.Fatalf("Failed to list history: %v", err)
+    }
+    var got []string
+    for _, entry := range history.Data {
+        got = append(got, entry.Kind+": "+entry.Description)
+    }
+    if want := []string{"diagnosis: Asthma", "allergy: Penicillin"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("History = %v, want %v", got, want)
+    }
+
+    // Every patient read carries the history.
+    fetched, err := env.PatientService.Get(patient.ID)
+    if err != nil || !reflect.DeepEqual(fetched.MedicalHistory, history.Data) {
+        t.Errorf("Get history = %+v, %v; want %+v", fetched.MedicalHistory, err, history.Data)
+    }
+    list, _ := env.PatientService.List(service.ListPatientsInput{Sort: "name"})
+    if len(list.Data) != 2 || len(list.Data[0].MedicalHistory) != 2 || len(list.Data[1].MedicalHistory) != 1 {
+        t.Errorf("Unexpected list histories: %+v", list.Data)
     }
 
-    if retrieved.ID != patient.ID || retrieved.FirstName != patient.FirstName {
-        t.Errorf("Retrieved patient does not match: got %+v, want %+v", retrieved, patient)
+    unknown := patient.ID + 100
+    if _, err := env.PatientService.AddMedicalHistoryEntry(unknown, 2, appends[0].input); err == nil {
+        t.Error("Expected an error adding history to an unknown patient")
     }
-}
\ No newline at end of file
+    if _, err := env.PatientService.ListMedicalHistory(unknown); err == nil {
+        t.Error("Expected an error listing history of an unknown patient")
+    }
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+    "net/http"
+    "reflect"
+    "testing"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestPatientService_Search(t *testing.T) {
+    seed := []model.Patient{
+        {FirstName: "Jane", LastName: "Doe", Gender: "Female", Contact: "9876543210", Address: "456 Elm St", DateOfBirth: mustDate(t, "1995-05-05")},
+        {FirstName: "Janet", LastName: "Smith", Gender: "Female", Contact: "5551234567", Address: "1 Oak Ave", DateOfBirth: mustDate(t, "1980-01-01")},
+        {FirstName: "John", LastName: "Doe", Gender: "Male", Contact: "5559876543", Address: "9 Pine Rd", DateOfBirth: mustDate(t, "1970-07-07")},
+        {FirstName: "Elmer", LastName: "Fudd", Gender: "Male", Contact: "1112223333", Address: "77 Birch Ln", DateOfBirth: mustDate(t, "1960-06-06")},
+    }
+
+    tests := []struct {
+        name      string
+        input     service.SearchPatientsInput
+        wantNames []string
+        ordered   bool
+    }{
+        {name: "first name prefix", input: service.SearchPatientsInput{Q: "jan"}, wantNames: []string{"Jane", "Janet"}},
+        {name: "last name", input: service.SearchPatientsInput{Q: "DOE"}, wantNames: []string{"Jane", "John"}},
+        {name: "all terms must match", input: service.SearchPatientsInput{Q: "doe, jane"}, wantNames: []string{"Jane"}},
+        {name: "phone number prefix", input: service.SearchPatientsInput{Q: "555123"}, wantNames: []string{"Janet"}},
+        {name: "address fragment", input: service.SearchPatientsInput{Q: "oak"}, wantNames: []string{"Janet"}},
+        {name: "short term matches a whole word", input: service.SearchPatientsInput{Q: "77"}, wantNames: []string{"Elmer"}},
+        {name: "short term is not a prefix", input: service.SearchPatientsInput{Q: "55"}, wantNames: []string{}},
+        {name: "names rank above addresses", input: service.SearchPatientsInput{Q: "elm"}, wantNames: []string{"Elmer", "Jane"}, ordered: true},
+        {name: "limit", input: service.SearchPatientsInput{Q: "doe", Limit: 1}, wantNames: nil},
+        {name: "no match", input: service.SearchPatientsInput{Q: "zebra"}, wantNames: []string{}},
+        {name: "punctuation only", input: service.SearchPatientsInput{Q: "%%"}, wantNames: []string{}},
+    }
+
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        for _, patient := range seed {
+            if err := store.Create(&patient); err != nil {
+                t.Fatalf("Failed to seed patient: %v", err)
+            }
+        }
+        // Deleted patients never show up in results.
+        deleted := model.Patient{FirstName: "Janice", LastName: "Gone", Gender: "Female", DateOfBirth: mustDate(t, "1990-01-01")}
+        if err := store.Create(&deleted); err != nil {
+            t.Fatalf("Failed to seed patient: %v", err)
+        }
+        if err := store.Delete(deleted.ID); err != nil {
+            t.Fatalf("Failed to delete patient: %v", err)
+        }
+        svc := newPatientService(store)
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                results, err := svc.Search(tt.input)
+                if err != nil {
+                    t.Fatalf("Failed to search patients: %v", err)
+                }
+
+                names := make([]string, 0, len(results.Data))
+                for i, result := range results.Data {
+                    names = append(names, result.FirstName)
+                    if result.Score <= 0 {
+                        t.Errorf("Result %s has non-positive score %v", result.FirstName, result.Score)
+                    }
+                    if i > 0 && result.Score > results.Data[i-1].Score {
+                        t.Errorf("Results are not ordered by score: %+v", results.Data)
+                    }
+                }
+
+                if tt.input.Limit > 0 {
+                    if len(names) != tt.input.Limit {
+                        t.Errorf("Got %d results, want %d", len(names), tt.input.Limit)
+                    }
+                    return
+                }
+                if !tt.ordered {
+                    names, tt.wantNames = sorted(names), sorted(tt.wantNames)
+                }
+                if !reflect.DeepEqual(names, tt.wantNames) {
+                    t.Errorf("Got patients %v, want %v", names, tt.wantNames)
+                }
+            })
+        }
+    })
+}
+
+func TestAPI_SearchPatients(t *testing.T) {
+    env := newTestEnv(t)
+    seedPatient(t, env.DB, "Jane")
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+
+    tests := []struct {
+        name       string
+        path       string
+        token      string
+        wantStatus int
+        wantCount  int
+    }{
+        {"receptionist search", "/api/patients/search?q=jan", receptionist, http.StatusOK, 1},
+        {"doctor search", "/api/patients/search?q=doe&limit=5", doctor, http.StatusOK, 1},
+        {"missing query", "/api/patients/search", doctor, http.StatusBadRequest, 0},
+        {"query too short", "/api/patients/search?q=j", doctor, http.StatusBadRequest, 0},
+        {"anonymous", "/api/patients/search?q=jan", "", http.StatusUnauthorized, 0},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, http.MethodGet, tt.path, tt.token, nil)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("Status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+
+            var results service.PatientSearchResponse
+            decodeJSON(t, w, &results)
+            if len(results.Data) != tt.wantCount {
+                t.Errorf("Got %d results, want %d: %s", len(results.Data), tt.wantCount, w.Body.String())
+            }
+        })
+    }
+}
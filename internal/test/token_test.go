@@ -0,0 +1,233 @@
+package test
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/pem"
+    "errors"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+    "github.com/golang-jwt/jwt/v4"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/token"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+    t.Helper()
+
+    path := filepath.Join(t.TempDir(), "key.pem")
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+        t.Fatalf("Failed to write key: %v", err)
+    }
+    return path
+}
+
+func newRSAKey(t *testing.T) (*token.Key, *rsa.PrivateKey) {
+    t.Helper()
+
+    private, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("Failed to generate RSA key: %v", err)
+    }
+    key, err := token.ParsePEMKey("", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}))
+    if err != nil {
+        t.Fatalf("Failed to parse RSA key: %v", err)
+    }
+    return key, private
+}
+
+func newEd25519Key(t *testing.T) (*token.Key, ed25519.PrivateKey) {
+    t.Helper()
+
+    _, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("Failed to generate Ed25519 key: %v", err)
+    }
+    der, _ := x509.MarshalPKCS8PrivateKey(private)
+    key, err := token.ParsePEMKey("", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+    if err != nil {
+        t.Fatalf("Failed to parse Ed25519 key: %v", err)
+    }
+    return key, private
+}
+
+func claimsFor(userID uint) jwt.MapClaims {
+    return jwt.MapClaims{"user_id": userID, "permissions": []string{"patient:read"}, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestKeySet_SignAndVerify(t *testing.T) {
+    rsaKey, _ := newRSAKey(t)
+    edKey, _ := newEd25519Key(t)
+
+    tests := []struct {
+        name    string
+        key     *token.Key
+        wantAlg string
+    }{
+        {name: "HS256", key: token.NewHMACKey("", []byte("secret")), wantAlg: "HS256"},
+        {name: "RS256", key: rsaKey, wantAlg: "RS256"},
+        {name: "EdDSA", key: edKey, wantAlg: "EdDSA"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            keys, err := token.NewKeySet(tt.key)
+            if err != nil {
+                t.Fatalf("Failed to build key set: %v", err)
+            }
+
+            signed, err := keys.Sign(claimsFor(7))
+            if err != nil {
+                t.Fatalf("Failed to sign: %v", err)
+            }
+            parsed, err := jwt.Parse(signed, keys.Keyfunc)
+            if err != nil {
+                t.Fatalf("Failed to verify: %v", err)
+            }
+            if parsed.Header["alg"] != tt.wantAlg || parsed.Header["kid"] != tt.key.ID || tt.key.ID == "" {
+                t.Errorf("Unexpected header %v, want alg %s and kid %q", parsed.Header, tt.wantAlg, tt.key.ID)
+            }
+        })
+    }
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+    oldKey, oldPrivate := newRSAKey(t)
+    newKey, _ := newEd25519Key(t)
+
+    oldKeys, _ := token.NewKeySet(oldKey)
+    oldToken, err := oldKeys.Sign(claimsFor(1))
+    if err != nil {
+        t.Fatalf("Failed to sign: %v", err)
+    }
+
+    // After rotation the old key is verify-only; its public half is enough.
+    publicDER, _ := x509.MarshalPKIXPublicKey(&oldPrivate.PublicKey)
+    oldPublic, err := token.ParsePEMKey(oldKey.ID, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+    if err != nil {
+        t.Fatalf("Failed to parse public key: %v", err)
+    }
+    if oldPublic.CanSign() {
+        t.Error("A public key must not be able to sign")
+    }
+    if _, err := token.NewKeySet(oldPublic); err == nil {
+        t.Error("Expected a verify-only signing key to be rejected")
+    }
+
+    rotated, err := token.NewKeySet(newKey, oldPublic)
+    if err != nil {
+        t.Fatalf("Failed to build rotated key set: %v", err)
+    }
+    if _, err := jwt.Parse(oldToken, rotated.Keyfunc); err != nil {
+        t.Errorf("Token signed with the retired key should still verify: %v", err)
+    }
+
+    newToken, _ := rotated.Sign(claimsFor(1))
+    if _, err := jwt.Parse(newToken, oldKeys.Keyfunc); !errors.Is(err, token.ErrUnknownKey) {
+        t.Errorf("Old key set should not know the new kid, got %v", err)
+    }
+
+    jwks := rotated.JWKS()
+    if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != newKey.ID || jwks.Keys[0].KeyType != "OKP" ||
+        jwks.Keys[1].KeyID != oldKey.ID || jwks.Keys[1].KeyType != "RSA" || jwks.Keys[1].E != "AQAB" {
+        t.Errorf("Unexpected JWKS: %+v", jwks)
+    }
+}
+
+func TestKeySet_RejectsAlgorithmConfusion(t *testing.T) {
+    rsaKey, private := newRSAKey(t)
+    keys, _ := token.NewKeySet(rsaKey)
+
+    // An attacker signs HS256 using the published RSA public key as the secret.
+    publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&private.PublicKey)})
+    forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor(1))
+    forged.Header["kid"] = rsaKey.ID
+    signed, _ := forged.SignedString(publicPEM)
+
+    if _, err := jwt.Parse(signed, keys.Keyfunc); !errors.Is(err, token.ErrWrongAlg) {
+        t.Errorf("Expected ErrWrongAlg, got %v", err)
+    }
+}
+
+func TestKeySet_HMACNotPublished(t *testing.T) {
+    keys, _ := token.NewKeySet(token.NewHMACKey("", []byte("secret")), token.NewHMACKey("", []byte("older")))
+    if jwks := keys.JWKS(); len(jwks.Keys) != 0 {
+        t.Errorf("HMAC keys must not appear in the JWKS: %+v", jwks)
+    }
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+    _, edPrivate := newEd25519Key(t)
+    edDER, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+    edPath := writePEM(t, "PRIVATE KEY", edDER)
+
+    _, rsaPrivate := newRSAKey(t)
+    rsaPath := writePEM(t, "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaPrivate.PublicKey))
+
+    tests := []struct {
+        name        string
+        env         map[string]string
+        wantErr     bool
+        wantKid     string
+        wantJWKSLen int
+    }{
+        {name: "nothing configured", env: map[string]string{}, wantErr: true},
+        {name: "secret", env: map[string]string{"JWT_SECRET": "s", "JWT_KEY_ID": "primary"}, wantKid: "primary"},
+        {name: "secret with previous secrets", env: map[string]string{"JWT_SECRET": "s", "JWT_PREVIOUS_SECRETS": "a, b"}},
+        {name: "compromised secret", env: map[string]string{"JWT_SECRET": "mysecret123456"}, wantErr: true},
+        {name: "compromised previous secret", env: map[string]string{"JWT_SECRET": "s", "JWT_PREVIOUS_SECRETS": "a, mysecret123456"}, wantErr: true},
+        {
+            name:        "key file with previous key",
+            env:         map[string]string{"JWT_SIGNING_KEY_FILE": edPath, "JWT_KEY_ID": "ed-2024", "JWT_VERIFY_KEY_FILES": "rsa-2023=" + rsaPath},
+            wantKid:     "ed-2024",
+            wantJWKSLen: 2,
+        },
+        {name: "missing key file", env: map[string]string{"JWT_SIGNING_KEY_FILE": filepath.Join(t.TempDir(), "nope.pem")}, wantErr: true},
+        {name: "public key cannot sign", env: map[string]string{"JWT_SIGNING_KEY_FILE": rsaPath}, wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, key := range []string{"JWT_SECRET", "JWT_KEY_ID", "JWT_SIGNING_KEY_FILE", "JWT_VERIFY_KEY_FILES", "JWT_PREVIOUS_SECRETS"} {
+                t.Setenv(key, tt.env[key])
+            }
+
+            keys, err := config.LoadJWTKeys()
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatal("Expected an error, got nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Failed to load keys: %v", err)
+            }
+            if tt.wantKid != "" && keys.SigningKeyID() != tt.wantKid {
+                t.Errorf("Signing kid = %q, want %q", keys.SigningKeyID(), tt.wantKid)
+            }
+            if got := len(keys.JWKS().Keys); got != tt.wantJWKSLen {
+                t.Errorf("JWKS has %d keys, want %d", got, tt.wantJWKSLen)
+            }
+        })
+    }
+}
+
+func TestAPI_JWKS(t *testing.T) {
+    env := newTestEnv(t)
+
+    w := env.do(t, http.MethodGet, "/.well-known/jwks.json", "", nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+    }
+
+    var jwks token.JWKS
+    decodeJSON(t, w, &jwks)
+    if jwks.Keys == nil || len(jwks.Keys) != 0 {
+        t.Errorf("Expected an empty key list for an HMAC-only set, got %s", w.Body.String())
+    }
+}
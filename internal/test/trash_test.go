@@ -0,0 +1,341 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+func TestPatientService_Trash(t *testing.T) {
+    forEachPatientStore(t, func(t *testing.T, store repository.PatientStore) {
+        svc := newPatientService(store)
+        var ids []uint
+        for _, firstName := range []string{"Jane", "John", "Janet"} {
+            created, err := svc.Create(0, service.CreatePatientInput{FirstName: firstName, LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Force: true})
+            if err != nil {
+                t.Fatalf("Failed to create patient: %v", err)
+            }
+            ids = append(ids, created.ID)
+        }
+        jane, john, janet := ids[0], ids[1], ids[2]
+
+        for _, id := range []uint{jane, john} {
+            if err := svc.Delete(0, id); err != nil {
+                t.Fatalf("Failed to delete patient: %v", err)
+            }
+            time.Sleep(10 * time.Millisecond)
+        }
+
+        trash, err := svc.ListDeleted(service.ListDeletedPatientsInput{})
+        if err != nil {
+            t.Fatalf("Failed to list trash: %v", err)
+        }
+        if trash.Meta.Total != 2 || len(trash.Data) != 2 || trash.Data[0].ID != john || trash.Data[1].ID != jane || trash.Data[0].DeletedAt == "" {
+            t.Fatalf("Unexpected trash, want John then Jane: %+v", trash)
+        }
+
+        restored, err := svc.Restore(0, jane)
+        if err != nil {
+            t.Fatalf("Failed to restore patient: %v", err)
+        }
+        if restored.FirstName != "Jane" {
+            t.Errorf("Unexpected restored patient: %+v", restored)
+        }
+        if _, err := svc.Get(jane); err != nil {
+            t.Errorf("Restored patient should be readable: %v", err)
+        }
+        if _, err := svc.Restore(0, jane); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Restoring a live patient: expected gorm.ErrRecordNotFound, got %v", err)
+        }
+
+        // Only patients in the trash can be purged.
+        if err := svc.Purge(0, janet); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Purging a live patient: expected gorm.ErrRecordNotFound, got %v", err)
+        }
+        if err := svc.Purge(0, john); err != nil {
+            t.Fatalf("Failed to purge patient: %v", err)
+        }
+        if _, err := svc.Restore(0, john); !errors.Is(err, gorm.ErrRecordNotFound) {
+            t.Errorf("Restoring a purged patient: expected gorm.ErrRecordNotFound, got %v", err)
+        }
+        if trash, _ := svc.ListDeleted(service.ListDeletedPatientsInput{}); trash.Meta.Total != 0 {
+            t.Errorf("Trash should be empty: %+v", trash)
+        }
+
+        // Only patients deleted before the cutoff are purged.
+        if err := svc.Delete(0, janet); err != nil {
+            t.Fatalf("Failed to delete patient: %v", err)
+        }
+        if purged, err := svc.PurgeDeletedBefore(0, time.Now().Add(-time.Hour), 0); err != nil || len(purged) != 0 {
+            t.Errorf("PurgeDeletedBefore an hour ago = %v, %v; want nothing", purged, err)
+        }
+        purged, err := svc.PurgeDeletedBefore(0, time.Now().Add(time.Second), 0)
+        if err != nil || !reflect.DeepEqual(purged, []uint{janet}) {
+            t.Errorf("PurgeDeletedBefore = %v, %v; want [%d]", purged, err, janet)
+        }
+    })
+}
+
+func TestPatientRepository_PurgeRemovesDependents(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    other := seedPatient(t, env.DB, "John")
+
+    for _, id := range []uint{patient.ID, other.ID} {
+        if err := env.DB.Create(&model.MedicalHistoryEntry{PatientID: id, Kind: model.EntryNote, Description: "Seen"}).Error; err != nil {
+            t.Fatalf("Failed to seed history: %v", err)
+        }
+        start := time.Now().Add(time.Duration(id) * time.Hour)
+        if err := env.DB.Create(&model.Appointment{PatientID: id, DoctorID: 2, StartsAt: start, EndsAt: start.Add(time.Hour), Status: model.AppointmentScheduled}).Error; err != nil {
+            t.Fatalf("Failed to seed appointment: %v", err)
+        }
+        if err := env.DB.Create(&model.PatientIdentifier{PatientID: id, System: "PAS", Value: fmt.Sprint("MRN", id)}).Error; err != nil {
+            t.Fatalf("Failed to seed identifier: %v", err)
+        }
+    }
+    audit := service.NewAuditService(repository.NewAuditLogRepository(env.DB))
+    if err := audit.Record(1, model.AuditPatientRead, patient.ID, nil, nil); err != nil {
+        t.Fatalf("Failed to record audit entry: %v", err)
+    }
+
+    if err := env.PatientService.Delete(0, patient.ID); err != nil {
+        t.Fatalf("Failed to delete patient: %v", err)
+    }
+    if err := env.PatientService.Purge(0, patient.ID); err != nil {
+        t.Fatalf("Failed to purge patient: %v", err)
+    }
+
+    // Audit entries (the read, the delete and the purge) are kept;
+    // everything else about the patient goes.
+    counts := []struct {
+        name       string
+        model      interface{}
+        query      string
+        wantPurged int64
+        wantOther  int64
+    }{
+        {"patients", &model.Patient{}, "id = ?", 0, 1},
+        {"medical history", &model.MedicalHistoryEntry{}, "patient_id = ?", 0, 1},
+        {"appointments", &model.Appointment{}, "patient_id = ?", 0, 1},
+        {"identifiers", &model.PatientIdentifier{}, "patient_id = ?", 0, 1},
+        {"audit logs", &model.AuditLog{}, "patient_id = ?", 3, 0},
+    }
+    for _, tt := range counts {
+        for id, want := range map[uint]int64{patient.ID: tt.wantPurged, other.ID: tt.wantOther} {
+            var count int64
+            if err := env.DB.Unscoped().Model(tt.model).Where(tt.query, id).Count(&count).Error; err != nil {
+                t.Fatalf("Failed to count %s: %v", tt.name, err)
+            }
+            if count != want {
+                t.Errorf("Patient %d has %d %s rows, want %d", id, count, tt.name, want)
+            }
+        }
+    }
+}
+
+func TestRetentionJob(t *testing.T) {
+    stores := repository.Stores{
+        Patients: repository.NewMemoryPatientRepository(),
+        History:  repository.NewMemoryMedicalHistoryRepository(),
+        Audit:    repository.NewMemoryAuditLogRepository(),
+    }
+    patients := service.NewPatientService(stores)
+    audit := service.NewAuditService(stores.Audit)
+
+    created, err := patients.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Force: true})
+    if err != nil {
+        t.Fatalf("Failed to create patient: %v", err)
+    }
+    if err := patients.Delete(0, created.ID); err != nil {
+        t.Fatalf("Failed to delete patient: %v", err)
+    }
+
+    disabled := service.NewRetentionJob(patients, service.RetentionConfig{})
+    if ids, err := disabled.RunOnce(time.Now().Add(24 * time.Hour)); err != nil || len(ids) != 0 {
+        t.Errorf("A job without retention purged %v, %v", ids, err)
+    }
+
+    job := service.NewRetentionJob(patients, service.RetentionConfig{Retention: 24 * time.Hour})
+    if ids, err := job.RunOnce(time.Now()); err != nil || len(ids) != 0 {
+        t.Errorf("Purged %v, %v before the retention period passed", ids, err)
+    }
+    ids, err := job.RunOnce(time.Now().Add(25 * time.Hour))
+    if err != nil || !reflect.DeepEqual(ids, []uint{created.ID}) {
+        t.Fatalf("RunOnce = %v, %v; want [%d]", ids, err, created.ID)
+    }
+
+    logs, _ := audit.List(service.ListAuditLogsInput{PatientID: created.ID})
+    // Newest first: the purge follows the create and the delete.
+    if len(logs.Data) != 3 || logs.Data[0].Action != model.AuditPatientPurge || logs.Data[0].UserID != 0 || logs.Data[0].Changes != nil {
+        t.Errorf("Unexpected audit entries: %+v", logs.Data)
+    }
+    if trash, _ := patients.ListDeleted(service.ListDeletedPatientsInput{}); trash.Meta.Total != 0 {
+        t.Errorf("Trash should be empty: %+v", trash)
+    }
+
+    // A run purges at most one batch, oldest IDs first.
+    var deleted []uint
+    for i := 0; i < 3; i++ {
+        p, err := patients.Create(0, service.CreatePatientInput{FirstName: "Jane", LastName: "Doe", DateOfBirth: "1995-05-05T00:00:00Z", Gender: "Female", Force: true})
+        if err != nil {
+            t.Fatalf("Failed to create patient: %v", err)
+        }
+        if err := patients.Delete(0, p.ID); err != nil {
+            t.Fatalf("Failed to delete patient: %v", err)
+        }
+        deleted = append(deleted, p.ID)
+    }
+    batched := service.NewRetentionJob(patients, service.RetentionConfig{Retention: 24 * time.Hour, BatchSize: 2})
+    later := time.Now().Add(25 * time.Hour)
+    if ids, err := batched.RunOnce(later); err != nil || !reflect.DeepEqual(ids, deleted[:2]) {
+        t.Errorf("First batch = %v, %v; want %v", ids, err, deleted[:2])
+    }
+    if ids, err := batched.RunOnce(later); err != nil || !reflect.DeepEqual(ids, deleted[2:]) {
+        t.Errorf("Second batch = %v, %v; want %v", ids, err, deleted[2:])
+    }
+}
+
+func TestAPI_PatientTrash(t *testing.T) {
+    env := newTestEnv(t)
+    patient := seedPatient(t, env.DB, "Jane")
+    other := seedPatient(t, env.DB, "John")
+    receptionist := env.login(t, receptionistEmail)
+    admin := env.login(t, adminEmail)
+
+    for _, id := range []uint{patient.ID, other.ID} {
+        if w := env.do(t, http.MethodDelete, fmt.Sprintf("/api/patients/%d", id), receptionist, nil); w.Code != http.StatusNoContent {
+            t.Fatalf("Delete status = %d: %s", w.Code, w.Body.String())
+        }
+    }
+
+    trashPath := func(id uint) string { return fmt.Sprintf("/api/admin/patients/trash/%d", id) }
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        wantStatus int
+    }{
+        {"receptionist cannot list trash", http.MethodGet, "/api/admin/patients/trash", receptionist, http.StatusForbidden},
+        {"receptionist cannot restore", http.MethodPost, trashPath(patient.ID) + "/restore", receptionist, http.StatusForbidden},
+        {"receptionist cannot purge", http.MethodDelete, trashPath(patient.ID), receptionist, http.StatusForbidden},
+        {"anonymous", http.MethodGet, "/api/admin/patients/trash", "", http.StatusUnauthorized},
+        {"admin lists trash", http.MethodGet, "/api/admin/patients/trash?limit=5", admin, http.StatusOK},
+        {"invalid limit", http.MethodGet, "/api/admin/patients/trash?limit=1000", admin, http.StatusBadRequest},
+        {"admin restores", http.MethodPost, trashPath(patient.ID) + "/restore", admin, http.StatusOK},
+        {"restored patient is back", http.MethodGet, fmt.Sprintf("/api/patients/%d", patient.ID), receptionist, http.StatusOK},
+        {"restore twice", http.MethodPost, trashPath(patient.ID) + "/restore", admin, http.StatusNotFound},
+        {"cannot purge a live patient", http.MethodDelete, trashPath(patient.ID), admin, http.StatusNotFound},
+        {"admin purges", http.MethodDelete, trashPath(other.ID), admin, http.StatusNoContent},
+        {"purge twice", http.MethodDelete, trashPath(other.ID), admin, http.StatusNotFound},
+        {"purged patient cannot be restored", http.MethodPost, trashPath(other.ID) + "/restore", admin, http.StatusNotFound},
+        {"invalid id", http.MethodDelete, "/api/admin/patients/trash/abc", admin, http.StatusBadRequest},
+    }
+
+    // Cases run in order against one database; later cases depend on earlier ones.
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, tt.method, tt.path, tt.token, nil)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+            }
+            if tt.name == "admin lists trash" {
+                var trash service.DeletedPatientListResponse
+                decodeJSON(t, w, &trash)
+                if trash.Meta.Total != 2 || len(trash.Data) != 2 || trash.Data[0].DeletedAt == "" {
+                    t.Errorf("Unexpected trash: %s", w.Body.String())
+                }
+            }
+        })
+    }
+
+    var logs service.AuditLogListResponse
+    decodeJSON(t, env.do(t, http.MethodGet, "/api/admin/audit-logs?"+url.Values{"patient_id": {fmt.Sprint(other.ID)}}.Encode(), admin, nil), &logs)
+    var actions []string
+    for _, entry := range logs.Data {
+        actions = append(actions, entry.Action)
+    }
+    want := []string{"patient.purge", "patient.trash_list", "patient.delete"}
+    if !reflect.DeepEqual(actions, want) || logs.Data[0].Changes != nil {
+        t.Errorf("Actions = %v, want %v", actions, want)
+    }
+}
+
+func TestAPI_PurgeErasesAuditDiffs(t *testing.T) {
+    env := newTestEnv(t)
+    receptionist := env.login(t, receptionistEmail)
+    doctor := env.login(t, doctorEmail)
+    admin := env.login(t, adminEmail)
+
+    create := service.CreatePatientInput{FirstName: "Zelda", LastName: "Quixote", DateOfBirth: "1981-02-03T00:00:00Z", Gender: "Female", Contact: "5550001111", Address: "7 Hidden Lane"}
+    w := env.do(t, http.MethodPost, "/api/patients", receptionist, create)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Create status = %d: %s", w.Code, w.Body.String())
+    }
+    var created service.PatientResponse
+    decodeJSON(t, w, &created)
+    path := fmt.Sprintf("/api/patients/%d", created.ID)
+
+    steps := []struct {
+        method string
+        path   string
+        token  string
+        body   interface{}
+    }{
+        {http.MethodPut, path, receptionist, service.UpdatePatientInput{Contact: "5552223333", Address: "9 Secret Road"}},
+        {http.MethodPost, path + "/medical-history", doctor, service.MedicalHistoryInput{Kind: "diagnosis", Description: "Rare condition"}},
+        {http.MethodDelete, path, receptionist, nil},
+    }
+    for _, step := range steps {
+        if w := env.doWithHeaders(t, step.method, step.path, step.token, map[string]string{"If-Match": "*"}, step.body); w.Code >= 300 {
+            t.Fatalf("%s %s status = %d: %s", step.method, step.path, w.Code, w.Body.String())
+        }
+    }
+
+    logsPath := fmt.Sprintf("/api/admin/audit-logs?patient_id=%d", created.ID)
+    var logs service.AuditLogListResponse
+    decodeJSON(t, env.do(t, http.MethodGet, logsPath, admin, nil), &logs)
+    if update := logs.Data[len(logs.Data)-2]; update.Changes["contact"] != (service.FieldChange{Before: "5550001111", After: "5552223333"}) {
+        t.Errorf("Unexpected update diff before the purge: %+v", update)
+    }
+
+    if w := env.do(t, http.MethodDelete, fmt.Sprintf("/api/admin/patients/trash/%d", created.ID), admin, nil); w.Code != http.StatusNoContent {
+        t.Fatalf("Purge status = %d: %s", w.Code, w.Body.String())
+    }
+
+    var keys int64
+    env.DB.Model(&model.AuditKey{}).Where("patient_id = ?", created.ID).Count(&keys)
+    if keys != 0 {
+        t.Errorf("Got %d audit keys for the purged patient, want 0", keys)
+    }
+
+    w = env.do(t, http.MethodGet, logsPath, admin, nil)
+    secrets := []string{"Zelda", "Quixote", "1981-02-03", "5550001111", "5552223333", "Hidden Lane", "Secret Road", "Rare condition"}
+    for _, secret := range secrets {
+        if strings.Contains(w.Body.String(), secret) {
+            t.Errorf("Audit log still shows %q: %s", secret, w.Body.String())
+        }
+    }
+    logs = service.AuditLogListResponse{}
+    decodeJSON(t, w, &logs)
+    if len(logs.Data) != 5 {
+        t.Fatalf("Got %d audit entries, want 5", len(logs.Data))
+    }
+    for _, entry := range logs.Data {
+        if entry.Changes != nil {
+            t.Errorf("%s entry still has changes: %+v", entry.Action, entry.Changes)
+        }
+        if wantErased := entry.Action != model.AuditPatientPurge; entry.ChangesErased != wantErased {
+            t.Errorf("%s entry erased = %v, want %v", entry.Action, entry.ChangesErased, wantErased)
+        }
+    }
+}
@@ -0,0 +1,433 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+    "makerble-assessment/internal/handler"
+    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/router"
+    "makerble-assessment/internal/service"
+)
+
+// totpCode is the code for secret offset steps from now.
+func totpCode(t *testing.T, secret string, offset int64) string {
+    t.Helper()
+
+    code, err := service.TOTPCode(secret, service.TOTPStep(time.Now())+offset)
+    if err != nil {
+        t.Fatalf("Failed to compute TOTP code: %v", err)
+    }
+    return code
+}
+
+func TestTOTPCode(t *testing.T) {
+    // RFC 6238 appendix B, SHA-1, truncated to six digits. The secret is
+    // "12345678901234567890" in base32.
+    const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+    tests := []struct {
+        unix int64
+        want string
+    }{
+        {59, "287082"},
+        {1111111109, "081804"},
+        {1234567890, "005924"},
+        {2000000000, "279037"},
+    }
+
+    for _, tt := range tests {
+        got, err := service.TOTPCode(secret, service.TOTPStep(time.Unix(tt.unix, 0)))
+        if err != nil || got != tt.want {
+            t.Errorf("TOTPCode at %d = %q, %v; want %q", tt.unix, got, err, tt.want)
+        }
+    }
+}
+
+func TestAuthService_TwoFactor(t *testing.T) {
+    db := newTestDB(t)
+    // Run against both stores so the in-memory store stays a faithful fake.
+    stores := map[string]struct {
+        users  repository.UserStore
+        tokens repository.RefreshTokenStore
+    }{
+        "gorm":   {repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryUserRepository(), repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            users := service.NewUserService(store.users, store.tokens)
+            auth := service.NewAuthService(store.users, store.tokens, newTestKeys(t), service.DefaultAuthConfig())
+            created, err := users.Create(service.CreateUserInput{Email: "house@example.com", Password: strongPassword, Roles: []string{model.RoleDoctor}})
+            if err != nil {
+                t.Fatalf("Failed to create doctor: %v", err)
+            }
+            credentials := service.LoginInput{Email: created.Email, Password: strongPassword}
+
+            // Doctors must enroll before their first login completes.
+            login, err := auth.Login(credentials)
+            if err != nil || login.Token != "" || login.TwoFactor == nil || !login.TwoFactor.EnrollmentRequired {
+                t.Fatalf("Login = %+v, %v; want an enrollment challenge", login, err)
+            }
+            challenge := login.TwoFactor.ChallengeToken
+            if _, err := auth.ValidateToken(challenge); service.AsError(err).Code != service.ErrInvalidToken.Code {
+                t.Errorf("A challenge must not pass as an access token, got %v", err)
+            }
+            if _, err := auth.VerifyTwoFactor(service.ChallengeCodeInput{ChallengeToken: challenge, Code: "000000"}); !errors.Is(err, service.ErrEnrollmentRequired) {
+                t.Errorf("Expected ErrEnrollmentRequired, got %v", err)
+            }
+            if _, err := auth.ConfirmChallengeEnrollment(service.ChallengeCodeInput{ChallengeToken: challenge, Code: "000000"}); !errors.Is(err, service.ErrEnrollmentNotStarted) {
+                t.Errorf("Expected ErrEnrollmentNotStarted, got %v", err)
+            }
+
+            setup, err := auth.StartChallengeEnrollment(service.ChallengeInput{ChallengeToken: challenge})
+            if err != nil {
+                t.Fatalf("Failed to start enrollment: %v", err)
+            }
+            uri, err := url.Parse(setup.ProvisioningURI)
+            if err != nil || uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Query().Get("secret") != setup.Secret ||
+                uri.Query().Get("issuer") != "Makerble Hospital" || !strings.HasSuffix(uri.Path, ":house@example.com") {
+                t.Errorf("Unexpected provisioning URI %q", setup.ProvisioningURI)
+            }
+            if _, err := auth.ConfirmChallengeEnrollment(service.ChallengeCodeInput{ChallengeToken: challenge, Code: "not-a-code"}); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+                t.Errorf("Expected ErrInvalidTwoFactorCode, got %v", err)
+            }
+
+            enrolled, err := auth.ConfirmChallengeEnrollment(service.ChallengeCodeInput{ChallengeToken: challenge, Code: totpCode(t, setup.Secret, 0)})
+            if err != nil || enrolled.Token == "" || len(enrolled.RecoveryCodes) != 10 || !enrolled.User.TwoFactorEnabled {
+                t.Fatalf("Confirm = %+v, %v; want tokens and 10 recovery codes", enrolled, err)
+            }
+            if _, err := auth.StartChallengeEnrollment(service.ChallengeInput{ChallengeToken: challenge}); !errors.Is(err, service.ErrInvalidChallenge) {
+                t.Errorf("Reusing a completed challenge: expected ErrInvalidChallenge, got %v", err)
+            }
+
+            // Later logins need a code, and each code and challenge works
+            // once.
+            challengeFor := func() string {
+                login, err := auth.Login(credentials)
+                if err != nil || login.TwoFactor == nil || login.TwoFactor.EnrollmentRequired {
+                    t.Fatalf("Login = %+v, %v; want a code challenge", login, err)
+                }
+                return login.TwoFactor.ChallengeToken
+            }
+            verify := func(code string) error {
+                _, err := auth.VerifyTwoFactor(service.ChallengeCodeInput{ChallengeToken: challengeFor(), Code: code})
+                return err
+            }
+            challenge = challengeFor()
+            if _, err := auth.VerifyTwoFactor(service.ChallengeCodeInput{ChallengeToken: challenge, Code: totpCode(t, setup.Secret, 0)}); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+                t.Errorf("Replayed enrollment code: expected ErrInvalidTwoFactorCode, got %v", err)
+            }
+            if _, err := auth.VerifyTwoFactor(service.ChallengeCodeInput{ChallengeToken: challenge, Code: totpCode(t, setup.Secret, 1)}); err != nil {
+                t.Errorf("Failed to verify the next code: %v", err)
+            }
+            if _, err := auth.VerifyTwoFactor(service.ChallengeCodeInput{ChallengeToken: challenge, Code: enrolled.RecoveryCodes[3]}); !errors.Is(err, service.ErrInvalidChallenge) {
+                t.Errorf("Reusing a completed challenge: expected ErrInvalidChallenge, got %v", err)
+            }
+            if err := verify(totpCode(t, setup.Secret, 1)); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+                t.Errorf("Replayed code: expected ErrInvalidTwoFactorCode, got %v", err)
+            }
+            if err := verify(strings.ToUpper(enrolled.RecoveryCodes[0])); err != nil {
+                t.Errorf("Failed to verify a recovery code: %v", err)
+            }
+            if err := verify(enrolled.RecoveryCodes[0]); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+                t.Errorf("Reused recovery code: expected ErrInvalidTwoFactorCode, got %v", err)
+            }
+
+            // New recovery codes replace the old ones.
+            fresh, err := auth.RegenerateRecoveryCodes(created.ID, service.TwoFactorCodeInput{Code: enrolled.RecoveryCodes[1]})
+            if err != nil || len(fresh.RecoveryCodes) != 10 {
+                t.Fatalf("Regenerate = %+v, %v", fresh, err)
+            }
+            if err := verify(enrolled.RecoveryCodes[2]); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+                t.Errorf("Replaced recovery code: expected ErrInvalidTwoFactorCode, got %v", err)
+            }
+
+            // Only roles that do not require it let a user turn it off.
+            disable := service.TwoFactorCodeInput{Code: fresh.RecoveryCodes[0]}
+            if err := auth.DisableTwoFactor(created.ID, disable); !errors.Is(err, service.ErrTwoFactorRoleRequired) {
+                t.Errorf("Expected ErrTwoFactorRoleRequired, got %v", err)
+            }
+            optional := false
+            role, err := users.UpdateRole(model.RoleDoctor, service.UpdateRoleInput{TwoFactorRequired: &optional})
+            if err != nil || role.TwoFactorRequired {
+                t.Fatalf("UpdateRole = %+v, %v", role, err)
+            }
+            if err := auth.DisableTwoFactor(created.ID, disable); err != nil {
+                t.Fatalf("Failed to disable two-factor authentication: %v", err)
+            }
+            login, err = auth.Login(credentials)
+            if err != nil || login.Token == "" || login.TwoFactor != nil || login.User.TwoFactorEnabled {
+                t.Errorf("Login = %+v, %v; want tokens", login, err)
+            }
+            if _, err := users.UpdateRole("janitor", service.UpdateRoleInput{TwoFactorRequired: &optional}); service.AsError(err).Kind != service.KindNotFound {
+                t.Errorf("Expected not found for an unknown role, got %v", err)
+            }
+        })
+    }
+}
+
+func TestAuthService_TwoFactorPolicyChange(t *testing.T) {
+    db := newTestDB(t)
+    stores := map[string]struct {
+        users  repository.UserStore
+        tokens repository.RefreshTokenStore
+    }{
+        "gorm":   {repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryUserRepository(), repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            users := service.NewUserService(store.users, store.tokens)
+            auth := service.NewAuthService(store.users, store.tokens, newTestKeys(t), service.DefaultAuthConfig())
+            setPolicy := func(required bool) {
+                t.Helper()
+                roles, err := store.users.FindRoles([]string{model.RoleReceptionist})
+                if err != nil || len(roles) != 1 {
+                    t.Fatalf("FindRoles = %+v, %v", roles, err)
+                }
+                roles[0].TwoFactorRequired = required
+                if err := store.users.UpdateRole(&roles[0]); err != nil {
+                    t.Fatalf("Failed to update role: %v", err)
+                }
+            }
+            login := func(email string) service.TokenResponse {
+                t.Helper()
+                tokens, err := auth.Login(service.LoginInput{Email: email, Password: strongPassword})
+                if err != nil || tokens.Token == "" {
+                    t.Fatalf("Login = %+v, %v; want tokens", tokens, err)
+                }
+                return tokens
+            }
+            for _, email := range []string{"pam@example.com", "kelly@example.com"} {
+                if _, err := users.Create(service.CreateUserInput{Email: email, Password: strongPassword, Roles: []string{model.RoleReceptionist}}); err != nil {
+                    t.Fatalf("Failed to create receptionist: %v", err)
+                }
+            }
+
+            // A session begun before the policy cannot be refreshed past it.
+            session := login("pam@example.com")
+            setPolicy(true)
+            if _, err := auth.Refresh(service.RefreshInput{RefreshToken: session.RefreshToken}); !errors.Is(err, service.ErrTwoFactorLoginRequired) {
+                t.Errorf("Refresh under the new policy: expected ErrTwoFactorLoginRequired, got %v", err)
+            }
+            if _, err := auth.ValidateToken(session.Token); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Access token of the refused session: expected ErrTokenRevoked, got %v", err)
+            }
+            setPolicy(false)
+
+            // Turning the policy on ends the sessions of holders who have
+            // not enrolled, and only theirs.
+            session = login("pam@example.com")
+            enrolledUser := login("kelly@example.com")
+            setup, err := auth.EnrollTwoFactor(enrolledUser.User.ID)
+            if err != nil {
+                t.Fatalf("Failed to start enrollment: %v", err)
+            }
+            if _, err := auth.ConfirmTwoFactor(enrolledUser.User.ID, service.TwoFactorCodeInput{Code: totpCode(t, setup.Secret, 0)}); err != nil {
+                t.Fatalf("Failed to confirm enrollment: %v", err)
+            }
+            required := true
+            if _, err := users.UpdateRole(model.RoleReceptionist, service.UpdateRoleInput{TwoFactorRequired: &required}); err != nil {
+                t.Fatalf("Failed to update role: %v", err)
+            }
+            if _, err := auth.ValidateToken(session.Token); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Unenrolled session: expected ErrTokenRevoked, got %v", err)
+            }
+            if _, err := auth.Refresh(service.RefreshInput{RefreshToken: session.RefreshToken}); !errors.Is(err, service.ErrInvalidRefreshToken) {
+                t.Errorf("Unenrolled refresh: expected ErrInvalidRefreshToken, got %v", err)
+            }
+            if _, err := auth.ValidateToken(enrolledUser.Token); err != nil {
+                t.Errorf("Enrolled session: %v", err)
+            }
+            if _, err := auth.Refresh(service.RefreshInput{RefreshToken: enrolledUser.RefreshToken}); err != nil {
+                t.Errorf("Enrolled refresh: %v", err)
+            }
+        })
+    }
+}
+
+func TestAPI_TwoFactor(t *testing.T) {
+    env := newTestEnv(t)
+    setTwoFactorRequired(t, env.DB, model.RoleDoctor, true)
+    admin := env.login(t, adminEmail)
+    credentials := service.LoginInput{Email: doctorEmail, Password: seedPassword}
+
+    w := env.do(t, http.MethodPost, "/login", "", credentials)
+    var login service.TokenResponse
+    decodeJSON(t, w, &login)
+    if w.Code != http.StatusOK || login.Token != "" || login.TwoFactor == nil || !login.TwoFactor.EnrollmentRequired {
+        t.Fatalf("Login: status %d, %s", w.Code, w.Body.String())
+    }
+    challenge := login.TwoFactor.ChallengeToken
+    if w := env.do(t, http.MethodGet, "/api/patients", challenge, nil); w.Code != http.StatusUnauthorized {
+        t.Errorf("Challenge used as a bearer token: status %d", w.Code)
+    }
+
+    w = env.do(t, http.MethodPost, "/auth/2fa/enroll", "", service.ChallengeInput{ChallengeToken: challenge})
+    var setup service.TwoFactorSetup
+    decodeJSON(t, w, &setup)
+    if w.Code != http.StatusOK || !strings.HasPrefix(setup.ProvisioningURI, "otpauth://totp/") {
+        t.Fatalf("Enroll: status %d, %s", w.Code, w.Body.String())
+    }
+    w = env.do(t, http.MethodPost, "/auth/2fa/enroll/confirm", "", service.ChallengeCodeInput{ChallengeToken: challenge, Code: totpCode(t, setup.Secret, 0)})
+    var enrolled service.TokenResponse
+    decodeJSON(t, w, &enrolled)
+    if w.Code != http.StatusOK || enrolled.Token == "" || len(enrolled.RecoveryCodes) != 10 {
+        t.Fatalf("Confirm: status %d, %s", w.Code, w.Body.String())
+    }
+    if w := env.do(t, http.MethodGet, "/api/patients", enrolled.Token, nil); w.Code != http.StatusOK {
+        t.Errorf("Enrolled token: status %d", w.Code)
+    }
+
+    decodeJSON(t, env.do(t, http.MethodPost, "/login", "", credentials), &login)
+    w = env.do(t, http.MethodPost, "/auth/2fa/verify", "", service.ChallengeCodeInput{ChallengeToken: login.TwoFactor.ChallengeToken, Code: enrolled.RecoveryCodes[0]})
+    if w.Code != http.StatusOK {
+        t.Errorf("Verify: status %d, %s", w.Code, w.Body.String())
+    }
+
+    t.Run("admin enforcement", func(t *testing.T) {
+        var roles []service.RoleResponse
+        decodeJSON(t, env.do(t, http.MethodGet, "/api/admin/roles", admin, nil), &roles)
+        required := map[string]bool{}
+        for _, role := range roles {
+            required[role.Name] = role.TwoFactorRequired
+        }
+        if len(roles) != 3 || !required[model.RoleDoctor] || required[model.RoleReceptionist] {
+            t.Errorf("Unexpected roles: %+v", roles)
+        }
+
+        receptionist := env.login(t, receptionistEmail)
+        w := env.do(t, http.MethodPut, "/api/admin/roles/receptionist", admin, map[string]bool{"two_factor_required": true})
+        if w.Code != http.StatusOK {
+            t.Fatalf("Update role: status %d, %s", w.Code, w.Body.String())
+        }
+        if w := env.do(t, http.MethodGet, "/api/patients", receptionist, nil); w.Code != http.StatusUnauthorized {
+            t.Errorf("Unenrolled receptionist session: status %d", w.Code)
+        }
+        var login service.TokenResponse
+        decodeJSON(t, env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: receptionistEmail, Password: seedPassword}), &login)
+        if login.Token != "" || login.TwoFactor == nil || !login.TwoFactor.EnrollmentRequired {
+            t.Errorf("Receptionist login = %+v, want an enrollment challenge", login)
+        }
+
+        for _, tt := range []struct {
+            name string
+            path string
+            body interface{}
+            want int
+        }{
+            {"missing flag", "/api/admin/roles/receptionist", map[string]string{}, http.StatusBadRequest},
+            {"unknown role", "/api/admin/roles/janitor", map[string]bool{"two_factor_required": true}, http.StatusNotFound},
+        } {
+            if w := env.do(t, http.MethodPut, tt.path, admin, tt.body); w.Code != tt.want {
+                t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+            }
+        }
+        if w := env.do(t, http.MethodGet, "/api/admin/roles", enrolled.Token, nil); w.Code != http.StatusForbidden {
+            t.Errorf("Roles as a doctor: status %d", w.Code)
+        }
+    })
+
+    t.Run("self-service", func(t *testing.T) {
+        // The doctor role requires two-factor authentication.
+        w := env.do(t, http.MethodPost, "/api/account/2fa/disable", enrolled.Token, service.TwoFactorCodeInput{Code: enrolled.RecoveryCodes[1]})
+        if w.Code != http.StatusForbidden {
+            t.Errorf("Disable: status %d, %s", w.Code, w.Body.String())
+        }
+        w = env.do(t, http.MethodPost, "/api/account/2fa", enrolled.Token, nil)
+        if w.Code != http.StatusConflict {
+            t.Errorf("Enroll twice: status %d, %s", w.Code, w.Body.String())
+        }
+        w = env.do(t, http.MethodPost, "/api/account/2fa/recovery-codes", enrolled.Token, service.TwoFactorCodeInput{Code: enrolled.RecoveryCodes[1]})
+        var codes service.RecoveryCodesResponse
+        decodeJSON(t, w, &codes)
+        if w.Code != http.StatusOK || len(codes.RecoveryCodes) != 10 {
+            t.Errorf("Regenerate: status %d, %s", w.Code, w.Body.String())
+        }
+
+        // Admins enroll of their own accord.
+        w = env.do(t, http.MethodPost, "/api/account/2fa", admin, nil)
+        var setup service.TwoFactorSetup
+        decodeJSON(t, w, &setup)
+        if w.Code != http.StatusOK {
+            t.Fatalf("Admin enroll: status %d, %s", w.Code, w.Body.String())
+        }
+        w = env.do(t, http.MethodPost, "/api/account/2fa/confirm", admin, service.TwoFactorCodeInput{Code: totpCode(t, setup.Secret, 0)})
+        if w.Code != http.StatusOK {
+            t.Fatalf("Admin confirm: status %d, %s", w.Code, w.Body.String())
+        }
+        w = env.do(t, http.MethodPost, "/api/account/2fa/disable", admin, service.TwoFactorCodeInput{Code: totpCode(t, setup.Secret, 1)})
+        if w.Code != http.StatusNoContent {
+            t.Errorf("Admin disable: status %d, %s", w.Code, w.Body.String())
+        }
+    })
+
+    t.Run("admin reset", func(t *testing.T) {
+        var doctors service.UserListResponse
+        decodeJSON(t, env.do(t, http.MethodGet, "/api/admin/users?role=doctor", admin, nil), &doctors)
+        if len(doctors.Data) != 1 || !doctors.Data[0].TwoFactorEnabled {
+            t.Fatalf("Unexpected doctors: %+v", doctors)
+        }
+
+        w := env.do(t, http.MethodDelete, fmt.Sprintf("/api/admin/users/%d/2fa", doctors.Data[0].ID), admin, nil)
+        var reset service.UserResponse
+        decodeJSON(t, w, &reset)
+        if w.Code != http.StatusOK || reset.TwoFactorEnabled {
+            t.Fatalf("Reset: status %d, %s", w.Code, w.Body.String())
+        }
+        if w := env.do(t, http.MethodGet, "/api/patients", enrolled.Token, nil); w.Code != http.StatusUnauthorized {
+            t.Errorf("Session after reset: status %d", w.Code)
+        }
+        var login service.TokenResponse
+        decodeJSON(t, env.do(t, http.MethodPost, "/login", "", credentials), &login)
+        if login.TwoFactor == nil || !login.TwoFactor.EnrollmentRequired {
+            t.Errorf("Login after reset = %+v, want an enrollment challenge", login)
+        }
+    })
+}
+
+func TestAPI_TwoFactorLimit(t *testing.T) {
+    env := newTestEnv(t)
+    setTwoFactorRequired(t, env.DB, model.RoleDoctor, true)
+    env.Router = router.New(env.DB, router.Config{
+        Keys:       newTestKeys(t),
+        Auth:       service.DefaultAuthConfig(),
+        LoginLimit: service.LoginLimitConfig{AccountFailures: 2, FailureWindow: time.Minute, Lockout: time.Minute},
+    })
+
+    var login service.TokenResponse
+    decodeJSON(t, env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: doctorEmail, Password: seedPassword}), &login)
+    challenge := login.TwoFactor.ChallengeToken
+    var setup service.TwoFactorSetup
+    decodeJSON(t, env.do(t, http.MethodPost, "/auth/2fa/enroll", "", service.ChallengeInput{ChallengeToken: challenge}), &setup)
+    if w := env.do(t, http.MethodPost, "/auth/2fa/enroll/confirm", "", service.ChallengeCodeInput{ChallengeToken: challenge, Code: totpCode(t, setup.Secret, 0)}); w.Code != http.StatusOK {
+        t.Fatalf("Confirm: status %d, %s", w.Code, w.Body.String())
+    }
+
+    // Wrong codes lock the account like wrong passwords, and a right
+    // password in between does not start the count over.
+    decodeJSON(t, env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: doctorEmail, Password: seedPassword}), &login)
+    wrong := service.ChallengeCodeInput{ChallengeToken: login.TwoFactor.ChallengeToken, Code: "aaaa-aaaa"}
+    if w := env.do(t, http.MethodPost, "/auth/2fa/verify", "", wrong); w.Code != http.StatusUnauthorized {
+        t.Fatalf("Wrong code: status %d", w.Code)
+    }
+    decodeJSON(t, env.do(t, http.MethodPost, "/login", "", service.LoginInput{Email: doctorEmail, Password: seedPassword}), &login)
+    wrong.ChallengeToken = login.TwoFactor.ChallengeToken
+    if w := env.do(t, http.MethodPost, "/auth/2fa/verify", "", wrong); w.Code != http.StatusUnauthorized {
+        t.Fatalf("Wrong code: status %d", w.Code)
+    }
+
+    w := env.do(t, http.MethodPost, "/auth/2fa/verify", "", service.ChallengeCodeInput{ChallengeToken: wrong.ChallengeToken, Code: totpCode(t, setup.Secret, 1)})
+    var refused handler.ErrorResponse
+    decodeJSON(t, w, &refused)
+    if w.Code != http.StatusTooManyRequests || refused.Code != "too_many_attempts" {
+        t.Errorf("Locked verify: status %d, %+v", w.Code, refused)
+    }
+}
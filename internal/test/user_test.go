@@ -0,0 +1,276 @@
+package test
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+    "gorm.io/gorm"
+    "makerble-assessment/internal/repository"
+    "makerble-assessment/internal/service"
+)
+
+const strongPassword = "Correct-Horse-42"
+
+func TestValidatePassword(t *testing.T) {
+    tests := []struct {
+        name     string
+        password string
+        wantErr  bool
+    }{
+        {name: "strong", password: strongPassword},
+        {name: "too short", password: "Short1a", wantErr: true},
+        {name: "too long", password: "Aa1" + string(make([]byte, 70)), wantErr: true},
+        {name: "no digit", password: "NoDigitsHereAtAll", wantErr: true},
+        {name: "no upper case", password: "lowercase12345", wantErr: true},
+        {name: "no lower case", password: "UPPERCASE12345", wantErr: true},
+        {name: "contains email", password: "Xjane.smith2024", wantErr: true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := service.ValidatePassword(tt.password, "jane.smith@example.com")
+            if tt.wantErr != (err != nil) {
+                t.Fatalf("ValidatePassword(%q) = %v, wantErr %v", tt.password, err, tt.wantErr)
+            }
+            if err != nil && !errors.Is(err, service.ErrWeakPassword) {
+                t.Errorf("Expected ErrWeakPassword, got %v", err)
+            }
+        })
+    }
+}
+
+func TestUserService(t *testing.T) {
+    db := newTestDB(t)
+    // Run against both stores so the in-memory store stays a faithful fake.
+    stores := map[string]struct {
+        users  repository.UserStore
+        tokens repository.RefreshTokenStore
+    }{
+        "gorm":   {repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryUserRepository(), repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            svc := service.NewUserService(store.users, store.tokens)
+            auth := service.NewAuthService(store.users, store.tokens, newTestKeys(t), service.DefaultAuthConfig())
+
+            created, err := svc.Create(service.CreateUserInput{Email: "nurse@example.com", Password: strongPassword, Roles: []string{"receptionist", "doctor", "doctor"}})
+            if err != nil {
+                t.Fatalf("Failed to create user: %v", err)
+            }
+            if !reflect.DeepEqual(created.Roles, []string{"doctor", "receptionist"}) || !created.Active ||
+                !reflect.DeepEqual(created.Permissions, []string{"appointment:attend", "appointment:read", "appointment:write", "medical_history:write", "patient:read", "patient:write"}) {
+                t.Errorf("Unexpected user: %+v", created)
+            }
+
+            rejected := []struct {
+                input service.CreateUserInput
+                want  error
+            }{
+                {service.CreateUserInput{Email: "nurse@example.com", Password: strongPassword, Roles: []string{"doctor"}}, service.ErrEmailTaken},
+                {service.CreateUserInput{Email: "other@example.com", Password: strongPassword, Roles: []string{"janitor"}}, service.ErrUnknownRole},
+                {service.CreateUserInput{Email: "other@example.com", Password: "password123", Roles: []string{"doctor"}}, service.ErrWeakPassword},
+            }
+            for _, tt := range rejected {
+                if _, err := svc.Create(tt.input); !errors.Is(err, tt.want) {
+                    t.Errorf("Create(%+v) = %v, want %v", tt.input, err, tt.want)
+                }
+            }
+
+            updated, err := svc.Update(0, created.ID, service.UpdateUserInput{Email: "head.nurse@example.com", Roles: []string{"admin"}})
+            if err != nil {
+                t.Fatalf("Failed to update user: %v", err)
+            }
+            if updated.Email != "head.nurse@example.com" || !reflect.DeepEqual(updated.Roles, []string{"admin"}) {
+                t.Errorf("Unexpected updated user: %+v", updated)
+            }
+            if got, _ := svc.Get(created.ID); !reflect.DeepEqual(got, updated) {
+                t.Errorf("Get = %+v, want %+v", got, updated)
+            }
+            if _, err := svc.Update(0, 9999, service.UpdateUserInput{Email: "x@example.com"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+                t.Errorf("Expected gorm.ErrRecordNotFound, got %v", err)
+            }
+
+            session, err := auth.Login(service.LoginInput{Email: "head.nurse@example.com", Password: strongPassword})
+            if err != nil {
+                t.Fatalf("Failed to log in: %v", err)
+            }
+
+            if _, err := svc.Deactivate(created.ID, created.ID); !errors.Is(err, service.ErrCannotDeactivateSelf) {
+                t.Errorf("Expected ErrCannotDeactivateSelf, got %v", err)
+            }
+            deactivated, err := svc.Deactivate(0, created.ID)
+            if err != nil || deactivated.Active {
+                t.Fatalf("Deactivate = %+v, %v", deactivated, err)
+            }
+            if _, err := auth.ValidateToken(session.Token); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Expected sessions to be revoked on deactivation, got %v", err)
+            }
+            if _, err := auth.Login(service.LoginInput{Email: "head.nurse@example.com", Password: strongPassword}); !errors.Is(err, service.ErrAccountDeactivated) {
+                t.Errorf("Expected ErrAccountDeactivated, got %v", err)
+            }
+
+            inactive, err := svc.List(service.ListUsersInput{Status: "inactive"})
+            if err != nil || len(inactive.Data) != 1 || inactive.Data[0].ID != created.ID {
+                t.Errorf("Inactive users = %+v, %v", inactive, err)
+            }
+            admins, _ := svc.List(service.ListUsersInput{Role: "admin", Status: "active"})
+            for _, user := range admins.Data {
+                if user.ID == created.ID || !reflect.DeepEqual(user.Roles, []string{"admin"}) {
+                    t.Errorf("Unexpected user in active admins: %+v", user)
+                }
+            }
+
+            if activated, err := svc.Activate(created.ID); err != nil || !activated.Active {
+                t.Fatalf("Activate = %+v, %v", activated, err)
+            }
+            session, err = auth.Login(service.LoginInput{Email: "head.nurse@example.com", Password: strongPassword})
+            if err != nil {
+                t.Fatalf("Failed to log in after reactivation: %v", err)
+            }
+
+            if err := svc.ResetPassword(created.ID, service.ResetPasswordInput{Password: "short"}); !errors.Is(err, service.ErrWeakPassword) {
+                t.Errorf("Expected ErrWeakPassword, got %v", err)
+            }
+            if err := svc.ResetPassword(created.ID, service.ResetPasswordInput{Password: "Brand-New-Pass-7"}); err != nil {
+                t.Fatalf("Failed to reset password: %v", err)
+            }
+            if _, err := auth.ValidateToken(session.Token); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Expected sessions to be revoked on password reset, got %v", err)
+            }
+            if _, err := auth.Login(service.LoginInput{Email: "head.nurse@example.com", Password: strongPassword}); err == nil {
+                t.Error("Old password should no longer work")
+            }
+            if _, err := auth.Login(service.LoginInput{Email: "head.nurse@example.com", Password: "Brand-New-Pass-7"}); err != nil {
+                t.Errorf("Failed to log in with the new password: %v", err)
+            }
+        })
+    }
+}
+
+func TestUserService_RoleChanges(t *testing.T) {
+    db := newTestDB(t)
+    stores := map[string]struct {
+        users  repository.UserStore
+        tokens repository.RefreshTokenStore
+    }{
+        "gorm":   {repository.NewUserRepository(db), repository.NewRefreshTokenRepository(db)},
+        "memory": {repository.NewMemoryUserRepository(), repository.NewMemoryRefreshTokenRepository()},
+    }
+
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            svc := service.NewUserService(store.users, store.tokens)
+            auth := service.NewAuthService(store.users, store.tokens, newTestKeys(t), service.DefaultAuthConfig())
+            // Leave the created admin as the only active one.
+            if seeded, err := store.users.FindByEmail(adminEmail); err == nil {
+                if _, err := svc.Deactivate(0, seeded.ID); err != nil {
+                    t.Fatalf("Failed to deactivate the seeded admin: %v", err)
+                }
+            }
+
+            admin, err := svc.Create(service.CreateUserInput{Email: "boss@example.com", Password: strongPassword, Roles: []string{"admin"}})
+            if err != nil {
+                t.Fatalf("Failed to create admin: %v", err)
+            }
+            nurse, err := svc.Create(service.CreateUserInput{Email: "nurse@example.com", Password: strongPassword, Roles: []string{"receptionist"}})
+            if err != nil {
+                t.Fatalf("Failed to create user: %v", err)
+            }
+            session, err := auth.Login(service.LoginInput{Email: "nurse@example.com", Password: strongPassword})
+            if err != nil {
+                t.Fatalf("Failed to log in: %v", err)
+            }
+
+            // An email change keeps the session; a role change ends it.
+            if _, err := svc.Update(admin.ID, nurse.ID, service.UpdateUserInput{Email: "nurse2@example.com", Roles: []string{"receptionist"}}); err != nil {
+                t.Fatalf("Failed to update user: %v", err)
+            }
+            if _, err := auth.ValidateToken(session.Token); err != nil {
+                t.Errorf("Session should survive an email change: %v", err)
+            }
+            if _, err := svc.Update(admin.ID, nurse.ID, service.UpdateUserInput{Roles: []string{"admin", "doctor"}}); err != nil {
+                t.Fatalf("Failed to update roles: %v", err)
+            }
+            if _, err := auth.ValidateToken(session.Token); !errors.Is(err, service.ErrTokenRevoked) {
+                t.Errorf("Expected sessions to be revoked on a role change, got %v", err)
+            }
+
+            if _, err := svc.Update(admin.ID, admin.ID, service.UpdateUserInput{Roles: []string{"doctor"}}); !errors.Is(err, service.ErrCannotDemoteSelf) {
+                t.Errorf("Expected ErrCannotDemoteSelf, got %v", err)
+            }
+            // With two admins, one may be demoted, but not the other.
+            if _, err := svc.Update(admin.ID, nurse.ID, service.UpdateUserInput{Roles: []string{"doctor"}}); err != nil {
+                t.Fatalf("Failed to demote admin: %v", err)
+            }
+            if _, err := svc.Update(nurse.ID, admin.ID, service.UpdateUserInput{Roles: []string{"doctor"}}); !errors.Is(err, service.ErrLastAdmin) {
+                t.Errorf("Expected ErrLastAdmin, got %v", err)
+            }
+            if got, _ := svc.Get(admin.ID); !reflect.DeepEqual(got.Roles, []string{"admin"}) {
+                t.Errorf("Roles after refused update = %v", got.Roles)
+            }
+        })
+    }
+}
+
+func TestAPI_AdminUsers(t *testing.T) {
+    env := newTestEnv(t)
+    admin := env.login(t, adminEmail)
+    receptionist := env.login(t, receptionistEmail)
+
+    w := env.do(t, http.MethodPost, "/api/admin/users", admin, service.CreateUserInput{Email: "new@example.com", Password: strongPassword, Roles: []string{"doctor"}})
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Create status = %d: %s", w.Code, w.Body.String())
+    }
+    var created service.UserResponse
+    decodeJSON(t, w, &created)
+    userPath := fmt.Sprintf("/api/admin/users/%d", created.ID)
+
+    var admins service.UserListResponse
+    decodeJSON(t, env.do(t, http.MethodGet, "/api/admin/users?role=admin", admin, nil), &admins)
+    if len(admins.Data) != 1 || admins.Data[0].Email != adminEmail {
+        t.Fatalf("Unexpected admin list: %+v", admins)
+    }
+    selfPath := fmt.Sprintf("/api/admin/users/%d", admins.Data[0].ID)
+
+    tests := []struct {
+        name       string
+        method     string
+        path       string
+        token      string
+        body       interface{}
+        wantStatus int
+    }{
+        {"receptionist cannot list", http.MethodGet, "/api/admin/users", receptionist, nil, http.StatusForbidden},
+        {"anonymous cannot list", http.MethodGet, "/api/admin/users", "", nil, http.StatusUnauthorized},
+        {"list", http.MethodGet, "/api/admin/users?page=1&limit=10&status=active", admin, nil, http.StatusOK},
+        {"list invalid status", http.MethodGet, "/api/admin/users?status=gone", admin, nil, http.StatusBadRequest},
+        {"create duplicate", http.MethodPost, "/api/admin/users", admin, service.CreateUserInput{Email: "new@example.com", Password: strongPassword, Roles: []string{"doctor"}}, http.StatusConflict},
+        {"create weak password", http.MethodPost, "/api/admin/users", admin, service.CreateUserInput{Email: "b@example.com", Password: "password123", Roles: []string{"doctor"}}, http.StatusBadRequest},
+        {"create without roles", http.MethodPost, "/api/admin/users", admin, map[string]interface{}{"email": "c@example.com", "password": strongPassword, "roles": []string{}}, http.StatusBadRequest},
+        {"create unknown role", http.MethodPost, "/api/admin/users", admin, service.CreateUserInput{Email: "d@example.com", Password: strongPassword, Roles: []string{"janitor"}}, http.StatusBadRequest},
+        {"get", http.MethodGet, userPath, admin, nil, http.StatusOK},
+        {"get unknown", http.MethodGet, "/api/admin/users/9999", admin, nil, http.StatusNotFound},
+        {"get invalid id", http.MethodGet, "/api/admin/users/abc", admin, nil, http.StatusBadRequest},
+        {"update roles", http.MethodPut, userPath, admin, service.UpdateUserInput{Roles: []string{"doctor", "receptionist"}}, http.StatusOK},
+        {"update email taken", http.MethodPut, userPath, admin, service.UpdateUserInput{Email: doctorEmail}, http.StatusConflict},
+        {"reset weak password", http.MethodPut, userPath + "/password", admin, service.ResetPasswordInput{Password: "weak"}, http.StatusBadRequest},
+        {"reset password", http.MethodPut, userPath + "/password", admin, service.ResetPasswordInput{Password: "Another-Pass-99"}, http.StatusNoContent},
+        {"deactivate", http.MethodPost, userPath + "/deactivate", admin, nil, http.StatusOK},
+        {"activate", http.MethodPost, userPath + "/activate", admin, nil, http.StatusOK},
+        {"cannot deactivate self", http.MethodPost, selfPath + "/deactivate", admin, nil, http.StatusBadRequest},
+        {"deactivate unknown", http.MethodPost, "/api/admin/users/9999/deactivate", admin, nil, http.StatusNotFound},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            w := env.do(t, tt.method, tt.path, tt.token, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,139 @@
+package token
+
+import (
+    "crypto/ed25519"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "math/big"
+    "github.com/golang-jwt/jwt/v4"
+)
+
+// Key is a JWT signing or verification key identified by its kid. Keys
+// parsed from a public key can only verify.
+type Key struct {
+    ID        string
+    Method    jwt.SigningMethod
+    signKey   interface{}
+    verifyKey interface{}
+}
+
+// NewHMACKey returns an HS256 key. An empty id is derived from a hash of the
+// secret, so the kid never reveals the secret itself.
+func NewHMACKey(id string, secret []byte) *Key {
+    if id == "" {
+        sum := sha256.Sum256(secret)
+        id = "hs256-" + hex.EncodeToString(sum[:8])
+    }
+    return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// ParsePEMKey reads an RSA (RS256) or Ed25519 (EdDSA) private or public key
+// in PKCS#1, PKCS#8 or PKIX PEM form. An empty id defaults to the RFC 7638
+// thumbprint of the public key.
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("no PEM block found")
+    }
+
+    var parsed interface{}
+    var err error
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    case "PRIVATE KEY":
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    case "RSA PUBLIC KEY":
+        parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+    case "PUBLIC KEY":
+        parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+    default:
+        return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    key := &Key{ID: id}
+    switch k := parsed.(type) {
+    case *rsa.PrivateKey:
+        key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, k, &k.PublicKey
+    case *rsa.PublicKey:
+        key.Method, key.verifyKey = jwt.SigningMethodRS256, k
+    case ed25519.PrivateKey:
+        key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, k, k.Public()
+    case ed25519.PublicKey:
+        key.Method, key.verifyKey = jwt.SigningMethodEdDSA, k
+    default:
+        return nil, fmt.Errorf("unsupported key type %T", parsed)
+    }
+
+    if key.ID == "" {
+        key.ID = key.thumbprint()
+    }
+    return key, nil
+}
+
+// CanSign reports whether the key holds private material.
+func (k *Key) CanSign() bool {
+    return k.signKey != nil
+}
+
+// JWK returns the public JSON Web Key. ok is false for symmetric keys, which
+// must never be published.
+func (k *Key) JWK() (jwk JWK, ok bool) {
+    jwk = JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+    switch pub := k.verifyKey.(type) {
+    case *rsa.PublicKey:
+        jwk.KeyType = "RSA"
+        jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+        jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+    case ed25519.PublicKey:
+        jwk.KeyType = "OKP"
+        jwk.Curve = "Ed25519"
+        jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+    default:
+        return JWK{}, false
+    }
+    return jwk, true
+}
+
+func (k *Key) thumbprint() string {
+    jwk, ok := k.JWK()
+    if !ok {
+        return ""
+    }
+
+    // RFC 7638: the required members only, in lexicographic order.
+    var members string
+    switch jwk.KeyType {
+    case "RSA":
+        members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+    case "OKP":
+        members = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, jwk.X)
+    }
+    sum := sha256.Sum256([]byte(members))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWK is the public part of a key as published in a JWKS document.
+type JWK struct {
+    KeyType   string `json:"kty"`
+    KeyID     string `json:"kid"`
+    Use       string `json:"use"`
+    Algorithm string `json:"alg"`
+    N         string `json:"n,omitempty"`
+    E         string `json:"e,omitempty"`
+    Curve     string `json:"crv,omitempty"`
+    X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,79 @@
+package token
+
+import (
+    "errors"
+    "fmt"
+    "github.com/golang-jwt/jwt/v4"
+)
+
+var (
+    ErrUnknownKey = errors.New("unknown signing key")
+    ErrWrongAlg   = errors.New("signing method does not match key")
+)
+
+// KeySet signs tokens with one active key and verifies them with any key it
+// holds, which lets retired keys keep validating tokens during a rotation.
+type KeySet struct {
+    signing *Key
+    keys    map[string]*Key
+    order   []string
+}
+
+// NewKeySet builds a set that signs with signing and also accepts the
+// verification-only keys in previous.
+func NewKeySet(signing *Key, previous ...*Key) (*KeySet, error) {
+    if signing == nil || !signing.CanSign() {
+        return nil, errors.New("signing key must include private material")
+    }
+
+    ks := &KeySet{signing: signing, keys: make(map[string]*Key)}
+    for _, key := range append([]*Key{signing}, previous...) {
+        if _, exists := ks.keys[key.ID]; exists {
+            return nil, fmt.Errorf("duplicate key id %q", key.ID)
+        }
+        ks.keys[key.ID] = key
+        ks.order = append(ks.order, key.ID)
+    }
+    return ks, nil
+}
+
+// SigningKeyID is the kid placed in the header of newly issued tokens.
+func (ks *KeySet) SigningKeyID() string {
+    return ks.signing.ID
+}
+
+// Sign issues a token for claims with the active key and its kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+    token := jwt.NewWithClaims(ks.signing.Method, claims)
+    token.Header["kid"] = ks.signing.ID
+    return token.SignedString(ks.signing.signKey)
+}
+
+// Keyfunc resolves the verification key for jwt.Parse. Tokens without a kid
+// predate rotation support and are checked against the active key. The
+// token's alg must match the key's, so an RSA public key can never be
+// accepted as an HMAC secret.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+    key := ks.signing
+    if kid, ok := token.Header["kid"].(string); ok {
+        if key, ok = ks.keys[kid]; !ok {
+            return nil, ErrUnknownKey
+        }
+    }
+
+    if token.Method.Alg() != key.Method.Alg() {
+        return nil, ErrWrongAlg
+    }
+    return key.verifyKey, nil
+}
+
+// JWKS lists the public keys of the set; symmetric keys are left out.
+func (ks *KeySet) JWKS() JWKS {
+    jwks := JWKS{Keys: []JWK{}}
+    for _, id := range ks.order {
+        if jwk, ok := ks.keys[id].JWK(); ok {
+            jwks.Keys = append(jwks.Keys, jwk)
+        }
+    }
+    return jwks
+}
@@ -1,39 +1,91 @@
 package main
 
 import (
+    "fmt"
     "log"
     "os"
+    "strconv"
     "github.com/joho/godotenv"
-    "golang.org/x/crypto/bcrypt"
-    "gorm.io/driver/mysql"
-    "gorm.io/gorm"
-    "makerble-assessment/internal/model"
+    "makerble-assessment/internal/config"
+    "makerble-assessment/internal/migration"
 )
 
+const usage = `usage: go run ./migrations <command>
+
+commands:
+  up             apply all pending migrations
+  down [n]       roll back the last n migrations (default 1)
+  status         list migrations and whether they are applied
+  create <name>  write a new empty migration into internal/migration`
+
 func main() {
-    if err := godotenv.Load(); err != nil {
-        log.Fatal("Error loading .env file")
+    if len(os.Args) < 2 {
+        log.Fatal(usage)
     }
 
-    dsn := os.Getenv("DB_USER") + ":" + os.Getenv("DB_PASSWORD") + "@tcp(" + os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT") + ")/" + os.Getenv("DB_NAME") + "?charset=utf8mb4&parseTime=True&loc=Local"
-    db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-    if err != nil {
-        log.Fatalf("Failed to connect to database: %v", err)
+    command := os.Args[1]
+    if command == "create" {
+        if len(os.Args) < 3 {
+            log.Fatal(usage)
+        }
+        path, err := migration.Create("internal/migration", os.Args[2])
+        if err != nil {
+            log.Fatalf("Failed to create migration: %v", err)
+        }
+        fmt.Println("Created", path)
+        return
     }
 
-    if err := db.AutoMigrate(&model.User{}, &model.Patient{}); err != nil {
-        log.Fatalf("Failed to migrate database: %v", err)
+    if err := godotenv.Load(); err != nil {
+        log.Fatal("Error loading .env file")
     }
 
-    password, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
-    users := []model.User{
-        {Email: "recep@example.com", Password: string(password), Role: "receptionist"},
-        {Email: "doc@example.com", Password: string(password), Role: "doctor"},
+    db, err := config.OpenDB()
+    if err != nil {
+        log.Fatalf("Failed to connect to database: %v", err)
     }
+    migrator := migration.NewMigrator(db)
 
-    for _, user := range users {
-        if err := db.FirstOrCreate(&user, model.User{Email: user.Email}).Error; err != nil {
-            log.Printf("Failed to create user %s: %v", user.Email, err)
+    switch command {
+    case "up":
+        ran, err := migrator.Up()
+        for _, m := range ran {
+            fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+        }
+        if err != nil {
+            log.Fatalf("Failed to migrate database: %v", err)
+        }
+        if len(ran) == 0 {
+            fmt.Println("No pending migrations")
+        }
+    case "down":
+        steps := 1
+        if len(os.Args) > 2 {
+            steps, err = strconv.Atoi(os.Args[2])
+            if err != nil || steps < 1 {
+                log.Fatalf("Invalid step count %q", os.Args[2])
+            }
+        }
+        rolledBack, err := migrator.Down(steps)
+        for _, m := range rolledBack {
+            fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+        }
+        if err != nil {
+            log.Fatalf("Failed to roll back database: %v", err)
+        }
+    case "status":
+        statuses, err := migrator.Status()
+        if err != nil {
+            log.Fatalf("Failed to read migration status: %v", err)
+        }
+        for _, s := range statuses {
+            state := "pending"
+            if s.Applied {
+                state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+            }
+            fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
         }
+    default:
+        log.Fatal(usage)
     }
-}
\ No newline at end of file
+}